@@ -38,12 +38,13 @@ type Agent struct {
 	uGen     *unit.UnitStateGenerator
 	Machine  machine.Machine
 	ttl      time.Duration
+	health   *HealthChecker
 
 	cache *agentCache
 }
 
-func New(mgr unit.UnitManager, uGen *unit.UnitStateGenerator, reg registry.Registry, mach machine.Machine, ttl time.Duration) *Agent {
-	return &Agent{reg, mgr, uGen, mach, ttl, &agentCache{}}
+func New(mgr unit.UnitManager, uGen *unit.UnitStateGenerator, reg registry.Registry, mach machine.Machine, ttl time.Duration, health *HealthChecker) *Agent {
+	return &Agent{reg, mgr, uGen, mach, ttl, health, &agentCache{}}
 }
 
 func (a *Agent) MarshalJSON() ([]byte, error) {
@@ -63,7 +63,7 @@ func TestAgentLoadUnloadUnit(t *testing.T) {
 	usGenerator := unit.NewUnitStateGenerator(uManager)
 	fReg := registry.NewFakeRegistry()
 	mach := &machine.FakeMachine{MachineState: machine.MachineState{ID: "XXX"}}
-	a := New(uManager, usGenerator, fReg, mach, time.Second)
+	a := New(uManager, usGenerator, fReg, mach, time.Second, nil)
 
 	u := newTestUnitFromUnitContents(t, "foo.service", "")
 	err := a.loadUnit(u)
@@ -108,7 +108,7 @@ func TestAgentLoadStartStopUnit(t *testing.T) {
 	usGenerator := unit.NewUnitStateGenerator(uManager)
 	fReg := registry.NewFakeRegistry()
 	mach := &machine.FakeMachine{MachineState: machine.MachineState{ID: "XXX"}}
-	a := New(uManager, usGenerator, fReg, mach, time.Second)
+	a := New(uManager, usGenerator, fReg, mach, time.Second, nil)
 
 	u := newTestUnitFromUnitContents(t, "foo.service", "")
 
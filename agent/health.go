@@ -0,0 +1,226 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/unit"
+)
+
+// healthCheckPeriod is how often the HealthChecker looks for checks due
+const healthCheckPeriod = time.Second
+
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{
+		checks: make(map[string]*unitHealth),
+		clock:  clockwork.NewRealClock(),
+		probe:  probeHealth,
+	}
+}
+
+// HealthChecker runs the health checks declared by the units scheduled to
+// the local machine, and keeps track of their outcome. Checks only run while
+// systemd reports their unit as active.
+type HealthChecker struct {
+	mu     sync.Mutex
+	checks map[string]*unitHealth
+
+	clock clockwork.Clock
+	probe func(job.HealthCheck) error
+}
+
+type unitHealth struct {
+	check job.HealthCheck
+
+	active    bool
+	running   bool
+	next      time.Time
+	health    string
+	successes int
+	failures  int
+}
+
+// record counts the outcome of a check, and updates the health of the unit
+// once a threshold is reached
+func (uh *unitHealth) record(ok bool) {
+	if ok {
+		uh.successes++
+		uh.failures = 0
+		if uh.successes >= uh.check.HealthyThreshold {
+			uh.health = unit.HealthHealthy
+		}
+	} else {
+		uh.failures++
+		uh.successes = 0
+		if uh.failures >= uh.check.UnhealthyThreshold {
+			uh.health = unit.HealthUnhealthy
+		}
+	}
+}
+
+func (uh *unitHealth) reset() {
+	uh.health = unit.HealthUnknown
+	uh.successes = 0
+	uh.failures = 0
+}
+
+// Sync starts checking the health of the given units that declare a health
+// check, and stops checking all other units. Units whose health check did
+// not change keep their health.
+func (hc *HealthChecker) Sync(units map[string]*job.Unit) {
+	if hc == nil {
+		return
+	}
+
+	desired := make(map[string]job.HealthCheck)
+	for name, u := range units {
+		j := job.Job{Name: name, Unit: u.Unit}
+		check, err := j.HealthCheck()
+		if err != nil {
+			log.Warningf("Not checking health of Unit(%s): %v", name, err)
+			continue
+		}
+		if check != nil {
+			desired[name] = *check
+		}
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for name := range hc.checks {
+		if _, ok := desired[name]; !ok {
+			log.Debugf("Stopped checking health of Unit(%s)", name)
+			delete(hc.checks, name)
+		}
+	}
+	for name, check := range desired {
+		if uh, ok := hc.checks[name]; ok && uh.check == check {
+			continue
+		}
+		log.Debugf("Checking health of Unit(%s) over %s", name, check.Type)
+		hc.checks[name] = &unitHealth{check: check, health: unit.HealthUnknown}
+	}
+}
+
+// Health returns the health of the named unit, given whether systemd
+// reports it active, or an empty string if the unit declares no health
+// check. The health of a unit that is not active is always unknown.
+func (hc *HealthChecker) Health(name string, active bool) string {
+	if hc == nil {
+		return ""
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	uh, ok := hc.checks[name]
+	if !ok {
+		return ""
+	}
+	if !active {
+		uh.reset()
+	} else if !uh.active {
+		// check a unit that just became active without waiting
+		// for a whole interval
+		uh.next = hc.clock.Now()
+	}
+	uh.active = active
+	return uh.health
+}
+
+// Run checks the health of the units whose check is due every second,
+// until stop is closed.
+func (hc *HealthChecker) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hc.clock.After(healthCheckPeriod):
+			hc.runDue()
+		}
+	}
+}
+
+// runDue starts the checks that are due, unless a previous check of the
+// same unit is still running
+func (hc *HealthChecker) runDue() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	now := hc.clock.Now()
+	for name, uh := range hc.checks {
+		if !uh.active || uh.running || now.Before(uh.next) {
+			continue
+		}
+		uh.running = true
+		uh.next = now.Add(uh.check.Interval)
+		go hc.run(name, uh)
+	}
+}
+
+func (hc *HealthChecker) run(name string, uh *unitHealth) {
+	err := hc.probe(uh.check)
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	uh.running = false
+	// the check was replaced or the unit stopped in the meantime
+	if hc.checks[name] != uh || !uh.active {
+		return
+	}
+	if err != nil {
+		log.Debugf("Health check of Unit(%s) failed: %v", name, err)
+	}
+	uh.record(err == nil)
+}
+
+// probeHealth runs a single health check, returning an error if it failed
+func probeHealth(check job.HealthCheck) error {
+	switch check.Type {
+	case job.HealthCheckHTTP:
+		client := &http.Client{Timeout: check.Timeout}
+		resp, err := client.Get(check.Target)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unexpected response status %s", resp.Status)
+		}
+		return nil
+	case job.HealthCheckTCP:
+		conn, err := net.DialTimeout("tcp", check.Target, check.Timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case job.HealthCheckExec:
+		return pkg.RunWithTimeout(exec.Command("/bin/sh", "-c", check.Target), check.Timeout)
+	}
+	return fmt.Errorf("unknown health check type %q", check.Type)
+}
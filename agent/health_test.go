@@ -0,0 +1,139 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/unit"
+)
+
+func newHealthCheckUnit(t *testing.T, contents string) *job.Unit {
+	uf, err := unit.NewUnitFile(contents)
+	if err != nil {
+		t.Fatalf("error creating unit from %q: %v", contents, err)
+	}
+	return &job.Unit{Name: "foo.service", Unit: *uf}
+}
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	results := make(chan error)
+	hc := NewHealthChecker()
+	hc.clock = clock
+	hc.probe = func(job.HealthCheck) error {
+		return <-results
+	}
+
+	hc.Sync(map[string]*job.Unit{
+		"foo.service": newHealthCheckUnit(t, "[X-Fleet]\nHealthCheckExec=true\nHealthCheckHealthyThreshold=2\nHealthCheckUnhealthyThreshold=2\n"),
+		"bar.service": newHealthCheckUnit(t, "[Service]\nExecStart=/bin/true\n"),
+	})
+	if got := hc.Health("bar.service", true); got != "" {
+		t.Fatalf("unit without health check has health %q", got)
+	}
+	if got := hc.Health("foo.service", true); got != unit.HealthUnknown {
+		t.Fatalf("unit not checked yet has health %q", got)
+	}
+
+	// check runs the due check, which returns the given result
+	check := func(result error) string {
+		hc.runDue()
+		results <- result
+		for {
+			hc.mu.Lock()
+			running := hc.checks["foo.service"].running
+			hc.mu.Unlock()
+			if !running {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(job.DefaultHealthCheckInterval)
+		return hc.Health("foo.service", true)
+	}
+
+	for i, tt := range []struct {
+		result error
+		health string
+	}{
+		{nil, unit.HealthUnknown},
+		{nil, unit.HealthHealthy},
+		{errors.New("fail"), unit.HealthHealthy},
+		{nil, unit.HealthHealthy},
+		{errors.New("fail"), unit.HealthHealthy},
+		{errors.New("fail"), unit.HealthUnhealthy},
+		{nil, unit.HealthUnhealthy},
+		{nil, unit.HealthHealthy},
+	} {
+		if got := check(tt.result); got != tt.health {
+			t.Fatalf("check %d: unexpected health %q, want %q", i, got, tt.health)
+		}
+	}
+
+	// the health of an inactive unit is unknown
+	if got := hc.Health("foo.service", false); got != unit.HealthUnknown {
+		t.Errorf("inactive unit has health %q", got)
+	}
+
+	hc.Sync(map[string]*job.Unit{})
+	if got := hc.Health("foo.service", true); got != "" {
+		t.Errorf("unit no longer checked has health %q", got)
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/healthz" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		typ    job.HealthCheckType
+		target string
+		ok     bool
+	}{
+		{job.HealthCheckHTTP, ts.URL + "/healthz", true},
+		{job.HealthCheckHTTP, ts.URL + "/broken", false},
+		{job.HealthCheckTCP, ts.Listener.Addr().String(), true},
+		{job.HealthCheckTCP, addr, false},
+		{job.HealthCheckExec, "true", true},
+		{job.HealthCheckExec, "exit 3", false},
+		{job.HealthCheckExec, "sleep 5", false},
+	}
+	for i, tt := range tests {
+		check := job.HealthCheck{Type: tt.typ, Target: tt.target, Timeout: 500 * time.Millisecond}
+		if err := probeHealth(check); (err == nil) != tt.ok {
+			t.Errorf("case %d: unexpected result of %s check of %q: %v", i, tt.typ, tt.target, err)
+		}
+	}
+}
@@ -28,13 +28,18 @@ import (
 
 const (
 	// time between triggering reconciliation routine
-	reconcileInterval = 5 * time.Second
+	ReconcileInterval = 5 * time.Second
+	// time between triggering reconciliation routine when the engine
+	// pushes unit changes to the agent, so that periodic runs only catch
+	// up on missed events
+	PushedReconcileInterval = 60 * time.Second
 )
 
-func NewReconciler(reg registry.Registry, rStream pkg.EventStream) *AgentReconciler {
+func NewReconciler(reg registry.Registry, rStream pkg.EventStream, ival time.Duration) *AgentReconciler {
 	return &AgentReconciler{
 		reg:      reg,
 		rStream:  rStream,
+		ival:     ival,
 		tManager: newTaskManager(),
 	}
 }
@@ -42,6 +47,7 @@ func NewReconciler(reg registry.Registry, rStream pkg.EventStream) *AgentReconci
 type AgentReconciler struct {
 	reg      registry.Registry
 	rStream  pkg.EventStream
+	ival     time.Duration
 	tManager *taskManager
 }
 
@@ -55,13 +61,13 @@ func (ar *AgentReconciler) Run(a *Agent, stop <-chan struct{}) {
 		elapsed := time.Now().Sub(start)
 
 		msg := fmt.Sprintf("AgentReconciler completed reconciliation in %s", elapsed)
-		if elapsed > reconcileInterval {
+		if elapsed > ar.ival {
 			log.Warning(msg)
 		} else {
 			log.Debug(msg)
 		}
 	}
-	reconciler := pkg.NewPeriodicReconciler(reconcileInterval, reconcile, ar.rStream)
+	reconciler := pkg.NewPeriodicReconciler(ar.ival, reconcile, ar.rStream)
 	reconciler.Run(stop)
 }
 
@@ -80,6 +86,8 @@ func (ar *AgentReconciler) Reconcile(a *Agent) {
 		return
 	}
 
+	a.health.Sync(dAgentState.Units)
+
 	tasks := ar.calculateTasksForUnits(dAgentState, cAgentState)
 	ar.launchTasks(tasks, a)
 }
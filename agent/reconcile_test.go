@@ -320,6 +320,37 @@ func TestAbleToRun(t *testing.T) {
 			want:   job.JobActionUnschedule,
 		},
 
+		// cordoned Machine rejects new units
+		{
+			dState: NewAgentState(&machine.MachineState{ID: "123", Cordoned: true}),
+			job:    newTestJobWithXFleetValues(t, ""),
+			want:   job.JobActionUnschedule,
+		},
+
+		// cordoned Machine keeps units already scheduled to it
+		{
+			dState: NewAgentState(&machine.MachineState{ID: "123", Cordoned: true}),
+			job: &job.Job{
+				Name:            "ping.service",
+				TargetMachineID: "123",
+			},
+			want: job.JobActionSchedule,
+		},
+
+		// SpreadBy key present in Machine metadata
+		{
+			dState: NewAgentState(&machine.MachineState{ID: "123", Metadata: map[string]string{"rack": "r1"}}),
+			job:    newTestJobWithXFleetValues(t, "SpreadBy=rack"),
+			want:   job.JobActionSchedule,
+		},
+
+		// SpreadBy key missing from Machine metadata
+		{
+			dState: NewAgentState(&machine.MachineState{ID: "123", Metadata: map[string]string{"region": "us-west"}}),
+			job:    newTestJobWithXFleetValues(t, "SpreadBy=rack"),
+			want:   job.JobActionUnschedule,
+		},
+
 		// peer scheduled locally
 		{
 			dState: &AgentState{
@@ -762,7 +793,7 @@ func TestCalculateTasksForJob(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		ar := NewReconciler(registry.NewFakeRegistry(), nil)
+		ar := NewReconciler(registry.NewFakeRegistry(), nil, ReconcileInterval)
 		got := ar.calculateTasksForUnit(tt.dState, tt.cState, tt.uName)
 		if !reflect.DeepEqual(tt.want, got) {
 			t.Errorf("case %d: calculated incorrect tasks\nexpected=%#v\nreceived=%#v\n", i, tt.want, got)
@@ -926,7 +957,7 @@ func TestCalculateTasksForUnitsReloadUnitFilesTask(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		ar := NewReconciler(registry.NewFakeRegistry(), nil)
+		ar := NewReconciler(registry.NewFakeRegistry(), nil, ReconcileInterval)
 		got := ar.calculateTasksForUnits(tt.dState, tt.cState)
 		if !reflect.DeepEqual(tt.want, got) {
 			t.Errorf("case %d: calculated incorrect tasks", i)
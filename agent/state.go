@@ -21,6 +21,8 @@ import (
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/resource"
 )
 
 type AgentState struct {
@@ -39,6 +41,48 @@ func (as *AgentState) unitScheduled(name string) bool {
 	return as.Units[name] != nil
 }
 
+// AvailableResources returns the resources left on the Agent's machine once
+// those reserved for the host and those required by the locally-scheduled
+// Units are subtracted from the machine's advertised capacity. A machine
+// which does not advertise its capacity is treated as having none.
+func (as *AgentState) AvailableResources() resource.ResourceTuple {
+	used := []resource.ResourceTuple{resource.HostResources}
+	for _, u := range as.Units {
+		res, err := u.Resources()
+		if err != nil {
+			log.Debugf("Ignoring invalid resources of Unit(%s): %v", u.Name, err)
+			continue
+		}
+		used = append(used, res)
+	}
+	var total resource.ResourceTuple
+	if as.MState.TotalResources != nil {
+		total = *as.MState.TotalResources
+	}
+	return resource.Sub(total, resource.Sum(used...))
+}
+
+// PreferenceScore rates how well the Agent matches the soft preferences of
+// the given Job. Each preferred metadata key whose value the local machine
+// matches, and each preferred peer scheduled locally, adds one to the score.
+func (as *AgentState) PreferenceScore(j *job.Job) int {
+	score := 0
+
+	for key, values := range j.PreferredTargetMetadata() {
+		if machine.HasMetadata(as.MState, map[string]pkg.Set{key: values}) {
+			score++
+		}
+	}
+
+	for _, peer := range j.PreferredPeers() {
+		if as.unitScheduled(peer) {
+			score++
+		}
+	}
+
+	return score
+}
+
 func hasStringInSlice(inSlice []string, unitName string) bool {
 	for _, elem := range inSlice {
 		if globMatches(elem, unitName) {
@@ -130,12 +174,22 @@ func globMatches(pattern, target string) bool {
 // AbleToRun determines if an Agent can run the provided Job based on
 // the Agent's current state. A boolean indicating whether this is the
 // case or not is returned. The following criteria is used:
+//   - Agent must not be cordoned, unless the Job is already scheduled to it
 //   - Agent must meet the Job's machine target requirement (if any)
 //   - Agent must have all of the Job's required metadata (if any)
+//   - Agent must have the metadata key the Job is spread by (if any)
 //   - Agent must have all required Peers of the Job scheduled locally (if any)
 //   - Job must not conflict with any other Units scheduled to the agent
 //   - Job must specially handle replaced units to be rescheduled
 func (as *AgentState) AbleToRun(j *job.Job) (jobAction job.JobAction, errstr string) {
+	if as.MState.Cordoned && j.TargetMachineID != as.MState.ID {
+		return job.JobActionUnschedule, "local Machine is cordoned"
+	}
+
+	if j.FailedTooOftenOn(as.MState.ID) && j.TargetMachineID != as.MState.ID {
+		return job.JobActionUnschedule, "unit failed too often on local Machine"
+	}
+
 	if tgt, ok := j.RequiredTarget(); ok && !as.MState.MatchID(tgt) {
 		return job.JobActionUnschedule, fmt.Sprintf("agent ID %q does not match required %q", as.MState.ID, tgt)
 	}
@@ -147,6 +201,12 @@ func (as *AgentState) AbleToRun(j *job.Job) (jobAction job.JobAction, errstr str
 		}
 	}
 
+	if key, ok := j.SpreadBy(); ok {
+		if _, ok := as.MState.Metadata[key]; !ok {
+			return job.JobActionUnschedule, fmt.Sprintf("local Machine metadata lacks SpreadBy key %q", key)
+		}
+	}
+
 	peers := j.Peers()
 	if len(peers) != 0 {
 		for _, peer := range peers {
@@ -20,6 +20,7 @@ import (
 
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/resource"
 	"github.com/coreos/fleet/unit"
 )
 
@@ -255,6 +256,96 @@ func TestHasReplaces(t *testing.T) {
 	}
 }
 
+func TestAvailableResources(t *testing.T) {
+	total := &resource.ResourceTuple{Cores: 400, Memory: 4096, Disk: 10240}
+	tests := []struct {
+		cState *AgentState
+		want   resource.ResourceTuple
+	}{
+		// only the host reservation is subtracted from an idle machine
+		{
+			cState: NewAgentState(&machine.MachineState{ID: "XXX", TotalResources: total}),
+			want:   resource.ResourceTuple{Cores: 300, Memory: 3840, Disk: 10240},
+		},
+
+		// scheduled Units consume their declared resources
+		{
+			cState: &AgentState{
+				MState: &machine.MachineState{ID: "XXX", TotalResources: total},
+				Units: map[string]*job.Unit{
+					"foo.service": &job.Unit{
+						Name: "foo.service",
+						Unit: fleetUnit(t, "Resources=cores=100 memory=1G"),
+					},
+					"bar.service": &job.Unit{
+						Name: "bar.service",
+						Unit: fleetUnit(t, "Resources=disk=1G"),
+					},
+					"baz.service": &job.Unit{
+						Name: "baz.service",
+						Unit: unit.UnitFile{},
+					},
+				},
+			},
+			want: resource.ResourceTuple{Cores: 200, Memory: 2816, Disk: 9216},
+		},
+
+		// a machine that advertises no capacity has nothing available
+		{
+			cState: NewAgentState(&machine.MachineState{ID: "XXX"}),
+			want:   resource.ResourceTuple{Cores: -100, Memory: -256, Disk: 0},
+		},
+	}
+
+	for i, tt := range tests {
+		got := tt.cState.AvailableResources()
+		if got != tt.want {
+			t.Errorf("case %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestPreferenceScore(t *testing.T) {
+	tests := []struct {
+		cState *AgentState
+		job    *job.Job
+		want   int
+	}{
+		// no preferences
+		{
+			cState: NewAgentState(&machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "ssd"}}),
+			job:    &job.Job{Name: "foo.service", Unit: unit.UnitFile{}},
+			want:   0,
+		},
+
+		// preferences not met
+		{
+			cState: NewAgentState(&machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "hdd"}}),
+			job:    &job.Job{Name: "foo.service", Unit: fleetUnit(t, "PreferMachineMetadata=disk=ssd", "PreferMachineOf=db.service")},
+			want:   0,
+		},
+
+		// each met preference counts once
+		{
+			cState: &AgentState{
+				MState: &machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "ssd", "net": "10g"}},
+				Units: map[string]*job.Unit{
+					"db.service": &job.Unit{Name: "db.service"},
+				},
+			},
+			job:  &job.Job{Name: "foo.service", Unit: fleetUnit(t, "PreferMachineMetadata=\"disk=ssd\" \"disk=nvme\" \"net=10g\"", "PreferMachineOf=db.service cache.service")},
+			want: 3,
+		},
+	}
+
+	for i, tt := range tests {
+		got := tt.cState.PreferenceScore(tt.job)
+		if got != tt.want {
+			t.Errorf("case %d: got %d, want %d", i, got, tt.want)
+		}
+	}
+}
+
 func TestGlobMatches(t *testing.T) {
 	tests := []struct {
 		pattern  string
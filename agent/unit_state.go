@@ -30,10 +30,11 @@ import (
 
 const numPublishers = 5
 
-func NewUnitStatePublisher(reg registry.Registry, mach machine.Machine, ttl time.Duration) *UnitStatePublisher {
+func NewUnitStatePublisher(reg registry.Registry, mach machine.Machine, ttl time.Duration, health *HealthChecker) *UnitStatePublisher {
 	return &UnitStatePublisher{
 		mach:            mach,
 		ttl:             ttl,
+		health:          health,
 		publisher:       newPublisher(reg, ttl),
 		cache:           make(map[string]*unit.UnitState),
 		cacheMutex:      sync.RWMutex{},
@@ -50,6 +51,10 @@ type UnitStatePublisher struct {
 	mach machine.Machine
 	ttl  time.Duration
 
+	// health provides the outcome of the health checks declared by the
+	// units, which is published along with their systemd state
+	health *HealthChecker
+
 	cache      map[string]*unit.UnitState
 	cacheMutex sync.RWMutex
 
@@ -130,6 +135,7 @@ func (p *UnitStatePublisher) Run(beatchan <-chan *unit.UnitStateHeartbeat, stop
 		case bt := <-beatchan:
 			if bt.State != nil {
 				bt.State.MachineID = machID
+				bt.State.Health = p.health.Health(bt.Name, bt.State.ActiveState == "active")
 			}
 
 			if p.updateCache(bt) {
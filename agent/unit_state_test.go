@@ -111,7 +111,7 @@ func TestUpdateCache(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		usp := NewUnitStatePublisher(nil, mach, 0)
+		usp := NewUnitStatePublisher(nil, mach, 0, nil)
 		usp.cache = tt.cacheBefore
 		changed := usp.updateCache(tt.ush)
 		if tt.changed != changed {
@@ -158,7 +158,7 @@ func TestPruneCache(t *testing.T) {
 		mach := &machine.FakeMachine{
 			MachineState: machine.MachineState{ID: "XXX"},
 		}
-		usp := NewUnitStatePublisher(nil, mach, 0)
+		usp := NewUnitStatePublisher(nil, mach, 0, nil)
 		usp.cache = tt.cacheBefore
 		usp.pruneCache()
 		if !reflect.DeepEqual(tt.cacheAfter, usp.cache) {
@@ -197,7 +197,7 @@ func TestPurge(t *testing.T) {
 	}
 	freg := registry.NewFakeRegistry()
 	freg.SetUnitStates(initStates)
-	usp := NewUnitStatePublisher(freg, &machine.FakeMachine{}, 0)
+	usp := NewUnitStatePublisher(freg, &machine.FakeMachine{}, 0, nil)
 	usp.cache = cache
 
 	usp.Purge()
@@ -275,7 +275,7 @@ func TestDefaultPublisher(t *testing.T) {
 	for i, tt := range testCases {
 		freg := registry.NewFakeRegistry()
 		freg.SetUnitStates(tt.initStates)
-		usp := NewUnitStatePublisher(freg, &machine.FakeMachine{}, 0)
+		usp := NewUnitStatePublisher(freg, &machine.FakeMachine{}, 0, nil)
 		usp.publisher(tt.name, tt.state)
 		us, err := freg.UnitStates()
 		if err != nil {
@@ -785,7 +785,7 @@ func TestQueueForPublish(t *testing.T) {
 }
 
 func TestMarshalJSON(t *testing.T) {
-	usp := NewUnitStatePublisher(&registry.FakeRegistry{}, &machine.FakeMachine{}, 0)
+	usp := NewUnitStatePublisher(&registry.FakeRegistry{}, &machine.FakeMachine{}, 0, nil)
 	got, err := json.Marshal(usp)
 	if err != nil {
 		t.Fatalf("unexpected error marshalling: %#v", err)
@@ -795,7 +795,7 @@ func TestMarshalJSON(t *testing.T) {
 		t.Fatalf("Bad JSON representation: got\n%s\n\nwant\n%s", string(got), want)
 	}
 
-	usp = NewUnitStatePublisher(&registry.FakeRegistry{}, &machine.FakeMachine{}, 0)
+	usp = NewUnitStatePublisher(&registry.FakeRegistry{}, &machine.FakeMachine{}, 0, nil)
 	usp.cache = map[string]*unit.UnitState{
 		"foo.service": &unit.UnitState{
 			UnitName:    "foo.service",
@@ -819,7 +819,7 @@ func TestMarshalJSON(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error marshalling: %v", err)
 	}
-	want = `{"Cache":{"bar.service":{"LoadState":"","ActiveState":"inactive","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"bar.service"},"foo.service":{"LoadState":"","ActiveState":"active","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"foo.service"}},"ToPublish":{"woof.service":{"LoadState":"","ActiveState":"active","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"woof.service"}}}`
+	want = `{"Cache":{"bar.service":{"LoadState":"","ActiveState":"inactive","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"bar.service","Health":""},"foo.service":{"LoadState":"","ActiveState":"active","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"foo.service","Health":""}},"ToPublish":{"woof.service":{"LoadState":"","ActiveState":"active","SubState":"","MachineID":"asdf","UnitHash":"","UnitName":"woof.service","Health":""}}}`
 	if string(got) != want {
 		t.Fatalf("Bad JSON representation: got\n%s\n\nwant\n%s", string(got), want)
 	}
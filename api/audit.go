@@ -0,0 +1,84 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/log"
+)
+
+func wireUpAuditResource(mux *http.ServeMux, prefix string, sink audit.Sink) {
+	res := path.Join(prefix, "audit")
+	ar := auditResource{sink}
+	mux.Handle(res, &ar)
+}
+
+type auditResource struct {
+	sink audit.Sink
+}
+
+func (ar *auditResource) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		sendError(rw, http.StatusMethodNotAllowed, errors.New("only GET supported against this resource"))
+		return
+	}
+	if ar.sink == nil {
+		sendError(rw, http.StatusNotFound, errors.New("audit log is disabled, see the audit_sink option of fleetd"))
+		return
+	}
+
+	f, err := audit.ParseFilter(req.URL.Query())
+	if err != nil {
+		sendError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	records, err := ar.sink.Records(f)
+	if err != nil {
+		log.Errorf("Failed fetching audit records: %v", err)
+		sendError(rw, http.StatusInternalServerError, nil)
+		return
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+
+	sendResponse(rw, http.StatusOK, audit.RecordPage{Records: records})
+}
+
+// newAuditRecord returns the audit Record of the given change requested by
+// req, attributed to the user it was authenticated as, if any. The user
+// named by clients in their UserHeader is not trusted.
+func newAuditRecord(req *http.Request, action string) audit.Record {
+	return audit.Record{
+		Source:     audit.SourceAPI,
+		User:       req.Header.Get(authenticatedUserHeader),
+		RemoteAddr: req.RemoteAddr,
+		Action:     action,
+	}
+}
+
+// writeAuditRecord records the outcome of the change described by rec in
+// the given Sink.
+func writeAuditRecord(sink audit.Sink, rec audit.Record, err error) {
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	audit.Write(sink, rec)
+}
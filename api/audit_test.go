@@ -0,0 +1,205 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/schema"
+)
+
+func newAuditTestClient(t *testing.T, srv *httptest.Server, rt http.RoundTripper) client.API {
+	ep, _ := url.Parse(srv.URL)
+	hc := &http.Client{Transport: rt}
+	cAPI, err := client.NewHTTPClient(hc, *ep)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cAPI
+}
+
+func TestAuditRecordsOverHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fleet-api-audit")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fr := registry.NewFakeRegistry()
+	fr.SetMachines([]machine.MachineState{
+		{ID: "XXX", Metadata: map[string]string{"region": "us-east"}},
+	})
+	srv := httptest.NewServer(NewServeMux(fr, registry.NewFakeClusterRegistry(nil, 0), testTokenLimit, nil, time.Second, newTestAuth(t, dir), audit.NewRegistrySink(fr)))
+	defer srv.Close()
+	cAPI := newAuditTestClient(t, srv, client.NewAuthTransport(http.DefaultTransport, "secret-token", "", ""))
+
+	u := &schema.Unit{
+		Name:         "foo.service",
+		DesiredState: "loaded",
+		Options:      []*schema.UnitOption{{Section: "Service", Name: "ExecStart", Value: "/usr/bin/true"}},
+	}
+	if err := cAPI.CreateUnit(u); err != nil {
+		t.Fatalf("CreateUnit failed: %v", err)
+	}
+	if err := cAPI.SetUnitTargetState("foo.service", "launched"); err != nil {
+		t.Fatalf("SetUnitTargetState failed: %v", err)
+	}
+	if err := cAPI.DestroyUnit("foo.service"); err != nil {
+		t.Fatalf("DestroyUnit failed: %v", err)
+	}
+	if err := cAPI.CordonMachine("XXX"); err != nil {
+		t.Fatalf("CordonMachine failed: %v", err)
+	}
+	body := `[{"op": "replace", "path": "/XXX/metadata/region", "value": {"value": "us-west"}}]`
+	req, _ := http.NewRequest("PATCH", srv.URL+"/fleet/v1/machines", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer other-token")
+	// the user named by the client is not recorded
+	req.Header.Set(client.UserHeader, "mallory")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil || res.StatusCode != http.StatusNoContent {
+		t.Fatalf("PATCH of machine metadata returned %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	records, err := cAPI.AuditRecords(audit.Filter{})
+	if err != nil {
+		t.Fatalf("AuditRecords failed: %v", err)
+	}
+	want := []audit.Record{
+		{Source: audit.SourceAPI, User: "alice", Action: audit.ActionCreate, UnitName: "foo.service", NewState: "loaded"},
+		{Source: audit.SourceAPI, User: "alice", Action: audit.ActionSetTargetState, UnitName: "foo.service", OldState: "loaded", NewState: "launched"},
+		{Source: audit.SourceAPI, User: "alice", Action: audit.ActionDestroy, UnitName: "foo.service", OldState: "launched"},
+		{Source: audit.SourceAPI, User: "alice", Action: audit.ActionCordon, MachineID: "XXX", OldState: "schedulable", NewState: "cordoned"},
+		{Source: audit.SourceAPI, User: "bob", Action: audit.ActionSetMetadata, MachineID: "XXX", Key: "region", OldState: "us-east", NewState: "us-west"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d audit records, got %v", len(want), records)
+	}
+	for i := range records {
+		if records[i].Time.IsZero() || records[i].RemoteAddr == "" {
+			t.Errorf("record %d lacks its time or remote address: %#v", i, records[i])
+		}
+		records[i].Time, records[i].RemoteAddr = want[i].Time, want[i].RemoteAddr
+		if !reflect.DeepEqual(records[i], want[i]) {
+			t.Errorf("record %d is %#v, want %#v", i, records[i], want[i])
+		}
+	}
+
+	records, err = cAPI.AuditRecords(audit.Filter{User: "bob"})
+	if err != nil {
+		t.Fatalf("AuditRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != audit.ActionSetMetadata {
+		t.Errorf("unexpected audit records of bob: %v", records)
+	}
+
+	req, _ = http.NewRequest("GET", srv.URL+"/fleet/v1/audit?since=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid filter, got %d", res.StatusCode)
+	}
+}
+
+func TestAuditRecordsDisabled(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	srv := httptest.NewServer(NewServeMux(fr, registry.NewFakeClusterRegistry(nil, 0), testTokenLimit, nil, time.Second, nil, nil))
+	defer srv.Close()
+
+	cAPI := newAuditTestClient(t, srv, http.DefaultTransport)
+	if _, err := cAPI.AuditRecords(audit.Filter{}); err == nil {
+		t.Errorf("expected AuditRecords to fail while auditing is disabled")
+	}
+}
+
+func TestAuditRecordsUnauthenticated(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	srv := httptest.NewServer(NewServeMux(fr, registry.NewFakeClusterRegistry(nil, 0), testTokenLimit, nil, time.Second, nil, audit.NewRegistrySink(fr)))
+	defer srv.Close()
+
+	body := `{"desiredState": "loaded", "options": [{"section": "Service", "name": "ExecStart", "value": "/usr/bin/true"}]}`
+	req, _ := http.NewRequest("PUT", srv.URL+"/fleet/v1/units/foo.service", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(client.UserHeader, "mallory")
+	req.Header.Set(authenticatedUserHeader, "mallory")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil || res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT of unit returned %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	cAPI := newAuditTestClient(t, srv, http.DefaultTransport)
+	records, err := cAPI.AuditRecords(audit.Filter{})
+	if err != nil {
+		t.Fatalf("AuditRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != audit.ActionCreate || records[0].User != "" {
+		t.Errorf("expected a single create record without user, got %v", records)
+	}
+}
+
+type failingMetadataRegistry struct {
+	*registry.FakeRegistry
+}
+
+func (failingMetadataRegistry) SetMachineMetadata(machID, key, value string) error {
+	return errors.New("etcd unavailable")
+}
+
+func TestAuditRecordsFailedChange(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetMachines([]machine.MachineState{
+		{ID: "XXX", Metadata: map[string]string{"region": "us-east"}},
+	})
+	srv := httptest.NewServer(NewServeMux(failingMetadataRegistry{fr}, registry.NewFakeClusterRegistry(nil, 0), testTokenLimit, nil, time.Second, nil, audit.NewRegistrySink(fr)))
+	defer srv.Close()
+
+	body := `[{"op": "replace", "path": "/XXX/metadata/region", "value": {"value": "us-west"}}]`
+	req, _ := http.NewRequest("PATCH", srv.URL+"/fleet/v1/machines", strings.NewReader(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil || res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("PATCH of machine metadata returned %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	records, err := audit.NewRegistrySink(fr).Records(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected a single audit record, got %v", records)
+	}
+	r := records[0]
+	if r.OldState != "us-east" || r.NewState != "" || r.Error != "etcd unavailable" {
+		t.Errorf("unexpected record of the failed change: %#v", r)
+	}
+}
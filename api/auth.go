@@ -0,0 +1,252 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/log"
+)
+
+// authenticatedUserHeader names the user authMiddleware authenticated a
+// request as. Unlike client.UserHeader it cannot be sent by clients.
+const authenticatedUserHeader = "X-Fleet-Authenticated-User"
+
+var (
+	errAuthRequired      = errors.New("authentication required")
+	errInvalidCredential = errors.New("invalid credentials")
+)
+
+// Auth configures the authentication of API requests, and their
+// authorization against a Policy.
+type Auth struct {
+	// Authenticators are tried in order until one of them finds
+	// credentials in a request.
+	Authenticators []Authenticator
+	// Policy authorizes the requests of authenticated users. A nil
+	// Policy lets them make any request.
+	Policy *Policy
+}
+
+// Authenticator establishes the user on whose behalf a request is made. It
+// returns ok=false if the request holds no credentials it handles, and an
+// error if they are invalid.
+type Authenticator interface {
+	Authenticate(req *http.Request) (user string, ok bool, err error)
+}
+
+// authMiddleware rejects the requests which cannot be authenticated or are
+// not authorized. The authenticated user replaces any client.UserHeader
+// sent along, so that unit revisions are attributed to them. A nil auth
+// lets all requests through unauthenticated.
+type authMiddleware struct {
+	next http.Handler
+	auth *Auth
+}
+
+func (am *authMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	req.Header.Del(authenticatedUserHeader)
+	if am.auth == nil {
+		am.next.ServeHTTP(rw, req)
+		return
+	}
+
+	user, err := am.authenticate(req)
+	if err != nil {
+		log.Infof("Rejected unauthenticated HTTP %s %v: %v", req.Method, req.URL, err)
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="fleet"`)
+		rw.Header().Add("WWW-Authenticate", `Basic realm="fleet"`)
+		sendError(rw, http.StatusUnauthorized, err)
+		return
+	}
+
+	if am.auth.Policy != nil {
+		verb, unit := requestVerb(req)
+		if !am.auth.Policy.Allows(user, verb, unit) {
+			log.Infof("Denied HTTP %s %v to user %s", req.Method, req.URL, user)
+			sendError(rw, http.StatusForbidden, describeDenial(user, verb, unit))
+			return
+		}
+	}
+
+	req.Header.Set(client.UserHeader, user)
+	req.Header.Set(authenticatedUserHeader, user)
+	am.next.ServeHTTP(rw, req)
+}
+
+func (am *authMiddleware) authenticate(req *http.Request) (string, error) {
+	for _, a := range am.auth.Authenticators {
+		user, ok, err := a.Authenticate(req)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return user, nil
+		}
+	}
+	return "", errAuthRequired
+}
+
+func describeDenial(user, verb, unit string) error {
+	if unit == "" {
+		return fmt.Errorf("user %q is not allowed to %s", user, verb)
+	}
+	return fmt.Errorf("user %q is not allowed to %s unit %q", user, verb, unit)
+}
+
+// CertAuthenticator authenticates the requests made over TLS with a
+// verified client certificate, as the Common Name of its subject.
+type CertAuthenticator struct{}
+
+func (CertAuthenticator) Authenticate(req *http.Request) (string, bool, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", false, nil
+	}
+	cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return "", false, errors.New("client certificate has no common name")
+	}
+	return cn, true, nil
+}
+
+// TokenAuthenticator authenticates the requests carrying a known bearer
+// token in their Authorization header.
+type TokenAuthenticator struct {
+	// users maps tokens to the user they belong to
+	users map[string]string
+}
+
+// NewTokenAuthenticator reads the tokens from a file holding a token and
+// the name of its user, separated by whitespace, on each line. Empty lines
+// and those starting with "#" are ignored.
+func NewTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	users := make(map[string]string)
+	err := readAuthFile(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.New("expected a token and a user")
+		}
+		users[fields[0]] = fields[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenAuthenticator{users}, nil
+}
+
+func (ta *TokenAuthenticator) Authenticate(req *http.Request) (string, bool, error) {
+	h := req.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false, nil
+	}
+	user, ok := ta.users[strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))]
+	if !ok {
+		return "", false, errInvalidCredential
+	}
+	return user, true, nil
+}
+
+// HtpasswdAuthenticator authenticates the requests carrying the password
+// of a user in their Authorization header, as HTTP basic authentication.
+type HtpasswdAuthenticator struct {
+	// hashes maps users to the hash of their password
+	hashes map[string]string
+}
+
+// NewHtpasswdAuthenticator reads the passwords of users from a file in the
+// format of htpasswd. Passwords must be hashed with bcrypt (htpasswd -B),
+// or SHA1 (htpasswd -s).
+func NewHtpasswdAuthenticator(path string) (*HtpasswdAuthenticator, error) {
+	hashes := make(map[string]string)
+	err := readAuthFile(path, func(line string) error {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.New("expected user:hash")
+		}
+		if !isBcryptHash(parts[1]) && !strings.HasPrefix(parts[1], "{SHA}") {
+			return fmt.Errorf("unsupported password hash for user %q, use bcrypt or SHA1", parts[0])
+		}
+		hashes[parts[0]] = parts[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &HtpasswdAuthenticator{hashes}, nil
+}
+
+func (ha *HtpasswdAuthenticator) Authenticate(req *http.Request) (string, bool, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false, nil
+	}
+	hash, known := ha.hashes[user]
+	if !known || !matchPassword(hash, password) {
+		return "", false, errInvalidCredential
+	}
+	return user, true, nil
+}
+
+func isBcryptHash(hash string) bool {
+	for _, p := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPassword(hash, password string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	sum := sha1.Sum([]byte(password))
+	want := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(want)) == 1
+}
+
+// readAuthFile calls parse on every line of the file at path which is not
+// empty nor a comment.
+func readAuthFile(path string, parse func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parse(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
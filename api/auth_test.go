@@ -0,0 +1,158 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/coreos/fleet/client"
+)
+
+func writeAuthFile(t *testing.T, dir, name, content string) string {
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed writing %s: %v", name, err)
+	}
+	return p
+}
+
+func newTestAuth(t *testing.T, dir string) *Auth {
+	ta, err := NewTokenAuthenticator(writeAuthFile(t, dir, "tokens", "# token user\nsecret-token alice\n\nother-token bob\n"))
+	if err != nil {
+		t.Fatalf("Failed reading tokens: %v", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed hashing password: %v", err)
+	}
+	// carol's password is "password", hashed with SHA1
+	htpasswd := "carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\ndave:" + string(hash) + "\n"
+	ha, err := NewHtpasswdAuthenticator(writeAuthFile(t, dir, "htpasswd", htpasswd))
+	if err != nil {
+		t.Fatalf("Failed reading htpasswd: %v", err)
+	}
+
+	return &Auth{Authenticators: []Authenticator{CertAuthenticator{}, ta, ha}}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fleet-api-auth")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth := newTestAuth(t, dir)
+	auth.Policy = &Policy{
+		Roles: map[string][]PolicyRule{
+			"admin":    {{Verbs: []string{"*"}}},
+			"deployer": {{Verbs: []string{VerbGet, VerbSet, VerbDestroy}, Units: []string{"web@*"}}},
+			"viewer":   {{Verbs: []string{VerbGet, VerbList, VerbWatch}}},
+		},
+		Users: map[string][]string{
+			"alice": {"admin"},
+			"bob":   {"deployer"},
+			"*":     {"viewer"},
+		},
+	}
+
+	var gotUser string
+	hdlr := &authMiddleware{http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		gotUser = req.Header.Get(client.UserHeader)
+	}), auth}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "erin"}}
+
+	for i, tt := range []struct {
+		method string
+		path   string
+		setup  func(req *http.Request)
+		code   int
+		user   string
+	}{
+		// no or invalid credentials
+		{"GET", "/fleet/v1/units", func(req *http.Request) {}, http.StatusUnauthorized, ""},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized, ""},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.SetBasicAuth("carol", "nope") }, http.StatusUnauthorized, ""},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.SetBasicAuth("nobody", "password") }, http.StatusUnauthorized, ""},
+
+		// each authenticator, overriding the user sent by the client
+		{"DELETE", "/fleet/v1/units/db.service", func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer secret-token")
+			req.Header.Set(client.UserHeader, "mallory")
+		}, http.StatusOK, "alice"},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.SetBasicAuth("carol", "password") }, http.StatusOK, "carol"},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.SetBasicAuth("dave", "hunter2") }, http.StatusOK, "dave"},
+		{"GET", "/fleet/v1/state", func(req *http.Request) {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}, http.StatusOK, "erin"},
+
+		// authorization by verb and unit
+		{"PUT", "/fleet/v1/units/web@1.service", func(req *http.Request) { req.Header.Set("Authorization", "Bearer other-token") }, http.StatusOK, "bob"},
+		{"PUT", "/fleet/v1/units/db.service", func(req *http.Request) { req.Header.Set("Authorization", "Bearer other-token") }, http.StatusForbidden, ""},
+		{"GET", "/fleet/v1/units", func(req *http.Request) { req.Header.Set("Authorization", "Bearer other-token") }, http.StatusOK, "bob"},
+		{"PATCH", "/fleet/v1/machines", func(req *http.Request) { req.SetBasicAuth("carol", "password") }, http.StatusForbidden, ""},
+		{"POST", "/fleet/v1/rebalance", func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret-token") }, http.StatusOK, "alice"},
+	} {
+		gotUser = ""
+		req, err := http.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed creating request: %v", i, err)
+		}
+		tt.setup(req)
+		rw := httptest.NewRecorder()
+
+		hdlr.ServeHTTP(rw, req)
+		if rw.Code != tt.code {
+			t.Errorf("case %d: expected %d, got %d: %s", i, tt.code, rw.Code, rw.Body.String())
+		}
+		if gotUser != tt.user {
+			t.Errorf("case %d: expected user %q, got %q", i, tt.user, gotUser)
+		}
+		if tt.code == http.StatusUnauthorized && rw.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("case %d: missing WWW-Authenticate header", i)
+		}
+	}
+}
+
+func TestAuthFilesInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fleet-api-auth")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewTokenAuthenticator(writeAuthFile(t, dir, "tokens", "lonely-token\n")); err == nil {
+		t.Errorf("expected error reading token without user")
+	}
+	// MD5 hashes of htpasswd are not supported
+	if _, err := NewHtpasswdAuthenticator(writeAuthFile(t, dir, "htpasswd", "carol:$apr1$x$y\n")); err == nil {
+		t.Errorf("expected error reading unsupported hash")
+	}
+	if _, err := NewTokenAuthenticator(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error reading missing file")
+	}
+}
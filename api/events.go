@@ -0,0 +1,425 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/schema"
+)
+
+const (
+	// eventMaxBackoff caps the delay between attempts to check the registry
+	// for changes while they keep failing.
+	eventMaxBackoff = time.Minute
+
+	// eventLinger is how long changes of the registry keep being followed
+	// after the last watcher left, so that watchers reconnecting within it
+	// can resume their stream without missing events.
+	eventLinger = 5 * time.Minute
+
+	// eventHistorySize is the number of past events kept for watchers
+	// resuming their stream.
+	eventHistorySize = 1000
+)
+
+var errEventIndexCleared = errors.New("the requested event index is no longer available")
+
+func wireUpEventsResource(mux *http.ServeMux, prefix string, hub *eventHub) {
+	res := path.Join(prefix, "events")
+	er := eventsResource{hub}
+	mux.Handle(res, &er)
+}
+
+type eventsResource struct {
+	hub *eventHub
+}
+
+func (er *eventsResource) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		sendError(rw, http.StatusMethodNotAllowed, errors.New("only GET supported against this resource"))
+		return
+	}
+
+	query := req.URL.Query()
+	if query.Get("watch") != "true" {
+		sendError(rw, http.StatusBadRequest, errors.New("events can only be watched, set watch=true"))
+		return
+	}
+
+	var from uint64
+	if val := query.Get("index"); val != "" {
+		var err error
+		from, err = strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			sendError(rw, http.StatusBadRequest, fmt.Errorf("invalid index %q", val))
+			return
+		}
+	}
+
+	er.hub.subscribe()
+	defer er.hub.unsubscribe()
+
+	events, from, changed, err := er.hub.since(from)
+	if err != nil {
+		sendError(rw, http.StatusGone, err)
+		return
+	}
+
+	var closed <-chan bool
+	if cn, ok := rw.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	flusher, _ := rw.(http.Flusher)
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(rw)
+	for {
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				log.Debugf("Failed sending event: %v", err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		}
+
+		events, from, changed, err = er.hub.since(from)
+		if err != nil {
+			// the watcher fell too far behind; ending the stream
+			// makes it resume and learn that from the status code
+			return
+		}
+	}
+}
+
+// eventHub turns the changes observed in the registry into a stream of
+// events. While events are being watched, the registry is read again
+// whenever the given stream reports a change, or every interval if there
+// is no stream, and the most recent events are kept so that watchers can
+// resume their stream.
+type eventHub struct {
+	cAPI     client.API
+	stream   pkg.EventStream
+	interval time.Duration
+	linger   time.Duration
+
+	mu       sync.Mutex
+	watchers int
+	left     time.Time
+	running  bool
+	// events holds the events following index first, up to index last.
+	events  []schema.Event
+	first   uint64
+	last    uint64
+	changed chan struct{}
+}
+
+func newEventHub(cAPI client.API, stream pkg.EventStream, interval time.Duration) *eventHub {
+	// Indexes start from the current time in milliseconds, so indexes
+	// handed out before a restart of the server are not mistaken for
+	// current ones.
+	start := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	return &eventHub{
+		cAPI:     cAPI,
+		stream:   stream,
+		interval: interval,
+		linger:   eventLinger,
+		first:    start + 1,
+		last:     start,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (h *eventHub) subscribe() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers++
+	if h.running {
+		return
+	}
+
+	// Changes made while the registry was not followed are unknown, so
+	// streams from before cannot be resumed.
+	h.events = nil
+	h.last++
+	h.first = h.last + 1
+	h.running = true
+	go h.run()
+}
+
+func (h *eventHub) unsubscribe() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers--
+	h.left = time.Now()
+}
+
+// since returns the events following the given index, or none if it is 0,
+// along with the index of the last event and a channel closed as soon as
+// more events are available.
+func (h *eventHub) since(index uint64) ([]schema.Event, uint64, <-chan struct{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if index == 0 {
+		return nil, h.last, h.changed, nil
+	}
+	if index+1 < h.first || index > h.last {
+		return nil, 0, nil, errEventIndexCleared
+	}
+
+	events := h.events[len(h.events)-int(h.last-index):]
+	return append([]schema.Event(nil), events...), h.last, h.changed, nil
+}
+
+// run follows the changes of the registry until nobody has watched events
+// for the linger period.
+func (h *eventHub) run() {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Following the stream before the first read makes sure no change
+	// made after it is missed.
+	var changes chan pkg.Event
+	if h.stream != nil {
+		changes = h.stream.Next(stop)
+	}
+
+	var prev *eventSnapshot
+	delay := h.interval
+	read := true
+	for !h.idle() {
+		if read {
+			cur, err := takeEventSnapshot(h.cAPI)
+			delay = eventPollDelay(delay, h.interval, err != nil)
+			if err != nil {
+				log.Errorf("Failed fetching cluster state for events, retrying in %v: %v", delay, err)
+			} else {
+				if prev != nil {
+					h.publish(diffEventSnapshots(prev, cur))
+				}
+				prev = cur
+				read = h.stream == nil
+			}
+		}
+
+		// Without a change to read, waking up every interval only
+		// serves to notice the last watcher left.
+		select {
+		case <-changes:
+			changes = h.stream.Next(stop)
+			read = true
+		case <-time.After(delay):
+		}
+	}
+}
+
+// idle tells whether nobody has watched events for the linger period, in
+// which case the hub stops running.
+func (h *eventHub) idle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.watchers == 0 && time.Since(h.left) > h.linger {
+		h.running = false
+		return true
+	}
+	return false
+}
+
+// eventPollDelay returns how long to wait before reading the registry
+// again, backing off from the last delay while reading fails.
+func eventPollDelay(last, interval time.Duration, failed bool) time.Duration {
+	if !failed {
+		return interval
+	}
+	max := eventMaxBackoff
+	if interval > max {
+		max = interval
+	}
+	return pkg.ExpBackoff(last, max)
+}
+
+func (h *eventHub) publish(events []schema.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ev := range events {
+		h.last++
+		ev.Index = h.last
+		h.events = append(h.events, ev)
+	}
+	if n := len(h.events) - eventHistorySize; n > 0 {
+		h.events = append([]schema.Event(nil), h.events[n:]...)
+		h.first += uint64(n)
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// eventSnapshot holds the parts of the cluster state events are derived from.
+type eventSnapshot struct {
+	units    map[string]*schema.Unit
+	states   map[string]*schema.UnitState
+	machines map[string]machine.MachineState
+}
+
+func takeEventSnapshot(cAPI client.API) (*eventSnapshot, error) {
+	snap := eventSnapshot{
+		units:    make(map[string]*schema.Unit),
+		states:   make(map[string]*schema.UnitState),
+		machines: make(map[string]machine.MachineState),
+	}
+
+	machines, err := cAPI.Machines()
+	if err != nil {
+		return nil, err
+	}
+	for _, ms := range machines {
+		snap.machines[ms.ID] = ms
+	}
+
+	units, err := cAPI.Units()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range units {
+		snap.units[u.Name] = u
+	}
+
+	states, err := cAPI.UnitStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, us := range states {
+		snap.states[path.Join(us.Name, us.MachineID)] = us
+	}
+
+	return &snap, nil
+}
+
+// diffEventSnapshots returns the events leading from one snapshot to the
+// next: machines joining first, then changes of units and unit states by
+// name, and machines leaving last.
+func diffEventSnapshots(prev, cur *eventSnapshot) []schema.Event {
+	var events []schema.Event
+
+	machines := make(map[string]bool)
+	for id := range prev.machines {
+		machines[id] = true
+	}
+	for id := range cur.machines {
+		machines[id] = true
+	}
+	units := make(map[string]bool)
+	for name := range prev.units {
+		units[name] = true
+	}
+	for name := range cur.units {
+		units[name] = true
+	}
+	states := make(map[string]bool)
+	for key := range prev.states {
+		states[key] = true
+	}
+	for key := range cur.states {
+		states[key] = true
+	}
+
+	for _, id := range sortedNames(machines) {
+		if _, ok := prev.machines[id]; !ok {
+			ms := cur.machines[id]
+			events = append(events, schema.Event{
+				Type:      schema.EventMachineJoined,
+				MachineID: id,
+				Machine:   schema.MapMachineStateToSchema(&ms),
+			})
+		}
+	}
+
+	for _, name := range sortedNames(units) {
+		p, c := prev.units[name], cur.units[name]
+		switch {
+		case c == nil:
+			events = append(events, schema.Event{Type: schema.EventUnitDestroyed, UnitName: name})
+			continue
+		case p == nil:
+			events = append(events, schema.Event{Type: schema.EventUnitCreated, UnitName: name, DesiredState: c.DesiredState})
+			p = &schema.Unit{DesiredState: c.DesiredState}
+		}
+
+		if p.DesiredState != c.DesiredState {
+			events = append(events, schema.Event{Type: schema.EventUnitTargetStateChanged, UnitName: name, DesiredState: c.DesiredState})
+		}
+		if p.MachineID != c.MachineID {
+			if p.MachineID != "" {
+				events = append(events, schema.Event{Type: schema.EventUnitUnscheduled, UnitName: name, MachineID: p.MachineID})
+			}
+			if c.MachineID != "" {
+				events = append(events, schema.Event{Type: schema.EventUnitScheduled, UnitName: name, MachineID: c.MachineID})
+			}
+		}
+	}
+
+	for _, key := range sortedNames(states) {
+		p, c := prev.states[key], cur.states[key]
+		switch {
+		case c == nil:
+			events = append(events, schema.Event{Type: schema.EventUnitStateRemoved, UnitName: p.Name, MachineID: p.MachineID})
+		case p == nil || !p.SameState(c):
+			events = append(events, schema.Event{Type: schema.EventUnitStateChanged, UnitName: c.Name, MachineID: c.MachineID, UnitState: c})
+		}
+	}
+
+	for _, id := range sortedNames(machines) {
+		if _, ok := cur.machines[id]; !ok {
+			events = append(events, schema.Event{Type: schema.EventMachineLeft, MachineID: id})
+		}
+	}
+
+	return events
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
+)
+
+func TestDiffEventSnapshots(t *testing.T) {
+	prev := &eventSnapshot{
+		units: map[string]*schema.Unit{
+			"a.service": {Name: "a.service", DesiredState: "launched", MachineID: "XXX"},
+			"b.service": {Name: "b.service", DesiredState: "loaded"},
+			"c.service": {Name: "c.service", DesiredState: "launched", MachineID: "YYY"},
+		},
+		states: map[string]*schema.UnitState{
+			"a.service/XXX": {Name: "a.service", MachineID: "XXX", SystemdActiveState: "activating"},
+			"c.service/YYY": {Name: "c.service", MachineID: "YYY", SystemdActiveState: "active"},
+		},
+		machines: map[string]machine.MachineState{
+			"XXX": {ID: "XXX"},
+			"YYY": {ID: "YYY"},
+		},
+	}
+	cur := &eventSnapshot{
+		units: map[string]*schema.Unit{
+			"a.service": {Name: "a.service", DesiredState: "launched", MachineID: "ZZZ"},
+			"b.service": {Name: "b.service", DesiredState: "launched"},
+			"d.service": {Name: "d.service", DesiredState: "launched", MachineID: "XXX"},
+		},
+		states: map[string]*schema.UnitState{
+			"a.service/XXX": {Name: "a.service", MachineID: "XXX", SystemdActiveState: "active"},
+		},
+		machines: map[string]machine.MachineState{
+			"XXX": {ID: "XXX"},
+			"ZZZ": {ID: "ZZZ", PublicIP: "10.0.0.3"},
+		},
+	}
+
+	want := []schema.Event{
+		{Type: schema.EventMachineJoined, MachineID: "ZZZ", Machine: schema.MapMachineStateToSchema(&machine.MachineState{ID: "ZZZ", PublicIP: "10.0.0.3"})},
+		{Type: schema.EventUnitUnscheduled, UnitName: "a.service", MachineID: "XXX"},
+		{Type: schema.EventUnitScheduled, UnitName: "a.service", MachineID: "ZZZ"},
+		{Type: schema.EventUnitTargetStateChanged, UnitName: "b.service", DesiredState: "launched"},
+		{Type: schema.EventUnitDestroyed, UnitName: "c.service"},
+		{Type: schema.EventUnitCreated, UnitName: "d.service", DesiredState: "launched"},
+		{Type: schema.EventUnitScheduled, UnitName: "d.service", MachineID: "XXX"},
+		{Type: schema.EventUnitStateChanged, UnitName: "a.service", MachineID: "XXX", UnitState: cur.states["a.service/XXX"]},
+		{Type: schema.EventUnitStateRemoved, UnitName: "c.service", MachineID: "YYY"},
+		{Type: schema.EventMachineLeft, MachineID: "YYY"},
+	}
+	got := diffEventSnapshots(prev, cur)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected events\nwant %#v\ngot  %#v", want, got)
+	}
+
+	if got := diffEventSnapshots(cur, cur); len(got) != 0 {
+		t.Errorf("unexpected events between equal snapshots: %#v", got)
+	}
+}
+
+func TestEventsResourceWatch(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	hub := newEventHub(&client.RegistryClient{Registry: fr}, nil, 10*time.Millisecond)
+
+	srv := httptest.NewServer(&eventsResource{hub})
+	defer srv.Close()
+
+	ep, _ := url.Parse(srv.URL)
+	cAPI, err := client.NewHTTPClient(http.DefaultClient, *ep)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the resource is served at the root path of the test server
+	httpClient := cAPI.(*client.HTTPClient)
+
+	watch := func(index uint64) (chan *schema.Event, chan struct{}, chan error) {
+		events := make(chan *schema.Event)
+		stop := make(chan struct{})
+		errc := make(chan error, 1)
+		go func() {
+			errc <- httpClient.Watch(index, events, stop)
+		}()
+		return events, stop, errc
+	}
+	next := func(events chan *schema.Event, errc chan error) *schema.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case err := <-errc:
+			t.Fatalf("watch ended: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event received")
+		}
+		return nil
+	}
+
+	events, stop, errc := watch(0)
+	// let the hub take the snapshot changes are compared against
+	time.Sleep(100 * time.Millisecond)
+
+	fr.CreateUnit(&job.Unit{Name: "foo.service", Unit: unit.UnitFile{}, TargetState: job.JobStateInactive})
+	ev := next(events, errc)
+	if ev.Type != schema.EventUnitCreated || ev.UnitName != "foo.service" {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	close(stop)
+	if err := <-errc; err != nil {
+		t.Errorf("stopping the watch returned %v", err)
+	}
+
+	// changes made while not watching are received on resumption
+	fr.ScheduleUnit("foo.service", "XXX")
+	time.Sleep(100 * time.Millisecond)
+	events, stop, errc = watch(ev.Index)
+	ev = next(events, errc)
+	if ev.Type != schema.EventUnitScheduled || ev.MachineID != "XXX" {
+		t.Errorf("unexpected event %#v", ev)
+	}
+	close(stop)
+	<-errc
+
+	_, _, errc = watch(1)
+	if err := <-errc; !client.IsEventIndexCleared(err) {
+		t.Errorf("watching from a cleared index returned %v", err)
+	}
+}
+
+// fakeEventStream emits the events sent to it.
+type fakeEventStream chan pkg.Event
+
+func (es fakeEventStream) Next(stop chan struct{}) chan pkg.Event {
+	return es
+}
+
+// countingAPI counts the reads of the unit states, the last part of the
+// cluster state read for events.
+type countingAPI struct {
+	client.API
+
+	mu    sync.Mutex
+	reads int
+}
+
+func (c *countingAPI) UnitStates() ([]*schema.UnitState, error) {
+	states, err := c.API.UnitStates()
+	c.mu.Lock()
+	c.reads++
+	c.mu.Unlock()
+	return states, err
+}
+
+func (c *countingAPI) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads
+}
+
+func TestEventHubFollowsStream(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	cAPI := &countingAPI{API: &client.RegistryClient{Registry: fr}}
+	changes := make(fakeEventStream)
+	hub := newEventHub(cAPI, changes, 10*time.Millisecond)
+	hub.subscribe()
+	defer hub.unsubscribe()
+	_, from, changed, _ := hub.since(0)
+
+	for i := 0; cAPI.count() == 0; i++ {
+		if i == 100 {
+			t.Fatalf("the cluster state was never read")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// without a change reported by the stream, the registry is not read
+	fr.CreateUnit(&job.Unit{Name: "foo.service", Unit: unit.UnitFile{}, TargetState: job.JobStateInactive})
+	time.Sleep(100 * time.Millisecond)
+	if n := cAPI.count(); n != 1 {
+		t.Errorf("cluster state read %d times, want 1", n)
+	}
+
+	changes <- registry.ClusterChangeEvent
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event published")
+	}
+	events, _, _, err := hub.since(from)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != schema.EventUnitCreated || events[0].UnitName != "foo.service" {
+		t.Errorf("unexpected events %#v", events)
+	}
+}
+
+func TestEventsResourceBadRequest(t *testing.T) {
+	hub := newEventHub(&client.RegistryClient{Registry: registry.NewFakeRegistry()}, nil, time.Second)
+	tests := []struct {
+		method string
+		query  string
+		code   int
+	}{
+		{"GET", "", http.StatusBadRequest},
+		{"GET", "?watch=true&index=foo", http.StatusBadRequest},
+		{"POST", "?watch=true", http.StatusMethodNotAllowed},
+	}
+
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://example.com/fleet/v1/events"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("case %d: failed creating http.Request: %v", i, err)
+		}
+		rw := httptest.NewRecorder()
+		(&eventsResource{hub}).ServeHTTP(rw, req)
+		if rw.Code != tt.code {
+			t.Errorf("case %d: expected %d, got %d", i, tt.code, rw.Code)
+		}
+	}
+}
+
+func TestEventPollDelay(t *testing.T) {
+	tests := []struct {
+		last     time.Duration
+		interval time.Duration
+		failed   bool
+		want     time.Duration
+	}{
+		{time.Second, time.Second, false, time.Second},
+		{time.Second, time.Second, true, 2 * time.Second},
+		{40 * time.Second, time.Second, true, time.Minute},
+		// success resets the backoff
+		{time.Minute, time.Second, false, time.Second},
+		// the backoff never goes below the interval
+		{2 * time.Minute, 2 * time.Minute, true, 2 * time.Minute},
+	}
+
+	for i, tt := range tests {
+		if got := eventPollDelay(tt.last, tt.interval, tt.failed); got != tt.want {
+			t.Errorf("case %d: expected %v, got %v", i, tt.want, got)
+		}
+	}
+}
@@ -17,10 +17,12 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"path"
 	"regexp"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
@@ -29,17 +31,20 @@ import (
 
 var (
 	metadataPathRegex = regexp.MustCompile("^/([^/]+)/metadata/([A-Za-z0-9_.-]+$)")
+	machinePathRegex  = regexp.MustCompile("^/([^/]+)$")
 )
 
-func wireUpMachinesResource(mux *http.ServeMux, prefix string, tokenLimit int, cAPI client.API) {
+func wireUpMachinesResource(mux *http.ServeMux, prefix string, tokenLimit int, cAPI client.API, auditSink audit.Sink) {
 	res := path.Join(prefix, "machines")
-	mr := machinesResource{cAPI, uint16(tokenLimit)}
+	mr := machinesResource{cAPI, uint16(tokenLimit), auditSink}
 	mux.Handle(res, &mr)
 }
 
 type machinesResource struct {
 	cAPI       client.API
 	tokenLimit uint16
+	// audit records the changes made to machines, if not nil
+	audit audit.Sink
 }
 
 type machineMetadataOp struct {
@@ -73,7 +78,16 @@ func (mr *machinesResource) list(rw http.ResponseWriter, req *http.Request) {
 		token = &def
 	}
 
-	page, err := getMachinePage(mr.cAPI, *token)
+	opts, err := client.ParseListOptions(req.URL.Query(), "")
+	if err == nil {
+		err = client.ValidateMachineListOptions(opts)
+	}
+	if err != nil {
+		sendError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := getMachinePage(mr.cAPI, opts, *token)
 	if err != nil {
 		log.Errorf("Failed fetching page of Machines: %v", err)
 		sendError(rw, http.StatusInternalServerError, nil)
@@ -92,8 +106,16 @@ func (mr *machinesResource) patch(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	for _, op := range ops {
+		if isMachineOp(op.Operation) {
+			if machinePathRegex.FindStringSubmatch(op.Path) == nil {
+				sendError(rw, http.StatusBadRequest, errors.New("machine path invalid"))
+				return
+			}
+			continue
+		}
+
 		if op.Operation != "add" && op.Operation != "remove" && op.Operation != "replace" {
-			sendError(rw, http.StatusBadRequest, errors.New("invalid op: expect add, remove, or replace"))
+			sendError(rw, http.StatusBadRequest, errors.New("invalid op: expect add, remove, replace, cordon, uncordon or drain"))
 			return
 		}
 
@@ -108,31 +130,122 @@ func (mr *machinesResource) patch(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	states := mr.auditedMachineStates()
 	for _, op := range ops {
+		if isMachineOp(op.Operation) {
+			// regex already validated above
+			machID := machinePathRegex.FindStringSubmatch(op.Path)[1]
+			err := mr.applyMachineOp(op.Operation, machID)
+
+			rec := newAuditRecord(req, op.Operation)
+			rec.MachineID = machID
+			if ms, ok := states[machID]; ok {
+				rec.OldState = cordonState(ms.Cordoned)
+				if err == nil {
+					ms.Cordoned = op.Operation != "uncordon"
+					rec.NewState = cordonState(ms.Cordoned)
+					states[machID] = ms
+				}
+			}
+			writeAuditRecord(mr.audit, rec, err)
+
+			if err != nil {
+				sendError(rw, http.StatusInternalServerError, err)
+				return
+			}
+			continue
+		}
+
 		// regex already validated above
 		s := metadataPathRegex.FindStringSubmatch(op.Path)
 		machID := s[1]
 		key := s[2]
 
+		var err error
+		var rec audit.Record
 		if op.Operation == "remove" {
-			err := mr.cAPI.DeleteMachineMetadata(machID, key)
-			if err != nil {
-				sendError(rw, http.StatusInternalServerError, err)
-				return
-			}
+			err = mr.cAPI.DeleteMachineMetadata(machID, key)
+			rec = newAuditRecord(req, audit.ActionDeleteMetadata)
 		} else {
-			err := mr.cAPI.SetMachineMetadata(machID, key, op.Value.Value)
-			if err != nil {
-				sendError(rw, http.StatusInternalServerError, err)
-				return
+			err = mr.cAPI.SetMachineMetadata(machID, key, op.Value.Value)
+			rec = newAuditRecord(req, audit.ActionSetMetadata)
+			if err == nil {
+				rec.NewState = op.Value.Value
+			}
+		}
+		rec.MachineID = machID
+		rec.Key = key
+		if ms, ok := states[machID]; ok {
+			rec.OldState = ms.Metadata[key]
+			if err == nil && op.Operation == "remove" {
+				delete(ms.Metadata, key)
+			} else if err == nil {
+				ms.Metadata[key] = rec.NewState
 			}
 		}
+		writeAuditRecord(mr.audit, rec, err)
+
+		if err != nil {
+			sendError(rw, http.StatusInternalServerError, err)
+			return
+		}
 	}
 	sendResponse(rw, http.StatusNoContent, nil)
 }
 
-func getMachinePage(cAPI client.API, tok PageToken) (*schema.MachinePage, error) {
-	all, err := cAPI.Machines()
+// auditedMachineStates returns the current states of the machines by ID,
+// so that the changes made to them can be audited, if they are.
+func (mr *machinesResource) auditedMachineStates() map[string]machine.MachineState {
+	states := map[string]machine.MachineState{}
+	if mr.audit == nil {
+		return states
+	}
+
+	machines, err := mr.cAPI.Machines()
+	if err != nil {
+		log.Warningf("Failed fetching Machines, audit records will lack their previous state: %v", err)
+		return states
+	}
+	for _, ms := range machines {
+		md := make(map[string]string, len(ms.Metadata))
+		for k, v := range ms.Metadata {
+			md[k] = v
+		}
+		ms.Metadata = md
+		states[ms.ID] = ms
+	}
+	return states
+}
+
+// cordonState describes whether a machine accepts newly scheduled units in
+// audit records.
+func cordonState(cordoned bool) string {
+	if cordoned {
+		return "cordoned"
+	}
+	return "schedulable"
+}
+
+// isMachineOp determines whether the operation applies to a machine as a
+// whole rather than to one of its metadata keys.
+func isMachineOp(op string) bool {
+	return op == "cordon" || op == "uncordon" || op == "drain"
+}
+
+func (mr *machinesResource) applyMachineOp(op, machID string) error {
+	switch op {
+	case "cordon":
+		return mr.cAPI.CordonMachine(machID)
+	case "uncordon":
+		return mr.cAPI.UncordonMachine(machID)
+	case "drain":
+		return mr.cAPI.DrainMachine(machID)
+	}
+	return fmt.Errorf("invalid machine op %q", op)
+}
+
+func getMachinePage(cAPI client.API, opts client.ListOptions, tok PageToken) (*schema.MachinePage, error) {
+	all, err := cAPI.ListMachines(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/registry"
 )
@@ -40,6 +41,34 @@ func fakeMachinesSetup() (*machinesResource, *httptest.ResponseRecorder) {
 	return resource, rw
 }
 
+func TestMachinesListAddresses(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetMachines([]machine.MachineState{
+		{
+			ID: "XXX",
+			Addresses: []machine.Address{
+				{Role: machine.AddressPublic, IP: "2001:db8::1"},
+				{Role: machine.AddressPrivate, IP: "fd00::1"},
+			},
+		},
+	})
+	resource := &machinesResource{cAPI: &client.RegistryClient{Registry: fr}, tokenLimit: testTokenLimit}
+	rw := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed creating http.Request: %v", err)
+	}
+
+	resource.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rw.Code)
+	}
+	expected := `{"machines":[{"addresses":[{"ip":"2001:db8::1","role":"public"},{"ip":"fd00::1","role":"private"}],"id":"XXX","primaryIP":"2001:db8::1"}]}`
+	if body := rw.Body.String(); body != expected {
+		t.Errorf("Expected body:\n%s\n\nReceived body:\n%s\n", expected, body)
+	}
+}
+
 func TestMachinesList(t *testing.T) {
 	resource, rw := fakeMachinesSetup()
 	req, err := http.NewRequest("GET", "http://example.com", nil)
@@ -70,10 +99,44 @@ func TestMachinesList(t *testing.T) {
 	}
 }
 
+func TestMachinesListSelectors(t *testing.T) {
+	for _, tt := range []struct {
+		query    string
+		code     int
+		expected string
+	}{
+		{"metadata=ping=pong", http.StatusOK, `{"machines":[{"id":"YYY","metadata":{"ping":"pong"},"primaryIP":"1.2.3.4"}]}`},
+		{"metadata=!ping", http.StatusOK, `{"machines":[{"id":"XXX"}]}`},
+		{"machineID=XXX", http.StatusOK, `{"machines":[{"id":"XXX"}]}`},
+		{"machineID=X*", http.StatusOK, `{}`},
+		{"machineIDPattern=X*", http.StatusOK, `{"machines":[{"id":"XXX"}]}`},
+		{"sort=-machineID", http.StatusOK, `{"machines":[{"id":"YYY","metadata":{"ping":"pong"},"primaryIP":"1.2.3.4"},{"id":"XXX"}]}`},
+		{"sort=-metadata.ping", http.StatusOK, `{"machines":[{"id":"YYY","metadata":{"ping":"pong"},"primaryIP":"1.2.3.4"},{"id":"XXX"}]}`},
+		{"sort=name", http.StatusOK, `{"machines":[{"id":"XXX"},{"id":"YYY","metadata":{"ping":"pong"},"primaryIP":"1.2.3.4"}]}`},
+		{"sort=activeState", http.StatusBadRequest, ""},
+		{"machineIDPattern=[", http.StatusBadRequest, ""},
+	} {
+		resource, rw := fakeMachinesSetup()
+		req, err := http.NewRequest("GET", "http://example.com/machines?"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("Failed creating http.Request: %v", err)
+		}
+
+		resource.ServeHTTP(rw, req)
+		if rw.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.query, tt.code, rw.Code)
+			continue
+		}
+		if tt.code == http.StatusOK && rw.Body.String() != tt.expected {
+			t.Errorf("%s: expected body:\n%s\n\nReceived body:\n%s\n", tt.query, tt.expected, rw.Body.String())
+		}
+	}
+}
+
 func TestMachinesListBadNextPageToken(t *testing.T) {
 	fr := registry.NewFakeRegistry()
 	fAPI := &client.RegistryClient{Registry: fr}
-	resource := &machinesResource{fAPI, testTokenLimit}
+	resource := &machinesResource{fAPI, testTokenLimit, nil}
 	rw := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "http://example.com/machines?nextPageToken=EwBMLg==", nil)
 	if err != nil {
@@ -266,3 +329,93 @@ func TestMachinesPatchBadValue(t *testing.T) {
 		t.Errorf("Expected 400, got %d", rw.Code)
 	}
 }
+
+func TestMachinesPatchCordon(t *testing.T) {
+	reqBody := `
+	[{"op": "cordon", "path": "/XXX"},
+	 {"op": "cordon", "path": "/YYY"},
+	 {"op": "uncordon", "path": "/YYY"}]
+	`
+
+	resource, rw := fakeMachinesSetup()
+	req, err := http.NewRequest("PATCH", "http://example.com/machines", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("Failed creating http.Request: %v", err)
+	}
+
+	resource.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rw.Code)
+	}
+
+	machines, err := resource.cAPI.Machines()
+	if err != nil {
+		t.Fatalf("Failed fetching machines: %v", err)
+	}
+	cordoned := make(map[string]bool)
+	for _, ms := range machines {
+		cordoned[ms.ID] = ms.Cordoned
+	}
+	if want := map[string]bool{"XXX": true, "YYY": false}; !reflect.DeepEqual(want, cordoned) {
+		t.Errorf("Expected cordoned machines %v, got %v", want, cordoned)
+	}
+}
+
+func TestMachinesPatchDrain(t *testing.T) {
+	reqBody := `
+	[{"op": "drain", "path": "/XXX"}]
+	`
+
+	fr := registry.NewFakeRegistry()
+	fr.SetMachines([]machine.MachineState{
+		{ID: "XXX", Metadata: map[string]string{}},
+		{ID: "YYY", Metadata: map[string]string{}},
+	})
+	fr.SetJobs([]job.Job{
+		{Name: "foo.service", TargetMachineID: "XXX"},
+		{Name: "bar.service", TargetMachineID: "YYY"},
+	})
+	resource := &machinesResource{cAPI: &client.RegistryClient{Registry: fr}, tokenLimit: testTokenLimit}
+	rw := httptest.NewRecorder()
+
+	req, err := http.NewRequest("PATCH", "http://example.com/machines", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("Failed creating http.Request: %v", err)
+	}
+
+	resource.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rw.Code)
+	}
+
+	machines, _ := fr.Machines()
+	if !machines[0].Cordoned || machines[1].Cordoned {
+		t.Errorf("Expected only XXX to be cordoned, got %v", machines)
+	}
+
+	sUnits, _ := fr.Schedule()
+	targets := make(map[string]string)
+	for _, su := range sUnits {
+		targets[su.Name] = su.TargetMachineID
+	}
+	if want := map[string]string{"foo.service": "", "bar.service": "YYY"}; !reflect.DeepEqual(want, targets) {
+		t.Errorf("Expected schedule %v, got %v", want, targets)
+	}
+}
+
+func TestMachinesPatchBadMachinePath(t *testing.T) {
+	reqBody := `
+	[{"op": "cordon", "path": "/XXX/metadata/foo"}]
+	`
+
+	resource, rw := fakeMachinesSetup()
+	req, err := http.NewRequest("PATCH", "http://example.com/machines", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("Failed creating http.Request: %v", err)
+	}
+
+	resource.ServeHTTP(rw, req)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rw.Code)
+	}
+}
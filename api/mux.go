@@ -16,32 +16,44 @@ package api
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/pkg"
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/version"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewServeMux(reg registry.Registry, tokenLimit int) http.Handler {
+// NewServeMux returns the handler of the fleet API. Events are watched by
+// reading the registry again whenever eventStream reports a change, or
+// every eventInterval if eventStream is nil. Unless auth is nil,
+// requests must be authenticated, and authorized by its Policy if any. The
+// changes made to units and machines are recorded in auditSink, if not nil.
+func NewServeMux(reg registry.Registry, cReg registry.ClusterRegistry, tokenLimit int, eventStream pkg.EventStream, eventInterval time.Duration, auth *Auth, auditSink audit.Sink) http.Handler {
 	sm := http.NewServeMux()
 	cAPI := &client.RegistryClient{Registry: reg}
+	hub := newEventHub(cAPI, eventStream, eventInterval)
 
 	for _, prefix := range []string{"/v1-alpha", "/fleet/v1"} {
 		wireUpDiscoveryResource(sm, prefix)
 
-		wireUpMachinesResource(sm, prefix, tokenLimit, cAPI)
+		wireUpMachinesResource(sm, prefix, tokenLimit, cAPI, auditSink)
 		wireUpStateResource(sm, prefix, tokenLimit, cAPI)
-		wireUpUnitsResource(sm, prefix, tokenLimit, cAPI)
+		wireUpUnitsResource(sm, prefix, tokenLimit, cAPI, auditSink)
+		wireUpRebalanceResource(sm, prefix, cReg)
+		wireUpEventsResource(sm, prefix, hub)
+		wireUpAuditResource(sm, prefix, auditSink)
 		sm.HandleFunc(prefix, methodNotAllowedHandler)
 	}
 
 	sm.HandleFunc("/", baseHandler)
 	sm.Handle("/metrics", prometheus.Handler())
 
-	hdlr := http.Handler(sm)
+	hdlr := http.Handler(&authMiddleware{sm, auth})
 	hdlr = &loggingMiddleware{hdlr}
 	hdlr = &serverInfoMiddleware{hdlr}
 
@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/version"
@@ -40,7 +41,7 @@ func TestDefaultHandlers(t *testing.T) {
 
 	for i, tt := range tests {
 		fr := registry.NewFakeRegistry()
-		hdlr := NewServeMux(fr, testTokenLimit)
+		hdlr := NewServeMux(fr, registry.NewFakeClusterRegistry(nil, 0), testTokenLimit, nil, time.Second, nil, nil)
 		rr := httptest.NewRecorder()
 
 		req, err := http.NewRequest(tt.method, tt.path, nil)
@@ -43,3 +43,12 @@ func isItemPath(base, p string) (item string, matched bool) {
 
 	return
 }
+
+// isSubResourcePath determines whether p addresses the named sub-resource of
+// an item in the base collection, e.g. /units/foo.service/revisions
+func isSubResourcePath(base, p, sub string) (item string, matched bool) {
+	if path.Base(p) != sub {
+		return
+	}
+	return isItemPath(base, path.Dir(p))
+}
@@ -93,3 +93,24 @@ func TestIsItemPathFail(t *testing.T) {
 		}
 	}
 }
+
+func TestIsSubResourcePath(t *testing.T) {
+	tests := []struct {
+		arg  string
+		item string
+		ok   bool
+	}{
+		{"/v1/units/foo.service/revisions", "foo.service", true},
+		{"/v1/units/foo.service/revisions/", "", false},
+		{"/v1/units/foo.service/bar", "", false},
+		{"/v1/units/revisions", "", false},
+		{"/v1/units/foo/bar/revisions", "", false},
+	}
+
+	for i, tt := range tests {
+		item, ok := isSubResourcePath("/v1/units", tt.arg, "revisions")
+		if ok != tt.ok || item != tt.item {
+			t.Errorf("case %d: expected (%q, %t), got (%q, %t)", i, tt.item, tt.ok, item, ok)
+		}
+	}
+}
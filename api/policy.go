@@ -0,0 +1,199 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Verbs authorized by a Policy.
+const (
+	VerbGet       = "get"
+	VerbList      = "list"
+	VerbWatch     = "watch"
+	VerbSet       = "set"
+	VerbDestroy   = "destroy"
+	VerbPatch     = "patch"
+	VerbRebalance = "rebalance"
+	VerbAudit     = "audit"
+)
+
+var policyVerbs = []string{VerbGet, VerbList, VerbWatch, VerbSet, VerbDestroy, VerbPatch, VerbRebalance, VerbAudit}
+
+// Policy grants roles to users. Each role is a set of rules allowing some
+// verbs, possibly on some units only.
+type Policy struct {
+	Roles map[string][]PolicyRule `json:"roles"`
+	// Users maps users to the names of their roles. The roles of the
+	// "*" user are granted to all users.
+	Users map[string][]string `json:"users"`
+}
+
+// PolicyRule allows Verbs, or all of them if it holds "*". If Units holds
+// any glob patterns, the rule only applies to requests concerning a unit
+// whose name matches one of them.
+type PolicyRule struct {
+	Verbs []string `json:"verbs"`
+	Units []string `json:"units,omitempty"`
+}
+
+// LoadPolicy reads a Policy from a JSON file.
+func LoadPolicy(file string) (*Policy, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p Policy
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+	return &p, nil
+}
+
+// Validate checks that the Policy only refers to known verbs and roles, and
+// holds valid patterns.
+func (p *Policy) Validate() error {
+	for name, rules := range p.Roles {
+		for _, r := range rules {
+			for _, v := range r.Verbs {
+				if v != "*" && !isPolicyVerb(v) {
+					return fmt.Errorf("role %q: unknown verb %q, expected one of %s", name, v, strings.Join(policyVerbs, ", "))
+				}
+			}
+			for _, u := range r.Units {
+				if _, err := path.Match(u, ""); err != nil {
+					return fmt.Errorf("role %q: invalid unit pattern %q: %v", name, u, err)
+				}
+			}
+		}
+	}
+	for user, roles := range p.Users {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("user %q: unknown role %q", user, role)
+			}
+		}
+	}
+	return nil
+}
+
+func isPolicyVerb(verb string) bool {
+	for _, v := range policyVerbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the user may apply verb to the named unit, or to
+// anything else if unit is empty.
+func (p *Policy) Allows(user, verb, unit string) bool {
+	for _, u := range []string{user, "*"} {
+		for _, role := range p.Users[u] {
+			for _, r := range p.Roles[role] {
+				if r.allows(verb, unit) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) allows(verb, unit string) bool {
+	verbOK := false
+	for _, v := range r.Verbs {
+		if v == "*" || v == verb {
+			verbOK = true
+			break
+		}
+	}
+	if !verbOK {
+		return false
+	}
+
+	if len(r.Units) == 0 {
+		return true
+	}
+	if unit == "" {
+		return false
+	}
+	for _, pattern := range r.Units {
+		if ok, _ := path.Match(pattern, unit); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requestVerb determines the verb of an API request, and the name of the
+// unit it concerns, if any.
+func requestVerb(req *http.Request) (verb, unit string) {
+	switch req.Method {
+	case "GET", "HEAD":
+		verb = VerbGet
+	case "PUT", "POST":
+		verb = VerbSet
+	case "DELETE":
+		verb = VerbDestroy
+	case "PATCH":
+		verb = VerbPatch
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+
+	// strip the version prefix of the API
+	p := req.URL.Path
+	for _, prefix := range []string{"/fleet/v1/", "/v1-alpha/"} {
+		if strings.HasPrefix(p, prefix) {
+			p = strings.TrimPrefix(p, prefix)
+			break
+		}
+	}
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+
+	switch parts[0] {
+	case "units", "state":
+		if len(parts) == 1 {
+			if verb == VerbGet {
+				verb = VerbList
+			}
+		} else {
+			unit = parts[1]
+		}
+	case "machines":
+		if verb == VerbGet {
+			verb = VerbList
+		}
+	case "events":
+		verb = VerbWatch
+	case "rebalance":
+		verb = VerbRebalance
+	case "audit":
+		verb = VerbAudit
+	}
+	return
+}
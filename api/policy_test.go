@@ -0,0 +1,120 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestRequestVerb(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		path   string
+		verb   string
+		unit   string
+	}{
+		{"GET", "/fleet/v1/units", VerbList, ""},
+		{"GET", "/fleet/v1/units/foo.service", VerbGet, "foo.service"},
+		{"GET", "/fleet/v1/units/foo.service/revisions", VerbGet, "foo.service"},
+		{"PUT", "/fleet/v1/units/foo.service", VerbSet, "foo.service"},
+		{"DELETE", "/v1-alpha/units/foo.service", VerbDestroy, "foo.service"},
+		{"GET", "/fleet/v1/state", VerbList, ""},
+		{"GET", "/fleet/v1/state/foo.service", VerbGet, "foo.service"},
+		{"GET", "/fleet/v1/machines", VerbList, ""},
+		{"PATCH", "/fleet/v1/machines", VerbPatch, ""},
+		{"GET", "/fleet/v1/events", VerbWatch, ""},
+		{"POST", "/fleet/v1/rebalance", VerbRebalance, ""},
+		{"GET", "/fleet/v1/audit", VerbAudit, ""},
+		{"GET", "/fleet/v1/discovery.json", VerbGet, ""},
+		{"GET", "/metrics", VerbGet, ""},
+	} {
+		req, err := http.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+		if err != nil {
+			t.Fatalf("failed creating request: %v", err)
+		}
+		verb, unit := requestVerb(req)
+		if verb != tt.verb || unit != tt.unit {
+			t.Errorf("%s %s: expected (%s, %q), got (%s, %q)", tt.method, tt.path, tt.verb, tt.unit, verb, unit)
+		}
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	p := &Policy{
+		Roles: map[string][]PolicyRule{
+			"deployer": {
+				{Verbs: []string{VerbSet, VerbDestroy}, Units: []string{"web@*", "cache.service"}},
+				{Verbs: []string{VerbGet}},
+			},
+			"viewer": {{Verbs: []string{VerbGet, VerbList}}},
+		},
+		Users: map[string][]string{
+			"bob": {"deployer"},
+			"*":   {"viewer"},
+		},
+	}
+	for _, tt := range []struct {
+		user, verb, unit string
+		allowed          bool
+	}{
+		{"bob", VerbSet, "web@1.service", true},
+		{"bob", VerbDestroy, "cache.service", true},
+		{"bob", VerbSet, "db.service", false},
+		// rules restricted to units do not apply to other requests
+		{"bob", VerbPatch, "", false},
+		{"bob", VerbGet, "db.service", true},
+		// everyone is a viewer
+		{"bob", VerbList, "", true},
+		{"carol", VerbList, "", true},
+		{"carol", VerbSet, "web@1.service", false},
+	} {
+		if got := p.Allows(tt.user, tt.verb, tt.unit); got != tt.allowed {
+			t.Errorf("%s %s %q: expected %t, got %t", tt.user, tt.verb, tt.unit, tt.allowed, got)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	f, err := ioutil.TempFile("", "fleet-policy")
+	if err != nil {
+		t.Fatalf("Failed creating tempfile: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	for i, tt := range []struct {
+		content string
+		valid   bool
+	}{
+		{`{"roles": {"admin": [{"verbs": ["*"]}]}, "users": {"alice": ["admin"]}}`, true},
+		{`{"roles": {"web": [{"verbs": ["set"], "units": ["web@*"]}]}, "users": {"*": ["web"]}}`, true},
+		{`{"roles": {"admin": [{"verbs": ["nuke"]}]}}`, false},
+		{`{"roles": {"web": [{"verbs": ["set"], "units": ["[web"]}]}}`, false},
+		{`{"roles": {}, "users": {"alice": ["admin"]}}`, false},
+		{`{"roles": `, false},
+	} {
+		if err := ioutil.WriteFile(f.Name(), []byte(tt.content), 0600); err != nil {
+			t.Fatalf("Failed writing policy: %v", err)
+		}
+		_, err := LoadPolicy(f.Name())
+		if tt.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
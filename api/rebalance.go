@@ -0,0 +1,49 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/registry"
+)
+
+func wireUpRebalanceResource(mux *http.ServeMux, prefix string, cReg registry.ClusterRegistry) {
+	res := path.Join(prefix, "rebalance")
+	rr := rebalanceResource{cReg}
+	mux.Handle(res, &rr)
+}
+
+type rebalanceResource struct {
+	cReg registry.ClusterRegistry
+}
+
+func (rr *rebalanceResource) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		sendError(rw, http.StatusMethodNotAllowed, errors.New("only POST supported against this resource"))
+		return
+	}
+
+	if err := rr.cReg.RequestRebalance(); err != nil {
+		log.Errorf("Failed requesting rebalance: %v", err)
+		sendError(rw, http.StatusInternalServerError, nil)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
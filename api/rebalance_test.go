@@ -0,0 +1,59 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/fleet/registry"
+)
+
+func TestRebalanceRequest(t *testing.T) {
+	tests := []struct {
+		method    string
+		code      int
+		requested bool
+	}{
+		{"POST", http.StatusAccepted, true},
+		{"GET", http.StatusMethodNotAllowed, false},
+		{"PUT", http.StatusMethodNotAllowed, false},
+	}
+
+	for i, tt := range tests {
+		fcr := registry.NewFakeClusterRegistry(nil, 0)
+		resource := &rebalanceResource{cReg: fcr}
+		rw := httptest.NewRecorder()
+
+		req, err := http.NewRequest(tt.method, "http://example.com/fleet/v1/rebalance", nil)
+		if err != nil {
+			t.Fatalf("case %d: failed creating http.Request: %v", i, err)
+		}
+
+		resource.ServeHTTP(rw, req)
+		if rw.Code != tt.code {
+			t.Errorf("case %d: expected %d, got %d", i, tt.code, rw.Code)
+		}
+
+		requested, err := fcr.TakeRebalanceRequest()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if requested != tt.requested {
+			t.Errorf("case %d: expected rebalance requested=%t, got %t", i, tt.requested, requested)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package api
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
 	"net/http"
@@ -36,6 +37,9 @@ type Server struct {
 	listeners []net.Listener
 	api       http.Handler
 	cur       http.Handler
+
+	// TLS, if set, secures the listeners other than unix sockets.
+	TLS *tls.Config
 }
 
 func (s *Server) GetListeners() []net.Listener {
@@ -49,6 +53,11 @@ func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 func (s *Server) Serve() {
 	for i, _ := range s.listeners {
 		l := s.listeners[i]
+		if s.TLS != nil && l.Addr().Network() != "unix" {
+			// keep the listeners plain, as they are reused
+			// by the next Server on reconfiguration
+			l = tls.NewListener(l, s.TLS)
+		}
 		go func() {
 			err := http.Serve(l, s)
 			if err != nil {
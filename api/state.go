@@ -69,17 +69,16 @@ func (sr *stateResource) list(rw http.ResponseWriter, req *http.Request) {
 		token = &def
 	}
 
-	var machineID, unitName string
-	for _, val := range req.URL.Query()["machineID"] {
-		machineID = val
-		break
+	opts, err := client.ParseListOptions(req.URL.Query(), client.ListParamUnitName)
+	if err == nil {
+		err = client.ValidateUnitStateListOptions(opts)
 	}
-	for _, val := range req.URL.Query()["unitName"] {
-		unitName = val
-		break
+	if err != nil {
+		sendError(rw, http.StatusBadRequest, err)
+		return
 	}
 
-	page, err := getUnitStatePage(sr.cAPI, machineID, unitName, *token)
+	page, err := getUnitStatePage(sr.cAPI, opts, *token)
 	if err != nil {
 		log.Errorf("Failed fetching page of UnitStates: %v", err)
 		sendError(rw, http.StatusInternalServerError, nil)
@@ -105,23 +104,13 @@ func (sr *stateResource) get(rw http.ResponseWriter, req *http.Request, item str
 	sendResponse(rw, http.StatusOK, *us)
 }
 
-func getUnitStatePage(cAPI client.API, machineID, unitName string, tok PageToken) (*schema.UnitStatePage, error) {
-	states, err := cAPI.UnitStates()
+func getUnitStatePage(cAPI client.API, opts client.ListOptions, tok PageToken) (*schema.UnitStatePage, error) {
+	states, err := cAPI.ListUnitStates(opts)
 	if err != nil {
 		return nil, err
 	}
-	var filtered []*schema.UnitState
-	for _, us := range states {
-		if machineID != "" && machineID != us.MachineID {
-			continue
-		}
-		if unitName != "" && unitName != us.Name {
-			continue
-		}
-		filtered = append(filtered, us)
-	}
 
-	items, next := extractUnitStatePageData(filtered, tok)
+	items, next := extractUnitStatePageData(states, tok)
 	page := schema.UnitStatePage{
 		States: items,
 	}
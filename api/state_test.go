@@ -16,13 +16,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/schema"
 	"github.com/coreos/fleet/unit"
@@ -77,9 +81,53 @@ func TestUnitStateList(t *testing.T) {
 			"http://example.com/state?unitName=CCC&machineID=XXX",
 			[]*schema.UnitState{sus3},
 		},
+		{
+			// Unit names match exactly
+			"http://example.com/state?unitName=C*",
+			nil,
+		},
+		{
+			// Unit name patterns may be globs
+			"http://example.com/state?unitNamePattern=C*",
+			[]*schema.UnitState{sus3, sus4},
+		},
+		{
+			// Exact names and patterns are combined
+			"http://example.com/state?unitName=AAA&unitNamePattern=C*",
+			[]*schema.UnitState{sus1, sus3, sus4},
+		},
+		{
+			// Machine ID patterns may be globs
+			"http://example.com/state?machineIDPattern=Y*",
+			[]*schema.UnitState{sus4},
+		},
+		{
+			// Any of several unit names may match
+			"http://example.com/state?unitName=AAA,BBB",
+			[]*schema.UnitState{sus1, sus2},
+		},
+		{
+			// Query for machine metadata selects the units on matching machines
+			"http://example.com/state?metadata=region=east",
+			[]*schema.UnitState{sus2, sus3},
+		},
+		{
+			// Sort by descending name, then machine ID
+			"http://example.com/state?sort=-name,machineID",
+			[]*schema.UnitState{sus3, sus4, sus2, sus1},
+		},
+		{
+			// Sort by active state, then descending machine ID
+			"http://example.com/state?sort=activeState&sort=-machineID",
+			[]*schema.UnitState{sus3, sus1, sus4, sus2},
+		},
 	} {
 		fr := registry.NewFakeRegistry()
 		fr.SetUnitStates([]unit.UnitState{us1, us2, us3, us4})
+		fr.SetMachines([]machine.MachineState{
+			{ID: "XXX", Metadata: map[string]string{"region": "east"}},
+			{ID: "YYY", Metadata: map[string]string{"region": "west"}},
+		})
 		fAPI := &client.RegistryClient{Registry: fr}
 		resource := &stateResource{fAPI, "/state", testTokenLimit}
 		rw := httptest.NewRecorder()
@@ -243,3 +291,66 @@ func TestExtractUnitStatePage(t *testing.T) {
 		}
 	}
 }
+
+func TestUnitStateListBadSelector(t *testing.T) {
+	for _, url := range []string{
+		"http://example.com/state?sort=bogus",
+		"http://example.com/state?unitNamePattern=[",
+		"http://example.com/state?metadata=region=",
+	} {
+		fr := registry.NewFakeRegistry()
+		fAPI := &client.RegistryClient{Registry: fr}
+		resource := &stateResource{fAPI, "/state", testTokenLimit}
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Failed creating http.Request: %v", err)
+		}
+
+		resource.list(rw, req)
+
+		if err := assertErrorResponse(rw, http.StatusBadRequest); err != nil {
+			t.Errorf("%s: %v", url, err)
+		}
+	}
+}
+
+func TestUnitStateListOverHTTP(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	var states []unit.UnitState
+	for i := 0; i < 5; i++ {
+		states = append(states,
+			unit.UnitState{UnitName: fmt.Sprintf("web@%d.service", i), ActiveState: "active", MachineID: "XXX"},
+			unit.UnitState{UnitName: fmt.Sprintf("db@%d.service", i), ActiveState: "active", MachineID: "YYY"},
+		)
+	}
+	fr.SetUnitStates(states)
+
+	// a small page size makes the client send its selectors along with
+	// every page token
+	srv := httptest.NewServer(NewServeMux(fr, registry.NewFakeClusterRegistry(nil, 0), 2, nil, time.Second, nil, nil))
+	defer srv.Close()
+
+	ep, _ := url.Parse(srv.URL)
+	cAPI, err := client.NewHTTPClient(http.DefaultClient, *ep)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := cAPI.ListUnitStates(client.ListOptions{Names: []string{"web@*"}, Sort: []string{"-name"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, us := range got {
+		names = append(names, us.Name)
+	}
+	expected := []string{"web@4.service", "web@3.service", "web@2.service", "web@1.service", "web@0.service"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	if _, err := cAPI.ListUnitStates(client.ListOptions{Sort: []string{"bogus"}}); err == nil {
+		t.Errorf("expected error sorting by unknown field")
+	}
+}
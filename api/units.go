@@ -22,6 +22,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/log"
@@ -32,9 +33,9 @@ import (
 	gsunit "github.com/coreos/go-systemd/unit"
 )
 
-func wireUpUnitsResource(mux *http.ServeMux, prefix string, tokenLimit int, cAPI client.API) {
+func wireUpUnitsResource(mux *http.ServeMux, prefix string, tokenLimit int, cAPI client.API, auditSink audit.Sink) {
 	base := path.Join(prefix, "units")
-	ur := unitsResource{cAPI, base, uint16(tokenLimit)}
+	ur := unitsResource{cAPI, base, uint16(tokenLimit), auditSink}
 	mux.Handle(base, &ur)
 	mux.Handle(base+"/", &ur)
 }
@@ -43,6 +44,8 @@ type unitsResource struct {
 	cAPI       client.API
 	basePath   string
 	tokenLimit uint16
+	// audit records the changes made to units, if not nil
+	audit audit.Sink
 }
 
 func (ur *unitsResource) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -64,6 +67,13 @@ func (ur *unitsResource) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		default:
 			sendError(rw, http.StatusMethodNotAllowed, errors.New("only GET, PUT and DELETE supported against this resource"))
 		}
+	} else if item, ok := isSubResourcePath(ur.basePath, req.URL.Path, "revisions"); ok {
+		switch req.Method {
+		case "GET":
+			ur.revisions(rw, req, item)
+		default:
+			sendError(rw, http.StatusMethodNotAllowed, errors.New("only GET supported against this resource"))
+		}
 	} else {
 		sendError(rw, http.StatusNotFound, nil)
 	}
@@ -94,6 +104,7 @@ func (ur *unitsResource) set(rw http.ResponseWriter, req *http.Request, item str
 		return
 	}
 
+	ur = ur.asUser(req)
 	eu, err := ur.cAPI.Unit(su.Name)
 	if err != nil {
 		log.Errorf("Failed fetching Unit(%s) from Registry: %v", su.Name, err)
@@ -102,6 +113,7 @@ func (ur *unitsResource) set(rw http.ResponseWriter, req *http.Request, item str
 	}
 
 	newUnit := false
+	newContent := false
 	if eu == nil {
 		if len(su.Options) == 0 {
 			err := errors.New("unit does not exist and options field empty")
@@ -117,36 +129,57 @@ func (ur *unitsResource) set(rw http.ResponseWriter, req *http.Request, item str
 	} else if eu.Name == su.Name && len(su.Options) > 0 {
 		// There is already a unit with the same name that
 		// was submitted before. Check their hashes, if they do
-		// not match then this is probably a new version which
-		// needs its own new unit entry.
+		// not match then this is a new version of the unit
+		// whose content is swapped in place.
 		// In the other case if su.Options == 0 then probably we
 		// don't want to update the Unit options nor its content
 		// but only set the target job state of the
 		// corresponding unit, in this case just ignore.
 		a := schema.MapSchemaUnitOptionsToUnitFile(su.Options)
 		b := schema.MapSchemaUnitOptionsToUnitFile(eu.Options)
-		newUnit = !unit.MatchUnitFiles(a, b)
+		newContent = !unit.MatchUnitFiles(a, b)
 	}
 
+	rec := newAuditRecord(req, "")
+	rec.UnitName = su.Name
 	if newUnit {
-		ur.create(rw, su.Name, &su)
+		rec.Action = audit.ActionCreate
+		rec.NewState = su.DesiredState
+		ur.create(rw, su.Name, &su, rec)
 		return
 	}
+	rec.OldState = eu.DesiredState
 
-	if len(su.DesiredState) == 0 {
+	if len(su.DesiredState) == 0 && !newContent {
 		err := errors.New("must provide DesiredState to update existing unit")
 		sendError(rw, http.StatusConflict, err)
 		return
 	}
 
 	un := unit.NewUnitNameInfo(su.Name)
-	if un.IsTemplate() && job.JobState(su.DesiredState) != job.JobStateInactive {
+	if un.IsTemplate() && len(su.DesiredState) != 0 && job.JobState(su.DesiredState) != job.JobStateInactive {
 		err := fmt.Errorf("cannot activate template %q", su.Name)
 		sendError(rw, http.StatusBadRequest, err)
 		return
 	}
 
-	ur.update(rw, su.Name, su.DesiredState)
+	if newContent {
+		if err := ValidateOptions(su.Options); err != nil {
+			sendError(rw, http.StatusBadRequest, err)
+			return
+		}
+		rec.Action = audit.ActionReplace
+		rec.NewState = eu.DesiredState
+		if su.DesiredState != "" {
+			rec.NewState = su.DesiredState
+		}
+		ur.replace(rw, &su, rec)
+		return
+	}
+
+	rec.Action = audit.ActionSetTargetState
+	rec.NewState = su.DesiredState
+	ur.update(rw, su.Name, su.DesiredState, rec)
 }
 
 const (
@@ -234,6 +267,25 @@ func ValidateOptions(opts []*schema.UnitOption) error {
 	j := &job.Job{
 		Unit: *uf,
 	}
+	res, err := j.Resources()
+	if err != nil {
+		return fmt.Errorf("invalid Resources: %v", err)
+	}
+	if _, err := j.MaxSkew(); err != nil {
+		return err
+	}
+	if _, err := j.MaxFailuresPerMachine(); err != nil {
+		return err
+	}
+	if _, err := j.Backoff(); err != nil {
+		return err
+	}
+	if _, err := j.HealthCheck(); err != nil {
+		return err
+	}
+	if err := j.ValidateMetadata(); err != nil {
+		return err
+	}
 	conflicts := pkg.NewUnsafeSet(j.Conflicts()...)
 	replaces := pkg.NewUnsafeSet(j.Replaces()...)
 	peers := pkg.NewUnsafeSet(j.Peers()...)
@@ -254,7 +306,13 @@ func ValidateOptions(opts []*schema.UnitOption) error {
 	hasPeers := peers.Length() != 0
 	hasConflicts := conflicts.Length() != 0
 	hasReplaces := replaces.Length() != 0
+	hasResources := !res.Empty()
+	_, hasSpreadBy := j.SpreadBy()
+	hasMaxSkew := j.HasRequirement("MaxSkew")
+	hasPreferences := len(j.PreferredTargetMetadata()) != 0 || len(j.PreferredPeers()) != 0
 	_, hasReqTarget := j.RequiredTarget()
+	hasRescheduleOnFailure := j.RescheduleOnFailure()
+	hasFailureBudget := j.HasRequirement("MaxFailuresPerMachine") || j.HasRequirement("Backoff")
 	u := &job.Unit{
 		Unit: *uf,
 	}
@@ -273,15 +331,33 @@ func ValidateOptions(opts []*schema.UnitOption) error {
 		return errors.New("Global cannot be used with Peers")
 	case isGlobal && hasReplaces:
 		return errors.New("Global cannot be used with Replaces")
+	case isGlobal && hasResources:
+		return errors.New("Global cannot be used with Resources")
+	case hasReqTarget && hasSpreadBy:
+		return errors.New("MachineID cannot be used with SpreadBy")
+	case isGlobal && hasSpreadBy:
+		return errors.New("Global cannot be used with SpreadBy")
+	case isGlobal && hasPreferences:
+		return errors.New("Global cannot be used with PreferMachineMetadata or PreferMachineOf")
+	case hasMaxSkew && !hasSpreadBy:
+		return errors.New("MaxSkew cannot be used without SpreadBy")
 	case hasConflicts && hasReplaces:
 		return errors.New("Conflicts cannot be used with Replaces")
+	case hasReqTarget && hasRescheduleOnFailure:
+		return errors.New("MachineID cannot be used with RescheduleOnFailure")
+	case isGlobal && hasRescheduleOnFailure:
+		return errors.New("Global cannot be used with RescheduleOnFailure")
+	case hasFailureBudget && !hasRescheduleOnFailure:
+		return errors.New("MaxFailuresPerMachine and Backoff cannot be used without RescheduleOnFailure")
 	}
 
 	return nil
 }
 
-func (ur *unitsResource) create(rw http.ResponseWriter, name string, u *schema.Unit) {
-	if err := ur.cAPI.CreateUnit(u); err != nil {
+func (ur *unitsResource) create(rw http.ResponseWriter, name string, u *schema.Unit, rec audit.Record) {
+	err := ur.cAPI.CreateUnit(u)
+	writeAuditRecord(ur.audit, rec, err)
+	if err != nil {
 		log.Errorf("Failed creating Unit(%s) in Registry: %v", u.Name, err)
 		sendError(rw, http.StatusInternalServerError, nil)
 		return
@@ -290,8 +366,40 @@ func (ur *unitsResource) create(rw http.ResponseWriter, name string, u *schema.U
 	rw.WriteHeader(http.StatusCreated)
 }
 
-func (ur *unitsResource) update(rw http.ResponseWriter, item, ds string) {
-	if err := ur.cAPI.SetUnitTargetState(item, ds); err != nil {
+// asUser returns a copy of ur whose changes are attributed to the user named
+// in the UserHeader of the request, if any.
+func (ur *unitsResource) asUser(req *http.Request) *unitsResource {
+	user := req.Header.Get(client.UserHeader)
+	rc, ok := ur.cAPI.(*client.RegistryClient)
+	if user == "" || !ok {
+		return ur
+	}
+
+	urc := *rc
+	urc.User = user
+	cp := *ur
+	cp.cAPI = &urc
+	return &cp
+}
+
+// replace swaps the content of an existing unit, keeping its schedule. The
+// desired state is only changed if one was given.
+func (ur *unitsResource) replace(rw http.ResponseWriter, u *schema.Unit, rec audit.Record) {
+	err := ur.cAPI.UpdateUnit(u)
+	writeAuditRecord(ur.audit, rec, err)
+	if err != nil {
+		log.Errorf("Failed updating Unit(%s) in Registry: %v", u.Name, err)
+		sendError(rw, http.StatusInternalServerError, nil)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (ur *unitsResource) update(rw http.ResponseWriter, item, ds string, rec audit.Record) {
+	err := ur.cAPI.SetUnitTargetState(item, ds)
+	writeAuditRecord(ur.audit, rec, err)
+	if err != nil {
 		log.Errorf("Failed setting target state of Unit(%s): %v", item, err)
 		sendError(rw, http.StatusInternalServerError, nil)
 		return
@@ -314,6 +422,10 @@ func (ur *unitsResource) destroy(rw http.ResponseWriter, req *http.Request, item
 	}
 
 	err = ur.cAPI.DestroyUnit(item)
+	rec := newAuditRecord(req, audit.ActionDestroy)
+	rec.UnitName = item
+	rec.OldState = u.DesiredState
+	writeAuditRecord(ur.audit, rec, err)
 	if err != nil {
 		log.Errorf("Failed destroying Unit(%s): %v", item, err)
 		sendError(rw, http.StatusInternalServerError, nil)
@@ -339,6 +451,17 @@ func (ur *unitsResource) get(rw http.ResponseWriter, req *http.Request, item str
 	sendResponse(rw, http.StatusOK, *u)
 }
 
+func (ur *unitsResource) revisions(rw http.ResponseWriter, req *http.Request, item string) {
+	revs, err := ur.cAPI.UnitRevisions(item)
+	if err != nil {
+		log.Errorf("Failed fetching revisions of Unit(%s) from Registry: %v", item, err)
+		sendError(rw, http.StatusInternalServerError, nil)
+		return
+	}
+
+	sendResponse(rw, http.StatusOK, schema.UnitRevisionPage{Revisions: revs})
+}
+
 func (ur *unitsResource) list(rw http.ResponseWriter, req *http.Request) {
 	token, err := findNextPageToken(req.URL, ur.tokenLimit)
 	if err != nil {
@@ -351,7 +474,16 @@ func (ur *unitsResource) list(rw http.ResponseWriter, req *http.Request) {
 		token = &def
 	}
 
-	page, err := getUnitPage(ur.cAPI, *token)
+	opts, err := client.ParseListOptions(req.URL.Query(), client.ListParamName)
+	if err == nil {
+		err = client.ValidateUnitListOptions(opts)
+	}
+	if err != nil {
+		sendError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := getUnitPage(ur.cAPI, opts, *token)
 	if err != nil {
 		log.Errorf("Failed fetching page of Units: %v", err)
 		sendError(rw, http.StatusInternalServerError, nil)
@@ -361,8 +493,8 @@ func (ur *unitsResource) list(rw http.ResponseWriter, req *http.Request) {
 	sendResponse(rw, http.StatusOK, page)
 }
 
-func getUnitPage(cAPI client.API, tok PageToken) (*schema.UnitPage, error) {
-	units, err := cAPI.Units()
+func getUnitPage(cAPI client.API, opts client.ListOptions, tok PageToken) (*schema.UnitPage, error) {
+	units, err := cAPI.ListUnits(opts)
 	if err != nil {
 		return nil, err
 	}
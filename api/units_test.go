@@ -27,6 +27,7 @@ import (
 
 	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/schema"
 	"github.com/coreos/fleet/unit"
@@ -43,7 +44,7 @@ func newUnit(t *testing.T, str string) unit.UnitFile {
 func TestUnitsSubResourceNotFound(t *testing.T) {
 	fr := registry.NewFakeRegistry()
 	fAPI := &client.RegistryClient{Registry: fr}
-	ur := &unitsResource{fAPI, "/units", testTokenLimit}
+	ur := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 	rr := httptest.NewRecorder()
 
 	req, err := http.NewRequest("GET", "/units/foo/bar", nil)
@@ -66,7 +67,7 @@ func TestUnitsList(t *testing.T) {
 		{Name: "YYY.service"},
 	})
 	fAPI := &client.RegistryClient{Registry: fr}
-	resource := &unitsResource{fAPI, "/units", testTokenLimit}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 	rw := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "http://example.com/units", nil)
 	if err != nil {
@@ -100,10 +101,63 @@ func TestUnitsList(t *testing.T) {
 	}
 }
 
+func TestUnitsListSelectors(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetJobs([]job.Job{
+		{Name: "web@1.service", TargetState: job.JobStateLaunched, TargetMachineID: "XXX"},
+		{Name: "web@2.service", TargetState: job.JobStateInactive},
+		{Name: "db.service", TargetState: job.JobStateLaunched, TargetMachineID: "YYY"},
+	})
+	fr.SetMachines([]machine.MachineState{
+		{ID: "XXX", Metadata: map[string]string{"disk": "hdd"}},
+		{ID: "YYY", Metadata: map[string]string{"disk": "ssd"}},
+	})
+	fAPI := &client.RegistryClient{Registry: fr}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
+
+	for _, tt := range []struct {
+		query    string
+		expected []string
+	}{
+		{"name=web@*", nil},
+		{"name=web@1.service,db.service&sort=name", []string{"db.service", "web@1.service"}},
+		{"namePattern=web@*", []string{"web@1.service", "web@2.service"}},
+		{"namePattern=web@*&targetState=launched", []string{"web@1.service"}},
+		{"targetState=launched&sort=-name", []string{"web@1.service", "db.service"}},
+		{"metadata=disk=ssd", []string{"db.service"}},
+		{"machineID=XXX,YYY&sort=-machineID", []string{"db.service", "web@1.service"}},
+		{"sort=targetState,name", []string{"web@2.service", "db.service", "web@1.service"}},
+	} {
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "http://example.com/units?"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("Failed creating http.Request: %v", err)
+		}
+
+		resource.list(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", tt.query, rw.Code)
+			continue
+		}
+
+		var page schema.UnitPage
+		if err := json.Unmarshal(rw.Body.Bytes(), &page); err != nil {
+			t.Fatalf("%s: received unparseable body: %v", tt.query, err)
+		}
+		var names []string
+		for _, u := range page.Units {
+			names = append(names, u.Name)
+		}
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("%s: expected units %v, got %v", tt.query, tt.expected, names)
+		}
+	}
+}
+
 func TestUnitsListBadNextPageToken(t *testing.T) {
 	fr := registry.NewFakeRegistry()
 	fAPI := &client.RegistryClient{Registry: fr}
-	resource := &unitsResource{fAPI, "/units", testTokenLimit}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 	rw := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "http://example.com/units?nextPageToken=EwBMLg==", nil)
 	if err != nil {
@@ -184,7 +238,7 @@ func TestUnitGet(t *testing.T) {
 		{Name: "YYY.service"},
 	})
 	fAPI := &client.RegistryClient{Registry: fr}
-	resource := &unitsResource{fAPI, "/units", testTokenLimit}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 
 	for i, tt := range tests {
 		rw := httptest.NewRecorder()
@@ -247,7 +301,7 @@ func TestUnitsDestroy(t *testing.T) {
 		}
 
 		fAPI := &client.RegistryClient{Registry: fr}
-		resource := &unitsResource{fAPI, "/units", testTokenLimit}
+		resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 		rw := httptest.NewRecorder()
 		resource.destroy(rw, req, tt.arg)
 
@@ -388,6 +442,46 @@ func TestUnitsSetDesiredState(t *testing.T) {
 				"XXX@.service": "inactive",
 			},
 		},
+		// Changing the content of an existing Unit keeps its desired state
+		{
+			initJobs:   []job.Job{job.Job{Name: "XXX.service", Unit: newUnit(t, "[Service]\nFoo=Bar")}},
+			initStates: map[string]job.JobState{"XXX.service": "launched"},
+			item:       "XXX.service",
+			arg: schema.Unit{
+				Options: []*schema.UnitOption{
+					&schema.UnitOption{Section: "Service", Name: "Foo", Value: "Baz"},
+				},
+			},
+			code:        http.StatusNoContent,
+			finalStates: map[string]job.JobState{"XXX.service": "launched"},
+		},
+		// Changing the content and desired state of an existing Unit at once
+		{
+			initJobs:   []job.Job{job.Job{Name: "XXX.service", Unit: newUnit(t, "[Service]\nFoo=Bar")}},
+			initStates: map[string]job.JobState{"XXX.service": "launched"},
+			item:       "XXX.service",
+			arg: schema.Unit{
+				DesiredState: "loaded",
+				Options: []*schema.UnitOption{
+					&schema.UnitOption{Section: "Service", Name: "Foo", Value: "Baz"},
+				},
+			},
+			code:        http.StatusNoContent,
+			finalStates: map[string]job.JobState{"XXX.service": "loaded"},
+		},
+		// New content of an existing Unit must be valid
+		{
+			initJobs:   []job.Job{job.Job{Name: "XXX.service", Unit: newUnit(t, "[Service]\nFoo=Bar")}},
+			initStates: map[string]job.JobState{"XXX.service": "launched"},
+			item:       "XXX.service",
+			arg: schema.Unit{
+				Options: []*schema.UnitOption{
+					&schema.UnitOption{Section: "X-Fleet", Name: "MaxSkew", Value: "1"},
+				},
+			},
+			code:        http.StatusBadRequest,
+			finalStates: map[string]job.JobState{"XXX.service": "launched"},
+		},
 	}
 
 	for i, tt := range tests {
@@ -415,7 +509,7 @@ func TestUnitsSetDesiredState(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		fAPI := &client.RegistryClient{Registry: fr}
-		resource := &unitsResource{fAPI, "/units", testTokenLimit}
+		resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 		rw := httptest.NewRecorder()
 		resource.set(rw, req, tt.item)
 
@@ -446,6 +540,113 @@ func TestUnitsSetDesiredState(t *testing.T) {
 	}
 }
 
+func TestUnitsSetContentKeepsSchedule(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetJobs([]job.Job{
+		job.Job{Name: "XXX.service", Unit: newUnit(t, "[Service]\nFoo=Bar"), TargetMachineID: "YYY"},
+	})
+	fAPI := &client.RegistryClient{Registry: fr}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
+
+	want := newUnit(t, "[Service]\nFoo=Baz")
+	su := schema.Unit{Options: schema.MapUnitFileToSchemaUnitOptions(&want)}
+	enc, err := json.Marshal(su)
+	if err != nil {
+		t.Fatalf("unable to JSON-encode request: %v", err)
+	}
+	req, err := http.NewRequest("PUT", "http://example.com/units/XXX.service", bytes.NewBuffer(enc))
+	if err != nil {
+		t.Fatalf("failed creating http.Request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rw := httptest.NewRecorder()
+	resource.set(rw, req, "XXX.service")
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, rw.Code)
+	}
+
+	u, err := fr.Unit("XXX.service")
+	if err != nil || u == nil {
+		t.Fatalf("failed fetching Unit(XXX.service): %v", err)
+	}
+	if u.Unit.Hash() != want.Hash() {
+		t.Errorf("expected unit content %q, got %q", want.String(), u.Unit.String())
+	}
+
+	sched, err := fr.ScheduledUnit("XXX.service")
+	if err != nil || sched == nil {
+		t.Fatalf("failed fetching ScheduledUnit(XXX.service): %v", err)
+	}
+	if sched.TargetMachineID != "YYY" {
+		t.Errorf("expected Unit to stay scheduled to YYY, got %q", sched.TargetMachineID)
+	}
+}
+
+func TestUnitsRevisions(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fAPI := &client.RegistryClient{Registry: fr}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
+
+	for i, body := range []string{"[Service]\nFoo=Bar", "[Service]\nFoo=Baz"} {
+		uf := newUnit(t, body)
+		su := schema.Unit{Options: schema.MapUnitFileToSchemaUnitOptions(&uf)}
+		if i == 0 {
+			su.DesiredState = "loaded"
+		}
+		enc, err := json.Marshal(su)
+		if err != nil {
+			t.Fatalf("unable to JSON-encode request: %v", err)
+		}
+		req, err := http.NewRequest("PUT", "http://example.com/units/XXX.service", bytes.NewBuffer(enc))
+		if err != nil {
+			t.Fatalf("failed creating http.Request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(client.UserHeader, fmt.Sprintf("user%d", i))
+		resource.set(httptest.NewRecorder(), req, "XXX.service")
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/units/XXX.service/revisions", nil)
+	if err != nil {
+		t.Fatalf("failed creating http.Request: %v", err)
+	}
+	rw := httptest.NewRecorder()
+	resource.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	var page schema.UnitRevisionPage
+	if err := json.NewDecoder(rw.Body).Decode(&page); err != nil {
+		t.Fatalf("failed decoding response body: %v", err)
+	}
+	if len(page.Revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(page.Revisions))
+	}
+	for i, rev := range page.Revisions {
+		if rev.Revision != i+1 {
+			t.Errorf("revision %d: got number %d", i, rev.Revision)
+		}
+		if want := fmt.Sprintf("user%d", i); rev.User != want {
+			t.Errorf("revision %d: expected user %q, got %q", i, want, rev.User)
+		}
+	}
+	if page.Revisions[1].Options[0].Value != "Baz" {
+		t.Errorf("expected latest revision to hold the latest content, got %v", page.Revisions[1].Options[0])
+	}
+
+	req, err = http.NewRequest("DELETE", "http://example.com/units/XXX.service/revisions", nil)
+	if err != nil {
+		t.Fatalf("failed creating http.Request: %v", err)
+	}
+	rw = httptest.NewRecorder()
+	resource.ServeHTTP(rw, req)
+	if err := assertErrorResponse(rw, http.StatusMethodNotAllowed); err != nil {
+		t.Error(err)
+	}
+}
+
 func makeConflictUO(name string) *schema.UnitOption {
 	return &schema.UnitOption{
 		Section: "X-Fleet",
@@ -478,6 +679,14 @@ func makeIDUO(name string) *schema.UnitOption {
 	}
 }
 
+func makeFleetUO(name, value string) *schema.UnitOption {
+	return &schema.UnitOption{
+		Section: "X-Fleet",
+		Name:    name,
+		Value:   value,
+	}
+}
+
 func TestValidateOptions(t *testing.T) {
 	testCases := []struct {
 		opts  []*schema.UnitOption
@@ -721,6 +930,235 @@ func TestValidateOptions(t *testing.T) {
 			},
 			false,
 		},
+		// Resources by itself is OK
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("Resources", "cores=50 memory=512M"),
+			},
+			true,
+		},
+		// malformed Resources no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("Resources", "cores=half"),
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("Resources", "gpus=1"),
+			},
+			false,
+		},
+		// Global with Resources no good
+		{
+			[]*schema.UnitOption{
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "Global",
+					Value:   "true",
+				},
+				makeFleetUO("Resources", "memory=1G"),
+			},
+			false,
+		},
+		// SpreadBy with or without MaxSkew is OK
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+			},
+			true,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+				makeFleetUO("MaxSkew", "2"),
+			},
+			true,
+		},
+		// MaxSkew must be a positive integer
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+				makeFleetUO("MaxSkew", "0"),
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+				makeFleetUO("MaxSkew", "one"),
+			},
+			false,
+		},
+		// MaxSkew without SpreadBy no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("MaxSkew", "1"),
+			},
+			false,
+		},
+		// SpreadBy with MachineID or Global no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+				makeIDUO("abcdefghi"),
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("SpreadBy", "rack"),
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "Global",
+					Value:   "true",
+				},
+			},
+			false,
+		},
+		// RescheduleOnFailure with a failure budget is OK
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("RescheduleOnFailure", "true"),
+				makeFleetUO("MaxFailuresPerMachine", "3"),
+				makeFleetUO("Backoff", "30s"),
+			},
+			true,
+		},
+		// invalid failure budget no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("RescheduleOnFailure", "true"),
+				makeFleetUO("MaxFailuresPerMachine", "0"),
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("RescheduleOnFailure", "true"),
+				makeFleetUO("Backoff", "soon"),
+			},
+			false,
+		},
+		// failure budget without RescheduleOnFailure no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("Backoff", "30s"),
+			},
+			false,
+		},
+		// RescheduleOnFailure with MachineID or Global no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("RescheduleOnFailure", "true"),
+				makeIDUO("abcdefghi"),
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("RescheduleOnFailure", "true"),
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "Global",
+					Value:   "true",
+				},
+			},
+			false,
+		},
+		// a single health check is OK
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("HealthCheckHTTP", "http://localhost:8080/healthz"),
+				makeFleetUO("HealthCheckInterval", "30s"),
+			},
+			true,
+		},
+		// several health checks no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("HealthCheckTCP", "localhost:5432"),
+				makeFleetUO("HealthCheckExec", "pg_isready"),
+			},
+			false,
+		},
+		// health check options without a check no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("HealthCheckInterval", "30s"),
+			},
+			false,
+		},
+		// metadata operators are OK
+		{
+			[]*schema.UnitOption{
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "MachineMetadata",
+					Value:   `"zone=us-east-*" "zone!=us-east-1a" "memory_gb>=32" "gpu" "!spot"`,
+				},
+			},
+			true,
+		},
+		// malformed metadata no good
+		{
+			[]*schema.UnitOption{
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "MachineMetadata",
+					Value:   "memory_gb>=lots",
+				},
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "MachineMetadata",
+					Value:   "=us-east-1",
+				},
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("PreferMachineMetadata", "disk!"),
+			},
+			false,
+		},
+		// preferences are OK on their own
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("PreferMachineMetadata", "disk=ssd"),
+				makeFleetUO("PreferMachineOf", "db.service"),
+			},
+			true,
+		},
+		// preferences with Global no good
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("PreferMachineMetadata", "disk=ssd"),
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "Global",
+					Value:   "true",
+				},
+			},
+			false,
+		},
+		{
+			[]*schema.UnitOption{
+				makeFleetUO("PreferMachineOf", "db.service"),
+				&schema.UnitOption{
+					Section: "X-Fleet",
+					Name:    "Global",
+					Value:   "true",
+				},
+			},
+			false,
+		},
 	}
 	for i, tt := range testCases {
 		err := ValidateOptions(tt.opts)
@@ -805,7 +1243,7 @@ func TestValidateName(t *testing.T) {
 func TestUnitsSetDesiredStateBadContentType(t *testing.T) {
 	fr := registry.NewFakeRegistry()
 	fAPI := &client.RegistryClient{Registry: fr}
-	resource := &unitsResource{fAPI, "/units", testTokenLimit}
+	resource := &unitsResource{fAPI, "/units", testTokenLimit, nil}
 	rr := httptest.NewRecorder()
 
 	body := ioutil.NopCloser(bytes.NewBuffer([]byte(`{"foo":"bar"}`)))
@@ -0,0 +1,225 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records who changed what in the cluster, and when.
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/log"
+)
+
+// Sources of Records.
+const (
+	SourceAPI    = "api"
+	SourceEngine = "engine"
+)
+
+// Actions recorded by the API and the engine.
+const (
+	ActionCreate         = "create"
+	ActionReplace        = "replace"
+	ActionSetTargetState = "setTargetState"
+	ActionDestroy        = "destroy"
+	ActionSetMetadata    = "setMetadata"
+	ActionDeleteMetadata = "deleteMetadata"
+	ActionCordon         = "cordon"
+	ActionUncordon       = "uncordon"
+	ActionDrain          = "drain"
+	ActionSchedule       = "schedule"
+	ActionUnschedule     = "unschedule"
+)
+
+// Record describes a single change made to the cluster through the API,
+// or a scheduling decision of the engine.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// User is the user the API request was made by, if known.
+	User string `json:"user,omitempty"`
+	// RemoteAddr is the address the API request came from.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Action     string `json:"action"`
+
+	UnitName  string `json:"unitName,omitempty"`
+	MachineID string `json:"machineID,omitempty"`
+	// Key is the machine metadata key set or deleted.
+	Key string `json:"key,omitempty"`
+
+	// OldState and NewState hold the desired state of a unit, the
+	// machine a unit is scheduled to, the value of a metadata key or
+	// whether a machine is cordoned, before and after the change.
+	OldState string `json:"oldState,omitempty"`
+	NewState string `json:"newState,omitempty"`
+
+	// Reason explains scheduling decisions of the engine.
+	Reason string `json:"reason,omitempty"`
+	// Error is set if the change failed.
+	Error string `json:"error,omitempty"`
+}
+
+// RecordPage is the body of the responses of the audit resource of the API.
+type RecordPage struct {
+	Records []Record `json:"records"`
+}
+
+// A Sink stores Records, and returns those matching a Filter.
+type Sink interface {
+	Write(Record) error
+	Records(Filter) ([]Record, error)
+}
+
+// Write stores r in s, stamping it with the current time unless it already
+// has one. Failures are logged rather than returned, as they must not fail
+// the change being recorded. A nil Sink drops the Record.
+func Write(s Sink, r Record) {
+	if s == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if err := s.Write(r); err != nil {
+		log.Errorf("Failed writing audit record of %s: %v", r, err)
+	}
+}
+
+// String describes the change recorded by r, for logging purposes.
+func (r Record) String() string {
+	parts := []string{r.Action}
+	if r.UnitName != "" {
+		parts = append(parts, fmt.Sprintf("Unit(%s)", r.UnitName))
+	}
+	if r.MachineID != "" {
+		parts = append(parts, fmt.Sprintf("Machine(%s)", r.MachineID))
+	}
+	if r.Key != "" {
+		parts = append(parts, fmt.Sprintf("key %q", r.Key))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Filter selects Records. Empty fields select all Records.
+type Filter struct {
+	User     string
+	Action   string
+	UnitName string
+	// MachineID selects the Records of the machines whose ID starts
+	// with it, so that short machine IDs may be used.
+	MachineID string
+	// Since selects the Records made at or after the given time.
+	Since time.Time
+	// Limit keeps the given number of most recent Records only.
+	Limit int
+}
+
+// Query parameters of the audit resource of the API, matching the fields
+// of a Filter.
+const (
+	FilterParamUser      = "user"
+	FilterParamAction    = "action"
+	FilterParamUnitName  = "unitName"
+	FilterParamMachineID = "machineID"
+	FilterParamSince     = "since"
+	FilterParamLimit     = "limit"
+)
+
+// ParseFilter reads a Filter from the query parameters of a request to the
+// audit resource of the API. Since is an RFC 3339 time.
+func ParseFilter(q url.Values) (Filter, error) {
+	f := Filter{
+		User:      q.Get(FilterParamUser),
+		Action:    q.Get(FilterParamAction),
+		UnitName:  q.Get(FilterParamUnitName),
+		MachineID: q.Get(FilterParamMachineID),
+	}
+	if val := q.Get(FilterParamSince); val != "" {
+		since, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s %q, expected an RFC 3339 time", FilterParamSince, val)
+		}
+		f.Since = since
+	}
+	if val := q.Get(FilterParamLimit); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 0 {
+			return f, fmt.Errorf("invalid %s %q", FilterParamLimit, val)
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+// Query returns the query parameters ParseFilter reads f from.
+func (f Filter) Query() url.Values {
+	q := url.Values{}
+	for param, val := range map[string]string{
+		FilterParamUser:      f.User,
+		FilterParamAction:    f.Action,
+		FilterParamUnitName:  f.UnitName,
+		FilterParamMachineID: f.MachineID,
+	} {
+		if val != "" {
+			q.Set(param, val)
+		}
+	}
+	if !f.Since.IsZero() {
+		q.Set(FilterParamSince, f.Since.Format(time.RFC3339))
+	}
+	if f.Limit > 0 {
+		q.Set(FilterParamLimit, strconv.Itoa(f.Limit))
+	}
+	return q
+}
+
+// Matches reports whether f selects r, regardless of its Limit.
+func (f Filter) Matches(r Record) bool {
+	switch {
+	case f.User != "" && r.User != f.User:
+		return false
+	case f.Action != "" && r.Action != f.Action:
+		return false
+	case f.UnitName != "" && r.UnitName != f.UnitName:
+		return false
+	case f.MachineID != "" && !strings.HasPrefix(r.MachineID, f.MachineID):
+		return false
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	}
+	return true
+}
+
+// Apply returns the Records selected by f, oldest first, from the given
+// ones, themselves oldest first.
+func (f Filter) Apply(records []Record) []Record {
+	sel := make([]Record, 0, len(records))
+	for _, r := range records {
+		if f.Matches(r) {
+			sel = append(sel, r)
+		}
+	}
+	return f.limit(sel)
+}
+
+func (f Filter) limit(records []Record) []Record {
+	if f.Limit > 0 && len(records) > f.Limit {
+		records = records[len(records)-f.Limit:]
+	}
+	return records
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterQuery(t *testing.T) {
+	since := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	tests := []Filter{
+		{},
+		{User: "alice", Action: ActionDestroy},
+		{UnitName: "foo.service", MachineID: "XXX", Since: since, Limit: 10},
+	}
+	for i, want := range tests {
+		got, err := ParseFilter(want.Query())
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !got.Since.Equal(want.Since) {
+			t.Errorf("case %d: Since is %v, want %v", i, got.Since, want.Since)
+		}
+		got.Since, want.Since = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("case %d: ParseFilter returned %#v, want %#v", i, got, want)
+		}
+	}
+
+	for _, q := range []string{"since=yesterday", "limit=-1", "limit=ten"} {
+		vals, _ := url.ParseQuery(q)
+		if _, err := ParseFilter(vals); err == nil {
+			t.Errorf("ParseFilter of %q succeeded, want an error", q)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	now := time.Now()
+	records := []Record{
+		{Time: now.Add(-time.Hour), User: "alice", Action: ActionCreate, UnitName: "foo.service"},
+		{Time: now.Add(-time.Minute), Source: SourceEngine, Action: ActionSchedule, UnitName: "foo.service", MachineID: "XXXYYY"},
+		{Time: now, User: "bob", Action: ActionDestroy, UnitName: "foo.service"},
+		{Time: now, User: "bob", Action: ActionCordon, MachineID: "ZZZ"},
+	}
+
+	tests := []struct {
+		f    Filter
+		want []int
+	}{
+		{Filter{}, []int{0, 1, 2, 3}},
+		{Filter{User: "bob"}, []int{2, 3}},
+		{Filter{UnitName: "foo.service", Action: ActionDestroy}, []int{2}},
+		// short machine IDs select the machines they are a prefix of
+		{Filter{MachineID: "XXX"}, []int{1}},
+		{Filter{Since: now.Add(-10 * time.Minute)}, []int{1, 2, 3}},
+		// only the most recent records are kept
+		{Filter{UnitName: "foo.service", Limit: 2}, []int{1, 2}},
+	}
+	for i, tt := range tests {
+		want := []Record{}
+		for _, j := range tt.want {
+			want = append(want, records[j])
+		}
+		if got := tt.f.Apply(records); !reflect.DeepEqual(got, want) {
+			t.Errorf("case %d: Apply returned %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fleet-audit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "audit.log")
+	s, err := NewFileSink(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	Write(s, Record{Source: SourceAPI, User: "alice", Action: ActionCreate, UnitName: "foo.service", NewState: "launched"})
+	Write(s, Record{Source: SourceAPI, User: "bob", Action: ActionDestroy, UnitName: "foo.service", OldState: "launched"})
+	// garbage does not prevent reading the other records
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.WriteString("garbage\n")
+	f.Close()
+	Write(s, Record{Source: SourceEngine, Action: ActionUnschedule, UnitName: "foo.service", OldState: "XXX"})
+
+	records, err := s.Records(Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %v", records)
+	}
+	for i, r := range records {
+		if r.Time.IsZero() {
+			t.Errorf("record %d was not stamped with a time", i)
+		}
+	}
+
+	records, err = s.Records(Filter{User: "bob"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != ActionDestroy || records[0].OldState != "launched" {
+		t.Errorf("unexpected records of bob: %v", records)
+	}
+
+	// records are appended to the existing file
+	s2, err := NewFileSink(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s2.Close()
+	Write(s2, Record{Source: SourceAPI, Action: ActionCordon, MachineID: "XXX"})
+	records, err = s2.Records(Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 4 {
+		t.Errorf("expected 4 records, got %v", records)
+	}
+
+	// records are not limited in length
+	long := strings.Repeat("x", 2*1024*1024)
+	Write(s2, Record{Source: SourceAPI, Action: ActionCreate, UnitName: "long.service", NewState: long})
+	records, err = s2.Records(Filter{UnitName: "long.service"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].NewState != long {
+		t.Errorf("long record was not read back")
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	if s, err := NewSink("", "", nil); s != nil || err != nil {
+		t.Errorf("NewSink without a kind returned %v, %v", s, err)
+	}
+	for _, kind := range []string{SinkFile, SinkRegistry, "syslog"} {
+		if _, err := NewSink(kind, "", nil); err == nil {
+			t.Errorf("NewSink(%q) without a file or store succeeded", kind)
+		}
+	}
+}
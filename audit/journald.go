@@ -0,0 +1,132 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/coreos/fleet/log"
+)
+
+const (
+	journalSocket = "/run/systemd/journal/socket"
+
+	// journalIdentifier is the SYSLOG_IDENTIFIER of the entries holding
+	// Records, so they can be told apart from the logs of fleetd.
+	journalIdentifier = "fleet-audit"
+
+	// journalTimeFormat is the format of the times journalctl accepts.
+	journalTimeFormat = "2006-01-02 15:04:05"
+)
+
+// JournaldSink sends Records to the systemd journal. The message of each
+// entry is the Record as a JSON object, and its fields are also set as
+// FLEET_AUDIT_* journal fields so entries can be matched with journalctl.
+type JournaldSink struct {
+	conn *net.UnixConn
+}
+
+// NewJournaldSink connects to the journal of the local machine.
+func NewJournaldSink() (*JournaldSink, error) {
+	addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldSink{conn}, nil
+}
+
+// Write implements the Sink interface
+func (s *JournaldSink) Write(r Record) error {
+	msg, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", string(msg))
+	writeJournalField(&buf, "PRIORITY", "6")
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", journalIdentifier)
+	for name, val := range map[string]string{
+		"ACTION":     r.Action,
+		"USER":       r.User,
+		"UNIT_NAME":  r.UnitName,
+		"MACHINE_ID": r.MachineID,
+	} {
+		if val != "" {
+			writeJournalField(&buf, "FLEET_AUDIT_"+name, val)
+		}
+	}
+
+	_, err = s.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeJournalField serializes a field of a journal entry following the
+// native protocol of journald, which requires values spanning several
+// lines to be prefixed with their length.
+func writeJournalField(buf *bytes.Buffer, name, val string) {
+	if !strings.Contains(val, "\n") {
+		buf.WriteString(name + "=" + val + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(val)))
+	buf.WriteString(val + "\n")
+}
+
+// Records implements the Sink interface by reading the journal with
+// journalctl, which must be available.
+func (s *JournaldSink) Records(f Filter) ([]Record, error) {
+	args := []string{"--no-pager", "--output=cat", "--identifier=" + journalIdentifier}
+	if !f.Since.IsZero() {
+		args = append(args, "--since="+f.Since.Local().Format(journalTimeFormat))
+	}
+	out, err := exec.Command("journalctl", args...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, fmt.Errorf("failed reading the journal with journalctl: %v", err)
+	}
+
+	var records []Record
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			log.Debugf("Skipping invalid audit record in the journal: %v", err)
+			continue
+		}
+		if f.Matches(r) {
+			records = append(records, r)
+		}
+	}
+	return f.limit(records), nil
+}
+
+// Close disconnects from the journal.
+func (s *JournaldSink) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+// A Store keeps the most recent Records of the cluster, such as the
+// Registry does.
+type Store interface {
+	// AppendAuditRecord stores r, dropping the oldest Record kept if
+	// the Store is full.
+	AppendAuditRecord(r Record) error
+	// AuditRecords returns the Records kept, oldest first.
+	AuditRecords() ([]Record, error)
+}
+
+// NewRegistrySink returns a Sink keeping Records in the given Store, so
+// that the Records of all machines are available from any of them.
+func NewRegistrySink(s Store) Sink {
+	return &registrySink{s}
+}
+
+type registrySink struct {
+	store Store
+}
+
+func (s *registrySink) Write(r Record) error {
+	return s.store.AppendAuditRecord(r)
+}
+
+func (s *registrySink) Records(f Filter) ([]Record, error) {
+	records, err := s.store.AuditRecords()
+	if err != nil {
+		return nil, err
+	}
+	return f.Apply(records), nil
+}
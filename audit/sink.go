@@ -0,0 +1,56 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of Sinks fleetd may be configured with.
+const (
+	SinkFile     = "file"
+	SinkJournald = "journald"
+	SinkRegistry = "registry"
+)
+
+// SinkNames returns the kinds of Sinks NewSink accepts.
+func SinkNames() []string {
+	return []string{SinkFile, SinkJournald, SinkRegistry}
+}
+
+// NewSink returns a Sink of the given kind. A file Sink appends to the
+// named file, and a registry Sink keeps Records in the given Store. No
+// Sink is returned if kind is empty, as auditing is then disabled.
+func NewSink(kind, file string, store Store) (Sink, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case SinkFile:
+		if file == "" {
+			return nil, errors.New("a file audit sink requires a file")
+		}
+		return NewFileSink(file)
+	case SinkJournald:
+		return NewJournaldSink()
+	case SinkRegistry:
+		if store == nil {
+			return nil, errors.New("the registry cannot store audit records")
+		}
+		return NewRegistrySink(store), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q, expected one of %s", kind, strings.Join(SinkNames(), ", "))
+}
@@ -15,6 +15,7 @@
 package client
 
 import (
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
 )
@@ -23,13 +24,28 @@ type API interface {
 	Machines() ([]machine.MachineState, error)
 	SetMachineMetadata(machID, key, value string) error
 	DeleteMachineMetadata(machID, key string) error
+	CordonMachine(machID string) error
+	UncordonMachine(machID string) error
+	DrainMachine(machID string) error
 
 	Unit(string) (*schema.Unit, error)
 	Units() ([]*schema.Unit, error)
 	UnitState(string) (*schema.UnitState, error)
 	UnitStates() ([]*schema.UnitState, error)
+	UnitRevisions(name string) ([]*schema.UnitRevision, error)
+
+	// ListMachines, ListUnits and ListUnitStates return the objects
+	// selected by the given options, in the requested order.
+	ListMachines(opts ListOptions) ([]machine.MachineState, error)
+	ListUnits(opts ListOptions) ([]*schema.Unit, error)
+	ListUnitStates(opts ListOptions) ([]*schema.UnitState, error)
+
+	// AuditRecords returns the audit records selected by the given
+	// filter, oldest first.
+	AuditRecords(f audit.Filter) ([]audit.Record, error)
 
 	SetUnitTargetState(name, target string) error
 	CreateUnit(*schema.Unit) error
+	UpdateUnit(*schema.Unit) error
 	DestroyUnit(string) error
 }
@@ -15,16 +15,75 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 
 	"google.golang.org/api/googleapi"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
 )
 
+// UserHeader names the user on whose behalf a request is made. The API
+// records it as the submitting user of unit revisions.
+const UserHeader = "X-Fleet-User"
+
+// NewUserTransport wraps rt so that every request it sends carries the
+// given user in its UserHeader.
+func NewUserTransport(rt http.RoundTripper, user string) http.RoundTripper {
+	return &userTransport{rt, user}
+}
+
+type userTransport struct {
+	http.RoundTripper
+	user string
+}
+
+func (t *userTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it is given
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(UserHeader, t.user)
+	return t.RoundTripper.RoundTrip(&r)
+}
+
+// NewAuthTransport wraps rt so that every request it sends authenticates
+// against the API with the given bearer token or, if it is empty, with the
+// given username and password.
+func NewAuthTransport(rt http.RoundTripper, token, username, password string) http.RoundTripper {
+	return &authTransport{rt, token, username, password}
+}
+
+type authTransport struct {
+	http.RoundTripper
+	token    string
+	username string
+	password string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	if t.token != "" {
+		r.Header.Set("Authorization", "Bearer "+t.token)
+	} else {
+		r.SetBasicAuth(t.username, t.password)
+	}
+	return t.RoundTripper.RoundTrip(&r)
+}
+
 func NewHTTPClient(c *http.Client, ep url.URL) (API, error) {
 	svc, err := schema.New(c)
 	if err != nil {
@@ -35,22 +94,30 @@ func NewHTTPClient(c *http.Client, ep url.URL) (API, error) {
 	ep.Path = path.Join(ep.Path, "fleet", "v1") + "/"
 	svc.BasePath = ep.String()
 
-	return &HTTPClient{svc: svc}, nil
+	return &HTTPClient{svc: svc, client: c}, nil
 }
 
 type HTTPClient struct {
 	svc *schema.Service
 
+	// client is used for the requests schema.Service does not support
+	client *http.Client
+
 	//NOTE(bcwaldon): This is only necessary until the API interface
 	// is fully implemented by HTTPClient
 	API
 }
 
 func (c *HTTPClient) Machines() ([]machine.MachineState, error) {
+	return c.ListMachines(ListOptions{})
+}
+
+func (c *HTTPClient) ListMachines(opts ListOptions) ([]machine.MachineState, error) {
+	params := listCallOptions(opts, "")
 	machines := make([]machine.MachineState, 0)
 	call := c.svc.Machines.List()
 	for call != nil {
-		page, err := call.Do()
+		page, err := call.Do(params...)
 		if err != nil {
 			return nil, err
 		}
@@ -68,10 +135,15 @@ func (c *HTTPClient) Machines() ([]machine.MachineState, error) {
 }
 
 func (c *HTTPClient) Units() ([]*schema.Unit, error) {
+	return c.ListUnits(ListOptions{})
+}
+
+func (c *HTTPClient) ListUnits(opts ListOptions) ([]*schema.Unit, error) {
+	params := listCallOptions(opts, ListParamName)
 	var units []*schema.Unit
 	call := c.svc.Units.List()
 	for call != nil {
-		page, err := call.Do()
+		page, err := call.Do(params...)
 		if err != nil {
 			return nil, err
 		}
@@ -97,10 +169,15 @@ func (c *HTTPClient) Unit(name string) (*schema.Unit, error) {
 }
 
 func (c *HTTPClient) UnitStates() ([]*schema.UnitState, error) {
+	return c.ListUnitStates(ListOptions{})
+}
+
+func (c *HTTPClient) ListUnitStates(opts ListOptions) ([]*schema.UnitState, error) {
+	params := listCallOptions(opts, ListParamUnitName)
 	var states []*schema.UnitState
 	call := c.svc.UnitState.List()
 	for call != nil {
-		page, err := call.Do()
+		page, err := call.Do(params...)
 		if err != nil {
 			return nil, err
 		}
@@ -117,6 +194,20 @@ func (c *HTTPClient) UnitStates() ([]*schema.UnitState, error) {
 	return states, nil
 }
 
+// queryParam sets a query parameter the generated calls do not know of.
+type queryParam [2]string
+
+func (p queryParam) Get() (string, string) { return p[0], p[1] }
+
+// listCallOptions passes the ListOptions to the list calls. They must be
+// sent along with every page token, which does not hold them.
+func listCallOptions(opts ListOptions, nameParam string) (params []googleapi.CallOption) {
+	for key, values := range opts.Query(nameParam) {
+		params = append(params, queryParam{key, values[0]})
+	}
+	return
+}
+
 func (c *HTTPClient) UnitState(name string) (*schema.UnitState, error) {
 	u, err := c.svc.UnitState.Get(name).Do()
 	if err != nil && !is404(err) {
@@ -125,6 +216,40 @@ func (c *HTTPClient) UnitState(name string) (*schema.UnitState, error) {
 	return u, nil
 }
 
+func (c *HTTPClient) UnitRevisions(name string) ([]*schema.UnitRevision, error) {
+	res, err := c.client.Get(c.svc.BasePath + "units/" + url.QueryEscape(name) + "/revisions")
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+
+	var page schema.UnitRevisionPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	return page.Revisions, nil
+}
+
+func (c *HTTPClient) AuditRecords(f audit.Filter) ([]audit.Record, error) {
+	res, err := c.client.Get(c.svc.BasePath + "audit?" + f.Query().Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+
+	var page audit.RecordPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	return page.Records, nil
+}
+
 func (c *HTTPClient) DestroyUnit(name string) error {
 	return c.svc.Units.Delete(name).Do()
 }
@@ -133,6 +258,12 @@ func (c *HTTPClient) CreateUnit(u *schema.Unit) error {
 	return c.svc.Units.Set(u.Name, u).Do()
 }
 
+// UpdateUnit replaces the content of an existing unit. The server swaps the
+// unit file in place when it differs from the one already stored.
+func (c *HTTPClient) UpdateUnit(u *schema.Unit) error {
+	return c.svc.Units.Set(u.Name, u).Do()
+}
+
 func (c *HTTPClient) SetUnitTargetState(name, target string) error {
 	u := schema.Unit{
 		Name:         name,
@@ -141,6 +272,107 @@ func (c *HTTPClient) SetUnitTargetState(name, target string) error {
 	return c.svc.Units.Set(name, &u).Do()
 }
 
+func (c *HTTPClient) CordonMachine(machID string) error {
+	return c.patchMachine("cordon", machID)
+}
+
+func (c *HTTPClient) UncordonMachine(machID string) error {
+	return c.patchMachine("uncordon", machID)
+}
+
+func (c *HTTPClient) DrainMachine(machID string) error {
+	return c.patchMachine("drain", machID)
+}
+
+// patchMachine applies a single operation to a machine through a PATCH
+// request against the machines resource.
+func (c *HTTPClient) patchMachine(op, machID string) error {
+	ops := []struct {
+		Operation string `json:"op"`
+		Path      string `json:"path"`
+	}{
+		{op, "/" + machID},
+	}
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PATCH", c.svc.BasePath+"machines", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	return googleapi.CheckResponse(res)
+}
+
+// Watch streams the events happening in the cluster after the given index,
+// or from now on if it is 0, to the given channel until stop is closed. It
+// returns once the stream ends, with nil if it was stopped. Watching can be
+// resumed from the index of the last event received; IsEventIndexCleared
+// reports whether that is no longer possible.
+func (c *HTTPClient) Watch(index uint64, events chan<- *schema.Event, stop <-chan struct{}) error {
+	query := url.Values{"watch": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+	}
+	req, err := http.NewRequest("GET", c.svc.BasePath+"events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Cancel = stop
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return stopped(stop, err)
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var ev schema.Event
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return stopped(stop, err)
+		}
+
+		select {
+		case events <- &ev:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// stopped drops the error caused by closing the stop channel of a request.
+func stopped(stop <-chan struct{}, err error) error {
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// IsEventIndexCleared reports whether Watch failed because the events
+// following the index it was asked to resume from are no longer available.
+// The cluster state must then be fetched again before watching from now on.
+func IsEventIndexCleared(err error) bool {
+	googerr, ok := err.(*googleapi.Error)
+	return ok && googerr.Code == http.StatusGone
+}
+
 func is404(err error) bool {
 	googerr, ok := err.(*googleapi.Error)
 	return ok && googerr.Code == http.StatusNotFound
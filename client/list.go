@@ -0,0 +1,388 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/schema"
+)
+
+// Query parameters of ListOptions. Names are matched against the unitName
+// parameter of the state resource, and the name parameter of the units
+// resource. Those and the machineID parameter select exact values; glob
+// patterns are given by the same parameters suffixed by "Pattern".
+const (
+	ListParamName             = "name"
+	ListParamNamePattern      = ListParamName + listParamPatternSuffix
+	ListParamUnitName         = "unitName"
+	ListParamUnitNamePattern  = ListParamUnitName + listParamPatternSuffix
+	ListParamMachineID        = "machineID"
+	ListParamMachineIDPattern = ListParamMachineID + listParamPatternSuffix
+	ListParamTargetState      = "targetState"
+	ListParamCurrentState     = "currentState"
+	ListParamMetadata         = "metadata"
+	ListParamSort             = "sort"
+
+	listParamPatternSuffix = "Pattern"
+)
+
+// ListOptions selects and orders the objects returned by the List calls of
+// an API. Patterns are globs as understood by path.Match, of which any may
+// match. The zero value lists everything, in the order of the registry.
+type ListOptions struct {
+	// Names are patterns matching the names of units.
+	Names []string
+	// MachineIDs are patterns matching the ID of a machine, or of the
+	// machine a unit is scheduled to.
+	MachineIDs []string
+	// TargetState and CurrentState select units in the given states.
+	TargetState  string
+	CurrentState string
+	// Metadata are requirements on the metadata of a machine, or of the
+	// machine a unit is scheduled to, which must all be met. They take
+	// any form accepted by machine.ParseMetadataRequirement.
+	Metadata []string
+	// Sort lists the fields to order by, descending if prefixed by "-".
+	Sort []string
+}
+
+// ParseListOptions reads ListOptions from the query of a request. Names are
+// read from nameParam, if set, and its pattern parameter. Every parameter
+// may be repeated or hold a comma-separated list, except for the target and
+// current states.
+func ParseListOptions(q url.Values, nameParam string) (opts ListOptions, err error) {
+	if nameParam != "" {
+		opts.Names = parsePatternParams(q, nameParam)
+	}
+	opts.MachineIDs = parsePatternParams(q, ListParamMachineID)
+	opts.TargetState = q.Get(ListParamTargetState)
+	opts.CurrentState = q.Get(ListParamCurrentState)
+	opts.Metadata = splitListParam(q[ListParamMetadata])
+	opts.Sort = splitListParam(q[ListParamSort])
+
+	for _, p := range append(append([]string{}, opts.Names...), opts.MachineIDs...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return opts, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+	if _, err := opts.metadata(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// Query encodes the ListOptions in the form read by ParseListOptions.
+// Names and machine IDs are sent as patterns.
+func (opts ListOptions) Query(nameParam string) url.Values {
+	q := url.Values{}
+	if nameParam != "" && len(opts.Names) > 0 {
+		q.Set(nameParam+listParamPatternSuffix, strings.Join(opts.Names, ","))
+	}
+	if len(opts.MachineIDs) > 0 {
+		q.Set(ListParamMachineIDPattern, strings.Join(opts.MachineIDs, ","))
+	}
+	if opts.TargetState != "" {
+		q.Set(ListParamTargetState, opts.TargetState)
+	}
+	if opts.CurrentState != "" {
+		q.Set(ListParamCurrentState, opts.CurrentState)
+	}
+	if len(opts.Metadata) > 0 {
+		q.Set(ListParamMetadata, strings.Join(opts.Metadata, ","))
+	}
+	if len(opts.Sort) > 0 {
+		q.Set(ListParamSort, strings.Join(opts.Sort, ","))
+	}
+	return q
+}
+
+// parsePatternParams returns the patterns selected by a parameter of exact
+// values and by its pattern parameter.
+func parsePatternParams(q url.Values, param string) []string {
+	var patterns []string
+	for _, v := range splitListParam(q[param]) {
+		patterns = append(patterns, literalPattern(v))
+	}
+	return append(patterns, splitListParam(q[param+listParamPatternSuffix])...)
+}
+
+// literalPattern escapes s into a pattern matching only s itself.
+func literalPattern(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func splitListParam(values []string) (items []string) {
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return
+}
+
+func (opts ListOptions) metadata() (map[string]pkg.Set, error) {
+	if len(opts.Metadata) == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]pkg.Set)
+	for _, req := range opts.Metadata {
+		key, match, err := machine.ParseMetadataRequirement(req)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = pkg.NewUnsafeSet()
+		}
+		metadata[key].Add(match)
+	}
+	return metadata, nil
+}
+
+// matchAny reports whether value matches any of patterns, or whether there
+// are no patterns at all.
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, err := path.Match(p, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// machineFilter returns whether the machine of the given ID meets the
+// metadata requirements of opts; machines lists all known machines.
+func (opts ListOptions) machineFilter(machines []machine.MachineState) (func(machID string) bool, error) {
+	metadata, err := opts.metadata()
+	if err != nil {
+		return nil, err
+	}
+	matching := make(map[string]bool)
+	for i := range machines {
+		if metadata == nil || machine.HasMetadata(&machines[i], metadata) {
+			matching[machines[i].ID] = true
+		}
+	}
+	return func(machID string) bool {
+		return matchAny(opts.MachineIDs, machID) && (metadata == nil || matching[machID])
+	}, nil
+}
+
+var (
+	unitSortFields = map[string]func(u *schema.Unit) string{
+		ListParamName:         func(u *schema.Unit) string { return u.Name },
+		ListParamMachineID:    func(u *schema.Unit) string { return u.MachineID },
+		ListParamTargetState:  func(u *schema.Unit) string { return u.DesiredState },
+		ListParamCurrentState: func(u *schema.Unit) string { return u.CurrentState },
+	}
+	unitStateSortFields = map[string]func(us *schema.UnitState) string{
+		ListParamName:      func(us *schema.UnitState) string { return us.Name },
+		ListParamMachineID: func(us *schema.UnitState) string { return us.MachineID },
+		"loadState":        func(us *schema.UnitState) string { return us.SystemdLoadState },
+		"activeState":      func(us *schema.UnitState) string { return us.SystemdActiveState },
+		"subState":         func(us *schema.UnitState) string { return us.SystemdSubState },
+		"health":           func(us *schema.UnitState) string { return us.Health },
+	}
+	machineSortFields = map[string]func(ms *machine.MachineState) string{
+		ListParamMachineID: func(ms *machine.MachineState) string { return ms.ID },
+		"name":             func(ms *machine.MachineState) string { return ms.Name },
+		"primaryIP":        func(ms *machine.MachineState) string { return ms.PublicIP },
+	}
+)
+
+// machineMetadataSortPrefix prefixes a metadata key to sort machines by.
+const machineMetadataSortPrefix = "metadata."
+
+// sortKey extracts the value of the i-th object of a slice to sort by.
+type sortKey struct {
+	value func(i int) string
+	desc  bool
+}
+
+type fieldSorter struct {
+	n    int
+	swap func(i, j int)
+	keys []sortKey
+}
+
+func (s fieldSorter) Len() int      { return s.n }
+func (s fieldSorter) Swap(i, j int) { s.swap(i, j) }
+func (s fieldSorter) Less(i, j int) bool {
+	for _, k := range s.keys {
+		a, b := k.value(i), k.value(j)
+		if a != b {
+			return (a < b) != k.desc
+		}
+	}
+	return false
+}
+
+// sortKeys resolves the sort fields of opts, using lookup to find the value
+// of a field for the i-th object.
+func (opts ListOptions) sortKeys(lookup func(field string) func(i int) string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, field := range opts.Sort {
+		desc := strings.HasPrefix(field, "-")
+		value := lookup(strings.TrimPrefix(field, "-"))
+		if value == nil {
+			return nil, fmt.Errorf("invalid sort field %q", field)
+		}
+		keys = append(keys, sortKey{value, desc})
+	}
+	return keys, nil
+}
+
+// Selects reports whether opts selects a subset of the objects, rather than
+// only ordering them.
+func (opts ListOptions) Selects() bool {
+	return len(opts.Names) > 0 || len(opts.MachineIDs) > 0 || len(opts.Metadata) > 0 ||
+		opts.TargetState != "" || opts.CurrentState != ""
+}
+
+// ValidateUnitListOptions checks that opts may be used to list units.
+func ValidateUnitListOptions(opts ListOptions) error {
+	_, err := FilterUnits(nil, nil, opts)
+	return err
+}
+
+// ValidateUnitStateListOptions checks that opts may be used to list the
+// states of units.
+func ValidateUnitStateListOptions(opts ListOptions) error {
+	_, err := FilterUnitStates(nil, nil, opts)
+	return err
+}
+
+// ValidateMachineListOptions checks that opts may be used to list machines.
+func ValidateMachineListOptions(opts ListOptions) error {
+	_, err := FilterMachines(nil, opts)
+	return err
+}
+
+// FilterUnits returns the units selected by opts, in the requested order.
+// The machines are only needed if opts has metadata requirements.
+func FilterUnits(units []*schema.Unit, machines []machine.MachineState, opts ListOptions) ([]*schema.Unit, error) {
+	onMachine, err := opts.machineFilter(machines)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*schema.Unit
+	for _, u := range units {
+		if !matchAny(opts.Names, u.Name) || !onMachine(u.MachineID) {
+			continue
+		}
+		if opts.TargetState != "" && opts.TargetState != u.DesiredState {
+			continue
+		}
+		if opts.CurrentState != "" && opts.CurrentState != u.CurrentState {
+			continue
+		}
+		selected = append(selected, u)
+	}
+
+	keys, err := opts.sortKeys(func(field string) func(i int) string {
+		if f, ok := unitSortFields[field]; ok {
+			return func(i int) string { return f(selected[i]) }
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(fieldSorter{len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] }, keys})
+	return selected, nil
+}
+
+// FilterUnitStates returns the states of units selected by opts, in the
+// requested order. The target and current states of opts apply to units
+// only, and are ignored. The machines are only needed if opts has metadata
+// requirements.
+func FilterUnitStates(states []*schema.UnitState, machines []machine.MachineState, opts ListOptions) ([]*schema.UnitState, error) {
+	onMachine, err := opts.machineFilter(machines)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*schema.UnitState
+	for _, us := range states {
+		if matchAny(opts.Names, us.Name) && onMachine(us.MachineID) {
+			selected = append(selected, us)
+		}
+	}
+
+	keys, err := opts.sortKeys(func(field string) func(i int) string {
+		if f, ok := unitStateSortFields[field]; ok {
+			return func(i int) string { return f(selected[i]) }
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(fieldSorter{len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] }, keys})
+	return selected, nil
+}
+
+// FilterMachines returns the machines selected by opts, in the requested
+// order. Besides the fields of machines, they may be sorted by the value
+// of a metadata key, given as "metadata.<key>".
+func FilterMachines(machines []machine.MachineState, opts ListOptions) ([]machine.MachineState, error) {
+	selects, err := opts.machineFilter(machines)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []machine.MachineState
+	for _, ms := range machines {
+		if selects(ms.ID) {
+			selected = append(selected, ms)
+		}
+	}
+
+	keys, err := opts.sortKeys(func(field string) func(i int) string {
+		if f, ok := machineSortFields[field]; ok {
+			return func(i int) string { return f(&selected[i]) }
+		}
+		if strings.HasPrefix(field, machineMetadataSortPrefix) {
+			key := strings.TrimPrefix(field, machineMetadataSortPrefix)
+			return func(i int) string { return selected[i].Metadata[key] }
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(fieldSorter{len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] }, keys})
+	return selected, nil
+}
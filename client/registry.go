@@ -15,13 +15,22 @@
 package client
 
 import (
+	"errors"
+
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
 )
 
 type RegistryClient struct {
 	registry.Registry
+
+	// User is recorded as the submitting user of new unit revisions
+	User string
 }
 
 func (rc *RegistryClient) Units() ([]*schema.Unit, error) {
@@ -83,7 +92,79 @@ func (rc *RegistryClient) CreateUnit(u *schema.Unit) error {
 		rUnit.TargetState = ts
 	}
 
-	return rc.Registry.CreateUnit(&rUnit)
+	if err := rc.Registry.CreateUnit(&rUnit); err != nil {
+		return err
+	}
+
+	rc.saveRevision(u.Name, rUnit.Unit)
+	return nil
+}
+
+func (rc *RegistryClient) UpdateUnit(u *schema.Unit) error {
+	rUnit := job.Unit{
+		Name: u.Name,
+		Unit: *schema.MapSchemaUnitOptionsToUnitFile(u.Options),
+	}
+
+	var ts job.JobState
+	if len(u.DesiredState) > 0 {
+		var err error
+		ts, err = job.ParseJobState(u.DesiredState)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rc.Registry.UpdateUnit(&rUnit); err != nil {
+		return err
+	}
+	rc.saveRevision(u.Name, rUnit.Unit)
+
+	if len(ts) == 0 {
+		return nil
+	}
+	return rc.Registry.SetUnitTargetState(u.Name, ts)
+}
+
+func (rc *RegistryClient) UnitRevisions(name string) ([]*schema.UnitRevision, error) {
+	rRevs, err := rc.Registry.UnitRevisions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]*schema.UnitRevision, len(rRevs))
+	for i := range rRevs {
+		revs[i] = schema.MapUnitRevisionToSchema(&rRevs[i])
+	}
+
+	return revs, nil
+}
+
+// AuditRecords reads the audit records kept in the Registry, which only
+// holds those of the machines whose audit_sink is registry.
+func (rc *RegistryClient) AuditRecords(f audit.Filter) ([]audit.Record, error) {
+	store, ok := rc.Registry.(audit.Store)
+	if !ok {
+		return nil, errors.New("the registry does not keep audit records")
+	}
+
+	records, err := store.AuditRecords()
+	if err != nil {
+		return nil, err
+	}
+	return f.Apply(records), nil
+}
+
+// saveRevision records the content of a unit in its history. The unit
+// itself has been stored already, so a failure here is only logged.
+func (rc *RegistryClient) saveRevision(name string, uf unit.UnitFile) {
+	rev := job.UnitRevision{
+		Unit: uf,
+		User: rc.User,
+	}
+	if err := rc.Registry.SaveUnitRevision(name, rev); err != nil {
+		log.Warningf("Failed saving revision of Unit(%s): %v", name, err)
+	}
 }
 
 func (rc *RegistryClient) UnitState(name string) (*schema.UnitState, error) {
@@ -109,6 +190,71 @@ func (rc *RegistryClient) UnitStates() ([]*schema.UnitState, error) {
 	return states, nil
 }
 
+func (rc *RegistryClient) ListMachines(opts ListOptions) ([]machine.MachineState, error) {
+	machines, err := rc.Registry.Machines()
+	if err != nil {
+		return nil, err
+	}
+	return FilterMachines(machines, opts)
+}
+
+func (rc *RegistryClient) ListUnits(opts ListOptions) ([]*schema.Unit, error) {
+	units, err := rc.Units()
+	if err != nil {
+		return nil, err
+	}
+	machines, err := rc.machinesFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	return FilterUnits(units, machines, opts)
+}
+
+func (rc *RegistryClient) ListUnitStates(opts ListOptions) ([]*schema.UnitState, error) {
+	states, err := rc.UnitStates()
+	if err != nil {
+		return nil, err
+	}
+	machines, err := rc.machinesFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	return FilterUnitStates(states, machines, opts)
+}
+
+// machinesFor fetches the machines only if opts selects units by the
+// metadata of their machine.
+func (rc *RegistryClient) machinesFor(opts ListOptions) ([]machine.MachineState, error) {
+	if len(opts.Metadata) == 0 {
+		return nil, nil
+	}
+	return rc.Registry.Machines()
+}
+
+// DrainMachine cordons the machine and unschedules all non-global units
+// from it, so that the engine reschedules them elsewhere.
+func (rc *RegistryClient) DrainMachine(machID string) error {
+	if err := rc.Registry.CordonMachine(machID); err != nil {
+		return err
+	}
+
+	sUnits, err := rc.Registry.Schedule()
+	if err != nil {
+		return err
+	}
+
+	for _, sUnit := range sUnits {
+		if sUnit.TargetMachineID != machID {
+			continue
+		}
+		if err := rc.Registry.UnscheduleUnit(sUnit.Name, machID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (rc *RegistryClient) SetUnitTargetState(name, target string) error {
 	return rc.Registry.SetUnitTargetState(name, job.JobState(target))
 }
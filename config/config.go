@@ -29,15 +29,40 @@ type Config struct {
 	EtcdCertFile            string
 	EtcdCAFile              string
 	EtcdRequestTimeout      float64
+	EtcdAPIVersion          int
+	RegistryBackend         string
+	DataDir                 string
 	EngineReconcileInterval float64
+	EngineScheduler         string
+	EngineRebalance         bool
+	EngineRebalanceMaxMoves int
 	PublicIP                string
+	MachineID               string
+	MachineIDFile           string
+	MachineName             string
 	Verbosity               int
 	RawMetadata             string
+	RawAddresses            string
+	MetadataFacts           bool
+	MetadataDir             string
 	AgentTTL                string
 	TokenLimit              int
 	DisableEngine           bool
 	DisableWatches          bool
 	EnableGRPC              bool
+	GRPCPort                int
+	GRPCKeyFile             string
+	GRPCCertFile            string
+	GRPCCAFile              string
+	APIKeyFile              string
+	APICertFile             string
+	APICAFile               string
+	APITokenFile            string
+	APIHtpasswdFile         string
+	APIPolicyFile           string
+	APIEventInterval        float64
+	AuditSink               string
+	AuditFile               string
 	VerifyUnits             bool
 	UnitsDirectory          string
 	SystemdUser             bool
@@ -68,3 +93,24 @@ func (c *Config) Metadata() map[string]string {
 
 	return meta
 }
+
+// Addresses returns the addresses configured for the local machine. The
+// public_ip is the first public address, unless others are configured.
+func (c *Config) Addresses() ([]machine.Address, error) {
+	addrs, err := machine.ParseAddresses(c.RawAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.PublicIP != "" {
+		hasPublic := false
+		for _, a := range addrs {
+			hasPublic = hasPublic || a.Role == machine.AddressPublic
+		}
+		if !hasPublic {
+			addrs = append([]machine.Address{{Role: machine.AddressPublic, IP: c.PublicIP}}, addrs...)
+		}
+	}
+
+	return addrs, nil
+}
@@ -15,7 +15,10 @@
 package config
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/coreos/fleet/machine"
 )
 
 func TestConfigMetadata(t *testing.T) {
@@ -44,3 +47,41 @@ func TestConfigMetadataNotSet(t *testing.T) {
 		t.Errorf("Parsed %d keys, expected 0", len(metadata))
 	}
 }
+
+func TestConfigAddresses(t *testing.T) {
+	tests := []struct {
+		publicIP string
+		raw      string
+		addrs    []machine.Address
+	}{
+		{"", "", nil},
+		{
+			"192.0.2.10", "private=10.0.0.10",
+			[]machine.Address{
+				{Role: machine.AddressPublic, IP: "192.0.2.10"},
+				{Role: machine.AddressPrivate, IP: "10.0.0.10"},
+			},
+		},
+		{
+			"192.0.2.10", "public=2001:db8::10",
+			[]machine.Address{
+				{Role: machine.AddressPublic, IP: "2001:db8::10"},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		cfg := Config{PublicIP: tt.publicIP, RawAddresses: tt.raw}
+		addrs, err := cfg.Addresses()
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(tt.addrs, addrs) {
+			t.Errorf("case %d: got %v, want %v", i, addrs, tt.addrs)
+		}
+	}
+
+	cfg := Config{RawAddresses: "public"}
+	if _, err := cfg.Addresses(); err == nil {
+		t.Errorf("expected error for address without role")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/metrics"
+	"github.com/coreos/fleet/resource"
+)
+
+// binPackScheduler places each Job on the eligible agent with the least
+// remaining capacity that can still hold the resources declared by the
+// Job, giving precedence to agents matching the Job's preferences. Agents
+// are never overcommitted: if no agent has enough capacity left, no
+// decision is made.
+type binPackScheduler struct{}
+
+func (bps *binPackScheduler) Decide(clust *clusterState, j *job.Job) (*decision, error) {
+	return bps.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return ableToRun(agents, as, j)
+	})
+}
+
+// DecideReschedule finds the tightest-fitting agent other than the Job's
+// current target. As with leastLoadedScheduler.DecideReschedule, the other
+// requirements of the Job are not checked again.
+func (bps *binPackScheduler) DecideReschedule(clust *clusterState, j *job.Job) (*decision, error) {
+	return bps.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return as.MState.ID != j.TargetMachineID
+	})
+}
+
+func (bps *binPackScheduler) decide(clust *clusterState, j *job.Job, eligible func([]*agent.AgentState, *agent.AgentState) bool) (*decision, error) {
+	req, err := j.Resources()
+	if err != nil {
+		metrics.ReportEngineScheduleFailure(metrics.InvalidResources)
+		return nil, fmt.Errorf("invalid resources: %v", err)
+	}
+
+	agents := bps.sortedAgents(clust)
+	sortByPreference(agents, j)
+	if len(agents) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgents)
+		return nil, fmt.Errorf("zero agents available")
+	}
+
+	insufficient := false
+	for _, as := range agents {
+		if !eligible(agents, as) {
+			continue
+		}
+
+		// Units requiring nothing fit anywhere, even on machines not
+		// advertising their capacity.
+		if avail := as.AvailableResources(); !req.Empty() && !resource.Fits(avail, req) {
+			log.Debugf("Agent(%s) has insufficient resources for Job(%s): available %v, required %v", as.MState.ID, j.Name, avail, req)
+			insufficient = true
+			continue
+		}
+
+		dec := decision{
+			machineID: as.MState.ID,
+		}
+		return &dec, nil
+	}
+
+	if insufficient {
+		metrics.ReportEngineScheduleFailure(metrics.InsufficientResources)
+		return nil, fmt.Errorf("no agents with sufficient resources to run job")
+	}
+
+	metrics.ReportEngineScheduleFailure(metrics.NoAgentsAbleToRun)
+	return nil, fmt.Errorf("no agents able to run job")
+}
+
+// sortedAgents returns a list of AgentState objects sorted ascending by
+// the resources they have available
+func (bps *binPackScheduler) sortedAgents(clust *clusterState) []*agent.AgentState {
+	agents := clust.agents()
+
+	sas := make(capacitySortableAgentStates, 0, len(agents))
+	for _, as := range agents {
+		sas = append(sas, capacitySortableAgentState{as, as.AvailableResources()})
+	}
+	sort.Sort(sas)
+
+	sorted := make([]*agent.AgentState, len(sas))
+	for i, cs := range sas {
+		sorted[i] = cs.as
+	}
+	return sorted
+}
+
+type capacitySortableAgentState struct {
+	as    *agent.AgentState
+	avail resource.ResourceTuple
+}
+
+type capacitySortableAgentStates []capacitySortableAgentState
+
+func (sas capacitySortableAgentStates) Len() int      { return len(sas) }
+func (sas capacitySortableAgentStates) Swap(i, j int) { sas[i], sas[j] = sas[j], sas[i] }
+
+func (sas capacitySortableAgentStates) Less(i, j int) bool {
+	ri, rj := sas[i].avail, sas[j].avail
+	if ri.Cores != rj.Cores {
+		return ri.Cores < rj.Cores
+	}
+	if ri.Memory != rj.Memory {
+		return ri.Memory < rj.Memory
+	}
+	if ri.Disk != rj.Disk {
+		return ri.Disk < rj.Disk
+	}
+	return sortableAgentStates{sas[i].as, sas[j].as}.Less(0, 1)
+}
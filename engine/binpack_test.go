@@ -0,0 +1,193 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/resource"
+	"github.com/coreos/fleet/unit"
+)
+
+func newUnitWithResources(t *testing.T, resources string) unit.UnitFile {
+	contents := fmt.Sprintf("[X-Fleet]\nResources=%s", resources)
+	u, err := unit.NewUnitFile(contents)
+	if err != nil {
+		t.Fatalf("error creating unit from %q: %v", contents, err)
+	}
+	return *u
+}
+
+func TestBinPackSchedulerDecisions(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
+	small := &resource.ResourceTuple{Cores: 200, Memory: 1280}
+	large := &resource.ResourceTuple{Cores: 400, Memory: 4352}
+
+	tests := []struct {
+		clust *clusterState
+		job   *job.Job
+		dec   *decision
+	}{
+		// no machines to receive job
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{}),
+			job:   &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "cores=50")},
+			dec:   nil,
+		},
+
+		// pick the machine with the least capacity that still fits
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX", TotalResources: large},
+				machine.MachineState{ID: "YYY", TotalResources: small},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "cores=50 memory=512M")},
+			dec: &decision{
+				machineID: "YYY",
+			},
+		},
+
+		// skip machines without enough capacity left
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX", TotalResources: large},
+				machine.MachineState{ID: "YYY", TotalResources: small},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "memory=2G")},
+			dec: &decision{
+				machineID: "XXX",
+			},
+		},
+
+		// resources consumed by scheduled units are taken into account
+		{
+			clust: newClusterState(
+				[]job.Unit{
+					job.Unit{
+						Name:        "bar.service",
+						Unit:        newUnitWithResources(t, "cores=100 memory=1G"),
+						TargetState: job.JobStateLaunched,
+					},
+				},
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{
+						Name:            "bar.service",
+						State:           &jsLaunched,
+						TargetMachineID: "YYY",
+					},
+				},
+				[]machine.MachineState{
+					machine.MachineState{ID: "XXX", TotalResources: large},
+					machine.MachineState{ID: "YYY", TotalResources: small},
+				},
+			),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "cores=50 memory=512M")},
+			dec: &decision{
+				machineID: "XXX",
+			},
+		},
+
+		// refuse to overcommit
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX", TotalResources: large},
+				machine.MachineState{ID: "YYY", TotalResources: small},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "cores=800")},
+			dec: nil,
+		},
+
+		// machines advertising no capacity cannot run units with requirements
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX"},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "memory=1M")},
+			dec: nil,
+		},
+
+		// but they can run units without requirements
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX"},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: unit.UnitFile{}},
+			dec: &decision{
+				machineID: "XXX",
+			},
+		},
+
+		// other requirements are still honoured
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX", TotalResources: large},
+				machine.MachineState{ID: "YYY", TotalResources: small},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithMetadata(t, "region=us-east")},
+			dec: nil,
+		},
+
+		// malformed resources are rejected
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+				machine.MachineState{ID: "XXX", TotalResources: large},
+			}),
+			job: &job.Job{Name: "foo.service", Unit: newUnitWithResources(t, "cores=lots")},
+			dec: nil,
+		},
+	}
+
+	for i, tt := range tests {
+		sched := &binPackScheduler{}
+		dec, err := sched.Decide(tt.clust, tt.job)
+
+		if err != nil && tt.dec != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		} else if err == nil && tt.dec == nil {
+			t.Errorf("case %d: expected error", i)
+			continue
+		}
+
+		if !reflect.DeepEqual(tt.dec, dec) {
+			t.Errorf("case %d: expected decision %#v, got %#v", i, tt.dec, dec)
+		}
+	}
+}
+
+func TestBinPackSchedulerDecideReschedule(t *testing.T) {
+	clust := newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{
+		machine.MachineState{ID: "XXX", TotalResources: &resource.ResourceTuple{Cores: 400, Memory: 4352}},
+		machine.MachineState{ID: "YYY", TotalResources: &resource.ResourceTuple{Cores: 200, Memory: 1280}},
+	})
+	j := &job.Job{
+		Name:            "foo.service",
+		Unit:            newUnitWithResources(t, "cores=50"),
+		TargetMachineID: "YYY",
+	}
+
+	sched := &binPackScheduler{}
+	dec, err := sched.DecideReschedule(clust, j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dec.machineID != "XXX" {
+		t.Errorf("expected rescheduling to XXX, got %s", dec.machineID)
+	}
+}
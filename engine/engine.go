@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/metrics"
@@ -44,6 +45,9 @@ type Engine struct {
 
 	lease lease.Lease
 
+	// audit records the scheduling decisions of the engine, if not nil
+	audit audit.Sink
+
 	updateEngineState func(newEngine machine.MachineState)
 }
 
@@ -52,8 +56,8 @@ type CompleteRegistry interface {
 	registry.ClusterRegistry
 }
 
-func New(reg CompleteRegistry, lManager lease.Manager, rStream pkg.EventStream, mach machine.Machine, updateEngineState func(newEngine machine.MachineState)) *Engine {
-	rec := NewReconciler()
+func New(reg CompleteRegistry, lManager lease.Manager, rStream pkg.EventStream, mach machine.Machine, sched Scheduler, rebalance RebalanceConfig, auditSink audit.Sink, updateEngineState func(newEngine machine.MachineState)) *Engine {
+	rec := NewReconciler(sched, rebalance)
 	return &Engine{
 		rec:               rec,
 		registry:          reg,
@@ -61,6 +65,7 @@ func New(reg CompleteRegistry, lManager lease.Manager, rStream pkg.EventStream,
 		lManager:          lManager,
 		rStream:           rStream,
 		machine:           mach,
+		audit:             auditSink,
 		updateEngineState: updateEngineState,
 	}
 }
@@ -263,7 +268,24 @@ func (e *Engine) clusterState() (*clusterState, error) {
 		return nil, err
 	}
 
-	return newClusterState(units, sUnits, machines), nil
+	cs := newClusterState(units, sUnits, machines)
+	if cs.reschedulesOnFailure() {
+		failures, err := e.registry.UnitFailures()
+		if err != nil {
+			log.Errorf("Failed fetching unit failures from Registry: %v", err)
+			return nil, err
+		}
+
+		states, err := e.registry.UnitStates()
+		if err != nil {
+			log.Errorf("Failed fetching UnitStates from Registry: %v", err)
+			return nil, err
+		}
+
+		cs.setFailures(failures, states)
+	}
+
+	return cs, nil
 }
 
 func (e *Engine) unscheduleUnit(name, machID string) (err error) {
@@ -0,0 +1,88 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/metrics"
+)
+
+// randomScheduler places each Job on an agent picked at random from all
+// those able to run it that best match the Job's preferences.
+type randomScheduler struct {
+	rnd *rand.Rand
+}
+
+func newRandomScheduler() *randomScheduler {
+	return &randomScheduler{
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (rs *randomScheduler) Decide(clust *clusterState, j *job.Job) (*decision, error) {
+	return rs.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return ableToRun(agents, as, j)
+	})
+}
+
+// DecideReschedule picks a random agent other than the Job's current target.
+func (rs *randomScheduler) DecideReschedule(clust *clusterState, j *job.Job) (*decision, error) {
+	return rs.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return as.MState.ID != j.TargetMachineID
+	})
+}
+
+func (rs *randomScheduler) decide(clust *clusterState, j *job.Job, eligible func([]*agent.AgentState, *agent.AgentState) bool) (*decision, error) {
+	// sort the agents first so that the same seed yields the same decisions
+	agents := (&leastLoadedScheduler{}).sortedAgents(clust)
+	if len(agents) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgents)
+		return nil, fmt.Errorf("zero agents available")
+	}
+
+	// only consider the eligible agents sharing the best preference score
+	best := -1
+	candidates := make([]*agent.AgentState, 0, len(agents))
+	for _, as := range agents {
+		if !eligible(agents, as) {
+			continue
+		}
+
+		score := as.PreferenceScore(j)
+		if score > best {
+			best = score
+			candidates = candidates[:0]
+		}
+		if score == best {
+			candidates = append(candidates, as)
+		}
+	}
+
+	if len(candidates) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgentsAbleToRun)
+		return nil, fmt.Errorf("no agents able to run job")
+	}
+
+	dec := decision{
+		machineID: candidates[rs.rnd.Intn(len(candidates))].MState.ID,
+	}
+
+	return &dec, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+)
+
+func TestRandomSchedulerDecisions(t *testing.T) {
+	machines := []machine.MachineState{
+		machine.MachineState{ID: "A", Metadata: map[string]string{"disk": "ssd"}},
+		machine.MachineState{ID: "B"},
+		machine.MachineState{ID: "C", Metadata: map[string]string{"disk": "ssd"}},
+	}
+	sched := &randomScheduler{rnd: rand.New(rand.NewSource(1))}
+
+	if _, err := sched.Decide(newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{}), &job.Job{Name: "foo.service"}); err == nil {
+		t.Errorf("expected error with zero agents")
+	}
+
+	j := &job.Job{Name: "foo.service", Unit: newUnitWithMetadata(t, "disk=ssd")}
+	seen := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		dec, err := sched.Decide(newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines), j)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[dec.machineID]++
+	}
+	if seen["B"] != 0 {
+		t.Errorf("scheduled to ineligible agent B %d times", seen["B"])
+	}
+	if seen["A"] == 0 || seen["C"] == 0 {
+		t.Errorf("expected decisions spread across A and C, got %v", seen)
+	}
+
+	j = &job.Job{Name: "foo.service", TargetMachineID: "A"}
+	for i := 0; i < 10; i++ {
+		dec, err := sched.DecideReschedule(newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines[:2]), j)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if dec.machineID != "B" {
+			t.Errorf("expected rescheduling to B, got %s", dec.machineID)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/resource"
+)
+
+const (
+	// DefaultRebalanceMaxMoves is the number of units the engine moves at
+	// most per reconciliation round while rebalancing.
+	DefaultRebalanceMaxMoves = 1
+)
+
+// RebalanceConfig controls how the Reconciler evens out the load of the
+// cluster, e.g. after machines have joined it.
+type RebalanceConfig struct {
+	// Enabled causes the Reconciler to rebalance in every round rather than
+	// only after a rebalance has been requested through the registry.
+	Enabled bool
+
+	// MaxMoves bounds the number of units moved in a single round. A value
+	// below 1 disables rebalancing altogether.
+	MaxMoves int
+}
+
+// shouldRebalance determines whether the current reconciliation round
+// should rebalance the cluster. A requested rebalance lasts until a round
+// finds nothing left to move.
+func (r *Reconciler) shouldRebalance(e *Engine) bool {
+	if r.rebalance.MaxMoves < 1 {
+		return false
+	}
+
+	if !r.rebalancing {
+		requested, err := e.cRegistry.TakeRebalanceRequest()
+		if err != nil {
+			log.Errorf("Failed checking for rebalance request: %v", err)
+		} else if requested {
+			log.Infof("Rebalancing cluster on request")
+		}
+		r.rebalancing = requested
+	}
+
+	return r.rebalance.Enabled || r.rebalancing
+}
+
+// calculateRebalanceTasks moves up to MaxMoves units, one at a time, from
+// a more loaded agent to a less loaded one, as long as their number of
+// units differs by more than one. Only units which the target agent is
+// able to run without any change to the rest of the cluster are moved;
+// units with Pinned=true, and units other units are bound to through
+// MachineOf, stay where they are.
+func (r *Reconciler) calculateRebalanceTasks(clust *clusterState, stopchan chan struct{}) (taskchan chan *task) {
+	taskchan = make(chan *task)
+
+	send := func(typ, reason, jName, machID string) bool {
+		select {
+		case <-stopchan:
+			return false
+		default:
+		}
+
+		taskchan <- &task{Type: typ, Reason: reason, JobName: jName, MachineID: machID}
+		return true
+	}
+
+	go func() {
+		defer close(taskchan)
+
+		for moved := 0; moved < r.rebalance.MaxMoves; moved++ {
+			from, to, j := findMove(clust)
+			if j == nil {
+				return
+			}
+
+			reason := fmt.Sprintf("rebalancing from Machine(%s) with %d units to Machine(%s) with %d units",
+				from.MState.ID, len(from.Units), to.MState.ID, len(to.Units))
+			if !send(taskTypeUnscheduleUnit, reason, j.Name, from.MState.ID) {
+				return
+			}
+			clust.unschedule(j.Name)
+
+			if !send(taskTypeAttemptScheduleUnit, reason, j.Name, to.MState.ID) {
+				return
+			}
+			clust.schedule(j.Name, to.MState.ID)
+		}
+	}()
+
+	return
+}
+
+// findMove picks the next unit to move and the agents to move it between.
+// Sources are tried from the most loaded agent down, and targets from the
+// least loaded one up, so that agents refusing every unit, e.g. because
+// they are cordoned, do not hold up the rest of the cluster. A nil Job is
+// returned if no pair of agents allows a move.
+func findMove(clust *clusterState) (from, to *agent.AgentState, j *job.Job) {
+	agents := (&leastLoadedScheduler{}).sortedAgents(clust)
+	for fi := len(agents) - 1; fi > 0; fi-- {
+		from = agents[fi]
+		for _, to = range agents[:fi] {
+			if len(from.Units)-len(to.Units) < 2 {
+				break
+			}
+			if j = movableJob(clust, agents, from, to); j != nil {
+				return from, to, j
+			}
+			log.Debugf("No unit movable from Machine(%s) to Machine(%s)", from.MState.ID, to.MState.ID)
+		}
+	}
+	return nil, nil, nil
+}
+
+// movableJob returns the first Job, by name, which can be moved from one
+// agent to another, or nil if there is none.
+func movableJob(clust *clusterState, agents []*agent.AgentState, from, to *agent.AgentState) *job.Job {
+	bound := make(map[string]bool)
+	for _, cj := range clust.jobs {
+		if !cj.Scheduled() {
+			continue
+		}
+		for _, peer := range cj.Peers() {
+			bound[peer] = true
+		}
+	}
+
+	names := make([]string, 0, len(from.Units))
+	for name := range from.Units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		j, ok := clust.jobs[name]
+		if !ok || j.Pinned() || bound[name] {
+			continue
+		}
+
+		// Evaluate the target as if the Job had already left its
+		// current agent, so that it does not count against itself.
+		u := from.Units[name]
+		delete(from.Units, name)
+		ok = ableToMove(agents, to, j)
+		from.Units[name] = u
+
+		if ok {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// ableToMove determines whether the agent can run the Job without having to
+// replace any other unit. If the Job declares Resources, the agent must also
+// have enough capacity left to hold them.
+func ableToMove(agents []*agent.AgentState, as *agent.AgentState, j *job.Job) bool {
+	if act, _ := as.AbleToRun(j); act != job.JobActionSchedule {
+		return false
+	}
+
+	if ok, _ := spreadAllows(agents, as, j); !ok {
+		return false
+	}
+
+	req, err := j.Resources()
+	if err != nil {
+		return false
+	}
+	return req.Empty() || resource.Fits(as.AvailableResources(), req)
+}
@@ -0,0 +1,307 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/unit"
+)
+
+type placement struct {
+	name   string
+	machID string
+	values []string
+}
+
+func newRebalanceClusterState(t *testing.T, machines []machine.MachineState, placements []placement) *clusterState {
+	jsLaunched := job.JobStateLaunched
+	units := make([]job.Unit, 0, len(placements))
+	sUnits := make([]job.ScheduledUnit, 0, len(placements))
+	for _, p := range placements {
+		contents := "[X-Fleet]"
+		for _, v := range p.values {
+			contents = fmt.Sprintf("%s\n%s", contents, v)
+		}
+		u, err := unit.NewUnitFile(contents)
+		if err != nil {
+			t.Fatalf("error creating unit from %q: %v", contents, err)
+		}
+		units = append(units, job.Unit{Name: p.name, Unit: *u, TargetState: jsLaunched})
+		sUnits = append(sUnits, job.ScheduledUnit{Name: p.name, State: &jsLaunched, TargetMachineID: p.machID})
+	}
+	return newClusterState(units, sUnits, machines)
+}
+
+func moveTasks(name, from, to string) []*task {
+	return []*task{
+		&task{Type: taskTypeUnscheduleUnit, JobName: name, MachineID: from},
+		&task{Type: taskTypeAttemptScheduleUnit, JobName: name, MachineID: to},
+	}
+}
+
+func TestCalculateRebalanceTasks(t *testing.T) {
+	machines := []machine.MachineState{
+		machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "ssd"}},
+		machine.MachineState{ID: "YYY"},
+	}
+
+	tests := []struct {
+		maxMoves   int
+		placements []placement
+		tasks      []*task
+	}{
+		// nothing to do in a balanced cluster
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "YYY", nil},
+			},
+			tasks: []*task{},
+		},
+		// a difference of one unit is as balanced as it gets
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", nil},
+			},
+			tasks: []*task{},
+		},
+		// move a single unit per round
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "XXX", nil},
+				{"c.service", "XXX", nil},
+				{"d.service", "XXX", nil},
+			},
+			tasks: moveTasks("a.service", "XXX", "YYY"),
+		},
+		// stop once balanced, even if more moves are allowed
+		{
+			maxMoves: 5,
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "XXX", nil},
+				{"c.service", "XXX", nil},
+				{"d.service", "XXX", nil},
+			},
+			tasks: append(moveTasks("a.service", "XXX", "YYY"), moveTasks("b.service", "XXX", "YYY")...),
+		},
+		// pinned units stay
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", []string{"Pinned=true"}},
+				{"b.service", "XXX", nil},
+			},
+			tasks: moveTasks("b.service", "XXX", "YYY"),
+		},
+		// units the target is unable to run stay
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", []string{"MachineMetadata=disk=ssd"}},
+				{"b.service", "XXX", nil},
+			},
+			tasks: moveTasks("b.service", "XXX", "YYY"),
+		},
+		// units whose Resources do not fit stay
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", []string{"Resources=cores=50"}},
+				{"b.service", "XXX", nil},
+			},
+			tasks: moveTasks("b.service", "XXX", "YYY"),
+		},
+		// units bound to another unit through MachineOf stay, as do the
+		// units they are bound to
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "XXX", []string{"MachineOf=a.service"}},
+				{"c.service", "XXX", nil},
+			},
+			tasks: moveTasks("c.service", "XXX", "YYY"),
+		},
+		// conflicts are respected
+		{
+			maxMoves: 1,
+			placements: []placement{
+				{"a.service", "XXX", []string{"Conflicts=c.service"}},
+				{"b.service", "XXX", []string{"Pinned=true"}},
+				{"c.service", "YYY", nil},
+				{"d.service", "XXX", nil},
+				{"e.service", "XXX", nil},
+			},
+			tasks: moveTasks("d.service", "XXX", "YYY"),
+		},
+		// nothing movable
+		{
+			maxMoves: 5,
+			placements: []placement{
+				{"a.service", "XXX", []string{"Pinned=true"}},
+				{"b.service", "XXX", []string{"MachineID=XXX"}},
+			},
+			tasks: []*task{},
+		},
+	}
+
+	for i, tt := range tests {
+		r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{MaxMoves: tt.maxMoves})
+		clust := newRebalanceClusterState(t, machines, tt.placements)
+		tasks := make([]*task, 0)
+		for tsk := range r.calculateRebalanceTasks(clust, make(chan struct{})) {
+			tsk.Reason = ""
+			tasks = append(tasks, tsk)
+		}
+
+		if !reflect.DeepEqual(tt.tasks, tasks) {
+			t.Errorf("case %d: task mismatch\nexpected %v\n got %v", i, tt.tasks, tasks)
+		}
+	}
+}
+
+func TestCalculateRebalanceTasksRefusingTargets(t *testing.T) {
+	tests := []struct {
+		machines   []machine.MachineState
+		placements []placement
+		tasks      []*task
+	}{
+		// the least loaded machine is cordoned, so the next one takes
+		// the unit
+		{
+			machines: []machine.MachineState{
+				machine.MachineState{ID: "AAA", Cordoned: true},
+				machine.MachineState{ID: "XXX"},
+				machine.MachineState{ID: "YYY"},
+			},
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "XXX", nil},
+				{"c.service", "XXX", nil},
+				{"d.service", "XXX", nil},
+				{"e.service", "YYY", nil},
+			},
+			tasks: moveTasks("a.service", "XXX", "YYY"),
+		},
+		// the least loaded machine lacks the metadata every unit requires
+		{
+			machines: []machine.MachineState{
+				machine.MachineState{ID: "AAA"},
+				machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "ssd"}},
+				machine.MachineState{ID: "YYY", Metadata: map[string]string{"disk": "ssd"}},
+			},
+			placements: []placement{
+				{"a.service", "XXX", []string{"MachineMetadata=disk=ssd"}},
+				{"b.service", "XXX", []string{"MachineMetadata=disk=ssd"}},
+				{"c.service", "XXX", []string{"MachineMetadata=disk=ssd"}},
+			},
+			tasks: moveTasks("a.service", "XXX", "YYY"),
+		},
+		// the most loaded machine has nothing movable, but the next one
+		// does
+		{
+			machines: []machine.MachineState{
+				machine.MachineState{ID: "AAA"},
+				machine.MachineState{ID: "XXX"},
+				machine.MachineState{ID: "YYY"},
+			},
+			placements: []placement{
+				{"a.service", "XXX", []string{"Pinned=true"}},
+				{"b.service", "XXX", []string{"Pinned=true"}},
+				{"c.service", "XXX", []string{"Pinned=true"}},
+				{"d.service", "YYY", []string{"Pinned=true"}},
+				{"e.service", "YYY", nil},
+			},
+			tasks: moveTasks("e.service", "YYY", "AAA"),
+		},
+		// no pair of machines allows a move
+		{
+			machines: []machine.MachineState{
+				machine.MachineState{ID: "AAA", Cordoned: true},
+				machine.MachineState{ID: "XXX"},
+			},
+			placements: []placement{
+				{"a.service", "XXX", nil},
+				{"b.service", "XXX", nil},
+			},
+			tasks: []*task{},
+		},
+	}
+
+	for i, tt := range tests {
+		r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{MaxMoves: 5})
+		clust := newRebalanceClusterState(t, tt.machines, tt.placements)
+		tasks := make([]*task, 0)
+		for tsk := range r.calculateRebalanceTasks(clust, make(chan struct{})) {
+			tsk.Reason = ""
+			tasks = append(tasks, tsk)
+		}
+
+		if !reflect.DeepEqual(tt.tasks, tasks) {
+			t.Errorf("case %d: task mismatch\nexpected %v\n got %v", i, tt.tasks, tasks)
+		}
+	}
+}
+
+func TestShouldRebalance(t *testing.T) {
+	tests := []struct {
+		cfg       RebalanceConfig
+		requested bool
+		want      bool
+	}{
+		{RebalanceConfig{Enabled: false, MaxMoves: 1}, false, false},
+		{RebalanceConfig{Enabled: false, MaxMoves: 1}, true, true},
+		{RebalanceConfig{Enabled: true, MaxMoves: 1}, false, true},
+		{RebalanceConfig{Enabled: true, MaxMoves: 0}, false, false},
+		{RebalanceConfig{Enabled: false, MaxMoves: 0}, true, false},
+	}
+
+	for i, tt := range tests {
+		fcr := registry.NewFakeClusterRegistry(nil, 0)
+		if tt.requested {
+			fcr.RequestRebalance()
+		}
+		e := &Engine{cRegistry: fcr}
+		r := NewReconciler(&leastLoadedScheduler{}, tt.cfg)
+
+		if got := r.shouldRebalance(e); got != tt.want {
+			t.Errorf("case %d: expected %t, got %t", i, tt.want, got)
+		}
+	}
+
+	// a requested rebalance lasts until it is finished
+	fcr := registry.NewFakeClusterRegistry(nil, 0)
+	fcr.RequestRebalance()
+	e := &Engine{cRegistry: fcr}
+	r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{MaxMoves: 1})
+	if !r.shouldRebalance(e) || !r.shouldRebalance(e) {
+		t.Errorf("expected requested rebalance to last")
+	}
+	r.rebalancing = false
+	if r.shouldRebalance(e) {
+		t.Errorf("expected finished rebalance to end")
+	}
+}
@@ -18,14 +18,16 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/metrics"
 )
 
 const (
-	taskTypeUnscheduleUnit      = "UnscheduleUnit"
-	taskTypeAttemptScheduleUnit = "AttemptScheduleUnit"
+	taskTypeUnscheduleUnit       = "UnscheduleUnit"
+	taskTypeAttemptScheduleUnit  = "AttemptScheduleUnit"
+	taskTypeUnscheduleFailedUnit = "UnscheduleFailedUnit"
 )
 
 type task struct {
@@ -39,14 +41,24 @@ func (t *task) String() string {
 	return fmt.Sprintf("{Type: %s, JobName: %s, MachineID: %s, Reason: %q}", t.Type, t.JobName, t.MachineID, t.Reason)
 }
 
-func NewReconciler() *Reconciler {
+func NewReconciler(sched Scheduler, rebalance RebalanceConfig) *Reconciler {
 	return &Reconciler{
-		sched: &leastLoadedScheduler{},
+		sched:     sched,
+		rebalance: rebalance,
 	}
 }
 
 type Reconciler struct {
-	sched Scheduler
+	sched     Scheduler
+	rebalance RebalanceConfig
+
+	// rebalancing is set while a requested rebalance is in progress
+	rebalancing bool
+
+	// exhausted holds the time of the last failure of the jobs found to
+	// have exhausted their failure budget in the last round, so that this
+	// is reported once rather than in every round
+	exhausted map[string]time.Time
 }
 
 func (r *Reconciler) Reconcile(e *Engine, stop chan struct{}) {
@@ -67,6 +79,20 @@ func (r *Reconciler) Reconcile(e *Engine, stop chan struct{}) {
 		}
 	}
 
+	if r.shouldRebalance(e) {
+		moved := false
+		for t := range r.calculateRebalanceTasks(clust, stop) {
+			err = doTask(t, e)
+			if err != nil {
+				log.Errorf("Failed resolving task: task=%s err=%v", t, err)
+			}
+			moved = true
+		}
+		if !moved {
+			r.rebalancing = false
+		}
+	}
+
 	metrics.ReportEngineReconcileSuccess(start)
 }
 
@@ -165,11 +191,27 @@ func (r *Reconciler) calculateClusterTasks(clust *clusterState, stopchan chan st
 	go func() {
 		defer close(taskchan)
 
+		now := time.Now()
+
 		for _, j := range clust.jobs {
 			if !j.Scheduled() {
 				continue
 			}
 
+			if j.RescheduleOnFailure() && j.TargetState == job.JobStateLaunched && clust.failedOn(j.Name, j.TargetMachineID) {
+				reason := fmt.Sprintf("unit failed on target Machine(%s)", j.TargetMachineID)
+				if !send(taskTypeUnscheduleFailedUnit, reason, j.Name, j.TargetMachineID) {
+					log.Infof("Job(%s) send failed.", j.Name)
+					metrics.ReportEngineReconcileFailure(metrics.ScheduleFailure)
+					return
+				}
+
+				log.Debugf("Job(%s) failed, unscheduling.", j.Name)
+				clust.recordFailure(j.Name, j.TargetMachineID, now)
+				clust.unschedule(j.Name)
+				continue
+			}
+
 			act, reason := decide(j)
 			if act == job.JobActionReschedule && handle_reschedule(j, reason) {
 				log.Debugf("Job(%s) is rescheduled: %v", j.Name, reason)
@@ -192,15 +234,28 @@ func (r *Reconciler) calculateClusterTasks(clust *clusterState, stopchan chan st
 			clust.unschedule(j.Name)
 		}
 
+		exhausted := make(map[string]time.Time)
 		for _, j := range clust.jobs {
 			if j.Scheduled() || j.TargetState == job.JobStateInactive {
 				continue
 			}
 
+			if clust.waitingAfterFailure(j, now) {
+				log.Debugf("Job(%s) failed recently, not scheduling it yet", j.Name)
+				continue
+			}
+
 			dec, err := r.sched.Decide(clust, j)
 			if err != nil {
 				log.Debugf("Unable to schedule Job(%s): %v", j.Name, err)
 				metrics.ReportEngineReconcileFailure(metrics.ScheduleFailure)
+				if clust.failureBudgetExhausted(j) {
+					exhausted[j.Name] = j.Failures.Last
+					if r.newlyExhausted(j) {
+						log.Infof("Job(%s) failed too often on every machine, no longer scheduling it", j.Name)
+						metrics.ReportEngineFailureReschedule(metrics.FailureBudgetExhausted)
+					}
+				}
 				continue
 			}
 
@@ -212,23 +267,67 @@ func (r *Reconciler) calculateClusterTasks(clust *clusterState, stopchan chan st
 
 			clust.schedule(j.Name, dec.machineID)
 		}
+		r.exhausted = exhausted
 	}()
 
 	return
 }
 
+// newlyExhausted returns whether the job, which exhausted its failure
+// budget, was not found to have done so in the last round since its last
+// failure.
+func (r *Reconciler) newlyExhausted(j *job.Job) bool {
+	last, ok := r.exhausted[j.Name]
+	return !ok || !last.Equal(j.Failures.Last)
+}
+
 func doTask(t *task, e *Engine) (err error) {
+	rec := audit.Record{
+		Source:    audit.SourceEngine,
+		UnitName:  t.JobName,
+		MachineID: t.MachineID,
+		Reason:    t.Reason,
+	}
+
 	switch t.Type {
 	case taskTypeUnscheduleUnit:
 		err = e.unscheduleUnit(t.JobName, t.MachineID)
 		metrics.ReportEngineTask(t.Type)
+		rec.Action = audit.ActionUnschedule
+		rec.OldState = t.MachineID
+	case taskTypeUnscheduleFailedUnit:
+		err = e.registry.RecordUnitFailure(t.JobName, t.MachineID)
+		if err != nil {
+			log.Errorf("Failed recording failure of Unit(%s) on Machine(%s): %v", t.JobName, t.MachineID, err)
+		} else {
+			err = e.unscheduleUnit(t.JobName, t.MachineID)
+		}
+		if err == nil {
+			metrics.ReportEngineFailureReschedule(metrics.FailureRescheduled)
+		}
+		metrics.ReportEngineTask(t.Type)
+		rec.Action = audit.ActionUnschedule
+		rec.OldState = t.MachineID
 	case taskTypeAttemptScheduleUnit:
-		e.attemptScheduleUnit(t.JobName, t.MachineID)
+		if !e.attemptScheduleUnit(t.JobName, t.MachineID) {
+			// the failure was logged, and the unit is scheduled again
+			// during the next reconciliation
+			rec.Error = "failed persisting scheduling decision"
+		}
 		metrics.ReportEngineTask(t.Type)
+		rec.Action = audit.ActionSchedule
+		rec.NewState = t.MachineID
 	default:
 		err = fmt.Errorf("unrecognized task type %q", t.Type)
 	}
 
+	if rec.Action != "" {
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		audit.Write(e.audit, rec)
+	}
+
 	if err == nil {
 		log.Infof("EngineReconciler completed task: %s", t)
 	} else {
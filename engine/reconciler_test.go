@@ -17,9 +17,13 @@ package engine
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/unit"
 )
 
 func TestCalculateClusterTasks(t *testing.T) {
@@ -157,7 +161,7 @@ func TestCalculateClusterTasks(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		r := NewReconciler()
+		r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{})
 		tasks := make([]*task, 0)
 		for tsk := range r.calculateClusterTasks(tt.clust, make(chan struct{})) {
 			tasks = append(tasks, tsk)
@@ -168,3 +172,200 @@ func TestCalculateClusterTasks(t *testing.T) {
 		}
 	}
 }
+
+func TestDoTaskAudit(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetJobs([]job.Job{{Name: "foo.service", TargetMachineID: "XXX"}})
+	e := &Engine{registry: fr, audit: audit.NewRegistrySink(fr)}
+
+	tasks := []*task{
+		{Type: taskTypeUnscheduleUnit, Reason: "target Machine(XXX) went away", JobName: "foo.service", MachineID: "XXX"},
+		{Type: taskTypeAttemptScheduleUnit, Reason: "target state launched and unit not scheduled", JobName: "foo.service", MachineID: "YYY"},
+		// scheduling a unit missing from the registry fails
+		{Type: taskTypeAttemptScheduleUnit, Reason: "target state launched and unit not scheduled", JobName: "bar.service", MachineID: "YYY"},
+	}
+	for _, tsk := range tasks {
+		if err := doTask(tsk, e); err != nil {
+			t.Fatalf("doTask %s failed: %v", tsk, err)
+		}
+	}
+
+	records, err := fr.AuditRecords()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []audit.Record{
+		{Source: audit.SourceEngine, Action: audit.ActionUnschedule, UnitName: "foo.service", MachineID: "XXX", OldState: "XXX", Reason: tasks[0].Reason},
+		{Source: audit.SourceEngine, Action: audit.ActionSchedule, UnitName: "foo.service", MachineID: "YYY", NewState: "YYY", Reason: tasks[1].Reason},
+		{Source: audit.SourceEngine, Action: audit.ActionSchedule, UnitName: "bar.service", MachineID: "YYY", NewState: "YYY", Reason: tasks[2].Reason, Error: "failed persisting scheduling decision"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d audit records, got %v", len(want), records)
+	}
+	for i := range records {
+		if records[i].Time.IsZero() {
+			t.Errorf("record %d was not stamped with a time", i)
+		}
+		records[i].Time = want[i].Time
+		if !reflect.DeepEqual(records[i], want[i]) {
+			t.Errorf("record %d is %#v, want %#v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestCalculateClusterTasksRescheduleOnFailure(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
+	machines := []machine.MachineState{{ID: "XXX"}, {ID: "YYY"}}
+	newState := func(contents, target string, failures map[string]job.UnitFailures, states []*unit.UnitState) *clusterState {
+		u := newJobWithXFleetValues(t, "foo.service", contents)
+		cs := newClusterState(
+			[]job.Unit{{Name: "foo.service", Unit: u.Unit, TargetState: job.JobStateLaunched}},
+			[]job.ScheduledUnit{{Name: "foo.service", State: &jsLaunched, TargetMachineID: target}},
+			machines,
+		)
+		cs.setFailures(failures, states)
+		return cs
+	}
+	failedOnXXX := []*unit.UnitState{unit.NewUnitState("loaded", "failed", "failed", "XXX")}
+	for _, us := range failedOnXXX {
+		us.UnitName = "foo.service"
+	}
+
+	tests := []struct {
+		clust *clusterState
+		tasks []*task
+	}{
+		// a failed unit is unscheduled, and not scheduled again while
+		// its machine still reports it as failed
+		{
+			clust: newState("RescheduleOnFailure=true", "XXX", nil, failedOnXXX),
+			tasks: []*task{
+				{
+					Type:      taskTypeUnscheduleFailedUnit,
+					Reason:    "unit failed on target Machine(XXX)",
+					JobName:   "foo.service",
+					MachineID: "XXX",
+				},
+			},
+		},
+		// a failed unit is left alone without RescheduleOnFailure
+		{
+			clust: newState("Pinned=false", "XXX", nil, failedOnXXX),
+			tasks: []*task{},
+		},
+		// the unit is scheduled away from the machines it failed on
+		{
+			clust: newState("RescheduleOnFailure=true", "", map[string]job.UnitFailures{
+				"foo.service": {Machines: map[string]int{"XXX": 1}, Last: time.Now().Add(-time.Hour)},
+			}, nil),
+			tasks: []*task{
+				{
+					Type:      taskTypeAttemptScheduleUnit,
+					Reason:    "target state launched and unit not scheduled",
+					JobName:   "foo.service",
+					MachineID: "YYY",
+				},
+			},
+		},
+		// the unit is not scheduled during its backoff
+		{
+			clust: newState("RescheduleOnFailure=true\nBackoff=1h", "", map[string]job.UnitFailures{
+				"foo.service": {Machines: map[string]int{"XXX": 1}, Last: time.Now()},
+			}, nil),
+			tasks: []*task{},
+		},
+		// the unit is not scheduled once it failed too often everywhere
+		{
+			clust: newState("RescheduleOnFailure=true\nMaxFailuresPerMachine=2", "", map[string]job.UnitFailures{
+				"foo.service": {Machines: map[string]int{"XXX": 2, "YYY": 2}, Last: time.Now().Add(-time.Hour)},
+			}, nil),
+			tasks: []*task{},
+		},
+	}
+
+	for i, tt := range tests {
+		r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{})
+		tasks := make([]*task, 0)
+		for tsk := range r.calculateClusterTasks(tt.clust, make(chan struct{})) {
+			tasks = append(tasks, tsk)
+		}
+
+		if !reflect.DeepEqual(tt.tasks, tasks) {
+			t.Errorf("case %d: task mismatch\nexpected %v\n got %v", i, tt.tasks, tasks)
+		}
+	}
+}
+
+func TestCalculateClusterTasksFailureBudgetExhausted(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
+	u := newJobWithXFleetValues(t, "foo.service", "RescheduleOnFailure=true\nMaxFailuresPerMachine=1")
+	newState := func(last time.Time) *clusterState {
+		cs := newClusterState(
+			[]job.Unit{{Name: "foo.service", Unit: u.Unit, TargetState: job.JobStateLaunched}},
+			[]job.ScheduledUnit{{Name: "foo.service", State: &jsLaunched}},
+			[]machine.MachineState{{ID: "XXX"}},
+		)
+		cs.setFailures(map[string]job.UnitFailures{
+			"foo.service": {Machines: map[string]int{"XXX": 1}, Last: last},
+		}, nil)
+		return cs
+	}
+	round := func(r *Reconciler, cs *clusterState) {
+		for range r.calculateClusterTasks(cs, make(chan struct{})) {
+		}
+	}
+
+	r := NewReconciler(&leastLoadedScheduler{}, RebalanceConfig{})
+	first := time.Now().Add(-time.Hour)
+	cs := newState(first)
+	if !r.newlyExhausted(cs.jobs["foo.service"]) {
+		t.Fatalf("exhausted budget not reported in the first round")
+	}
+	round(r, cs)
+
+	cs = newState(first)
+	if r.newlyExhausted(cs.jobs["foo.service"]) {
+		t.Errorf("exhausted budget reported again in the following round")
+	}
+	round(r, cs)
+
+	// a later failure exhausts the budget anew
+	cs = newState(first.Add(time.Minute))
+	if !r.newlyExhausted(cs.jobs["foo.service"]) {
+		t.Errorf("exhausted budget not reported after a new failure")
+	}
+	round(r, cs)
+
+	// jobs no longer exhausting their budget are forgotten
+	round(r, newClusterState(nil, nil, nil))
+	if len(r.exhausted) != 0 {
+		t.Errorf("expected no exhausted jobs, got %v", r.exhausted)
+	}
+}
+
+func TestDoTaskUnscheduleFailedUnit(t *testing.T) {
+	fr := registry.NewFakeRegistry()
+	fr.SetJobs([]job.Job{{Name: "foo.service", TargetMachineID: "XXX"}})
+	e := &Engine{registry: fr}
+
+	tsk := &task{Type: taskTypeUnscheduleFailedUnit, Reason: "unit failed on target Machine(XXX)", JobName: "foo.service", MachineID: "XXX"}
+	if err := doTask(tsk, e); err != nil {
+		t.Fatalf("doTask %s failed: %v", tsk, err)
+	}
+
+	su, err := fr.ScheduledUnit("foo.service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if su.TargetMachineID != "" {
+		t.Errorf("failed unit is still scheduled to Machine(%s)", su.TargetMachineID)
+	}
+
+	failures, err := fr.UnitFailures()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := failures["foo.service"].Machines; !reflect.DeepEqual(got, map[string]int{"XXX": 1}) {
+		t.Errorf("unexpected failures recorded: %v", got)
+	}
+}
@@ -17,9 +17,11 @@ package engine
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/coreos/fleet/agent"
 	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/metrics"
 )
 
 type decision struct {
@@ -31,18 +33,79 @@ type Scheduler interface {
 	DecideReschedule(*clusterState, *job.Job) (*decision, error)
 }
 
+// DefaultScheduler is the name of the scheduling strategy used when none
+// is configured
+const DefaultScheduler = "least-loaded"
+
+// schedulerFactory builds a Scheduler from the (possibly empty) argument
+// following the strategy name, e.g. "region" in "spread:region"
+type schedulerFactory func(arg string) (Scheduler, error)
+
+// schedulers holds all known scheduling strategies, keyed by name
+var schedulers = map[string]schedulerFactory{
+	"least-loaded": func(arg string) (Scheduler, error) {
+		return &leastLoadedScheduler{}, nil
+	},
+	"bin-pack": func(arg string) (Scheduler, error) {
+		return &binPackScheduler{}, nil
+	},
+	"random": func(arg string) (Scheduler, error) {
+		return newRandomScheduler(), nil
+	},
+	"spread": func(arg string) (Scheduler, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("spread scheduler requires a metadata key, e.g. spread:region")
+		}
+		return &spreadScheduler{key: arg}, nil
+	},
+}
+
+// SchedulerNames returns the sorted names of all known scheduling strategies
+func SchedulerNames() []string {
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewScheduler returns the Scheduler implementing the named strategy. The
+// name takes the form STRATEGY[:ARGUMENT], e.g. "least-loaded" or
+// "spread:region". An empty name selects the DefaultScheduler.
+func NewScheduler(name string) (Scheduler, error) {
+	if name == "" {
+		name = DefaultScheduler
+	}
+
+	parts := strings.SplitN(name, ":", 2)
+	factory, ok := schedulers[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler %q, must be one of %s", parts[0], strings.Join(SchedulerNames(), ", "))
+	}
+
+	var arg string
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	return factory(arg)
+}
+
 type leastLoadedScheduler struct{}
 
 func (lls *leastLoadedScheduler) Decide(clust *clusterState, j *job.Job) (*decision, error) {
 	agents := lls.sortedAgents(clust)
+	sortByPreference(agents, j)
 
 	if len(agents) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgents)
 		return nil, fmt.Errorf("zero agents available")
 	}
 
 	var target *agent.AgentState
 	for _, as := range agents {
-		if act, _ := as.AbleToRun(j); act == job.JobActionUnschedule {
+		if !ableToRun(agents, as, j) {
 			continue
 		}
 
@@ -52,6 +115,7 @@ func (lls *leastLoadedScheduler) Decide(clust *clusterState, j *job.Job) (*decis
 	}
 
 	if target == nil {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgentsAbleToRun)
 		return nil, fmt.Errorf("no agents able to run job")
 	}
 
@@ -69,8 +133,10 @@ func (lls *leastLoadedScheduler) Decide(clust *clusterState, j *job.Job) (*decis
 // before getting into the function.
 func (lls *leastLoadedScheduler) DecideReschedule(clust *clusterState, j *job.Job) (*decision, error) {
 	agents := lls.sortedAgents(clust)
+	sortByPreference(agents, j)
 
 	if len(agents) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgents)
 		return nil, fmt.Errorf("zero agents available")
 	}
 
@@ -88,6 +154,7 @@ func (lls *leastLoadedScheduler) DecideReschedule(clust *clusterState, j *job.Jo
 	}
 
 	if !found {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgentsAbleToRun)
 		return nil, fmt.Errorf("no agents able to run job")
 	}
 
@@ -122,3 +189,28 @@ func (sas sortableAgentStates) Less(i, j int) bool {
 	njUnits := len(sas[j].Units)
 	return niUnits < njUnits || (niUnits == njUnits && sas[i].MState.ID < sas[j].MState.ID)
 }
+
+// sortByPreference orders the agents by how well they match the soft
+// preferences of the given Job, best first. The sort is stable, so agents
+// with equal scores keep their existing relative order.
+func sortByPreference(agents []*agent.AgentState, j *job.Job) {
+	scores := make(map[string]int, len(agents))
+	for _, as := range agents {
+		scores[as.MState.ID] = as.PreferenceScore(j)
+	}
+	sort.Stable(preferenceSortableAgentStates{agents, scores})
+}
+
+type preferenceSortableAgentStates struct {
+	agents []*agent.AgentState
+	scores map[string]int
+}
+
+func (psas preferenceSortableAgentStates) Len() int { return len(psas.agents) }
+func (psas preferenceSortableAgentStates) Swap(i, j int) {
+	psas.agents[i], psas.agents[j] = psas.agents[j], psas.agents[i]
+}
+
+func (psas preferenceSortableAgentStates) Less(i, j int) bool {
+	return psas.scores[psas.agents[i].MState.ID] > psas.scores[psas.agents[j].MState.ID]
+}
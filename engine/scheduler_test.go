@@ -25,6 +25,7 @@ import (
 )
 
 func TestSchedulerDecisions(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
 	tests := []struct {
 		clust *clusterState
 		job   *job.Job
@@ -45,6 +46,82 @@ func TestSchedulerDecisions(t *testing.T) {
 				machineID: "XXX",
 			},
 		},
+
+		// cordoned machines are skipped
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{machine.MachineState{ID: "XXX", Cordoned: true}, machine.MachineState{ID: "YYY"}}),
+			job:   &job.Job{Name: "foo.service"},
+			dec: &decision{
+				machineID: "YYY",
+			},
+		},
+
+		// preferred metadata outranks the number of units
+		{
+			clust: newClusterState(
+				[]job.Unit{
+					job.Unit{Name: "bar.service", TargetState: job.JobStateLaunched},
+				},
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "bar.service", State: &jsLaunched, TargetMachineID: "YYY"},
+				},
+				[]machine.MachineState{
+					machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "hdd"}},
+					machine.MachineState{ID: "YYY", Metadata: map[string]string{"disk": "ssd"}},
+				},
+			),
+			job: newJobWithXFleetValues(t, "foo.service", "PreferMachineMetadata=disk=ssd"),
+			dec: &decision{
+				machineID: "YYY",
+			},
+		},
+
+		// preferences are not requirements
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{machine.MachineState{ID: "XXX"}, machine.MachineState{ID: "YYY"}}),
+			job:   newJobWithXFleetValues(t, "foo.service", "PreferMachineMetadata=disk=ssd", "PreferMachineOf=db.service"),
+			dec: &decision{
+				machineID: "XXX",
+			},
+		},
+
+		// prefer the machine hosting a preferred peer
+		{
+			clust: newClusterState(
+				[]job.Unit{
+					job.Unit{Name: "db.service", TargetState: job.JobStateLaunched},
+				},
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "db.service", State: &jsLaunched, TargetMachineID: "YYY"},
+				},
+				[]machine.MachineState{machine.MachineState{ID: "XXX"}, machine.MachineState{ID: "YYY"}},
+			),
+			job: newJobWithXFleetValues(t, "foo.service", "PreferMachineOf=db.service"),
+			dec: &decision{
+				machineID: "YYY",
+			},
+		},
+
+		// a higher score wins, ties are broken by number of units
+		{
+			clust: newClusterState(
+				[]job.Unit{
+					job.Unit{Name: "db.service", TargetState: job.JobStateLaunched},
+				},
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "db.service", State: &jsLaunched, TargetMachineID: "XXX"},
+				},
+				[]machine.MachineState{
+					machine.MachineState{ID: "XXX", Metadata: map[string]string{"disk": "ssd"}},
+					machine.MachineState{ID: "YYY", Metadata: map[string]string{"disk": "ssd"}},
+					machine.MachineState{ID: "ZZZ", Metadata: map[string]string{"disk": "ssd"}},
+				},
+			),
+			job: newJobWithXFleetValues(t, "foo.service", "PreferMachineMetadata=disk=ssd"),
+			dec: &decision{
+				machineID: "YYY",
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -175,3 +252,41 @@ func TestAgentStateSorting(t *testing.T) {
 		}
 	}
 }
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		name  string
+		sched Scheduler
+	}{
+		{"", &leastLoadedScheduler{}},
+		{"least-loaded", &leastLoadedScheduler{}},
+		{"bin-pack", &binPackScheduler{}},
+		{"spread:rack", &spreadScheduler{key: "rack"}},
+		{"spread", nil},
+		{"spread:", nil},
+		{"best", nil},
+	}
+
+	for i, tt := range tests {
+		sched, err := NewScheduler(tt.name)
+		if tt.sched == nil {
+			if err == nil {
+				t.Errorf("case %d: expected error for %q", i, tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.sched, sched) {
+			t.Errorf("case %d: expected scheduler %#v, got %#v", i, tt.sched, sched)
+		}
+	}
+
+	if sched, err := NewScheduler("random"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if _, ok := sched.(*randomScheduler); !ok {
+		t.Errorf("expected random scheduler, got %#v", sched)
+	}
+}
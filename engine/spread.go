@@ -0,0 +1,106 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/metrics"
+)
+
+// spreadScheduler distributes Jobs evenly across the values of a machine
+// metadata key, e.g. across regions or racks. Each Job is placed in the
+// domain currently running the fewest units, and within that domain on the
+// agent best matching the Job's preferences, then the least-loaded one.
+// Machines lacking the key are only used if no machine carrying it is able
+// to run the Job.
+type spreadScheduler struct {
+	key string
+}
+
+func (ss *spreadScheduler) Decide(clust *clusterState, j *job.Job) (*decision, error) {
+	return ss.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return ableToRun(agents, as, j)
+	})
+}
+
+// DecideReschedule picks the least-loaded agent of the least-loaded domain,
+// excluding the Job's current target.
+func (ss *spreadScheduler) DecideReschedule(clust *clusterState, j *job.Job) (*decision, error) {
+	return ss.decide(clust, j, func(agents []*agent.AgentState, as *agent.AgentState) bool {
+		return as.MState.ID != j.TargetMachineID
+	})
+}
+
+func (ss *spreadScheduler) decide(clust *clusterState, j *job.Job, eligible func([]*agent.AgentState, *agent.AgentState) bool) (*decision, error) {
+	agents := (&leastLoadedScheduler{}).sortedAgents(clust)
+	if len(agents) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgents)
+		return nil, fmt.Errorf("zero agents available")
+	}
+
+	// count units per domain across all agents, eligible or not
+	load := make(map[string]int)
+	for _, as := range agents {
+		load[as.MState.Metadata[ss.key]] += len(as.Units)
+	}
+
+	// once sorted by preference, and then by load, the first eligible
+	// agent seen for a domain is the one to use within it
+	sortByPreference(agents, j)
+	targets := make(map[string]*agent.AgentState)
+	domains := make([]string, 0)
+	for _, as := range agents {
+		domain := as.MState.Metadata[ss.key]
+		if _, ok := targets[domain]; ok || !eligible(agents, as) {
+			continue
+		}
+		targets[domain] = as
+		domains = append(domains, domain)
+	}
+
+	if len(domains) == 0 {
+		metrics.ReportEngineScheduleFailure(metrics.NoAgentsAbleToRun)
+		return nil, fmt.Errorf("no agents able to run job")
+	}
+
+	sort.Sort(sortableDomains{domains, load})
+
+	dec := decision{
+		machineID: targets[domains[0]].MState.ID,
+	}
+
+	return &dec, nil
+}
+
+type sortableDomains struct {
+	names []string
+	load  map[string]int
+}
+
+func (sd sortableDomains) Len() int      { return len(sd.names) }
+func (sd sortableDomains) Swap(i, j int) { sd.names[i], sd.names[j] = sd.names[j], sd.names[i] }
+
+func (sd sortableDomains) Less(i, j int) bool {
+	// the domain of machines lacking the key always sorts last
+	if (sd.names[i] == "") != (sd.names[j] == "") {
+		return sd.names[j] == ""
+	}
+	li, lj := sd.load[sd.names[i]], sd.load[sd.names[j]]
+	return li < lj || (li == lj && sd.names[i] < sd.names[j])
+}
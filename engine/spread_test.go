@@ -0,0 +1,131 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+)
+
+func TestSpreadSchedulerDecisions(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
+	machines := []machine.MachineState{
+		machine.MachineState{ID: "A", Metadata: map[string]string{"region": "us-east"}},
+		machine.MachineState{ID: "B", Metadata: map[string]string{"region": "us-east"}},
+		machine.MachineState{ID: "C", Metadata: map[string]string{"region": "us-west"}},
+		machine.MachineState{ID: "D"},
+	}
+	launched := func(names ...string) []job.Unit {
+		units := make([]job.Unit, len(names))
+		for i, name := range names {
+			units[i] = job.Unit{Name: name, TargetState: job.JobStateLaunched}
+		}
+		return units
+	}
+
+	tests := []struct {
+		clust *clusterState
+		job   *job.Job
+		dec   *decision
+	}{
+		// no machines to receive job
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, []machine.MachineState{}),
+			job:   &job.Job{Name: "foo.service"},
+			dec:   nil,
+		},
+
+		// empty cluster: first domain alphabetically, least-loaded agent
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines),
+			job:   &job.Job{Name: "foo.service"},
+			dec:   &decision{machineID: "A"},
+		},
+
+		// prefer the domain running fewer units, even if one of its
+		// agents is busier than an agent elsewhere
+		{
+			clust: newClusterState(
+				launched("1.service", "2.service", "3.service"),
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "1.service", State: &jsLaunched, TargetMachineID: "A"},
+					job.ScheduledUnit{Name: "2.service", State: &jsLaunched, TargetMachineID: "A"},
+					job.ScheduledUnit{Name: "3.service", State: &jsLaunched, TargetMachineID: "C"},
+				},
+				machines,
+			),
+			job: &job.Job{Name: "foo.service"},
+			dec: &decision{machineID: "C"},
+		},
+		{
+			clust: newClusterState(
+				launched("1.service", "2.service", "3.service"),
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "1.service", State: &jsLaunched, TargetMachineID: "A"},
+					job.ScheduledUnit{Name: "2.service", State: &jsLaunched, TargetMachineID: "C"},
+					job.ScheduledUnit{Name: "3.service", State: &jsLaunched, TargetMachineID: "C"},
+				},
+				machines,
+			),
+			job: &job.Job{Name: "foo.service"},
+			dec: &decision{machineID: "B"},
+		},
+
+		// machines without the key are used as a last resort
+		{
+			clust: newClusterState(
+				launched("1.service"),
+				[]job.ScheduledUnit{
+					job.ScheduledUnit{Name: "1.service", State: &jsLaunched, TargetMachineID: "C"},
+				},
+				machines[2:],
+			),
+			job: &job.Job{Name: "foo.service"},
+			dec: &decision{machineID: "C"},
+		},
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines[3:]),
+			job:   &job.Job{Name: "foo.service"},
+			dec:   &decision{machineID: "D"},
+		},
+
+		// other requirements are still honoured
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines),
+			job:   &job.Job{Name: "foo.service", Unit: newUnitWithMetadata(t, "region=us-north")},
+			dec:   nil,
+		},
+	}
+
+	for i, tt := range tests {
+		sched := &spreadScheduler{key: "region"}
+		dec, err := sched.Decide(tt.clust, tt.job)
+
+		if err != nil && tt.dec != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		} else if err == nil && tt.dec == nil {
+			t.Errorf("case %d: expected error", i)
+			continue
+		}
+
+		if !reflect.DeepEqual(tt.dec, dec) {
+			t.Errorf("case %d: expected decision %#v, got %#v", i, tt.dec, dec)
+		}
+	}
+}
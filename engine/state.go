@@ -15,15 +15,21 @@
 package engine
 
 import (
+	"time"
+
 	"github.com/coreos/fleet/agent"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/unit"
 )
 
 type clusterState struct {
 	jobs     map[string]*job.Job
 	gUnits   map[string]*job.Unit
 	machines map[string]*machine.MachineState
+	// failed indexes, by job name, the machines reporting the unit
+	// as failed. It is only populated for jobs rescheduled on failure.
+	failed map[string]map[string]bool
 }
 
 func newClusterState(units []job.Unit, sUnits []job.ScheduledUnit, machines []machine.MachineState) *clusterState {
@@ -65,7 +71,100 @@ func newClusterState(units []job.Unit, sUnits []job.ScheduledUnit, machines []ma
 		jobs:     jMap,
 		gUnits:   guMap,
 		machines: mMap,
+		failed:   make(map[string]map[string]bool),
+	}
+}
+
+// reschedulesOnFailure returns whether any job must be moved to another
+// machine when it fails
+func (cs *clusterState) reschedulesOnFailure() bool {
+	for _, j := range cs.jobs {
+		if j.RescheduleOnFailure() {
+			return true
+		}
+	}
+	return false
+}
+
+// setFailures attaches the recorded failures to the jobs rescheduled on
+// failure, and notes where the states of these jobs report them failed
+func (cs *clusterState) setFailures(failures map[string]job.UnitFailures, states []*unit.UnitState) {
+	for name, uf := range failures {
+		if j, ok := cs.jobs[name]; ok && j.RescheduleOnFailure() {
+			uf := uf
+			j.Failures = &uf
+		}
+	}
+
+	for _, us := range states {
+		j, ok := cs.jobs[us.UnitName]
+		if !ok || !j.RescheduleOnFailure() || us.ActiveState != "failed" {
+			continue
+		}
+		if cs.failed[us.UnitName] == nil {
+			cs.failed[us.UnitName] = make(map[string]bool)
+		}
+		cs.failed[us.UnitName][us.MachineID] = true
+	}
+}
+
+// failedOn returns whether the given machine reports the job as failed
+func (cs *clusterState) failedOn(jobName, machID string) bool {
+	return cs.failed[jobName][machID]
+}
+
+// recordFailure counts a failure of the job on the given machine, so that
+// scheduling decisions made in the same reconciliation avoid it
+func (cs *clusterState) recordFailure(jobName, machID string, now time.Time) {
+	j := cs.jobs[jobName]
+	if j == nil {
+		return
+	}
+	machines := make(map[string]int)
+	if j.Failures != nil {
+		for m, n := range j.Failures.Machines {
+			machines[m] = n
+		}
+	}
+	machines[machID]++
+	j.Failures = &job.UnitFailures{
+		Machines: machines,
+		Last:     now,
+	}
+}
+
+// failureBudgetExhausted returns whether the job failed too often on every
+// machine of the cluster
+func (cs *clusterState) failureBudgetExhausted(j *job.Job) bool {
+	if j.Failures == nil || len(cs.machines) == 0 {
+		return false
+	}
+	for machID := range cs.machines {
+		if !j.FailedTooOftenOn(machID) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitingAfterFailure returns whether a job rescheduled on failure must not
+// be scheduled yet, because its backoff has not elapsed or a machine still
+// reports it as failed
+func (cs *clusterState) waitingAfterFailure(j *job.Job, now time.Time) bool {
+	if !j.RescheduleOnFailure() {
+		return false
+	}
+	if len(cs.failed[j.Name]) > 0 {
+		return true
+	}
+	if j.Failures == nil {
+		return false
+	}
+	backoff, err := j.Backoff()
+	if err != nil {
+		return false
 	}
+	return now.Before(j.Failures.Last.Add(backoff))
 }
 
 func (cs *clusterState) agents() map[string]*agent.AgentState {
@@ -0,0 +1,105 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+
+	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/unit"
+)
+
+// ableToRun determines whether the given agent can run the Job. On top of
+// AgentState.AbleToRun, it checks the requirements which can only be
+// evaluated against the whole cluster, i.e. topology spread constraints.
+func ableToRun(agents []*agent.AgentState, as *agent.AgentState, j *job.Job) bool {
+	if act, _ := as.AbleToRun(j); act == job.JobActionUnschedule {
+		return false
+	}
+
+	if ok, reason := spreadAllows(agents, as, j); !ok {
+		log.Debugf("Agent(%s) unable to run Job(%s): %s", as.MState.ID, j.Name, reason)
+		return false
+	}
+
+	return true
+}
+
+// spreadAllows determines whether scheduling the Job to the target agent
+// keeps the instances of the Job's template spread evenly across the values
+// of its SpreadBy metadata key. After scheduling, the number of instances
+// in the target's domain may exceed that of the least-populated domain by
+// at most MaxSkew. Domains are formed by the machines which carry the key
+// and meet the Job's MachineMetadata requirements.
+func spreadAllows(agents []*agent.AgentState, target *agent.AgentState, j *job.Job) (bool, string) {
+	key, ok := j.SpreadBy()
+	if !ok {
+		return true, ""
+	}
+
+	maxSkew, err := j.MaxSkew()
+	if err != nil {
+		return false, err.Error()
+	}
+
+	tDomain, ok := target.MState.Metadata[key]
+	if !ok {
+		return false, fmt.Sprintf("machine metadata lacks SpreadBy key %q", key)
+	}
+
+	group := spreadGroup(j.Name)
+	metadata := j.RequiredTargetMetadata()
+	counts := make(map[string]int)
+	for _, as := range agents {
+		domain, ok := as.MState.Metadata[key]
+		if !ok || !machine.HasMetadata(as.MState, metadata) {
+			continue
+		}
+
+		if _, ok := counts[domain]; !ok {
+			counts[domain] = 0
+		}
+		for name := range as.Units {
+			if name != j.Name && spreadGroup(name) == group {
+				counts[domain]++
+			}
+		}
+	}
+
+	min := -1
+	for _, count := range counts {
+		if min == -1 || count < min {
+			min = count
+		}
+	}
+
+	if skew := counts[tDomain] + 1 - min; skew > maxSkew {
+		return false, fmt.Sprintf("scheduling to %s=%s would result in a skew of %d, exceeding MaxSkew %d", key, tDomain, skew, maxSkew)
+	}
+
+	return true, ""
+}
+
+// spreadGroup returns the name identifying the set of units spread together
+// with the named unit: the template for instance units, or the unit itself.
+func spreadGroup(name string) string {
+	if uni := unit.NewUnitNameInfo(name); uni != nil && uni.IsInstance() {
+		return uni.Template
+	}
+	return name
+}
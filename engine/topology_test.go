@@ -0,0 +1,119 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/unit"
+)
+
+func newJobWithXFleetValues(t *testing.T, name string, values ...string) *job.Job {
+	contents := "[X-Fleet]"
+	for _, v := range values {
+		contents = fmt.Sprintf("%s\n%s", contents, v)
+	}
+	u, err := unit.NewUnitFile(contents)
+	if err != nil {
+		t.Fatalf("error creating unit from %q: %v", contents, err)
+	}
+	return &job.Job{Name: name, Unit: *u}
+}
+
+func TestTopologySpreadDecisions(t *testing.T) {
+	jsLaunched := job.JobStateLaunched
+	machines := []machine.MachineState{
+		machine.MachineState{ID: "A", Metadata: map[string]string{"rack": "r1"}},
+		machine.MachineState{ID: "B", Metadata: map[string]string{"rack": "r1"}},
+		machine.MachineState{ID: "C", Metadata: map[string]string{"rack": "r2", "disk": "ssd"}},
+		machine.MachineState{ID: "D"},
+	}
+	scheduled := func(name, machID string) ([]job.Unit, []job.ScheduledUnit) {
+		units := []job.Unit{
+			job.Unit{Name: name, TargetState: job.JobStateLaunched},
+		}
+		sUnits := []job.ScheduledUnit{
+			job.ScheduledUnit{Name: name, State: &jsLaunched, TargetMachineID: machID},
+		}
+		return units, sUnits
+	}
+
+	app1Units, app1SUnits := scheduled("app@1.service", "A")
+	fooUnits, fooSUnits := scheduled("foo@1.service", "A")
+
+	tests := []struct {
+		clust *clusterState
+		job   *job.Job
+		dec   *decision
+	}{
+		// the least-loaded agent would be B, but that would put two
+		// instances in rack r1 and none in rack r2
+		{
+			clust: newClusterState(app1Units, app1SUnits, machines),
+			job:   newJobWithXFleetValues(t, "app@2.service", "SpreadBy=rack"),
+			dec:   &decision{machineID: "C"},
+		},
+
+		// a larger MaxSkew tolerates the imbalance
+		{
+			clust: newClusterState(app1Units, app1SUnits, machines),
+			job:   newJobWithXFleetValues(t, "app@2.service", "SpreadBy=rack", "MaxSkew=2"),
+			dec:   &decision{machineID: "B"},
+		},
+
+		// instances of other templates are not counted
+		{
+			clust: newClusterState(fooUnits, fooSUnits, machines),
+			job:   newJobWithXFleetValues(t, "app@2.service", "SpreadBy=rack"),
+			dec:   &decision{machineID: "B"},
+		},
+
+		// only machines meeting the MachineMetadata requirements form
+		// domains, so rack r1 does not count towards the skew
+		{
+			clust: newClusterState(app1Units, app1SUnits, machines),
+			job:   newJobWithXFleetValues(t, "app@2.service", "SpreadBy=rack", "MachineMetadata=disk=ssd"),
+			dec:   &decision{machineID: "C"},
+		},
+
+		// machines lacking the key are never eligible
+		{
+			clust: newClusterState([]job.Unit{}, []job.ScheduledUnit{}, machines[3:]),
+			job:   newJobWithXFleetValues(t, "app@2.service", "SpreadBy=rack"),
+			dec:   nil,
+		},
+	}
+
+	for i, tt := range tests {
+		sched := &leastLoadedScheduler{}
+		dec, err := sched.Decide(tt.clust, tt.job)
+
+		if err != nil && tt.dec != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		} else if err == nil && tt.dec == nil {
+			t.Errorf("case %d: expected error", i)
+			continue
+		}
+
+		if !reflect.DeepEqual(tt.dec, dec) {
+			t.Errorf("case %d: expected decision %#v, got %#v", i, tt.dec, dec)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/machine"
+)
+
+var (
+	flagAuditUser    string
+	flagAuditAction  string
+	flagAuditUnit    string
+	flagAuditMachine string
+	flagAuditSince   string
+	flagAuditLimit   int
+)
+
+var cmdAudit = &cobra.Command{
+	Use:   "audit [--full] [--no-legend] [--user=USER] [--action=ACTION] [--unit=UNIT] [--machine=MACHINE] [--since=TIME] [--limit=N] [--output=FORMAT]",
+	Short: "List the changes made to the cluster and by whom",
+	Long: `Lists the audit records of the changes made to units and machines through
+the fleet API, and of the scheduling decisions of the engine, oldest first.
+Auditing must be enabled with the audit_sink option of fleetd. Unless it is
+registry, only the records of the machine serving the API are listed.
+
+List who destroyed a unit:
+	fleetctl audit --unit=foo.service --action=destroy
+
+List the changes made by a user during the last hour:
+	fleetctl audit --user=alice --since=1h
+
+Output the records as JSON:
+	fleetctl audit --output=json`,
+	Run: runWrapper(runAudit),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdAudit)
+
+	cmdAudit.Flags().BoolVar(&sharedFlags.Full, "full", false, "Do not ellipsize fields on output")
+	cmdAudit.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
+	cmdAudit.Flags().StringVar(&flagAuditUser, "user", "", "Only list the changes made by the given user")
+	cmdAudit.Flags().StringVar(&flagAuditAction, "action", "", "Only list the changes of the given kind, such as destroy or schedule")
+	cmdAudit.Flags().StringVar(&flagAuditUnit, "unit", "", "Only list the changes made to the given unit")
+	cmdAudit.Flags().StringVar(&flagAuditMachine, "machine", "", "Only list the changes made to the machine with the given ID, or the units scheduled to or from it")
+	cmdAudit.Flags().StringVar(&flagAuditSince, "since", "", "Only list the changes made since the given RFC 3339 time, or duration ago such as 30m")
+	cmdAudit.Flags().IntVar(&flagAuditLimit, "limit", 100, "Only list the given number of most recent changes, or all of them if 0")
+	addOutputFlag(cmdAudit)
+}
+
+func runAudit(cCmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 0 {
+		stderr("audit takes no arguments")
+		return 1
+	}
+
+	f, err := getAuditFilter(time.Now())
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	printer, err := getObjectPrinter(sharedFlags.Output)
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	records, err := cAPI.AuditRecords(f)
+	if err != nil {
+		stderr("Error retrieving audit records: %v", err)
+		return 1
+	}
+
+	if printer != nil {
+		return printObjects(printer, records)
+	}
+
+	noLegend, _ := cCmd.Flags().GetBool("no-legend")
+	if !noLegend {
+		fmt.Fprintln(out, "TIME\tSOURCE\tUSER\tADDRESS\tACTION\tTARGET\tOLD\tNEW\tERROR")
+	}
+
+	full, _ := cCmd.Flags().GetBool("full")
+	for _, r := range records {
+		fmt.Fprintln(out, strings.Join(auditRecordFields(r, full), "\t"))
+	}
+
+	out.Flush()
+	return 0
+}
+
+// getAuditFilter builds the filter of audit records from the flags, with
+// relative times taken from now.
+func getAuditFilter(now time.Time) (audit.Filter, error) {
+	f := audit.Filter{
+		User:      flagAuditUser,
+		Action:    flagAuditAction,
+		MachineID: flagAuditMachine,
+		Limit:     flagAuditLimit,
+	}
+	if flagAuditUnit != "" {
+		f.UnitName = unitNameMangle(flagAuditUnit)
+	}
+	if flagAuditLimit < 0 {
+		return f, fmt.Errorf("invalid --limit %d", flagAuditLimit)
+	}
+	if flagAuditSince != "" {
+		if d, err := time.ParseDuration(flagAuditSince); err == nil {
+			f.Since = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, flagAuditSince); err == nil {
+			f.Since = t
+		} else {
+			return f, fmt.Errorf("invalid --since %q, expected an RFC 3339 time or a duration", flagAuditSince)
+		}
+	}
+	return f, nil
+}
+
+// auditRecordFields returns the columns of the given record, in the order
+// of the legend.
+func auditRecordFields(r audit.Record, full bool) []string {
+	target := r.UnitName
+	if target == "" {
+		target = auditMachineID(r.MachineID, full)
+		if r.Key != "" {
+			target += "/" + r.Key
+		}
+	}
+
+	oldState, newState := r.OldState, r.NewState
+	if r.Action == audit.ActionSchedule || r.Action == audit.ActionUnschedule {
+		oldState = auditMachineID(oldState, full)
+		newState = auditMachineID(newState, full)
+	}
+
+	fields := []string{
+		r.Time.Local().Format(time.RFC3339),
+		r.Source,
+		r.User,
+		r.RemoteAddr,
+		r.Action,
+		target,
+		oldState,
+		newState,
+		r.Error,
+	}
+	for i, f := range fields {
+		if f == "" {
+			fields[i] = "-"
+		}
+	}
+	return fields
+}
+
+func auditMachineID(id string, full bool) string {
+	if id == "" {
+		return ""
+	}
+	return machineIDLegend(machine.MachineState{ID: id}, full)
+}
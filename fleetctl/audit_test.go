@@ -0,0 +1,101 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/client"
+)
+
+func TestGetAuditFilter(t *testing.T) {
+	defer func() {
+		flagAuditUnit, flagAuditSince, flagAuditLimit = "", "", 100
+	}()
+	now := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+
+	flagAuditUnit, flagAuditSince, flagAuditLimit = "foo", "30m", 10
+	f, err := getAuditFilter(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := audit.Filter{UnitName: "foo.service", Since: now.Add(-30 * time.Minute), Limit: 10}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("getAuditFilter returned %#v, want %#v", f, want)
+	}
+
+	flagAuditUnit, flagAuditSince = "", "2016-05-04T01:00:00Z"
+	f, err = getAuditFilter(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !f.Since.Equal(time.Date(2016, 5, 4, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("getAuditFilter returned Since %v", f.Since)
+	}
+
+	for _, since := range []string{"yesterday", "5"} {
+		flagAuditSince = since
+		if _, err := getAuditFilter(now); err == nil {
+			t.Errorf("expected an error for --since=%s", since)
+		}
+	}
+	flagAuditSince, flagAuditLimit = "", -1
+	if _, err := getAuditFilter(now); err == nil {
+		t.Errorf("expected an error for --limit=-1")
+	}
+}
+
+func TestAuditRecordFields(t *testing.T) {
+	tm := time.Now()
+	tests := []struct {
+		r    audit.Record
+		want []string
+	}{
+		{
+			audit.Record{Time: tm, Source: audit.SourceAPI, User: "alice", RemoteAddr: "10.0.0.1:4001", Action: audit.ActionDestroy, UnitName: "foo.service", OldState: "launched"},
+			[]string{"api", "alice", "10.0.0.1:4001", "destroy", "foo.service", "launched", "-", "-"},
+		},
+		{
+			audit.Record{Time: tm, Source: audit.SourceEngine, Action: audit.ActionSchedule, UnitName: "foo.service", MachineID: "c31e44e1-f858", NewState: "c31e44e1-f858", Error: "boom"},
+			[]string{"engine", "-", "-", "schedule", "foo.service", "-", "c31e44e1...", "boom"},
+		},
+		{
+			audit.Record{Time: tm, Source: audit.SourceAPI, Action: audit.ActionSetMetadata, MachineID: "c31e44e1-f858", Key: "region", NewState: "us-west"},
+			[]string{"api", "-", "-", "setMetadata", "c31e44e1.../region", "-", "us-west", "-"},
+		},
+	}
+	for i, tt := range tests {
+		got := auditRecordFields(tt.r, false)
+		if !reflect.DeepEqual(got[1:], tt.want) {
+			t.Errorf("case %d: got fields %v, want %v", i, got[1:], tt.want)
+		}
+	}
+}
+
+func TestRunAudit(t *testing.T) {
+	cAPI = newFakeRegistryForCommands("audit", 1, false)
+	rc := cAPI.(*client.RegistryClient)
+	audit.Write(audit.NewRegistrySink(rc.Registry.(audit.Store)), audit.Record{Source: audit.SourceAPI, Action: audit.ActionDestroy, UnitName: "audit1.service"})
+
+	if exit := runAudit(cmdAudit, nil); exit != 0 {
+		t.Errorf("expected exit code 0, got %d", exit)
+	}
+	if exit := runAudit(cmdAudit, []string{"audit1.service"}); exit != 1 {
+		t.Errorf("expected exit code 1 with arguments, got %d", exit)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCordon = &cobra.Command{
+		Use:   "cordon MACHINE",
+		Short: "Prevent new units from being scheduled to a machine",
+		Long: `Mark a machine as unschedulable. Units already scheduled to the machine keep
+running there, but the engine no longer schedules new units to it.
+
+MACHINE may be a machine ID or any unambiguous prefix of one, as printed by
+list-machines.`,
+		Run: runWrapper(runCordonMachine),
+	}
+	cmdUncordon = &cobra.Command{
+		Use:   "uncordon MACHINE",
+		Short: "Allow new units to be scheduled to a machine again",
+		Run:   runWrapper(runUncordonMachine),
+	}
+)
+
+func init() {
+	cmdFleet.AddCommand(cmdCordon)
+	cmdFleet.AddCommand(cmdUncordon)
+}
+
+func runCordonMachine(cCmd *cobra.Command, args []string) (exit int) {
+	return setMachineCordoned(args, true)
+}
+
+func runUncordonMachine(cCmd *cobra.Command, args []string) (exit int) {
+	return setMachineCordoned(args, false)
+}
+
+func setMachineCordoned(args []string, cordoned bool) (exit int) {
+	if len(args) != 1 {
+		stderr("One machine must be provided")
+		return 1
+	}
+
+	machID, err := findMachineID(args[0])
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	if cordoned {
+		err = cAPI.CordonMachine(machID)
+	} else {
+		err = cAPI.UncordonMachine(machID)
+	}
+	if err != nil {
+		stderr("Failed to update Machine(%s): %v", machID, err)
+		return 1
+	}
+
+	if cordoned {
+		stdout("Cordoned machine %s", machID)
+	} else {
+		stdout("Uncordoned machine %s", machID)
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRunCordonMachine(t *testing.T) {
+	tests := []struct {
+		args     []string
+		cordon   bool
+		exit     int
+		cordoned map[string]bool
+	}{
+		{[]string{"c31e44e1"}, true, 0, map[string]bool{"c31e44e1-f858-436e-933e-59c642517860": true}},
+		{[]string{"c31e44e1-f858-436e-933e-59c642517860"}, true, 0, map[string]bool{"c31e44e1-f858-436e-933e-59c642517860": true}},
+		{[]string{"c31e44e1"}, false, 0, map[string]bool{}},
+		// unknown machine
+		{[]string{"deadbeef"}, true, 1, map[string]bool{}},
+		// ambiguous prefix
+		{[]string{""}, true, 1, map[string]bool{}},
+		// no machine given
+		{[]string{}, true, 1, map[string]bool{}},
+	}
+
+	for i, tt := range tests {
+		cAPI = newFakeRegistryForCommands("cordon", 1, false)
+		if !tt.cordon {
+			cAPI.CordonMachine("c31e44e1-f858-436e-933e-59c642517860")
+		}
+
+		var exit int
+		if tt.cordon {
+			exit = runCordonMachine(cmdCordon, tt.args)
+		} else {
+			exit = runUncordonMachine(cmdUncordon, tt.args)
+		}
+		if exit != tt.exit {
+			t.Errorf("case %d: expected exit code %d, got %d", i, tt.exit, exit)
+		}
+
+		machines, err := cAPI.Machines()
+		if err != nil {
+			t.Fatalf("case %d: failed fetching machines: %v", i, err)
+		}
+		for _, ms := range machines {
+			if ms.Cordoned != tt.cordoned[ms.ID] {
+				t.Errorf("case %d: Machine(%s) expected cordoned=%t, got %t", i, ms.ID, tt.cordoned[ms.ID], ms.Cordoned)
+			}
+		}
+	}
+}
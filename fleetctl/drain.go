@@ -0,0 +1,57 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdDrain = &cobra.Command{
+	Use:   "drain MACHINE",
+	Short: "Move all units off a machine",
+	Long: `Cordon a machine and unschedule all non-global units from it, so that the
+engine reschedules them to other machines. Units which cannot run anywhere
+else, e.g. because of their MachineID option, stay unscheduled until the
+machine is uncordoned.
+
+MACHINE may be a machine ID or any unambiguous prefix of one, as printed by
+list-machines.`,
+	Run: runWrapper(runDrainMachine),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdDrain)
+}
+
+func runDrainMachine(cCmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		stderr("One machine must be provided")
+		return 1
+	}
+
+	machID, err := findMachineID(args[0])
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	if err := cAPI.DrainMachine(machID); err != nil {
+		stderr("Failed to drain Machine(%s): %v", machID, err)
+		return 1
+	}
+
+	stdout("Drained machine %s", machID)
+	return 0
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRunDrainMachine(t *testing.T) {
+	cAPI = newFakeRegistryForCommands("drain", 2, false)
+
+	if exit := runDrainMachine(cmdDrain, []string{"595989bb"}); exit != 0 {
+		t.Fatalf("expected exit code 0, got %d", exit)
+	}
+
+	machines, err := cAPI.Machines()
+	if err != nil {
+		t.Fatalf("failed fetching machines: %v", err)
+	}
+	for _, ms := range machines {
+		want := ms.ID == "595989bb-cbb7-49ce-8726-722d6e157b4e"
+		if ms.Cordoned != want {
+			t.Errorf("Machine(%s) expected cordoned=%t, got %t", ms.ID, want, ms.Cordoned)
+		}
+	}
+
+	units, err := cAPI.Units()
+	if err != nil {
+		t.Fatalf("failed fetching units: %v", err)
+	}
+	for _, u := range units {
+		if u.MachineID == "595989bb-cbb7-49ce-8726-722d6e157b4e" {
+			t.Errorf("Unit(%s) still scheduled to drained machine", u.Name)
+		}
+	}
+
+	if exit := runDrainMachine(cmdDrain, []string{"deadbeef"}); exit != 1 {
+		t.Errorf("expected exit code 1 for unknown machine, got %d", exit)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/user"
 	"path"
 	"strings"
 	"sync"
@@ -91,6 +92,10 @@ var (
 		CertFile string
 		CAFile   string
 
+		Token    string
+		Username string
+		Password string
+
 		Tunnel                string
 		KnownHostsFile        string
 		StrictHostKeyChecking bool
@@ -110,6 +115,7 @@ var (
 		BlockAttempts int
 		Fields        string
 		SSHPort       int
+		Output        string
 	}{}
 
 	// current command being executed
@@ -152,6 +158,10 @@ func init() {
 	cmdFleet.PersistentFlags().StringVar(&globalFlags.CertFile, "cert-file", "", "Location of TLS cert file used to secure communication with the fleet API or etcd")
 	cmdFleet.PersistentFlags().StringVar(&globalFlags.CAFile, "ca-file", "", "Location of TLS CA file used to secure communication with the fleet API or etcd")
 
+	cmdFleet.PersistentFlags().StringVar(&globalFlags.Token, "token", "", "Bearer token to authenticate with against the fleet API.")
+	cmdFleet.PersistentFlags().StringVar(&globalFlags.Username, "username", "", "Username to authenticate with against the fleet API, along with --password.")
+	cmdFleet.PersistentFlags().StringVar(&globalFlags.Password, "password", "", "Password to authenticate with against the fleet API. Prefer setting FLEETCTL_PASSWORD over using this flag.")
+
 	cmdFleet.PersistentFlags().StringVar(&globalFlags.KnownHostsFile, "known-hosts-file", ssh.DefaultKnownHostsFile, "File used to store remote machine fingerprints. Ignored if strict host key checking is disabled.")
 	cmdFleet.PersistentFlags().BoolVar(&globalFlags.StrictHostKeyChecking, "strict-host-key-checking", true, "Verify host keys presented by remote machines before initiating SSH connections.")
 	cmdFleet.PersistentFlags().Float64Var(&globalFlags.SSHTimeout, "ssh-timeout", 10.0, "Amount of time in seconds to allow for SSH connection initialization before failing.")
@@ -411,8 +421,13 @@ func getHTTPClient(cCmd *cobra.Command) (client.API, error) {
 		},
 	}
 
+	rt := client.NewUserTransport(&trans, localUserName())
+	if globalFlags.Token != "" || globalFlags.Username != "" {
+		rt = client.NewAuthTransport(rt, globalFlags.Token, globalFlags.Username, globalFlags.Password)
+	}
+
 	hc := http.Client{
-		Transport: &trans,
+		Transport: rt,
 	}
 
 	return client.NewHTTPClient(&hc, *ep)
@@ -485,7 +500,16 @@ func getRegistryClient(cCmd *cobra.Command) (client.API, error) {
 		stderr(msg)
 	}
 
-	return &client.RegistryClient{Registry: reg}, nil
+	return &client.RegistryClient{Registry: reg, User: localUserName()}, nil
+}
+
+// localUserName returns the name of the user running fleetctl, which fleet
+// records as the submitter of unit revisions.
+func localUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
 }
 
 // getChecker creates and returns a HostKeyChecker, or nil if any error is encountered
@@ -594,8 +618,8 @@ func getUnitFileFromTemplate(cCmd *cobra.Command, uni *unit.UnitNameInfo, fileNa
 
 func getTunnelFlag(cCmd *cobra.Command) string {
 	tun, _ := cmdFleet.PersistentFlags().GetString("tunnel")
-	if tun != "" && !strings.Contains(tun, ":") {
-		tun += ":22"
+	if tun != "" {
+		tun = ssh.AddPortIfMissing(tun, 22)
 	}
 	return tun
 }
@@ -652,6 +676,38 @@ func findUnits(args []string) (sus []schema.Unit, err error) {
 }
 
 func createUnit(name string, uf *unit.UnitFile) (*schema.Unit, error) {
+	u, err := newValidUnit(name, uf)
+	if err != nil {
+		return nil, err
+	}
+	err = cAPI.CreateUnit(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating unit %s: %v", name, err)
+	}
+
+	log.Debugf("Created Unit(%s) in Registry", name)
+	return u, nil
+}
+
+// updateUnit replaces the content of a Unit already in the Registry,
+// keeping its schedule and desired state.
+func updateUnit(name string, uf *unit.UnitFile) (*schema.Unit, error) {
+	u, err := newValidUnit(name, uf)
+	if err != nil {
+		return nil, err
+	}
+	err = cAPI.UpdateUnit(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed updating unit %s: %v", name, err)
+	}
+
+	log.Debugf("Updated Unit(%s) in Registry", name)
+	return u, nil
+}
+
+// newValidUnit builds the schema.Unit for the given unit file, checking
+// its name and options the same way the API does.
+func newValidUnit(name string, uf *unit.UnitFile) (*schema.Unit, error) {
 	if uf == nil {
 		return nil, fmt.Errorf("nil unit provided")
 	}
@@ -673,12 +729,6 @@ func createUnit(name string, uf *unit.UnitFile) (*schema.Unit, error) {
 	if err := j.ValidateRequirements(); err != nil {
 		log.Warningf("Unit %s: %v", name, err)
 	}
-	err := cAPI.CreateUnit(&u)
-	if err != nil {
-		return nil, fmt.Errorf("failed creating unit %s: %v", name, err)
-	}
-
-	log.Debugf("Created Unit(%s) in Registry", name)
 	return &u, nil
 }
 
@@ -778,6 +828,7 @@ func checkUnitCreation(cCmd *cobra.Command, arg string) (int, error) {
 func lazyCreateUnits(cCmd *cobra.Command, args []string) error {
 	errchan := make(chan error)
 	blockAttempts, _ := cCmd.Flags().GetInt("block-attempts")
+	replace, _ := cCmd.Flags().GetBool("replace")
 	var wg sync.WaitGroup
 	for _, arg := range args {
 		arg = maybeAppendDefaultUnitType(arg)
@@ -798,6 +849,22 @@ func lazyCreateUnits(cCmd *cobra.Command, args []string) error {
 			return err
 		}
 
+		// checkUnitCreation only lets existing units through when
+		// they are being replaced. Swap their content in place, which
+		// keeps their schedule and state, so there is nothing to wait for.
+		if replace {
+			existing, err := cAPI.Unit(name)
+			if err != nil {
+				return fmt.Errorf("error retrieving Unit(%s) from Registry: %v", name, err)
+			}
+			if existing != nil {
+				if _, err := updateUnit(name, uf); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
 		_, err = createUnit(name, uf)
 		if err != nil {
 			return err
@@ -1141,12 +1208,7 @@ func assertSystemdActiveState(unitName string) error {
 		if err != nil {
 			return fmt.Errorf("Error getting unit state of %s: %v", unitName, err)
 		}
-
-		// Get systemd state and check the state is active & loaded.
-		if us.SystemdActiveState != "active" || us.SystemdLoadState != "loaded" {
-			return fmt.Errorf("Failed to find an active unit %s", unitName)
-		}
-		return nil
+		return checkActiveUnitState(unitName, us)
 	}
 
 	timeout, err := waitForState(fetchSystemdActiveState)
@@ -1158,6 +1220,20 @@ func assertSystemdActiveState(unitName string) error {
 	return nil
 }
 
+// checkActiveUnitState returns an error unless the given state of a unit is
+// active and loaded, and healthy if the unit declares a health check.
+func checkActiveUnitState(unitName string, us *schema.UnitState) error {
+	// Get systemd state and check the state is active & loaded.
+	if us.SystemdActiveState != "active" || us.SystemdLoadState != "loaded" {
+		return fmt.Errorf("Failed to find an active unit %s", unitName)
+	}
+	// Units declaring a health check must also pass it
+	if us.Health != "" && us.Health != unit.HealthHealthy {
+		return fmt.Errorf("Unit %s is not healthy yet: %s", unitName, us.Health)
+	}
+	return nil
+}
+
 func machineState(machID string) (*machine.MachineState, error) {
 	machines, err := cAPI.Machines()
 	if err != nil {
@@ -1171,6 +1247,45 @@ func machineState(machID string) (*machine.MachineState, error) {
 	return nil, nil
 }
 
+// findMachineID returns the ID of the single machine whose ID starts with the
+// given string, e.g. the truncated ID printed by list-machines, or whose name
+// is the given string. Names shared by several machines are rejected.
+func findMachineID(lookup string) (string, error) {
+	machines, err := cAPI.Machines()
+	if err != nil {
+		return "", err
+	}
+
+	var match string
+	for _, ms := range machines {
+		if ms.Name == "" || ms.Name != lookup {
+			continue
+		}
+		if match != "" {
+			return "", fmt.Errorf("found more than one machine named %q", lookup)
+		}
+		match = ms.ID
+	}
+	if match != "" {
+		return match, nil
+	}
+
+	for _, ms := range machines {
+		if !strings.HasPrefix(ms.ID, lookup) {
+			continue
+		}
+		if match != "" {
+			return "", fmt.Errorf("found more than one machine matching %q", lookup)
+		}
+		match = ms.ID
+	}
+
+	if match == "" {
+		return "", fmt.Errorf("machine %q does not exist", lookup)
+	}
+	return match, nil
+}
+
 // cachedMachineState makes a best-effort to retrieve the MachineState of the given machine ID.
 // It memoizes MachineState information for the life of a fleetctl invocation.
 // Any error encountered retrieving the list of machines is ignored.
@@ -1255,7 +1370,7 @@ func cmdGlobalMachineState(cCmd *cobra.Command, globalUnits []schema.Unit) (err
 	mapUNs := map[string]string{}
 	for _, unit := range globalUnits {
 		m := cachedMachineState(unit.MachineID)
-		if m == nil || m.ID == "" || m.PublicIP == "" {
+		if m == nil || m.ID == "" || m.AddressFor(machine.AddressSSH) == "" {
 			continue
 		}
 		mapUNs[m.ID] = unit.Name
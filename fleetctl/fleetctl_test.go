@@ -350,3 +350,69 @@ Replaces=abcd`),
 		}
 	}
 }
+
+func TestUpdateUnit(t *testing.T) {
+	cAPI = newFakeRegistryForCommands("update", 1, false)
+	if err := cAPI.SetUnitTargetState("update1.service", string(job.JobStateLaunched)); err != nil {
+		t.Fatalf("failed setting target state: %v", err)
+	}
+
+	uf := newUnitFile(t, "[Service]\nExecStart=/usr/bin/true")
+	if _, err := updateUnit("update1.service", uf); err != nil {
+		t.Fatalf("unexpected error updating unit: %v", err)
+	}
+
+	u, err := cAPI.Unit("update1.service")
+	if err != nil || u == nil {
+		t.Fatalf("failed fetching Unit(update1.service): %v", err)
+	}
+	if !unit.MatchUnitFiles(schema.MapSchemaUnitOptionsToUnitFile(u.Options), uf) {
+		t.Errorf("unit content was not updated")
+	}
+	if job.JobState(u.DesiredState) != job.JobStateLaunched {
+		t.Errorf("expected desired state %s, got %s", job.JobStateLaunched, u.DesiredState)
+	}
+	if u.MachineID == "" {
+		t.Errorf("unit lost its schedule")
+	}
+
+	if _, err := updateUnit("missing.service", uf); err == nil {
+		t.Errorf("expected error updating a unit that does not exist")
+	}
+}
+
+func TestFindMachineID(t *testing.T) {
+	reg := registry.NewFakeRegistry()
+	reg.SetMachines([]machine.MachineState{
+		{ID: "c31e44e1-f858-436e-933e-59c642517860", Name: "web-1"},
+		{ID: "595989bb-cbb7-49ce-8726-722d6e157b4e", Name: "db"},
+		{ID: "5959aaaa-cbb7-49ce-8726-722d6e157b4e", Name: "db"},
+	})
+	cAPI = &client.RegistryClient{Registry: reg}
+
+	tests := []struct {
+		lookup  string
+		machID  string
+		wantErr bool
+	}{
+		{"web-1", "c31e44e1-f858-436e-933e-59c642517860", false},
+		{"c31e", "c31e44e1-f858-436e-933e-59c642517860", false},
+		{"595989bb", "595989bb-cbb7-49ce-8726-722d6e157b4e", false},
+		// ambiguous prefix
+		{"5959", "", true},
+		// ambiguous name
+		{"db", "", true},
+		// unknown machine
+		{"deadbeef", "", true},
+	}
+
+	for i, tt := range tests {
+		machID, err := findMachineID(tt.lookup)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("case %d: expected error=%t, got %v", i, tt.wantErr, err)
+		}
+		if machID != tt.machID {
+			t.Errorf("case %d: expected machine ID %q, got %q", i, tt.machID, machID)
+		}
+	}
+}
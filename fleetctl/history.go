@@ -0,0 +1,86 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/fleet/schema"
+)
+
+var cmdHistory = &cobra.Command{
+	Use:   "history [--full] [--no-legend] UNIT",
+	Short: "List the revisions of a unit",
+	Long: `Lists the revisions fleet keeps of the content of a unit, oldest first,
+along with when and by whom each was submitted. A unit can be rolled back to
+any of them with the rollback command.
+
+Show the revisions of a unit:
+	fleetctl history foo.service`,
+	Run: runWrapper(runHistory),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdHistory)
+
+	cmdHistory.Flags().BoolVar(&sharedFlags.Full, "full", false, "Do not ellipsize fields on output")
+	cmdHistory.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
+}
+
+func runHistory(cCmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		stderr("One unit file must be provided")
+		return 1
+	}
+	name := unitNameMangle(args[0])
+
+	revs, err := cAPI.UnitRevisions(name)
+	if err != nil {
+		stderr("Error retrieving revisions of Unit(%s): %v", name, err)
+		return 1
+	}
+	if len(revs) == 0 {
+		stderr("No revisions found for Unit(%s)", name)
+		return 1
+	}
+
+	noLegend, _ := cCmd.Flags().GetBool("no-legend")
+	if !noLegend {
+		fmt.Fprintln(out, "REVISION\tCREATED\tUSER\tHASH")
+	}
+
+	full, _ := cCmd.Flags().GetBool("full")
+	for _, rev := range revs {
+		user := rev.User
+		if user == "" {
+			user = "-"
+		}
+		fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", rev.Revision, rev.Created.Local().Format(time.RFC3339), user, revisionHash(rev, full))
+	}
+
+	out.Flush()
+	return 0
+}
+
+func revisionHash(rev *schema.UnitRevision, full bool) string {
+	h := schema.MapSchemaUnitOptionsToUnitFile(rev.Options).Hash()
+	if !full {
+		return h.Short()
+	}
+	return h.String()
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRunHistory(t *testing.T) {
+	cAPI = newFakeRegistryForCommands("history", 0, false)
+	submitRevisions(t, "hist.service", "[Service]\nExecStart=/usr/bin/true", "[Service]\nExecStart=/usr/bin/false")
+
+	if exit := runHistory(cmdHistory, []string{"hist.service"}); exit != 0 {
+		t.Errorf("expected exit code 0, got %d", exit)
+	}
+	if exit := runHistory(cmdHistory, []string{"missing.service"}); exit != 1 {
+		t.Errorf("expected exit code 1 for a unit without revisions, got %d", exit)
+	}
+	if exit := runHistory(cmdHistory, nil); exit != 1 {
+		t.Errorf("expected exit code 1 without a unit, got %d", exit)
+	}
+}
@@ -21,11 +21,13 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/machine"
 )
 
 const (
 	defaultListMachinesFields = "machine,ip,metadata"
+	listMachinesSortFields    = "machineID,name,primaryIP,metadata.<key>"
 )
 
 var (
@@ -34,12 +36,28 @@ var (
 		"machine": func(ms *machine.MachineState, full bool) string {
 			return machineIDLegend(*ms, full)
 		},
+		"name": func(ms *machine.MachineState, full bool) string {
+			if ms.Name == "" {
+				return "-"
+			}
+			return ms.Name
+		},
 		"ip": func(ms *machine.MachineState, full bool) string {
 			if len(ms.PublicIP) == 0 {
 				return "-"
 			}
 			return ms.PublicIP
 		},
+		"addresses": func(ms *machine.MachineState, full bool) string {
+			if len(ms.Addresses) == 0 {
+				return "-"
+			}
+			addrs := make([]string, len(ms.Addresses))
+			for i, a := range ms.Addresses {
+				addrs[i] = fmt.Sprintf("%s=%s", a.Role, a.IP)
+			}
+			return strings.Join(addrs, ",")
+		},
 		"metadata": func(ms *machine.MachineState, full bool) string {
 			if len(ms.Metadata) == 0 {
 				return "-"
@@ -52,7 +70,7 @@ var (
 type machineToField func(ms *machine.MachineState, full bool) string
 
 var cmdListMachines = &cobra.Command{
-	Use:   "list-machines [-l|--full] [--no-legend]",
+	Use:   "list-machines [-l|--full] [--no-legend] [--machine] [--metadata] [--sort] [--output=FORMAT]",
 	Short: "Enumerate the current hosts in the cluster",
 	Long: `Lists all active machines within the cluster. Previously active machines will not appear in this list.
 
@@ -60,7 +78,13 @@ For easily parsable output, you can remove the column headers:
 fleetctl list-machines --no-legend
 
 Output the list without truncation:
-fleetctl list-machines --full`,
+fleetctl list-machines --full
+
+Only list the machines of a region, sorted by rack:
+fleetctl list-machines --metadata=region=us-east --sort=metadata.rack
+
+Output the IP of each machine with a template:
+fleetctl list-machines --output='template={{.PublicIP}}'`,
 	Run: runWrapper(runListMachines),
 }
 
@@ -71,6 +95,8 @@ func init() {
 	cmdListMachines.Flags().BoolVar(&sharedFlags.Full, "l", false, "Shorthand for --full")
 	cmdListMachines.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
 	cmdListMachines.Flags().StringVar(&listMachinesFieldsFlag, "fields", defaultListMachinesFields, fmt.Sprintf("Columns to print for each Machine. Valid fields are %q", strings.Join(machineToFieldKeys(listMachinesFields), ",")))
+	addListFlags(cmdListMachines, false, false, listMachinesSortFields)
+	addOutputFlag(cmdListMachines)
 }
 
 func runListMachines(cCmd *cobra.Command, args []string) (exit int) {
@@ -87,7 +113,22 @@ func runListMachines(cCmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	machines, err := cAPI.Machines()
+	opts, err := getListOptions()
+	if err == nil {
+		err = client.ValidateMachineListOptions(opts)
+	}
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	printer, err := getObjectPrinter(sharedFlags.Output)
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	machines, err := cAPI.ListMachines(opts)
 	if err != nil {
 		stderr("Error retrieving list of active machines from fleet API (%v)", err)
 		stderr("Possible issues:")
@@ -96,6 +137,10 @@ func runListMachines(cCmd *cobra.Command, args []string) (exit int) {
 		return 1
 	}
 
+	if printer != nil {
+		return printObjects(printer, machines)
+	}
+
 	noLegend, _ := cCmd.Flags().GetBool("no-legend")
 	if !noLegend {
 		fmt.Fprintln(out, strings.ToUpper(strings.Join(cols, "\t")))
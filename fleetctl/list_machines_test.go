@@ -45,9 +45,14 @@ func TestListMachinesFieldsToStrings(t *testing.T) {
 
 	ms := &machine.MachineState{
 		ID:       id,
+		Name:     "web-1",
 		PublicIP: ip,
 		Metadata: metadata,
 		Version:  ver,
+		Addresses: []machine.Address{
+			{Role: machine.AddressPublic, IP: ip},
+			{Role: machine.AddressPrivate, IP: "fd00::1"},
+		},
 	}
 
 	val := listMachinesFields["machine"](ms, false)
@@ -56,9 +61,15 @@ func TestListMachinesFieldsToStrings(t *testing.T) {
 	val = listMachinesFields["machine"](ms, true)
 	assertEqual(t, "machine", "4d389537d9d14bdabe8be54a9c29f68d", val)
 
+	val = listMachinesFields["name"](ms, false)
+	assertEqual(t, "name", "web-1", val)
+
 	val = listMachinesFields["ip"](ms, false)
 	assertEqual(t, "ip", "192.0.2.1", val)
 
+	val = listMachinesFields["addresses"](ms, false)
+	assertEqual(t, "addresses", "public=192.0.2.1,private=fd00::1", val)
+
 	val = listMachinesFields["metadata"](ms, false)
 	assertEqual(t, "metadata", "foo=bar,ping=pong", val)
 }
@@ -76,7 +87,7 @@ func TestListMachinesFieldsEmpty(t *testing.T) {
 		Version:  ver,
 	}
 
-	for _, tt := range []string{"ip", "metadata"} {
+	for _, tt := range []string{"name", "ip", "addresses", "metadata"} {
 		f := listMachinesFields[tt](ms, false)
 		assertEqual(t, tt, "-", f)
 	}
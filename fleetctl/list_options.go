@@ -0,0 +1,70 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/fleet/client"
+)
+
+// listFlags select and order the objects of the list commands. They are
+// evaluated by the fleet API when possible.
+var listFlags struct {
+	Names        string
+	MachineIDs   string
+	Metadata     string
+	TargetState  string
+	CurrentState string
+	Sort         string
+}
+
+// addListFlags registers the selector flags of a list command, along with
+// --sort if it may be sorted by any fields. Units may also be selected by
+// name, and unit files by their states.
+func addListFlags(cCmd *cobra.Command, units, states bool, sortFields string) {
+	if units {
+		cCmd.Flags().StringVar(&listFlags.Names, "name", "", "Only list units whose name matches any of these comma-separated glob patterns")
+	}
+	cCmd.Flags().StringVar(&listFlags.MachineIDs, "machine", "", "Only list machines, or units on machines, whose ID matches any of these comma-separated glob patterns")
+	cCmd.Flags().StringVar(&listFlags.Metadata, "metadata", "", "Only list machines, or units on machines, meeting all of these comma-separated metadata requirements, e.g. \"region=us-east,disk!=hdd\"")
+	if states {
+		cCmd.Flags().StringVar(&listFlags.TargetState, "target-state", "", "Only list units with this target state")
+		cCmd.Flags().StringVar(&listFlags.CurrentState, "current-state", "", "Only list units in this current state")
+	}
+	if sortFields != "" {
+		cCmd.Flags().StringVar(&listFlags.Sort, "sort", "", "Comma-separated fields to sort by, descending if prefixed by \"-\". Valid fields are "+sortFields)
+	}
+}
+
+// getListOptions builds the ListOptions given by the listFlags.
+func getListOptions() (client.ListOptions, error) {
+	q := url.Values{}
+	for param, value := range map[string]string{
+		client.ListParamNamePattern:      listFlags.Names,
+		client.ListParamMachineIDPattern: listFlags.MachineIDs,
+		client.ListParamMetadata:         listFlags.Metadata,
+		client.ListParamTargetState:      listFlags.TargetState,
+		client.ListParamCurrentState:     listFlags.CurrentState,
+		client.ListParamSort:             listFlags.Sort,
+	} {
+		if value != "" {
+			q.Set(param, value)
+		}
+	}
+	return client.ParseListOptions(q, client.ListParamName)
+}
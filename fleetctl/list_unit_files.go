@@ -22,12 +22,14 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
 )
 
 const (
 	defaultListUnitFilesFields = "unit,hash,dstate,state,target"
+	listUnitFilesSortFields    = "name,machineID,targetState,currentState"
 )
 
 func mapTargetField(u schema.Unit, full bool) string {
@@ -89,10 +91,13 @@ var (
 type unitToField func(u schema.Unit, full bool) string
 
 var cmdListUnitFiles = &cobra.Command{
-	Use:   "list-unit-files [--fields]",
+	Use:   "list-unit-files [--fields] [--name] [--machine] [--metadata] [--target-state] [--current-state] [--sort] [--output=FORMAT]",
 	Short: "List the units that exist in the cluster.",
-	Long:  `Lists all unit files that exist in the cluster (whether or not they are loaded onto a machine).`,
-	Run:   runWrapper(runListUnitFiles),
+	Long: `Lists all unit files that exist in the cluster (whether or not they are loaded onto a machine).
+
+Only list the web units which should be running, but are not:
+fleetctl list-unit-files --name='web@*' --target-state=launched --current-state=inactive`,
+	Run: runWrapper(runListUnitFiles),
 }
 
 func init() {
@@ -101,6 +106,8 @@ func init() {
 	cmdListUnitFiles.Flags().BoolVar(&sharedFlags.Full, "full", false, "Do not ellipsize fields on output")
 	cmdListUnitFiles.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
 	cmdListUnitFiles.Flags().StringVar(&listUnitFilesFieldsFlag, "fields", defaultListUnitFilesFields, fmt.Sprintf("Columns to print for each Unit file. Valid fields are %q", strings.Join(unitToFieldKeys(listUnitFilesFields), ",")))
+	addListFlags(cmdListUnitFiles, true, true, listUnitFilesSortFields)
+	addOutputFlag(cmdListUnitFiles)
 }
 
 func runListUnitFiles(cCmd *cobra.Command, args []string) (exit int) {
@@ -120,12 +127,31 @@ func runListUnitFiles(cCmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	units, err := cAPI.Units()
+	opts, err := getListOptions()
+	if err == nil {
+		err = client.ValidateUnitListOptions(opts)
+	}
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	printer, err := getObjectPrinter(sharedFlags.Output)
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	units, err := cAPI.ListUnits(opts)
 	if err != nil {
 		stderr("Error retrieving list of units from repository: %v", err)
 		return 1
 	}
 
+	if printer != nil {
+		return printObjects(printer, units)
+	}
+
 	noLegend, _ := cCmd.Flags().GetBool("no-legend")
 	if !noLegend {
 		fmt.Fprintln(out, strings.ToUpper(strings.Join(cols, "\t")))
@@ -21,15 +21,18 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/coreos/fleet/client"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
 )
 
 const (
 	defaultListUnitsFields = "unit,machine,active,sub"
+	listUnitsSortFields    = "name,machineID,loadState,activeState,subState,health"
 )
 
 var (
+	flagListUnitsWatch  bool
 	listUnitsFieldsFlag string
 	listUnitsFields     = map[string]usToField{
 		"unit": func(us *schema.UnitState, full bool) string {
@@ -56,6 +59,12 @@ var (
 			}
 			return us.SystemdSubState
 		},
+		"health": func(us *schema.UnitState, full bool) string {
+			if us == nil || us.Health == "" {
+				return "-"
+			}
+			return us.Health
+		},
 		"machine": func(us *schema.UnitState, full bool) string {
 			if us == nil || us.MachineID == "" {
 				return "-"
@@ -81,7 +90,7 @@ var (
 type usToField func(us *schema.UnitState, full bool) string
 
 var cmdListUnits = &cobra.Command{
-	Use:   "list-units [--no-legend] [-l|--full] [--fields]",
+	Use:   "list-units [--no-legend] [-l|--full] [--fields] [--name] [--machine] [--metadata] [--sort] [--output=FORMAT] [--watch]",
 	Short: "List the current state of units in the cluster",
 	Long: `Lists the state of all units in the cluster loaded onto a machine.
 
@@ -92,7 +101,16 @@ Output the list without ellipses:
 fleetctl list-units --full
 
 Or, choose the columns to display:
-fleetctl list-units --fields=unit,machine`,
+fleetctl list-units --fields=unit,machine
+
+Or, only list the units running in a region, sorted by state:
+fleetctl list-units --metadata=region=us-east --sort=activeState,name
+
+Or, output the states of units as JSON:
+fleetctl list-units --output=json
+
+Keep the list on display, redrawing it as the states of units change:
+fleetctl list-units --watch`,
 	Run: runWrapper(runListUnits),
 }
 
@@ -103,6 +121,10 @@ func init() {
 	cmdListUnits.Flags().BoolVar(&sharedFlags.Full, "l", false, "Shorthand for --full")
 	cmdListUnits.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
 	cmdListUnits.Flags().StringVar(&listUnitsFieldsFlag, "fields", defaultListUnitsFields, fmt.Sprintf("Columns to print for each Unit. Valid fields are %q", strings.Join(usToFieldKeys(listUnitsFields), ",")))
+	addListFlags(cmdListUnits, true, false, listUnitsSortFields)
+	addOutputFlag(cmdListUnits)
+	cmdListUnits.Flags().BoolVar(&flagListUnitsWatch, "watch", false, "Keep displaying the list, redrawing it as the states of units change")
+	cmdListUnits.Flags().Float64Var(&flagWatchInterval, "interval", 1.0, "With --watch, seconds between two polls of the states of units when the event stream is not available")
 }
 
 func runListUnits(cCmd *cobra.Command, args []string) (exit int) {
@@ -119,18 +141,49 @@ func runListUnits(cCmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
-	states, err := cAPI.UnitStates()
+	opts, err := getListOptions()
+	if err == nil {
+		err = client.ValidateUnitStateListOptions(opts)
+	}
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	printer, err := getObjectPrinter(sharedFlags.Output)
 	if err != nil {
-		stderr("Error retrieving list of units from repository: %v", err)
+		stderr("%v", err)
 		return 1
 	}
 
 	noLegend, _ := cCmd.Flags().GetBool("no-legend")
+	full, _ := cCmd.Flags().GetBool("full")
+	if flagListUnitsWatch {
+		if printer != nil {
+			stderr("--watch cannot be used with --output")
+			return 1
+		}
+		if len(opts.Sort) > 0 {
+			stderr("--watch cannot be used with --sort")
+			return 1
+		}
+		return watchUnitStates(cols, full, noLegend, opts)
+	}
+
+	states, err := cAPI.ListUnitStates(opts)
+	if err != nil {
+		stderr("Error retrieving list of units from repository: %v", err)
+		return 1
+	}
+
+	if printer != nil {
+		return printObjects(printer, states)
+	}
+
 	if !noLegend {
 		fmt.Fprintln(out, strings.ToUpper(strings.Join(cols, "\t")))
 	}
 
-	full, _ := cCmd.Flags().GetBool("full")
 	for _, us := range states {
 		var f []string
 		for _, c := range cols {
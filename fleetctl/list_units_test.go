@@ -43,7 +43,7 @@ func TestListUnitsFieldsToStrings(t *testing.T) {
 	cAPI = fakeAPI{}
 
 	// nil UnitState shouldn't happen, but just in case
-	for _, tt := range []string{"unit", "load", "active", "sub", "machine", "hash"} {
+	for _, tt := range []string{"unit", "load", "active", "sub", "machine", "hash", "health"} {
 		f := listUnitsFields[tt](nil, false)
 		assertEqual(t, tt, "-", f)
 	}
@@ -62,6 +62,7 @@ func TestListUnitsFieldsToStrings(t *testing.T) {
 		"sub":     "baz",
 		"machine": "-",
 		"unit":    "sleep",
+		"health":  "-",
 	} {
 		got := listUnitsFields[k](us, false)
 		assertEqual(t, k, want, got)
@@ -81,6 +82,9 @@ func TestListUnitsFieldsToStrings(t *testing.T) {
 	ms = listUnitsFields["machine"](us, true)
 	assertEqual(t, "machine", "other-id/1.2.3.4", ms)
 
+	us.Health = "healthy"
+	assertEqual(t, "health", "healthy", listUnitsFields["health"](us, false))
+
 	uh := "a0f275d46bc6ee0eca06be7c339913c07d99c0c7"
 	us.Hash = uh
 	fuh := listUnitsFields["hash"](us, true)
@@ -0,0 +1,122 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputTemplate = "template="
+
+	outputFlagUsage = "Output format: table, json, yaml or template=<go-template>, the template being executed for each listed object"
+)
+
+// objectPrinter writes the objects listed by a command, in place of the
+// tab-aligned table.
+type objectPrinter func(w io.Writer, objs interface{}) error
+
+func addOutputFlag(cCmd *cobra.Command) {
+	cCmd.Flags().StringVar(&sharedFlags.Output, "output", outputTable, outputFlagUsage)
+}
+
+// getObjectPrinter parses the value of the --output flag. A nil printer
+// means the table must be rendered.
+func getObjectPrinter(format string) (objectPrinter, error) {
+	switch {
+	case format == "" || format == outputTable:
+		return nil, nil
+	case format == outputJSON:
+		return printJSON, nil
+	case format == outputYAML:
+		return printYAML, nil
+	case strings.HasPrefix(format, outputTemplate):
+		text := strings.TrimPrefix(format, outputTemplate)
+		if text == "" {
+			return nil, errors.New("empty output template")
+		}
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output template: %v", err)
+		}
+		return templatePrinter(tmpl), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// printObjects writes objs, a slice, to stdout with the given printer.
+func printObjects(p objectPrinter, objs interface{}) (exit int) {
+	// print empty lists as such rather than null
+	if v := reflect.ValueOf(objs); v.Kind() == reflect.Slice && v.IsNil() {
+		objs = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+	if err := p(os.Stdout, objs); err != nil {
+		stderr("Error writing output: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func printJSON(w io.Writer, objs interface{}) error {
+	b, err := json.MarshalIndent(objs, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// printYAML relies on the JSON field names, so both formats are alike.
+func printYAML(w io.Writer, objs interface{}) error {
+	b, err := yaml.Marshal(objs)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// templatePrinter executes tmpl once per object of the given slice, each
+// on its own line.
+func templatePrinter(tmpl *template.Template) objectPrinter {
+	return func(w io.Writer, objs interface{}) error {
+		v := reflect.ValueOf(objs)
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot execute template on %T", objs)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := tmpl.Execute(w, v.Index(i).Interface()); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
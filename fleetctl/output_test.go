@@ -0,0 +1,108 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/schema"
+)
+
+func TestGetObjectPrinter(t *testing.T) {
+	for _, tt := range []struct {
+		format  string
+		table   bool
+		invalid bool
+	}{
+		{"", true, false},
+		{"table", true, false},
+		{"json", false, false},
+		{"yaml", false, false},
+		{"template={{.Name}}", false, false},
+		{"template=", false, true},
+		{"template={{.Name", false, true},
+		{"xml", false, true},
+	} {
+		p, err := getObjectPrinter(tt.format)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("format %q: expected error", tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("format %q: unexpected error: %v", tt.format, err)
+		} else if (p == nil) != tt.table {
+			t.Errorf("format %q: expected table=%t", tt.format, tt.table)
+		}
+	}
+}
+
+func TestObjectPrinters(t *testing.T) {
+	states := []*schema.UnitState{
+		{Name: "foo.service", MachineID: "m1", SystemdActiveState: "active"},
+		{Name: "bar.service", MachineID: "m2", SystemdActiveState: "failed"},
+	}
+	machines := []machine.MachineState{
+		{ID: "m1", PublicIP: "10.0.0.1"},
+	}
+
+	for _, tt := range []struct {
+		format string
+		objs   interface{}
+		want   string
+	}{
+		{
+			"json",
+			states[:1],
+			"[\n  {\n    \"machineID\": \"m1\",\n    \"name\": \"foo.service\",\n    \"systemdActiveState\": \"active\"\n  }\n]\n",
+		},
+		{
+			"yaml",
+			states[:1],
+			"- machineID: m1\n  name: foo.service\n  systemdActiveState: active\n",
+		},
+		{
+			"template={{.Name}} {{.MachineID}}",
+			states,
+			"foo.service m1\nbar.service m2\n",
+		},
+		{
+			"template={{.ID}}={{.PublicIP}}",
+			machines,
+			"m1=10.0.0.1\n",
+		},
+		{
+			"json",
+			[]*schema.Unit{},
+			"[]\n",
+		},
+	} {
+		p, err := getObjectPrinter(tt.format)
+		if err != nil {
+			t.Fatalf("format %q: %v", tt.format, err)
+		}
+		var buf bytes.Buffer
+		if err := p(&buf, tt.objs); err != nil {
+			t.Errorf("format %q: unexpected error: %v", tt.format, err)
+			continue
+		}
+		if buf.String() != tt.want {
+			t.Errorf("format %q: got\n%q\nwant\n%q", tt.format, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
+)
+
+var flagRollbackTo int
+
+var cmdRollback = &cobra.Command{
+	Use:   "rollback --to=REV UNIT",
+	Short: "Restore an earlier revision of a unit",
+	Long: `Replaces the content of a unit with that of an earlier revision, as listed by
+the history command. The unit keeps its machine and desired state, and is
+restarted there with the restored content. The rollback itself is recorded as
+a new revision.
+
+Roll a unit back to its second revision:
+	fleetctl rollback --to=2 foo.service`,
+	Run: runWrapper(runRollback),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdRollback)
+
+	cmdRollback.Flags().IntVar(&flagRollbackTo, "to", 0, "Revision to restore the unit to.")
+}
+
+func runRollback(cCmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		stderr("One unit file must be provided")
+		return 1
+	}
+	if flagRollbackTo < 1 {
+		stderr("A revision must be given with --to")
+		return 1
+	}
+	name := unitNameMangle(args[0])
+
+	revs, err := cAPI.UnitRevisions(name)
+	if err != nil {
+		stderr("Error retrieving revisions of Unit(%s): %v", name, err)
+		return 1
+	}
+
+	var rev *schema.UnitRevision
+	for _, r := range revs {
+		if r.Revision == flagRollbackTo {
+			rev = r
+			break
+		}
+	}
+	if rev == nil {
+		stderr("Revision %d of Unit(%s) not found", flagRollbackTo, name)
+		return 1
+	}
+
+	u, err := cAPI.Unit(name)
+	if err != nil {
+		stderr("Error retrieving Unit(%s) from Registry: %v", name, err)
+		return 1
+	}
+	if u == nil {
+		stderr("Unit %s does not exist", name)
+		return 1
+	}
+
+	cur := schema.MapSchemaUnitOptionsToUnitFile(u.Options)
+	if unit.MatchUnitFiles(cur, schema.MapSchemaUnitOptionsToUnitFile(rev.Options)) {
+		stdout("Unit %s already at revision %d", name, rev.Revision)
+		return 0
+	}
+
+	if err := cAPI.UpdateUnit(&schema.Unit{Name: name, Options: rev.Options}); err != nil {
+		stderr("Failed rolling back Unit(%s): %v", name, err)
+		return 1
+	}
+
+	stdout("Rolled back unit %s to revision %d", name, rev.Revision)
+	return 0
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
+)
+
+func submitRevisions(t *testing.T, name string, contents ...string) []*unit.UnitFile {
+	var ufs []*unit.UnitFile
+	for i, c := range contents {
+		uf := newUnitFile(t, c)
+		u := &schema.Unit{Name: name, Options: schema.MapUnitFileToSchemaUnitOptions(uf)}
+		var err error
+		if i == 0 {
+			err = cAPI.CreateUnit(u)
+		} else {
+			err = cAPI.UpdateUnit(u)
+		}
+		if err != nil {
+			t.Fatalf("failed submitting revision %d of %s: %v", i+1, name, err)
+		}
+		ufs = append(ufs, uf)
+	}
+	return ufs
+}
+
+func TestRunRollback(t *testing.T) {
+	cAPI = newFakeRegistryForCommands("rollback", 0, false)
+	ufs := submitRevisions(t, "roll.service", "[Service]\nExecStart=/usr/bin/true", "[Service]\nExecStart=/usr/bin/false")
+
+	tests := []struct {
+		to   int
+		exit int
+		want *unit.UnitFile
+		revs int
+	}{
+		// no revision given
+		{0, 1, ufs[1], 2},
+		// unknown revision
+		{9, 1, ufs[1], 2},
+		// restoring an older revision records a new one
+		{1, 0, ufs[0], 3},
+		// the unit already has the content of revision 1
+		{1, 0, ufs[0], 3},
+		{2, 0, ufs[1], 4},
+	}
+
+	for i, tt := range tests {
+		flagRollbackTo = tt.to
+		if exit := runRollback(cmdRollback, []string{"roll.service"}); exit != tt.exit {
+			t.Errorf("case %d: expected exit code %d, got %d", i, tt.exit, exit)
+		}
+
+		u, err := cAPI.Unit("roll.service")
+		if err != nil || u == nil {
+			t.Fatalf("case %d: failed fetching unit: %v", i, err)
+		}
+		if !unit.MatchUnitFiles(schema.MapSchemaUnitOptionsToUnitFile(u.Options), tt.want) {
+			t.Errorf("case %d: unexpected unit content %v", i, u.Options)
+		}
+
+		revs, err := cAPI.UnitRevisions("roll.service")
+		if err != nil {
+			t.Fatalf("case %d: failed fetching revisions: %v", i, err)
+		}
+		if len(revs) != tt.revs {
+			t.Errorf("case %d: expected %d revisions, got %d", i, tt.revs, len(revs))
+		}
+	}
+
+	flagRollbackTo = 1
+	if exit := runRollback(cmdRollback, []string{"missing.service"}); exit != 1 {
+		t.Errorf("expected exit code 1 for unknown unit, got %d", exit)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
+)
+
+var (
+	flagBatch      int
+	flagWaitActive bool
+)
+
+var cmdRollingUpdate = &cobra.Command{
+	Use:   "rolling-update [--batch=N] [--wait-active] [--block-attempts=N] TEMPLATE-FILE",
+	Short: "Replace the unit file of a template and restart its instances in batches",
+	Long: `Replaces a template unit in the cluster with the given local file, or
+submits it if it does not exist yet, then restarts all of its instances with
+the new unit file, a batch of instances at a time.
+
+For each batch, fleetctl replaces the unit file of the instances in place,
+keeping their machine and desired state, and waits until they have been
+launched again with the new unit file. With --wait-active it additionally
+waits for systemd to report the instances as active with the new unit file,
+and for the instances declaring a health check to report healthy. The next
+batch is only started once the current one is healthy; if a batch fails to
+become healthy the update stops, leaving the remaining instances untouched.
+
+Update all instances of app@.service, two at a time:
+	fleetctl rolling-update --batch=2 --wait-active app@.service`,
+	Run: runWrapper(runRollingUpdate),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdRollingUpdate)
+
+	cmdRollingUpdate.Flags().IntVar(&flagBatch, "batch", 1, "Number of instances to update at a time.")
+	cmdRollingUpdate.Flags().BoolVar(&flagWaitActive, "wait-active", false, "Wait for systemd to report each batch as active, and healthy if it declares a health check, before continuing.")
+	cmdRollingUpdate.Flags().IntVar(&sharedFlags.BlockAttempts, "block-attempts", 0, "Wait until each batch is launched, performing up to N attempts before giving up. A value of 0 indicates no limit.")
+}
+
+func runRollingUpdate(cCmd *cobra.Command, args []string) (exit int) {
+	if len(args) != 1 {
+		stderr("One template unit file must be provided")
+		return 1
+	}
+	if flagBatch < 1 {
+		stderr("Batch size must be at least 1")
+		return 1
+	}
+
+	name := path.Base(args[0])
+	uni := unit.NewUnitNameInfo(name)
+	if uni == nil || !uni.IsTemplate() {
+		stderr("Unit %s is not a template unit", name)
+		return 1
+	}
+
+	uf, err := getUnitFromFile(args[0])
+	if err != nil {
+		stderr("Failed getting Unit(%s) from file: %v", name, err)
+		return 1
+	}
+
+	instances, err := findTemplateInstances(name)
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	if err := replaceUnitFile(name, uf, ""); err != nil {
+		stderr("Failed submitting template Unit(%s): %v", name, err)
+		return 1
+	}
+
+	if len(instances) == 0 {
+		stdout("Submitted template %s, no instances to update", name)
+		return 0
+	}
+
+	attempts := getBlockAttempts(cCmd)
+	for i := 0; i < len(instances); i += flagBatch {
+		end := i + flagBatch
+		if end > len(instances) {
+			end = len(instances)
+		}
+		batch := instances[i:end]
+		n := i/flagBatch + 1
+
+		if err := rollingUpdateBatch(batch, uf, flagWaitActive, attempts); err != nil {
+			stderr("Batch %d (%s) failed to become healthy: %v", n, unitNames(batch), err)
+			if end < len(instances) {
+				stderr("Rolling update stopped, not updated: %s", unitNames(instances[end:]))
+			}
+			return 1
+		}
+		stdout("Batch %d (%s) updated", n, unitNames(batch))
+	}
+
+	return 0
+}
+
+// findTemplateInstances returns the instances of the given template that
+// exist in the cluster, sorted by name.
+func findTemplateInstances(tmpl string) ([]schema.Unit, error) {
+	units, err := cAPI.Units()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving list of units from repository: %v", err)
+	}
+
+	var instances []schema.Unit
+	for _, u := range units {
+		uni := unit.NewUnitNameInfo(u.Name)
+		if uni != nil && uni.IsInstance() && uni.Template == tmpl {
+			instances = append(instances, *u)
+		}
+	}
+
+	sort.Sort(unitsByName(instances))
+	return instances, nil
+}
+
+// replaceUnitFile swaps the unit file of an existing unit for the given one
+// in place, keeping its schedule and target state, so that the unit exists
+// throughout. Units that do not exist yet are created with the given target
+// state.
+func replaceUnitFile(name string, uf *unit.UnitFile, desired string) error {
+	u, err := cAPI.Unit(name)
+	if err != nil {
+		return fmt.Errorf("error retrieving Unit(%s) from Registry: %v", name, err)
+	}
+	if u != nil {
+		_, err := updateUnit(name, uf)
+		return err
+	}
+
+	if _, err := createUnit(name, uf); err != nil {
+		return err
+	}
+	if desired == "" || job.JobState(desired) == job.JobStateInactive {
+		return nil
+	}
+	return cAPI.SetUnitTargetState(name, desired)
+}
+
+// rollingUpdateBatch replaces the unit file of every unit in the batch and
+// waits until the batch has reached its desired state again. As the units
+// are replaced in place, their states only tell the new unit file apart
+// from the old one by its hash.
+func rollingUpdateBatch(batch []schema.Unit, uf *unit.UnitFile, waitActive bool, attempts int) error {
+	waiting := map[job.JobState][]string{}
+	for _, u := range batch {
+		if err := replaceUnitFile(u.Name, uf, u.DesiredState); err != nil {
+			return err
+		}
+
+		js := job.JobState(u.DesiredState)
+		if suToGlobal(u) || js == job.JobStateInactive || js == "" {
+			continue
+		}
+		waiting[js] = append(waiting[js], u.Name)
+	}
+
+	hash := uf.Hash().String()
+	for _, js := range []job.JobState{job.JobStateLoaded, job.JobStateLaunched} {
+		if err := tryWaitForUnitStates(waiting[js], "rolling-update", js, attempts, os.Stdout); err != nil {
+			return err
+		}
+		active := waitActive && js == job.JobStateLaunched
+		if err := tryWaitForUnitHash(waiting[js], hash, active, attempts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryWaitForUnitHash polls the states of the given units until each of them
+// reports running the unit file of the given hash and, if active is set, is
+// active and healthy with it. maxAttempts is interpreted as by
+// tryWaitForUnitStates.
+func tryWaitForUnitHash(units []string, hash string, active bool, maxAttempts int) error {
+	if maxAttempts <= -1 {
+		return nil
+	}
+
+	errchan := make(chan error, len(units))
+	var wg sync.WaitGroup
+	for _, name := range units {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for attempt := 0; maxAttempts < 1 || attempt < maxAttempts; attempt++ {
+				if _, err := waitForState(func() error { return assertUnitHash(name, hash, active) }); err == nil {
+					return
+				}
+			}
+			errchan <- fmt.Errorf("timed out waiting for unit %s to run unit file %s", name, hash)
+		}(name)
+	}
+	wg.Wait()
+	close(errchan)
+
+	for err := range errchan {
+		stderr("Error waiting for units: %v", err)
+		return err
+	}
+	return nil
+}
+
+// assertUnitHash checks that the state of the given unit was published for
+// the unit file of the given hash and, if active is set, that it is active
+// and healthy.
+func assertUnitHash(name, hash string, active bool) error {
+	us, err := cAPI.UnitState(name)
+	if err != nil {
+		return fmt.Errorf("Error getting unit state of %s: %v", name, err)
+	}
+	if us == nil || us.Hash != hash {
+		return fmt.Errorf("Unit %s is not running unit file %s yet", name, hash)
+	}
+	if !active {
+		return nil
+	}
+	return checkActiveUnitState(name, us)
+}
+
+func unitNames(units []schema.Unit) string {
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = u.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+type unitsByName []schema.Unit
+
+func (u unitsByName) Len() int           { return len(u) }
+func (u unitsByName) Less(i, j int) bool { return u[i].Name < u[j].Name }
+func (u unitsByName) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
@@ -0,0 +1,208 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/unit"
+)
+
+const rollingUpdateContents = "[Service]\nExecStart=/usr/bin/sleep 3000\n"
+
+func newFakeRegistryForRollingUpdate() client.API {
+	machineStates = nil
+	old := unit.UnitFile{}
+	jobs := []job.Job{
+		{Name: "app@.service", Unit: old},
+		{Name: "app@1.service", Unit: old, TargetState: job.JobStateLaunched},
+		{Name: "app@2.service", Unit: old, TargetState: job.JobStateLaunched},
+		{Name: "app@3.service", Unit: old, TargetState: job.JobStateLoaded},
+		{Name: "other@1.service", Unit: old, TargetState: job.JobStateLaunched},
+	}
+
+	reg := registry.NewFakeRegistry()
+	reg.SetJobs(jobs)
+	return &client.RegistryClient{Registry: reg}
+}
+
+func writeRollingUpdateFile(t *testing.T, name string) (string, func()) {
+	dir, err := ioutil.TempDir("", "fleetctl-rolling-update")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %v", err)
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(rollingUpdateContents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed writing unit file: %v", err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestRunRollingUpdate(t *testing.T) {
+	file, cleanup := writeRollingUpdateFile(t, "app@.service")
+	defer cleanup()
+
+	cAPI = newFakeRegistryForRollingUpdate()
+	sharedFlags.NoBlock = true
+	defer func() { sharedFlags.NoBlock = false }()
+	flagBatch = 2
+
+	if exit := runRollingUpdate(cmdRollingUpdate, []string{file}); exit != 0 {
+		t.Fatalf("expected exit code 0, got %d", exit)
+	}
+
+	want := map[string]string{
+		"app@.service":    "",
+		"app@1.service":   string(job.JobStateLaunched),
+		"app@2.service":   string(job.JobStateLaunched),
+		"app@3.service":   string(job.JobStateLoaded),
+		"other@1.service": string(job.JobStateLaunched),
+	}
+	for name, desired := range want {
+		u, err := cAPI.Unit(name)
+		if err != nil || u == nil {
+			t.Fatalf("failed fetching Unit(%s): %v", name, err)
+		}
+		wantUpdated := name != "other@1.service"
+		if updated := len(u.Options) != 0; updated != wantUpdated {
+			t.Errorf("Unit(%s) expected updated=%t, got %t", name, wantUpdated, updated)
+		}
+		if name != "app@.service" && u.DesiredState != desired {
+			t.Errorf("Unit(%s) expected desired state %q, got %q", name, desired, u.DesiredState)
+		}
+	}
+}
+
+func TestRunRollingUpdateMissingTemplate(t *testing.T) {
+	file, cleanup := writeRollingUpdateFile(t, "web@.service")
+	defer cleanup()
+
+	cAPI = newFakeRegistryForRollingUpdate()
+	flagBatch = 1
+
+	if exit := runRollingUpdate(cmdRollingUpdate, []string{file}); exit != 0 {
+		t.Fatalf("expected exit code 0, got %d", exit)
+	}
+
+	u, err := cAPI.Unit("web@.service")
+	if err != nil || u == nil {
+		t.Fatalf("template Unit(web@.service) was not submitted: %v", err)
+	}
+	if len(u.Options) == 0 {
+		t.Errorf("template Unit(web@.service) submitted without its unit file")
+	}
+}
+
+func TestRunRollingUpdateBatchFailure(t *testing.T) {
+	file, cleanup := writeRollingUpdateFile(t, "app@.service")
+	defer cleanup()
+
+	// Units never report a current state in the fake registry, so the
+	// first batch times out.
+	cAPI = newFakeRegistryForRollingUpdate()
+	sharedFlags.BlockAttempts = 1
+	defer func() { sharedFlags.BlockAttempts = 0 }()
+	flagBatch = 2
+
+	if exit := runRollingUpdate(cmdRollingUpdate, []string{file}); exit != 1 {
+		t.Fatalf("expected exit code 1, got %d", exit)
+	}
+
+	u, err := cAPI.Unit("app@3.service")
+	if err != nil || u == nil {
+		t.Fatalf("failed fetching Unit(app@3.service): %v", err)
+	}
+	if len(u.Options) != 0 {
+		t.Errorf("Unit(app@3.service) updated after a failed batch")
+	}
+}
+
+func TestRunRollingUpdateWaitsForNewUnitFile(t *testing.T) {
+	file, cleanup := writeRollingUpdateFile(t, "app@.service")
+	defer cleanup()
+
+	// The instances are launched and active, but keep reporting the hash
+	// of the old unit file, as if the agent had not replaced them yet.
+	launched := job.JobStateLaunched
+	old := unit.UnitFile{}
+	reg := registry.NewFakeRegistry()
+	reg.SetJobs([]job.Job{
+		{Name: "app@.service", Unit: old},
+		{Name: "app@1.service", Unit: old, TargetState: launched, State: &launched, TargetMachineID: "XXX"},
+		{Name: "app@2.service", Unit: old, TargetState: launched, State: &launched, TargetMachineID: "XXX"},
+	})
+	reg.SetUnitStates([]unit.UnitState{
+		{UnitName: "app@1.service", UnitHash: old.Hash().String(), LoadState: "loaded", ActiveState: "active", MachineID: "XXX"},
+		{UnitName: "app@2.service", UnitHash: old.Hash().String(), LoadState: "loaded", ActiveState: "active", MachineID: "XXX"},
+	})
+	cAPI = &client.RegistryClient{Registry: reg}
+	machineStates = nil
+	sharedFlags.BlockAttempts = 1
+	defer func() {
+		sharedFlags.BlockAttempts = 0
+		flagWaitActive = false
+	}()
+	flagBatch = 1
+
+	for _, waitActive := range []bool{false, true} {
+		flagWaitActive = waitActive
+		if exit := runRollingUpdate(cmdRollingUpdate, []string{file}); exit != 1 {
+			t.Errorf("wait-active=%t: expected exit code 1, got %d", waitActive, exit)
+		}
+	}
+
+	u, err := cAPI.Unit("app@2.service")
+	if err != nil || u == nil {
+		t.Fatalf("failed fetching Unit(app@2.service): %v", err)
+	}
+	if len(u.Options) != 0 {
+		t.Errorf("Unit(app@2.service) updated before the first batch ran the new unit file")
+	}
+
+	// once the instances report the new unit file, the update goes through
+	uf, err := unit.NewUnitFile(rollingUpdateContents)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reg.SetUnitStates([]unit.UnitState{
+		{UnitName: "app@1.service", UnitHash: uf.Hash().String(), LoadState: "loaded", ActiveState: "active", MachineID: "XXX"},
+		{UnitName: "app@2.service", UnitHash: uf.Hash().String(), LoadState: "loaded", ActiveState: "active", MachineID: "XXX"},
+	})
+	flagWaitActive = true
+	if exit := runRollingUpdate(cmdRollingUpdate, []string{file}); exit != 0 {
+		t.Errorf("expected exit code 0 once the new unit file runs, got %d", exit)
+	}
+}
+
+func TestRunRollingUpdateBadArgs(t *testing.T) {
+	file, cleanup := writeRollingUpdateFile(t, "app.service")
+	defer cleanup()
+
+	cAPI = newFakeRegistryForRollingUpdate()
+	flagBatch = 1
+
+	for _, args := range [][]string{nil, {file}, {"a@.service", "b@.service"}} {
+		if exit := runRollingUpdate(cmdRollingUpdate, args); exit != 1 {
+			t.Errorf("args %v: expected exit code 1, got %d", args, exit)
+		}
+	}
+}
@@ -17,10 +17,8 @@ package main
 import (
 	"errors"
 	"fmt"
-	"net"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"syscall"
 
@@ -143,8 +141,8 @@ func runSSH(cCmd *cobra.Command, args []string) (exit int) {
 
 func findSSHPort(cCmd *cobra.Command, addr string) string {
 	SSHPort, _ := cCmd.Flags().GetInt("ssh-port")
-	if SSHPort != 22 && !strings.Contains(addr, ":") {
-		return net.JoinHostPort(addr, strconv.Itoa(SSHPort))
+	if SSHPort != 22 {
+		return ssh.AddPortIfMissing(addr, SSHPort)
 	} else {
 		return addr
 	}
@@ -196,7 +194,7 @@ func findAddressInMachineList(lookup string) (string, bool, error) {
 		return "", false, fmt.Errorf("machine does not exist")
 	}
 
-	return match.PublicIP, true, nil
+	return match.AddressFor(machine.AddressSSH), true, nil
 }
 
 func findAddressInRunningUnits(name string) (string, bool, error) {
@@ -211,8 +209,8 @@ func findAddressInRunningUnits(name string) (string, bool, error) {
 	}
 
 	m := cachedMachineState(u.MachineID)
-	if m != nil && m.PublicIP != "" {
-		return m.PublicIP, true, nil
+	if m != nil && m.AddressFor(machine.AddressSSH) != "" {
+		return m.AddressFor(machine.AddressSSH), true, nil
 	}
 
 	return "", false, nil
@@ -232,7 +230,7 @@ func runCommand(cCmd *cobra.Command, machID string, cmd string, args ...string)
 		if err != nil || ms == nil {
 			stderr("Error getting machine IP: %v", err)
 		} else {
-			addr := findSSHPort(cCmd, ms.PublicIP)
+			addr := findSSHPort(cCmd, ms.AddressFor(machine.AddressSSH))
 			err, retcode = runRemoteCommand(cCmd, addr, cmd, args...)
 			if err != nil {
 				stderr("Unable to SSH to remote host: %v", err)
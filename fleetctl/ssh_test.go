@@ -158,3 +158,19 @@ func TestGlobalLookupWithAmbiguousArgument(t *testing.T) {
 		t.Fatal("Expected to find an error with an ambiguous argument")
 	}
 }
+
+func TestSshFindMachineSSHAddress(t *testing.T) {
+	ms := newMachineState("c31e44e1-f858-436e-933e-59c642517860", "1.2.3.4", nil)
+	ms.Addresses = []machine.Address{
+		{Role: machine.AddressPublic, IP: "1.2.3.4"},
+		{Role: machine.AddressSSH, IP: "2001:db8::4"},
+	}
+	reg := registry.NewFakeRegistry()
+	reg.SetMachines([]machine.MachineState{ms})
+	cAPI = &client.RegistryClient{Registry: reg}
+
+	ip, _, _ := findAddressInMachineList("c31e44e1")
+	if ip != "2001:db8::4" {
+		t.Errorf("Expected to return the host 2001:db8::4, but it was %s", ip)
+	}
+}
@@ -24,7 +24,7 @@ import (
 )
 
 var cmdStatus = &cobra.Command{
-	Use:   "status [--ssh-port=N] UNIT...",
+	Use:   "status [--ssh-port=N] [--output=FORMAT] UNIT...",
 	Short: "Output the status of one or more units in the cluster",
 	Long: `Output the status of one or more units currently running in the cluster.
 Supports glob matching of units in the current working directory or matches
@@ -36,6 +36,10 @@ Show status of a single unit:
 Show status of an entire directory with glob matching:
 fleetctl status myservice/*
 
+Output the states of the unit as reported by fleet, rather than the status
+from systemd, as JSON:
+fleetctl status --output=json foo.service
+
 This command does not work with global units.`,
 	Run: runWrapper(runStatusUnit),
 }
@@ -44,9 +48,17 @@ func init() {
 	cmdFleet.AddCommand(cmdStatus)
 
 	cmdStatus.Flags().IntVar(&sharedFlags.SSHPort, "ssh-port", 22, "Connect to remote hosts over SSH using this TCP port.")
+	addOutputFlag(cmdStatus)
 }
 
 func runStatusUnit(cCmd *cobra.Command, args []string) (exit int) {
+	printer, err := getObjectPrinter(sharedFlags.Output)
+	if err != nil {
+		stderr("%v", err)
+		return 1
+	}
+
+	names := make(map[string]bool)
 	globalUnits := make([]schema.Unit, 0)
 	for i, arg := range args {
 		name := unitNameMangle(arg)
@@ -59,6 +71,9 @@ func runStatusUnit(cCmd *cobra.Command, args []string) (exit int) {
 		if unit == nil {
 			stderr("Unit %s does not exist.", name)
 			return 1
+		} else if printer != nil {
+			names[unit.Name] = true
+			continue
 		} else if suToGlobal(*unit) {
 			globalUnits = append(globalUnits, *unit)
 			continue
@@ -78,6 +93,10 @@ func runStatusUnit(cCmd *cobra.Command, args []string) (exit int) {
 		}
 	}
 
+	if printer != nil {
+		return printUnitStatus(printer, names)
+	}
+
 	if err := cmdGlobalMachineState(cCmd, globalUnits); err != nil {
 		stderr("Error retrieving machine state for global units: %v", err)
 		return 1
@@ -85,3 +104,21 @@ func runStatusUnit(cCmd *cobra.Command, args []string) (exit int) {
 
 	return
 }
+
+// printUnitStatus outputs the states of the named units on every machine
+// they are loaded onto.
+func printUnitStatus(printer objectPrinter, names map[string]bool) (exit int) {
+	states, err := cAPI.UnitStates()
+	if err != nil {
+		stderr("Error retrieving unit states: %v", err)
+		return 1
+	}
+
+	var found []*schema.UnitState
+	for _, us := range states {
+		if names[us.Name] {
+			found = append(found, us)
+		}
+	}
+	return printObjects(printer, found)
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"google.golang.org/api/googleapi"
+
+	"github.com/coreos/fleet/client"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/schema"
+)
+
+const (
+	// watchHighlight is how long changed rows stay highlighted.
+	watchHighlight = 3 * time.Second
+
+	ansiClearScreen = "\x1b[H\x1b[2J"
+	ansiBold        = "\x1b[1m"
+	ansiReset       = "\x1b[0m"
+)
+
+var flagWatchInterval float64
+
+var cmdWatch = &cobra.Command{
+	Use:   "watch [--no-legend] [-l|--full] [--fields] [--name] [--machine] [--metadata] [--interval=N]",
+	Short: "Continuously display the current state of units in the cluster",
+	Long: `Displays the same table as list-units, and keeps redrawing it as the
+states of units change. Rows which just changed are highlighted.
+
+Changes are received from the event stream of the fleet API. When it is not
+available, for example when using --driver=etcd, the states of units are
+polled instead, every --interval seconds. Units selected with --name,
+--machine or --metadata are always polled.
+
+This is equivalent to:
+fleetctl list-units --watch`,
+	Run: runWrapper(runWatch),
+}
+
+func init() {
+	cmdFleet.AddCommand(cmdWatch)
+
+	cmdWatch.Flags().BoolVar(&sharedFlags.Full, "full", false, "Do not ellipsize fields on output")
+	cmdWatch.Flags().BoolVar(&sharedFlags.Full, "l", false, "Shorthand for --full")
+	cmdWatch.Flags().BoolVar(&sharedFlags.NoLegend, "no-legend", false, "Do not print a legend (column headers)")
+	cmdWatch.Flags().StringVar(&listUnitsFieldsFlag, "fields", defaultListUnitsFields, fmt.Sprintf("Columns to print for each Unit. Valid fields are %q", strings.Join(usToFieldKeys(listUnitsFields), ",")))
+	addListFlags(cmdWatch, true, false, "")
+	cmdWatch.Flags().Float64Var(&flagWatchInterval, "interval", 1.0, "Seconds between two polls of the states of units when the event stream is not available")
+}
+
+func runWatch(cCmd *cobra.Command, args []string) (exit int) {
+	flagListUnitsWatch = true
+	return runListUnits(cCmd, args)
+}
+
+// eventWatcher is implemented by the clients able to stream cluster events.
+type eventWatcher interface {
+	Watch(index uint64, events chan<- *schema.Event, stop <-chan struct{}) error
+}
+
+// watchUnitStates keeps displaying the states of units until fleetctl is
+// interrupted.
+func watchUnitStates(cols []string, full, noLegend bool, opts client.ListOptions) (exit int) {
+	view := newUnitStateView()
+	stop := make(chan struct{})
+	fetch := func() ([]*schema.UnitState, error) {
+		return cAPI.ListUnitStates(opts)
+	}
+
+	states, err := fetch()
+	if err != nil {
+		stderr("Error retrieving list of units from repository: %v", err)
+		return 1
+	}
+	view.reset(states, time.Now())
+
+	interval := time.Duration(flagWatchInterval*1000) * time.Millisecond
+	// events are not filtered, so the selected states are polled
+	if w, ok := cAPI.(eventWatcher); ok && !opts.Selects() {
+		go followUnitStateEvents(w, view, fetch, interval, stop)
+	} else {
+		go pollUnitStates(view, fetch, interval, stop)
+	}
+
+	tty := terminal.IsTerminal(int(os.Stdout.Fd()))
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastTick := time.Now()
+	for {
+		var buf bytes.Buffer
+		if tty {
+			buf.WriteString(ansiClearScreen)
+		}
+		view.render(&buf, cols, full, noLegend, tty, time.Now())
+		if !tty {
+			buf.WriteString("\n")
+		}
+		os.Stdout.Write(buf.Bytes())
+
+		for redraw := false; !redraw; {
+			select {
+			case <-view.updated:
+				redraw = true
+			case now := <-ticker.C:
+				// redraw once highlighting of changed rows ends
+				redraw = tty && view.highlightExpired(lastTick, now)
+				lastTick = now
+			}
+		}
+	}
+}
+
+// followUnitStateEvents applies the changes received from the event stream
+// to the view, falling back to polling if the API does not serve events.
+func followUnitStateEvents(w eventWatcher, view *unitStateView, fetch unitStatesFetcher, interval time.Duration, stop chan struct{}) {
+	var index uint64
+	for {
+		events := make(chan *schema.Event)
+		errc := make(chan error, 1)
+		go func(index uint64) {
+			errc <- w.Watch(index, events, stop)
+		}(index)
+
+		// Events may have been missed, so start over from the
+		// current states of units.
+		if index == 0 {
+			if states, err := fetch(); err == nil {
+				view.reset(states, time.Now())
+			}
+		}
+
+		for watching := true; watching; {
+			select {
+			case ev := <-events:
+				index = ev.Index
+				view.apply(ev, time.Now())
+			case err := <-errc:
+				if googerr, ok := err.(*googleapi.Error); ok && googerr.Code == http.StatusNotFound {
+					log.Debugf("Event stream not available, polling unit states instead")
+					pollUnitStates(view, fetch, interval, stop)
+					return
+				}
+				if client.IsEventIndexCleared(err) {
+					index = 0
+				}
+				log.Debugf("Watching events failed: %v", err)
+				watching = false
+			case <-stop:
+				return
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// unitStatesFetcher returns the states of the units on display.
+type unitStatesFetcher func() ([]*schema.UnitState, error)
+
+func pollUnitStates(view *unitStateView, fetch unitStatesFetcher, interval time.Duration, stop chan struct{}) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+
+		states, err := fetch()
+		if err != nil {
+			log.Debugf("Polling unit states failed: %v", err)
+			continue
+		}
+		view.reset(states, time.Now())
+	}
+}
+
+// unitStateView holds the states of units on display, along with the time
+// each of them last changed.
+type unitStateView struct {
+	mu      sync.Mutex
+	states  map[string]*schema.UnitState
+	changed map[string]time.Time
+	loaded  bool
+	// machines is set once machines joined the cluster since the
+	// last time the view was rendered.
+	machines bool
+
+	// updated receives a value whenever the view changed.
+	updated chan struct{}
+}
+
+func newUnitStateView() *unitStateView {
+	return &unitStateView{
+		states:  make(map[string]*schema.UnitState),
+		changed: make(map[string]time.Time),
+		updated: make(chan struct{}, 1),
+	}
+}
+
+func unitStateKey(name, machID string) string {
+	return path.Join(name, machID)
+}
+
+// reset replaces the states on display, marking the ones that changed.
+func (v *unitStateView) reset(states []*schema.UnitState, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cur := make(map[string]*schema.UnitState, len(states))
+	for _, us := range states {
+		cur[unitStateKey(us.Name, us.MachineID)] = us
+	}
+
+	changed := false
+	for key, us := range cur {
+		if prev, ok := v.states[key]; !ok || !prev.SameState(us) {
+			changed = true
+			if v.loaded {
+				v.changed[key] = now
+			}
+		}
+	}
+	for key := range v.states {
+		if _, ok := cur[key]; !ok {
+			changed = true
+			delete(v.changed, key)
+		}
+	}
+
+	v.states = cur
+	v.loaded = true
+	if changed {
+		v.notify()
+	}
+}
+
+// apply updates the states on display with the given event.
+func (v *unitStateView) apply(ev *schema.Event, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := unitStateKey(ev.UnitName, ev.MachineID)
+	switch ev.Type {
+	case schema.EventUnitStateChanged:
+		if prev, ok := v.states[key]; ok && prev.SameState(ev.UnitState) {
+			return
+		}
+		v.states[key] = ev.UnitState
+		v.changed[key] = now
+	case schema.EventUnitStateRemoved:
+		if _, ok := v.states[key]; !ok {
+			return
+		}
+		delete(v.states, key)
+		delete(v.changed, key)
+	case schema.EventMachineJoined:
+		v.machines = true
+	default:
+		return
+	}
+	v.notify()
+}
+
+func (v *unitStateView) notify() {
+	select {
+	case v.updated <- struct{}{}:
+	default:
+	}
+}
+
+// highlightExpired reports whether the highlighting of any row ended after
+// since, and no later than until.
+func (v *unitStateView) highlightExpired(since, until time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, t := range v.changed {
+		if end := t.Add(watchHighlight); end.After(since) && !end.After(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// render writes the table of states to w, sorted by unit name and machine.
+// With color set, the rows which changed within watchHighlight are bold.
+func (v *unitStateView) render(w io.Writer, cols []string, full, noLegend, color bool, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.machines {
+		// let the machine column pick up the machines which joined
+		machineStates = nil
+		v.machines = false
+	}
+
+	keys := make([]string, 0, len(v.states))
+	for key := range v.states {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', tabwriter.StripEscape)
+	if !noLegend {
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(cols, "\t")))
+	}
+	for _, key := range keys {
+		var f []string
+		for _, c := range cols {
+			f = append(f, listUnitsFields[c](v.states[key], full))
+		}
+		row := strings.Join(f, "\t")
+		if t, ok := v.changed[key]; ok && color && now.Sub(t) < watchHighlight {
+			// escape sequences are bracketed by tabwriter.Escape so
+			// they take no room in the columns
+			esc := string([]byte{tabwriter.Escape})
+			row = esc + ansiBold + esc + row + esc + ansiReset + esc
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/schema"
+)
+
+func TestUnitStateViewChanges(t *testing.T) {
+	now := time.Now()
+	v := newUnitStateView()
+	v.reset([]*schema.UnitState{
+		{Name: "a.service", MachineID: "m1", SystemdActiveState: "active"},
+		{Name: "b.service", MachineID: "m1", SystemdActiveState: "inactive"},
+	}, now)
+	if len(v.states) != 2 || len(v.changed) != 0 {
+		t.Fatalf("initial load should not mark rows changed: states=%v changed=%v", v.states, v.changed)
+	}
+	<-v.updated
+
+	// identical states are no change
+	v.reset([]*schema.UnitState{
+		{Name: "a.service", MachineID: "m1", SystemdActiveState: "active"},
+		{Name: "b.service", MachineID: "m1", SystemdActiveState: "inactive"},
+	}, now)
+	select {
+	case <-v.updated:
+		t.Fatalf("unexpected update")
+	default:
+	}
+
+	later := now.Add(time.Second)
+	v.reset([]*schema.UnitState{
+		{Name: "a.service", MachineID: "m1", SystemdActiveState: "failed"},
+		{Name: "c.service", MachineID: "m2", SystemdActiveState: "active"},
+	}, later)
+	<-v.updated
+	if len(v.states) != 2 {
+		t.Fatalf("expected 2 states, got %v", v.states)
+	}
+	for _, key := range []string{"a.service/m1", "c.service/m2"} {
+		if v.changed[key] != later {
+			t.Errorf("expected %s marked changed", key)
+		}
+	}
+	// the highlight of the rows changed at later ends at once
+	// watchHighlight has passed, and is only reported then
+	expiry := later.Add(watchHighlight)
+	for _, tt := range []struct {
+		since, until time.Time
+		want         bool
+	}{
+		{later, later.Add(time.Second), false},
+		{expiry.Add(-2 * time.Second), expiry.Add(-time.Second), false},
+		{expiry.Add(-time.Second), expiry, true},
+		{expiry.Add(-500 * time.Millisecond), expiry.Add(500 * time.Millisecond), true},
+		{expiry, expiry.Add(time.Second), false},
+	} {
+		if got := v.highlightExpired(tt.since, tt.until); got != tt.want {
+			t.Errorf("highlightExpired(%v, %v) returned %t, expected %t", tt.since.Sub(later), tt.until.Sub(later), got, tt.want)
+		}
+	}
+
+	v.apply(&schema.Event{
+		Type:      schema.EventUnitStateRemoved,
+		UnitName:  "c.service",
+		MachineID: "m2",
+	}, later)
+	v.apply(&schema.Event{
+		Type:      schema.EventUnitStateChanged,
+		UnitName:  "b.service",
+		MachineID: "m1",
+		UnitState: &schema.UnitState{Name: "b.service", MachineID: "m1", SystemdActiveState: "active"},
+	}, later)
+	<-v.updated
+	if _, ok := v.states["c.service/m2"]; ok {
+		t.Errorf("c.service should have been removed")
+	}
+	if _, ok := v.changed["c.service/m2"]; ok {
+		t.Errorf("c.service should not be highlighted anymore")
+	}
+	if us := v.states["b.service/m1"]; us == nil || us.SystemdActiveState != "active" {
+		t.Errorf("b.service state not updated: %v", us)
+	}
+
+	// a change of health alone is a change
+	v.apply(&schema.Event{
+		Type:      schema.EventUnitStateChanged,
+		UnitName:  "b.service",
+		MachineID: "m1",
+		UnitState: &schema.UnitState{Name: "b.service", MachineID: "m1", SystemdActiveState: "active", Health: "unhealthy"},
+	}, later)
+	<-v.updated
+	if us := v.states["b.service/m1"]; us == nil || us.Health != "unhealthy" {
+		t.Errorf("b.service health not updated: %v", us)
+	}
+
+	v.apply(&schema.Event{Type: schema.EventMachineJoined, MachineID: "m3"}, later)
+	if !v.machines {
+		t.Errorf("machine joined should be recorded")
+	}
+}
+
+func TestUnitStateViewRender(t *testing.T) {
+	machineStates = map[string]*machine.MachineState{}
+	defer func() { machineStates = nil }()
+
+	now := time.Now()
+	v := newUnitStateView()
+	v.reset([]*schema.UnitState{
+		{Name: "b.service", MachineID: "m1", SystemdActiveState: "active"},
+		{Name: "a.service", MachineID: "m1", SystemdActiveState: "active"},
+	}, now)
+	v.reset([]*schema.UnitState{
+		{Name: "b.service", MachineID: "m1", SystemdActiveState: "failed"},
+		{Name: "a.service", MachineID: "m1", SystemdActiveState: "active"},
+	}, now)
+
+	cols := []string{"unit", "active"}
+	var buf bytes.Buffer
+	v.render(&buf, cols, false, false, false, now)
+	want := "UNIT\t\tACTIVE\na.service\tactive\nb.service\tfailed\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output without color:\n%q\nwant:\n%q", buf.String(), want)
+	}
+
+	buf.Reset()
+	v.render(&buf, cols, false, true, true, now)
+	want = "a.service\tactive\n" + ansiBold + "b.service\tfailed" + ansiReset + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output with color:\n%q\nwant:\n%q", buf.String(), want)
+	}
+
+	buf.Reset()
+	v.render(&buf, cols, false, true, true, now.Add(watchHighlight))
+	want = "a.service\tactive\nb.service\tfailed\n"
+	if buf.String() != want {
+		t.Errorf("highlight should have expired:\n%q\nwant:\n%q", buf.String(), want)
+	}
+}
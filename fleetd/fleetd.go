@@ -20,16 +20,20 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 
 	"github.com/rakyll/globalconf"
 
 	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/config"
+	"github.com/coreos/fleet/engine"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/pkg"
 	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/registry/rpc"
 	"github.com/coreos/fleet/server"
 	"github.com/coreos/fleet/version"
 )
@@ -42,6 +46,7 @@ const (
 func Main() {
 	userset := flag.NewFlagSet("fleet", flag.ExitOnError)
 	printVersion := userset.Bool("version", false, "Print the version and exit")
+	migrateEtcd := userset.Bool("migrate-etcd-v2", false, "Copy fleet data from the etcd v2 keyspace to the etcd v3 keyspace and exit")
 	cfgPath := userset.String("config", "", fmt.Sprintf("Path to config file. Fleet will look for a config at %s by default.", DefaultConfigFile))
 
 	userset.Usage = func() {
@@ -84,14 +89,39 @@ func Main() {
 	cfgset.String("etcd_cafile", "", "SSL Certificate Authority file used to secure etcd communication")
 	cfgset.String("etcd_key_prefix", registry.DefaultKeyPrefix, "Keyspace for fleet data in etcd")
 	cfgset.Float64("etcd_request_timeout", 1.0, "Amount of time in seconds to allow a single etcd request before considering it failed.")
+	cfgset.Int("etcd_api_version", 2, "Version of the etcd API used to store fleet data, either 2 or 3")
+	cfgset.String("registry_backend", "etcd", "Where fleet data is stored, either etcd or local for an embedded single-node registry")
+	cfgset.String("data_dir", "/var/lib/fleet", "Directory the local registry backend stores fleet data in")
 	cfgset.Float64("engine_reconcile_interval", 2.0, "Interval at which the engine should reconcile the cluster schedule in etcd.")
+	cfgset.String("engine_scheduler", engine.DefaultScheduler, fmt.Sprintf("Strategy used by the engine to schedule units, one of %s", strings.Join(engine.SchedulerNames(), ", ")))
+	cfgset.Bool("engine_rebalance", false, "Continuously move units from the most to the least loaded machines")
+	cfgset.Int("engine_rebalance_max_moves", engine.DefaultRebalanceMaxMoves, "Maximum number of units the engine moves per reconciliation round when rebalancing")
 	cfgset.String("public_ip", "", "IP address that fleet machine should publish")
 	cfgset.String("metadata", "", "List of key-value metadata to assign to the fleet machine")
+	cfgset.Bool("metadata_facts", false, "Publish facts about the host, such as arch, cpu_count and memory_mb, as metadata of the fleet machine")
+	cfgset.String("metadata_dir", "", "Directory of *.conf files and executables providing metadata of the fleet machine as key=value lines")
+	cfgset.String("addresses", "", "List of role=IP addresses of the fleet machine, with roles public, private and ssh")
+	cfgset.String("machine_id", "", "ID of the fleet machine, instead of the one in /etc/machine-id")
+	cfgset.String("machine_id_file", "", "File to read the ID of the fleet machine from, instead of /etc/machine-id")
+	cfgset.String("machine_name", "", "Human-friendly name of the fleet machine, which units may be scheduled to with MachineID")
 	cfgset.String("agent_ttl", agent.DefaultTTL, "TTL in seconds of fleet machine state in etcd")
 	cfgset.String("units_directory", "/run/fleet/units/", "Path to the fleet units directory")
 	cfgset.Bool("systemd_user", false, "When true use systemd --user)")
 	cfgset.Int("token_limit", 100, "Maximum number of entries per page returned from API requests")
 	cfgset.Bool("enable_grpc", false, "When possible, uses grpc to communicate between engine and agent")
+	cfgset.Int("grpc_port", rpc.DefaultPort, "Port the engine serves grpc requests on")
+	cfgset.String("grpc_keyfile", "", "SSL key file used to secure grpc communication between engine and agent")
+	cfgset.String("grpc_certfile", "", "SSL certification file used to secure grpc communication between engine and agent")
+	cfgset.String("grpc_cafile", "", "SSL Certificate Authority file used to secure grpc communication between engine and agent")
+	cfgset.String("api_keyfile", "", "SSL key file used to serve the fleet API over TLS on TCP sockets")
+	cfgset.String("api_certfile", "", "SSL certification file used to serve the fleet API over TLS on TCP sockets")
+	cfgset.String("api_cafile", "", "SSL Certificate Authority file used to verify the certificates of fleet API clients")
+	cfgset.String("api_token_file", "", "File of bearer tokens, and their users, accepted by the fleet API")
+	cfgset.String("api_htpasswd_file", "", "htpasswd file of the users and passwords accepted by the fleet API")
+	cfgset.String("api_policy_file", "", "JSON file of the roles granted to the users of the fleet API")
+	cfgset.Float64("api_event_interval", 1.0, "Interval in seconds at which the registry is checked for changes while events of the fleet API are watched, if watches are disabled")
+	cfgset.String("audit_sink", "", fmt.Sprintf("Where to record the changes made through the API and the scheduling decisions of the engine, one of %s", strings.Join(audit.SinkNames(), ", ")))
+	cfgset.String("audit_file", "", "File audit records are appended to when audit_sink is file")
 	cfgset.Bool("disable_engine", false, "Disable the engine entirely, use with care")
 	cfgset.Bool("disable_watches", false, "Disable the use of etcd watches. Increases scheduling latency")
 	cfgset.Bool("verify_units", false, "DEPRECATED - This option is ignored")
@@ -103,6 +133,13 @@ func Main() {
 		log.Fatal(err)
 	}
 
+	if *migrateEtcd {
+		if err := server.MigrateEtcdV2ToV3(*cfg); err != nil {
+			log.Fatalf("Failed migrating etcd data: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	log.Debugf("Creating Server")
 	srv, err := server.New(*cfg, nil)
 	if err != nil {
@@ -225,13 +262,38 @@ func getConfig(flagset *flag.FlagSet, userCfgFile string) (*config.Config, error
 		EtcdCertFile:            (*flagset.Lookup("etcd_certfile")).Value.(flag.Getter).Get().(string),
 		EtcdCAFile:              (*flagset.Lookup("etcd_cafile")).Value.(flag.Getter).Get().(string),
 		EtcdRequestTimeout:      (*flagset.Lookup("etcd_request_timeout")).Value.(flag.Getter).Get().(float64),
+		EtcdAPIVersion:          (*flagset.Lookup("etcd_api_version")).Value.(flag.Getter).Get().(int),
+		RegistryBackend:         (*flagset.Lookup("registry_backend")).Value.(flag.Getter).Get().(string),
+		DataDir:                 (*flagset.Lookup("data_dir")).Value.(flag.Getter).Get().(string),
 		EngineReconcileInterval: (*flagset.Lookup("engine_reconcile_interval")).Value.(flag.Getter).Get().(float64),
+		EngineScheduler:         (*flagset.Lookup("engine_scheduler")).Value.(flag.Getter).Get().(string),
+		EngineRebalance:         (*flagset.Lookup("engine_rebalance")).Value.(flag.Getter).Get().(bool),
+		EngineRebalanceMaxMoves: (*flagset.Lookup("engine_rebalance_max_moves")).Value.(flag.Getter).Get().(int),
 		PublicIP:                (*flagset.Lookup("public_ip")).Value.(flag.Getter).Get().(string),
 		RawMetadata:             (*flagset.Lookup("metadata")).Value.(flag.Getter).Get().(string),
+		RawAddresses:            (*flagset.Lookup("addresses")).Value.(flag.Getter).Get().(string),
+		MetadataFacts:           (*flagset.Lookup("metadata_facts")).Value.(flag.Getter).Get().(bool),
+		MetadataDir:             (*flagset.Lookup("metadata_dir")).Value.(flag.Getter).Get().(string),
+		MachineID:               (*flagset.Lookup("machine_id")).Value.(flag.Getter).Get().(string),
+		MachineIDFile:           (*flagset.Lookup("machine_id_file")).Value.(flag.Getter).Get().(string),
+		MachineName:             (*flagset.Lookup("machine_name")).Value.(flag.Getter).Get().(string),
 		AgentTTL:                (*flagset.Lookup("agent_ttl")).Value.(flag.Getter).Get().(string),
 		DisableEngine:           (*flagset.Lookup("disable_engine")).Value.(flag.Getter).Get().(bool),
 		DisableWatches:          (*flagset.Lookup("disable_watches")).Value.(flag.Getter).Get().(bool),
 		EnableGRPC:              (*flagset.Lookup("enable_grpc")).Value.(flag.Getter).Get().(bool),
+		GRPCPort:                (*flagset.Lookup("grpc_port")).Value.(flag.Getter).Get().(int),
+		GRPCKeyFile:             (*flagset.Lookup("grpc_keyfile")).Value.(flag.Getter).Get().(string),
+		GRPCCertFile:            (*flagset.Lookup("grpc_certfile")).Value.(flag.Getter).Get().(string),
+		GRPCCAFile:              (*flagset.Lookup("grpc_cafile")).Value.(flag.Getter).Get().(string),
+		APIKeyFile:              (*flagset.Lookup("api_keyfile")).Value.(flag.Getter).Get().(string),
+		APICertFile:             (*flagset.Lookup("api_certfile")).Value.(flag.Getter).Get().(string),
+		APICAFile:               (*flagset.Lookup("api_cafile")).Value.(flag.Getter).Get().(string),
+		APITokenFile:            (*flagset.Lookup("api_token_file")).Value.(flag.Getter).Get().(string),
+		APIHtpasswdFile:         (*flagset.Lookup("api_htpasswd_file")).Value.(flag.Getter).Get().(string),
+		APIPolicyFile:           (*flagset.Lookup("api_policy_file")).Value.(flag.Getter).Get().(string),
+		APIEventInterval:        (*flagset.Lookup("api_event_interval")).Value.(flag.Getter).Get().(float64),
+		AuditSink:               (*flagset.Lookup("audit_sink")).Value.(flag.Getter).Get().(string),
+		AuditFile:               (*flagset.Lookup("audit_file")).Value.(flag.Getter).Get().(string),
 		VerifyUnits:             (*flagset.Lookup("verify_units")).Value.(flag.Getter).Get().(bool),
 		UnitsDirectory:          (*flagset.Lookup("units_directory")).Value.(flag.Getter).Get().(string),
 		SystemdUser:             (*flagset.Lookup("systemd_user")).Value.(flag.Getter).Get().(bool),
@@ -15,12 +15,18 @@
 package heart
 
 import (
+	"errors"
 	"time"
 
+	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/registry"
 )
 
+// ErrMachineIDCollision is returned by Register while another live machine
+// holds the ID of the local machine.
+var ErrMachineIDCollision = errors.New("machine ID is already used by another live machine")
+
 type Heart interface {
 	Beat(time.Duration) (uint64, error)
 	Clear() error
@@ -36,8 +42,29 @@ type machineHeart struct {
 	mach machine.Machine
 }
 
+// Register publishes the state of the local machine, which must not be
+// published already. A state left by an earlier run of fleetd during the
+// same boot of the host is taken over, but the local machine refuses to join
+// the cluster while a different host publishes a state under the same ID,
+// e.g. because both were cloned from the same image.
 func (h *machineHeart) Register(ttl time.Duration) (uint64, error) {
-	return h.reg.CreateMachineState(h.mach.State(), ttl)
+	ms := h.mach.State()
+	idx, err := h.reg.CreateMachineState(ms, ttl)
+	if err == nil {
+		return idx, nil
+	}
+
+	existing, serr := h.reg.MachineState(ms.ID)
+	if serr != nil || existing.ID != ms.ID || existing.BootID == "" || ms.BootID == "" {
+		return idx, err
+	}
+	if existing.BootID == ms.BootID {
+		log.Infof("Taking over state of Machine(%s) left by a previous run", ms.ID)
+		return h.reg.SetMachineState(ms, ttl)
+	}
+
+	log.Errorf("Machine(%s) is already registered by another live host (IP %q, boot ID %s); refusing to join the cluster until it leaves. Give every host a unique ID with the machine_id or machine_id_file options, or regenerate /etc/machine-id of cloned hosts.", ms.ID, existing.PublicIP, existing.BootID)
+	return 0, ErrMachineIDCollision
 }
 
 func (h *machineHeart) Beat(ttl time.Duration) (uint64, error) {
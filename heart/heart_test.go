@@ -0,0 +1,94 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heart
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/registry"
+)
+
+// machineStateRegistry stores the states of machines like etcd, refusing to
+// create a state that already exists.
+type machineStateRegistry struct {
+	registry.Registry
+	states map[string]machine.MachineState
+}
+
+func (r *machineStateRegistry) CreateMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error) {
+	if _, ok := r.states[ms.ID]; ok {
+		return 0, errors.New("key already exists")
+	}
+	r.states[ms.ID] = ms
+	return 1, nil
+}
+
+func (r *machineStateRegistry) SetMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error) {
+	r.states[ms.ID] = ms
+	return 2, nil
+}
+
+func (r *machineStateRegistry) MachineState(machID string) (machine.MachineState, error) {
+	if ms, ok := r.states[machID]; ok {
+		return ms, nil
+	}
+	return machine.MachineState{}, errors.New("not found")
+}
+
+func TestRegister(t *testing.T) {
+	local := machine.MachineState{ID: "XXX", PublicIP: "192.0.2.1", BootID: "boot-1"}
+	tests := []struct {
+		existing *machine.MachineState
+		wantErr  error
+		wantIP   string
+	}{
+		// nothing registered yet
+		{nil, nil, "192.0.2.1"},
+		// state left by fleetd during the same boot is taken over
+		{&machine.MachineState{ID: "XXX", PublicIP: "192.0.2.9", BootID: "boot-1"}, nil, "192.0.2.1"},
+		// another host holds the ID
+		{&machine.MachineState{ID: "XXX", PublicIP: "192.0.2.2", BootID: "boot-2"}, ErrMachineIDCollision, "192.0.2.2"},
+	}
+
+	for i, tt := range tests {
+		reg := &machineStateRegistry{states: make(map[string]machine.MachineState)}
+		if tt.existing != nil {
+			reg.states[tt.existing.ID] = *tt.existing
+		}
+		hrt := New(reg, &machine.FakeMachine{MachineState: local})
+
+		if _, err := hrt.Register(time.Second); err != tt.wantErr {
+			t.Errorf("case %d: got error %v, want %v", i, err, tt.wantErr)
+		}
+		if got := reg.states["XXX"].PublicIP; got != tt.wantIP {
+			t.Errorf("case %d: registered IP %q, want %q", i, got, tt.wantIP)
+		}
+	}
+}
+
+func TestRegisterUnknownOwner(t *testing.T) {
+	reg := &machineStateRegistry{states: map[string]machine.MachineState{
+		"XXX": {ID: "XXX", PublicIP: "192.0.2.2"},
+	}}
+	hrt := New(reg, &machine.FakeMachine{MachineState: machine.MachineState{ID: "XXX", BootID: "boot-1"}})
+
+	_, err := hrt.Register(time.Second)
+	if err == nil || err == ErrMachineIDCollision {
+		t.Errorf("expected the registry error, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultHealthCheckInterval           = 10 * time.Second
+	DefaultHealthCheckTimeout            = 5 * time.Second
+	DefaultHealthCheckHealthyThreshold   = 1
+	DefaultHealthCheckUnhealthyThreshold = 3
+)
+
+type HealthCheckType string
+
+const (
+	HealthCheckHTTP HealthCheckType = "http"
+	HealthCheckTCP  HealthCheckType = "tcp"
+	HealthCheckExec HealthCheckType = "exec"
+)
+
+// HealthCheck describes how the agent running a Job checks that it is
+// actually serving, beyond what systemd reports about it
+type HealthCheck struct {
+	Type HealthCheckType
+	// Target is the URL, address or command line to check, depending on
+	// the Type of the check
+	Target string
+
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
+
+// HealthCheck returns the health check declared by the Job, or nil if it
+// declares none. An error is returned if the declaration is invalid. If an
+// option is declared more than once, the last value wins.
+func (j *Job) HealthCheck() (*HealthCheck, error) {
+	reqs := j.requirements()
+
+	var hc HealthCheck
+	for _, kind := range []struct {
+		key string
+		typ HealthCheckType
+	}{
+		{fleetHealthCheckHTTP, HealthCheckHTTP},
+		{fleetHealthCheckTCP, HealthCheckTCP},
+		{fleetHealthCheckExec, HealthCheckExec},
+	} {
+		values := reqs[kind.key]
+		if len(values) == 0 {
+			continue
+		}
+		if hc.Type != "" {
+			return nil, fmt.Errorf("only one of %s, %s and %s can be used", fleetHealthCheckHTTP, fleetHealthCheckTCP, fleetHealthCheckExec)
+		}
+		hc.Type = kind.typ
+		hc.Target = values[len(values)-1]
+	}
+
+	if hc.Type == "" {
+		for _, key := range []string{fleetHealthCheckInterval, fleetHealthCheckTimeout, fleetHealthCheckHealthyThreshold, fleetHealthCheckUnhealthyThreshold} {
+			if len(reqs[key]) != 0 {
+				return nil, fmt.Errorf("%s cannot be used without %s, %s or %s", key, fleetHealthCheckHTTP, fleetHealthCheckTCP, fleetHealthCheckExec)
+			}
+		}
+		return nil, nil
+	}
+
+	if err := validateHealthCheckTarget(hc.Type, hc.Target); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if hc.Interval, err = healthCheckDuration(reqs, fleetHealthCheckInterval, DefaultHealthCheckInterval); err != nil {
+		return nil, err
+	}
+	defaultTimeout := DefaultHealthCheckTimeout
+	if hc.Interval < defaultTimeout {
+		defaultTimeout = hc.Interval
+	}
+	if hc.Timeout, err = healthCheckDuration(reqs, fleetHealthCheckTimeout, defaultTimeout); err != nil {
+		return nil, err
+	}
+	if hc.HealthyThreshold, err = healthCheckThreshold(reqs, fleetHealthCheckHealthyThreshold, DefaultHealthCheckHealthyThreshold); err != nil {
+		return nil, err
+	}
+	if hc.UnhealthyThreshold, err = healthCheckThreshold(reqs, fleetHealthCheckUnhealthyThreshold, DefaultHealthCheckUnhealthyThreshold); err != nil {
+		return nil, err
+	}
+
+	return &hc, nil
+}
+
+func validateHealthCheckTarget(typ HealthCheckType, target string) error {
+	switch typ {
+	case HealthCheckHTTP:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid value %q for %s, must be an http or https URL", target, fleetHealthCheckHTTP)
+		}
+	case HealthCheckTCP:
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("invalid value %q for %s, must be a host:port address", target, fleetHealthCheckTCP)
+		}
+	case HealthCheckExec:
+		if target == "" {
+			return errors.New("HealthCheckExec requires a command")
+		}
+	}
+	return nil
+}
+
+func healthCheckDuration(reqs map[string][]string, key string, def time.Duration) (time.Duration, error) {
+	values := reqs[key]
+	if len(values) == 0 {
+		return def, nil
+	}
+
+	last := values[len(values)-1]
+	d, err := time.ParseDuration(last)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid value %q for %s, must be a positive duration such as 10s", last, key)
+	}
+	return d, nil
+}
+
+func healthCheckThreshold(reqs map[string][]string, key string, def int) (int, error) {
+	values := reqs[key]
+	if len(values) == 0 {
+		return def, nil
+	}
+
+	last := values[len(values)-1]
+	n, err := strconv.Atoi(last)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid value %q for %s, must be a positive integer", last, key)
+	}
+	return n, nil
+}
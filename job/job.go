@@ -16,9 +16,13 @@ package job
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/resource"
 	"github.com/coreos/fleet/unit"
 )
 
@@ -53,6 +57,38 @@ const (
 	fleetMachineMetadata = "MachineMetadata"
 	// Require that the unit be scheduled on every machine in the cluster
 	fleetGlobal = "Global"
+	// CPU, memory and disk the unit needs reserved on its machine
+	fleetResources = "Resources"
+	// Spread instances of the same template across the values of a machine metadata key
+	fleetSpreadBy = "SpreadBy"
+	// Maximum difference in the number of instances between any two values of the SpreadBy key
+	fleetMaxSkew = "MaxSkew"
+	// Prefer, but do not require, machines with this specific metadata
+	fleetPreferMachineMetadata = "PreferMachineMetadata"
+	// Prefer, but do not require, the machine that hosts a specific unit
+	fleetPreferMachineOf = "PreferMachineOf"
+	// Never move the unit to another machine in order to rebalance the cluster
+	fleetPinned = "Pinned"
+	// Move the unit to another machine when it fails
+	fleetRescheduleOnFailure = "RescheduleOnFailure"
+	// Number of failures on a machine after which the unit is never scheduled to it again
+	fleetMaxFailuresPerMachine = "MaxFailuresPerMachine"
+	// Time to wait after a failure before scheduling the unit again
+	fleetBackoff = "Backoff"
+	// HTTP URL to GET in order to check the health of the unit
+	fleetHealthCheckHTTP = "HealthCheckHTTP"
+	// Address to connect to over TCP in order to check the health of the unit
+	fleetHealthCheckTCP = "HealthCheckTCP"
+	// Command to execute in order to check the health of the unit
+	fleetHealthCheckExec = "HealthCheckExec"
+	// Time between two health checks
+	fleetHealthCheckInterval = "HealthCheckInterval"
+	// Time after which a health check is considered failed
+	fleetHealthCheckTimeout = "HealthCheckTimeout"
+	// Consecutive successful checks after which the unit is healthy
+	fleetHealthCheckHealthyThreshold = "HealthCheckHealthyThreshold"
+	// Consecutive failed checks after which the unit is unhealthy
+	fleetHealthCheckUnhealthyThreshold = "HealthCheckUnhealthyThreshold"
 
 	deprecatedXPrefix          = "X-"
 	deprecatedXConditionPrefix = "X-Condition"
@@ -71,6 +107,22 @@ var validRequirements = pkg.NewUnsafeSet(
 	fleetMachineMetadata,
 	fleetGlobal,
 	fleetReplaces,
+	fleetResources,
+	fleetSpreadBy,
+	fleetMaxSkew,
+	fleetPreferMachineMetadata,
+	fleetPreferMachineOf,
+	fleetPinned,
+	fleetRescheduleOnFailure,
+	fleetMaxFailuresPerMachine,
+	fleetBackoff,
+	fleetHealthCheckHTTP,
+	fleetHealthCheckTCP,
+	fleetHealthCheckExec,
+	fleetHealthCheckInterval,
+	fleetHealthCheckTimeout,
+	fleetHealthCheckHealthyThreshold,
+	fleetHealthCheckUnhealthyThreshold,
 )
 
 func ParseJobState(s string) (JobState, error) {
@@ -92,6 +144,8 @@ type Job struct {
 	TargetState     JobState
 	TargetMachineID string
 	Unit            unit.UnitFile
+	// Failures of the Job, if it is rescheduled on failure and ever failed
+	Failures *UnitFailures
 }
 
 // ScheduledUnit represents a Unit known by fleet and encapsulates its current scheduling state. This does not include Global units.
@@ -109,6 +163,22 @@ type Unit struct {
 	TargetState JobState
 }
 
+// UnitRevision is one version of the content of a Unit, as submitted to
+// fleet (history)
+type UnitRevision struct {
+	Revision int
+	Unit     unit.UnitFile
+	Created  time.Time
+	User     string
+}
+
+// UnitFailures records how many times a Unit failed on each of the machines
+// it was scheduled to, and when it last failed
+type UnitFailures struct {
+	Machines map[string]int
+	Last     time.Time
+}
+
 // IsGlobal returns whether a Unit is considered a global unit
 func (u *Unit) IsGlobal() bool {
 	j := &Job{
@@ -178,6 +248,14 @@ func (u *Unit) RequiredTargetMetadata() map[string]pkg.Set {
 	return j.RequiredTargetMetadata()
 }
 
+func (u *Unit) Resources() (resource.ResourceTuple, error) {
+	j := &Job{
+		Name: u.Name,
+		Unit: u.Unit,
+	}
+	return j.Resources()
+}
+
 // requirements returns all relevant options from the [X-Fleet] section of a unit file.
 // Relevant options are identified with a `X-` prefix in the unit.
 // This prefix is stripped from relevant options before being returned.
@@ -204,6 +282,12 @@ func (j *Job) requirements() map[string][]string {
 	return requirements
 }
 
+// HasRequirement returns whether the given option is declared in the
+// [X-Fleet] section of the Job's unit file.
+func (j *Job) HasRequirement(name string) bool {
+	return len(j.requirements()[name]) != 0
+}
+
 // ValidateRequirements ensures that all options in the [X-Fleet] section of
 // the job's associated unit file are known keys. If not, an error is
 // returned.
@@ -283,35 +367,171 @@ func (j *Job) RequiredTarget() (string, bool) {
 
 // RequiredTargetMetadata return all machine-related metadata from a Job's
 // requirements. Valid metadata fields are strings of the form `key=value`,
-// where both key and value are not the empty string.
+// where both key and value are not the empty string, or any of the other
+// forms accepted by machine.ParseMetadataRequirement. Each key maps to the
+// set of match expressions applying to it.
 func (j *Job) RequiredTargetMetadata() map[string]pkg.Set {
-	metadata := make(map[string]pkg.Set)
+	return j.targetMetadata(deprecatedXConditionPrefix+fleetMachineMetadata, fleetMachineMetadata)
+}
 
-	for _, key := range []string{
-		deprecatedXConditionPrefix + fleetMachineMetadata,
-		fleetMachineMetadata,
-	} {
-		for _, valuePair := range j.requirements()[key] {
-			s := strings.Split(valuePair, "=")
+// PreferredTargetMetadata returns the machine metadata the Job prefers, but
+// does not require, in the same form as RequiredTargetMetadata.
+func (j *Job) PreferredTargetMetadata() map[string]pkg.Set {
+	return j.targetMetadata(fleetPreferMachineMetadata)
+}
 
-			if len(s) != 2 {
-				continue
+// PreferredPeers returns a list of Job names next to which this Job would
+// rather, but does not have to, be scheduled.
+func (j *Job) PreferredPeers() []string {
+	return splitCombine(j.requirements()[fleetPreferMachineOf])
+}
+
+// ValidateMetadata returns an error describing the first malformed
+// requirement in the Job's MachineMetadata or PreferMachineMetadata options,
+// which are otherwise silently ignored.
+func (j *Job) ValidateMetadata() error {
+	requirements := j.requirements()
+	for _, key := range []string{deprecatedXConditionPrefix + fleetMachineMetadata, fleetMachineMetadata, fleetPreferMachineMetadata} {
+		for _, req := range requirements[key] {
+			if _, _, err := machine.ParseMetadataRequirement(req); err != nil {
+				return err
 			}
+		}
+	}
+	return nil
+}
+
+// targetMetadata parses the metadata requirements of the given requirement
+// keys, collecting all match expressions of each metadata key in a set.
+// Malformed requirements are ignored.
+func (j *Job) targetMetadata(keys ...string) map[string]pkg.Set {
+	metadata := make(map[string]pkg.Set)
 
-			if len(s[0]) == 0 || len(s[1]) == 0 {
+	for _, key := range keys {
+		for _, req := range j.requirements()[key] {
+			mdKey, match, err := machine.ParseMetadataRequirement(req)
+			if err != nil {
 				continue
 			}
 
-			if _, ok := metadata[s[0]]; !ok {
-				metadata[s[0]] = pkg.NewUnsafeSet()
+			if _, ok := metadata[mdKey]; !ok {
+				metadata[mdKey] = pkg.NewUnsafeSet()
 			}
-			metadata[s[0]].Add(s[1])
+			metadata[mdKey].Add(match)
 		}
 	}
 
 	return metadata
 }
 
+// Resources returns the CPU, memory and disk requirements declared by the
+// Job, e.g. `Resources=cores=50 memory=512M`. If a resource is declared
+// more than once, the last value wins. An error is returned if any of the
+// declarations is malformed.
+func (j *Job) Resources() (resource.ResourceTuple, error) {
+	values := j.requirements()[fleetResources]
+	return resource.ParseResourceTuple(strings.Join(values, " "))
+}
+
+// SpreadBy returns the machine metadata key across whose values the
+// instances of the Job's template must be spread, e.g. `SpreadBy=rack`.
+// If no such requirement exists, an empty string and false are returned.
+// If the key is declared more than once, the last value wins.
+func (j *Job) SpreadBy() (string, bool) {
+	values := j.requirements()[fleetSpreadBy]
+	if len(values) == 0 || values[len(values)-1] == "" {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// MaxSkew returns the maximum allowed difference in the number of instances
+// of the Job's template between any two values of its SpreadBy key. It
+// defaults to 1 and must be a positive integer; otherwise an error is
+// returned.
+func (j *Job) MaxSkew() (int, error) {
+	values := j.requirements()[fleetMaxSkew]
+	if len(values) == 0 {
+		return 1, nil
+	}
+
+	last := values[len(values)-1]
+	skew, err := strconv.Atoi(last)
+	if err != nil || skew < 1 {
+		return 0, fmt.Errorf("invalid value %q for %s, must be a positive integer", last, fleetMaxSkew)
+	}
+	return skew, nil
+}
+
+// Pinned returns whether the Job must stay on its machine when the engine
+// rebalances the cluster. If the requirement is declared more than once,
+// the last value wins.
+func (j *Job) Pinned() bool {
+	values := j.requirements()[fleetPinned]
+	if len(values) == 0 {
+		return false
+	}
+	return isTruthyValue(values[len(values)-1])
+}
+
+// RescheduleOnFailure returns whether the engine must move the Job to another
+// machine when it fails. If the requirement is declared more than once, the
+// last value wins.
+func (j *Job) RescheduleOnFailure() bool {
+	values := j.requirements()[fleetRescheduleOnFailure]
+	if len(values) == 0 {
+		return false
+	}
+	return isTruthyValue(values[len(values)-1])
+}
+
+// MaxFailuresPerMachine returns the number of times the Job may fail on a
+// machine before it is never scheduled to that machine again. It defaults to
+// 1 and must be a positive integer; otherwise an error is returned.
+func (j *Job) MaxFailuresPerMachine() (int, error) {
+	values := j.requirements()[fleetMaxFailuresPerMachine]
+	if len(values) == 0 {
+		return 1, nil
+	}
+
+	last := values[len(values)-1]
+	max, err := strconv.Atoi(last)
+	if err != nil || max < 1 {
+		return 0, fmt.Errorf("invalid value %q for %s, must be a positive integer", last, fleetMaxFailuresPerMachine)
+	}
+	return max, nil
+}
+
+// Backoff returns how long the engine waits after the Job failed before
+// scheduling it again. It defaults to 0 and must be a non-negative duration
+// such as "30s"; otherwise an error is returned.
+func (j *Job) Backoff() (time.Duration, error) {
+	values := j.requirements()[fleetBackoff]
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	last := values[len(values)-1]
+	d, err := time.ParseDuration(last)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s, must be a duration such as 30s", last, fleetBackoff)
+	}
+	return d, nil
+}
+
+// FailedTooOftenOn returns whether the Job is rescheduled on failure and
+// failed MaxFailuresPerMachine times on the given machine already.
+func (j *Job) FailedTooOftenOn(machID string) bool {
+	if j.Failures == nil || !j.RescheduleOnFailure() {
+		return false
+	}
+	max, err := j.MaxFailuresPerMachine()
+	if err != nil {
+		return false
+	}
+	return j.Failures.Machines[machID] >= max
+}
+
 func (j *Job) Scheduled() bool {
 	return len(j.TargetMachineID) > 0
 }
@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/resource"
 	"github.com/coreos/fleet/unit"
 )
 
@@ -126,6 +128,276 @@ Replaces=*bar*
 	}
 }
 
+func TestJobResources(t *testing.T) {
+	testCases := []struct {
+		contents  string
+		resources resource.ResourceTuple
+		err       bool
+	}{
+		{``, resource.ResourceTuple{}, false},
+		{`[X-Fleet]
+Resources=cores=50 memory=512M
+`, resource.ResourceTuple{Cores: 50, Memory: 512}, false},
+		// later declarations take precedence
+		{`[X-Fleet]
+Resources=cores=50 memory=512M
+Resources=memory=1G disk=100
+`, resource.ResourceTuple{Cores: 50, Memory: 1024, Disk: 100}, false},
+		{`[X-Fleet]
+Resources=cores=many
+`, resource.ResourceTuple{}, true},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo.service", *newUnit(t, tt.contents))
+		res, err := j.Resources()
+		if tt.err != (err != nil) {
+			t.Errorf("case %d: unexpected error state: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(res, tt.resources) {
+			t.Errorf("case %d: unexpected resources: got %#v, want %#v", i, res, tt.resources)
+		}
+	}
+}
+
+func TestJobPinned(t *testing.T) {
+	testCases := []struct {
+		contents string
+		pinned   bool
+	}{
+		{``, false},
+		{`[X-Fleet]
+Pinned=true
+`, true},
+		{`[X-Fleet]
+Pinned=yes
+`, true},
+		{`[X-Fleet]
+Pinned=false
+`, false},
+		{`[X-Fleet]
+Pinned=true
+Pinned=false
+`, false},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo.service", *newUnit(t, tt.contents))
+		if got := j.Pinned(); got != tt.pinned {
+			t.Errorf("case %d: unexpected Pinned: got %t, want %t", i, got, tt.pinned)
+		}
+	}
+}
+
+func TestJobSpreadBy(t *testing.T) {
+	testCases := []struct {
+		contents string
+		key      string
+		ok       bool
+		maxSkew  int
+		err      bool
+	}{
+		{``, "", false, 1, false},
+		{`[X-Fleet]
+SpreadBy=rack
+`, "rack", true, 1, false},
+		{`[X-Fleet]
+SpreadBy=rack
+SpreadBy=region
+MaxSkew=3
+`, "region", true, 3, false},
+		{`[X-Fleet]
+SpreadBy=rack
+MaxSkew=0
+`, "rack", true, 0, true},
+		{`[X-Fleet]
+SpreadBy=rack
+MaxSkew=few
+`, "rack", true, 0, true},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo@1.service", *newUnit(t, tt.contents))
+		key, ok := j.SpreadBy()
+		if key != tt.key || ok != tt.ok {
+			t.Errorf("case %d: unexpected SpreadBy: got (%q, %t), want (%q, %t)", i, key, ok, tt.key, tt.ok)
+		}
+		maxSkew, err := j.MaxSkew()
+		if tt.err != (err != nil) {
+			t.Errorf("case %d: unexpected error state: %v", i, err)
+			continue
+		}
+		if maxSkew != tt.maxSkew {
+			t.Errorf("case %d: unexpected MaxSkew: got %d, want %d", i, maxSkew, tt.maxSkew)
+		}
+	}
+}
+
+func TestJobHasRequirement(t *testing.T) {
+	j := NewJob("echo@1.service", *newUnit(t, `[Service]
+MaxSkew=2
+
+[X-Fleet]
+SpreadBy=rack
+`))
+	if !j.HasRequirement("SpreadBy") {
+		t.Errorf("SpreadBy not declared")
+	}
+	if j.HasRequirement("MaxSkew") {
+		t.Errorf("MaxSkew of another section declared")
+	}
+}
+
+func TestJobRescheduleOnFailure(t *testing.T) {
+	testCases := []struct {
+		contents    string
+		reschedule  bool
+		maxFailures int
+		backoff     time.Duration
+		err         bool
+	}{
+		{``, false, 1, 0, false},
+		{`[X-Fleet]
+RescheduleOnFailure=true
+`, true, 1, 0, false},
+		{`[X-Fleet]
+RescheduleOnFailure=true
+RescheduleOnFailure=false
+MaxFailuresPerMachine=3
+Backoff=30s
+`, false, 3, 30 * time.Second, false},
+		{`[X-Fleet]
+RescheduleOnFailure=yes
+MaxFailuresPerMachine=0
+`, true, 0, 0, true},
+		{`[X-Fleet]
+RescheduleOnFailure=yes
+Backoff=soon
+`, true, 1, 0, true},
+		{`[X-Fleet]
+RescheduleOnFailure=yes
+Backoff=-1s
+`, true, 1, 0, true},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo.service", *newUnit(t, tt.contents))
+		if got := j.RescheduleOnFailure(); got != tt.reschedule {
+			t.Errorf("case %d: unexpected RescheduleOnFailure: got %t, want %t", i, got, tt.reschedule)
+		}
+		maxFailures, merr := j.MaxFailuresPerMachine()
+		backoff, berr := j.Backoff()
+		if tt.err != (merr != nil || berr != nil) {
+			t.Errorf("case %d: unexpected error state: %v, %v", i, merr, berr)
+			continue
+		}
+		if maxFailures != tt.maxFailures {
+			t.Errorf("case %d: unexpected MaxFailuresPerMachine: got %d, want %d", i, maxFailures, tt.maxFailures)
+		}
+		if backoff != tt.backoff {
+			t.Errorf("case %d: unexpected Backoff: got %v, want %v", i, backoff, tt.backoff)
+		}
+	}
+}
+
+func TestJobFailedTooOftenOn(t *testing.T) {
+	j := NewJob("echo.service", *newUnit(t, `[X-Fleet]
+RescheduleOnFailure=true
+MaxFailuresPerMachine=2
+`))
+	if j.FailedTooOftenOn("XXX") {
+		t.Errorf("job without failures must not be banned")
+	}
+
+	j.Failures = &UnitFailures{Machines: map[string]int{"XXX": 2, "YYY": 1}}
+	if !j.FailedTooOftenOn("XXX") {
+		t.Errorf("job must be banned from XXX")
+	}
+	if j.FailedTooOftenOn("YYY") {
+		t.Errorf("job must not be banned from YYY")
+	}
+
+	j = NewJob("echo.service", *newUnit(t, ``))
+	j.Failures = &UnitFailures{Machines: map[string]int{"XXX": 5}}
+	if j.FailedTooOftenOn("XXX") {
+		t.Errorf("job not rescheduled on failure must never be banned")
+	}
+}
+
+func TestJobHealthCheck(t *testing.T) {
+	testCases := []struct {
+		contents string
+		check    *HealthCheck
+		err      bool
+	}{
+		{``, nil, false},
+		{`[X-Fleet]
+HealthCheckHTTP=http://localhost:8080/healthz
+`, &HealthCheck{
+			Type:               HealthCheckHTTP,
+			Target:             "http://localhost:8080/healthz",
+			Interval:           DefaultHealthCheckInterval,
+			Timeout:            DefaultHealthCheckTimeout,
+			HealthyThreshold:   DefaultHealthCheckHealthyThreshold,
+			UnhealthyThreshold: DefaultHealthCheckUnhealthyThreshold,
+		}, false},
+		// the timeout defaults to a shorter interval
+		{`[X-Fleet]
+HealthCheckTCP=localhost:5432
+HealthCheckInterval=2s
+HealthCheckHealthyThreshold=2
+HealthCheckUnhealthyThreshold=1
+`, &HealthCheck{
+			Type:               HealthCheckTCP,
+			Target:             "localhost:5432",
+			Interval:           2 * time.Second,
+			Timeout:            2 * time.Second,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 1,
+		}, false},
+		{`[X-Fleet]
+HealthCheckExec=test -f /run/ready
+HealthCheckTimeout=1s
+`, &HealthCheck{
+			Type:               HealthCheckExec,
+			Target:             "test -f /run/ready",
+			Interval:           DefaultHealthCheckInterval,
+			Timeout:            time.Second,
+			HealthyThreshold:   DefaultHealthCheckHealthyThreshold,
+			UnhealthyThreshold: DefaultHealthCheckUnhealthyThreshold,
+		}, false},
+		{`[X-Fleet]
+HealthCheckHTTP=localhost:8080
+`, nil, true},
+		{`[X-Fleet]
+HealthCheckTCP=localhost
+`, nil, true},
+		{`[X-Fleet]
+HealthCheckHTTP=http://localhost:8080/healthz
+HealthCheckTCP=localhost:8080
+`, nil, true},
+		{`[X-Fleet]
+HealthCheckExec=true
+HealthCheckInterval=0s
+`, nil, true},
+		{`[X-Fleet]
+HealthCheckExec=true
+HealthCheckUnhealthyThreshold=0
+`, nil, true},
+		{`[X-Fleet]
+HealthCheckInterval=10s
+`, nil, true},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo.service", *newUnit(t, tt.contents))
+		check, err := j.HealthCheck()
+		if tt.err != (err != nil) {
+			t.Errorf("case %d: unexpected error state: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(check, tt.check) {
+			t.Errorf("case %d: unexpected HealthCheck: got %#v, want %#v", i, check, tt.check)
+		}
+	}
+}
+
 func TestParseRequirements(t *testing.T) {
 	testCases := []struct {
 		contents string
@@ -440,6 +712,23 @@ MachineMetadata==asdf`,
 MachineMetadata=foo=asdf=WHAT`,
 			map[string]pkg.Set{},
 		},
+		{
+			`[X-Fleet]
+MachineMetadata=memory_gb>=lots`,
+			map[string]pkg.Set{},
+		},
+		// operators beyond equality
+		{
+			`[X-Fleet]
+MachineMetadata="zone~=us-east-*" "zone!=us-east-1a" "rack!~=r1*" "memory_gb>=32" "gpu" "!spot"`,
+			map[string]pkg.Set{
+				"zone":      pkg.NewUnsafeSet("~=us-east-*", "!=us-east-1a"),
+				"rack":      pkg.NewUnsafeSet("!~=r1*"),
+				"memory_gb": pkg.NewUnsafeSet(">=32"),
+				"gpu":       pkg.NewUnsafeSet("="),
+				"spot":      pkg.NewUnsafeSet("!"),
+			},
+		},
 		// mix everything up
 		{
 			`[X-Fleet]
@@ -467,6 +756,46 @@ X-ConditionMachineMetadata="one=abc" "two=def"`,
 	}
 }
 
+func TestJobPreferences(t *testing.T) {
+	testCases := []struct {
+		unit     string
+		metadata map[string]pkg.Set
+		peers    []string
+	}{
+		{
+			`[X-Fleet]`,
+			map[string]pkg.Set{},
+			[]string{},
+		},
+		// preferences are kept apart from requirements
+		{
+			`[X-Fleet]
+MachineMetadata=region=us-east
+MachineOf=db.service
+PreferMachineMetadata="disk=ssd" "disk=nvme" "net=10g"
+PreferMachineOf=cache.service proxy.service`,
+			map[string]pkg.Set{
+				"disk": pkg.NewUnsafeSet("ssd", "nvme"),
+				"net":  pkg.NewUnsafeSet("10g"),
+			},
+			[]string{"cache.service", "proxy.service"},
+		},
+	}
+	for i, tt := range testCases {
+		j := NewJob("echo.service", *newUnit(t, tt.unit))
+		md := j.PreferredTargetMetadata()
+		if !reflect.DeepEqual(md, tt.metadata) {
+			t.Errorf("case %d: metadata differs", i)
+			t.Logf("got: %#v", md)
+			t.Logf("want: %#v", tt.metadata)
+		}
+		peers := j.PreferredPeers()
+		if !reflect.DeepEqual(peers, tt.peers) {
+			t.Errorf("case %d: unexpected peers: got %#v, want %#v", i, peers, tt.peers)
+		}
+	}
+}
+
 func TestInstanceUnitPrintf(t *testing.T) {
 	u := unit.NewUnitNameInfo("foo@bar.waldo")
 	if u == nil {
@@ -606,6 +935,12 @@ func TestValidateRequirements(t *testing.T) {
 		"MachineMetadata=true=false",
 		"Global=true",
 		"Replaces=foo",
+		"Resources=cores=50",
+		"SpreadBy=rack",
+		"MaxSkew=2",
+		"PreferMachineMetadata=disk=ssd",
+		"Pinned=true",
+		"PreferMachineOf=db.service",
 	}
 	for i, req := range tests {
 		contents := fmt.Sprintf("[X-Fleet]\n%s", req)
@@ -0,0 +1,124 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressRole describes what an address of a machine is used for.
+type AddressRole string
+
+const (
+	// AddressPublic addresses are published to reach the machine, the
+	// first one being its PublicIP
+	AddressPublic AddressRole = "public"
+	// AddressPrivate addresses are used for traffic between fleet machines,
+	// e.g. agents connecting to the engine over gRPC
+	AddressPrivate AddressRole = "private"
+	// AddressSSH addresses are used by fleetctl to SSH to the machine
+	AddressSSH AddressRole = "ssh"
+)
+
+var addressRoles = []AddressRole{AddressPublic, AddressPrivate, AddressSSH}
+
+// Address is an IPv4 or IPv6 address of a machine and the role it serves.
+type Address struct {
+	Role AddressRole
+	IP   string
+}
+
+// ParseAddresses parses a comma-delimited list of role=IP pairs, e.g.
+// "public=2001:db8::10,private=10.0.0.10".
+func ParseAddresses(raw string) ([]Address, error) {
+	var addrs []Address
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("address %q must be formatted as role=IP", pair)
+		}
+
+		role := AddressRole(strings.TrimSpace(parts[0]))
+		if !validAddressRole(role) {
+			return nil, fmt.Errorf("unknown address role %q, must be one of public, private or ssh", role)
+		}
+		ip := net.ParseIP(strings.TrimSpace(parts[1]))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", strings.TrimSpace(parts[1]))
+		}
+		addrs = append(addrs, Address{Role: role, IP: ip.String()})
+	}
+	return addrs, nil
+}
+
+func validAddressRole(role AddressRole) bool {
+	for _, r := range addressRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressesFor returns the IPs of the machine with the given role.
+func (ms MachineState) AddressesFor(role AddressRole) []string {
+	var ips []string
+	for _, a := range ms.Addresses {
+		if a.Role == role {
+			ips = append(ips, a.IP)
+		}
+	}
+	return ips
+}
+
+// AddressFor returns the IP the machine should be reached at for the given
+// role. Machines without an address of that role are reached at their
+// PublicIP.
+func (ms MachineState) AddressFor(role AddressRole) string {
+	if role == AddressPublic && ms.PublicIP != "" {
+		return ms.PublicIP
+	}
+	if ips := ms.AddressesFor(role); len(ips) > 0 {
+		return ips[0]
+	}
+	return ms.PublicIP
+}
+
+// stackAddresses merges the addresses of two MachineStates. The addresses
+// of the top MachineState replace all addresses of the same role on the
+// bottom one.
+func stackAddresses(top, bottom []Address) []Address {
+	if len(top) == 0 {
+		return bottom
+	}
+
+	roles := make(map[AddressRole]bool)
+	for _, a := range top {
+		roles[a.Role] = true
+	}
+	addrs := append([]Address{}, top...)
+	for _, a := range bottom {
+		if !roles[a.Role] {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseAddresses(t *testing.T) {
+	tests := []struct {
+		raw   string
+		addrs []Address
+		err   bool
+	}{
+		{"", nil, false},
+		{
+			"public=192.0.2.10, public=2001:DB8::10,private=10.0.0.10,ssh=192.0.2.11",
+			[]Address{
+				{Role: AddressPublic, IP: "192.0.2.10"},
+				{Role: AddressPublic, IP: "2001:db8::10"},
+				{Role: AddressPrivate, IP: "10.0.0.10"},
+				{Role: AddressSSH, IP: "192.0.2.11"},
+			},
+			false,
+		},
+		{"192.0.2.10", nil, true},
+		{"backup=192.0.2.10", nil, true},
+		{"private=example.com", nil, true},
+	}
+
+	for i, tt := range tests {
+		addrs, err := ParseAddresses(tt.raw)
+		if tt.err != (err != nil) {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.addrs, addrs) {
+			t.Errorf("case %d: got %v, want %v", i, addrs, tt.addrs)
+		}
+	}
+}
+
+func TestAddressFor(t *testing.T) {
+	ms := MachineState{
+		PublicIP: "192.0.2.10",
+		Addresses: []Address{
+			{Role: AddressPublic, IP: "2001:db8::10"},
+			{Role: AddressPublic, IP: "192.0.2.10"},
+			{Role: AddressPrivate, IP: "fd00::10"},
+		},
+	}
+
+	if got := ms.AddressFor(AddressPublic); got != "192.0.2.10" {
+		t.Errorf("public: got %q", got)
+	}
+	if got := ms.AddressFor(AddressPrivate); got != "fd00::10" {
+		t.Errorf("private: got %q", got)
+	}
+	// without an SSH address, the PublicIP is used
+	if got := ms.AddressFor(AddressSSH); got != "192.0.2.10" {
+		t.Errorf("ssh: got %q", got)
+	}
+	if got := ms.AddressesFor(AddressPublic); !reflect.DeepEqual(got, []string{"2001:db8::10", "192.0.2.10"}) {
+		t.Errorf("public addresses: got %v", got)
+	}
+}
+
+func TestStackStateAddresses(t *testing.T) {
+	top := MachineState{
+		Addresses: []Address{
+			{Role: AddressPublic, IP: "2001:db8::10"},
+			{Role: AddressSSH, IP: "192.0.2.11"},
+		},
+	}
+	bottom := MachineState{
+		PublicIP: "192.0.2.10",
+		Addresses: []Address{
+			{Role: AddressPublic, IP: "192.0.2.10"},
+			{Role: AddressPrivate, IP: "10.0.0.10"},
+		},
+	}
+	stacked := stackState(top, bottom)
+
+	if stacked.PublicIP != "2001:db8::10" {
+		t.Errorf("Unexpected PublicIP value %s", stacked.PublicIP)
+	}
+	want := []Address{
+		{Role: AddressPublic, IP: "2001:db8::10"},
+		{Role: AddressSSH, IP: "192.0.2.11"},
+		{Role: AddressPrivate, IP: "10.0.0.10"},
+	}
+	if !reflect.DeepEqual(want, stacked.Addresses) {
+		t.Errorf("Unexpected Addresses %v", stacked.Addresses)
+	}
+
+	stacked = stackState(MachineState{}, bottom)
+	if stacked.PublicIP != "192.0.2.10" || !reflect.DeepEqual(bottom.Addresses, stacked.Addresses) {
+		t.Errorf("Unexpected stacked state %v", stacked)
+	}
+}
+
+func TestPublicAddresses(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:db8::10"),
+		net.ParseIP("192.0.2.10"),
+		net.ParseIP("2001:db8::10"),
+		net.ParseIP("192.0.2.11"),
+	}
+	want := []Address{
+		{Role: AddressPublic, IP: "192.0.2.10"},
+		{Role: AddressPublic, IP: "192.0.2.11"},
+		{Role: AddressPublic, IP: "2001:db8::10"},
+	}
+	if got := publicAddresses(ips); !reflect.DeepEqual(want, got) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -15,29 +15,45 @@
 package machine
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/vishvananda/netlink"
 
 	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/resource"
 	"github.com/coreos/fleet/unit"
 )
 
 const (
 	machineIDPath = "/etc/machine-id"
+	// registeredMachineIDPath holds the ID fleetd registered the local
+	// machine with, which differs from the machine-id if configured
+	registeredMachineIDPath = "/run/fleet/machine-id"
+	bootIDPath              = "/proc/sys/kernel/random/boot_id"
+	meminfoPath             = "/proc/meminfo"
 )
 
-func NewCoreOSMachine(static MachineState, um unit.UnitManager) *CoreOSMachine {
+// NewCoreOSMachine creates a CoreOSMachine with the given static state. If
+// a probe is given, the metadata it gathers is published along with the
+// static metadata, which takes precedence.
+func NewCoreOSMachine(static MachineState, um unit.UnitManager, probe *MetadataProbe) *CoreOSMachine {
 	log.Debugf("Created CoreOSMachine with static state %s", static)
 	m := &CoreOSMachine{
 		staticState: static,
 		um:          um,
+		probe:       probe,
 	}
 	return m
 }
@@ -46,6 +62,7 @@ type CoreOSMachine struct {
 	sync.RWMutex
 
 	um           unit.UnitManager
+	probe        *MetadataProbe
 	staticState  MachineState
 	dynamicState *MachineState
 }
@@ -99,30 +116,73 @@ func (m *CoreOSMachine) PeriodicRefresh(interval time.Duration, stop <-chan stru
 }
 
 // currentState generates a MachineState object with the values read from
-// the local system
+// the local system. The machine-id of the system is only read if no ID was
+// configured statically.
 func (m *CoreOSMachine) currentState() *MachineState {
-	id, err := readLocalMachineID("/")
+	id := m.staticState.ID
+	if id == "" {
+		var err error
+		id, err = readLocalMachineID("/")
+		if err != nil {
+			log.Errorf("Error retrieving machineID: %v\n", err)
+			return nil
+		}
+	}
+	bootID, err := readLocalBootID("/")
 	if err != nil {
-		log.Errorf("Error retrieving machineID: %v\n", err)
-		return nil
+		log.Debugf("Unable to determine boot ID: %v", err)
+	}
+	addrs := getLocalAddresses()
+	var publicIP string
+	if len(addrs) > 0 {
+		publicIP = addrs[0].IP
 	}
-	publicIP := getLocalIP()
 	return &MachineState{
-		ID:       id,
-		PublicIP: publicIP,
-		Metadata: make(map[string]string, 0),
+		ID:             id,
+		PublicIP:       publicIP,
+		Metadata:       m.probe.Metadata(),
+		TotalResources: readLocalResources("/"),
+		BootID:         bootID,
+		Addresses:      addrs,
 	}
 }
 
 // IsLocalMachineID returns whether the given machine ID is equal to that of the local machine
 func IsLocalMachineID(mID string) bool {
-	m, err := readLocalMachineID("/")
+	return isLocalMachineID("/", mID)
+}
+
+func isLocalMachineID(root, mID string) bool {
+	m, err := ReadMachineIDFile(filepath.Join(root, registeredMachineIDPath))
+	if err != nil {
+		// fleetd has not registered the local machine since boot
+		m, err = readLocalMachineID(root)
+	}
 	return err == nil && m == mID
 }
 
+// RecordRegisteredMachineID records the ID the local machine has been
+// registered with, for IsLocalMachineID to compare against.
+func RecordRegisteredMachineID(mID string) error {
+	return writeRegisteredMachineID("/", mID)
+}
+
+func writeRegisteredMachineID(root, mID string) error {
+	fullPath := filepath.Join(root, registeredMachineIDPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.FileMode(0755)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fullPath, []byte(mID+"\n"), os.FileMode(0644))
+}
+
 func readLocalMachineID(root string) (string, error) {
-	fullPath := filepath.Join(root, machineIDPath)
-	id, err := ioutil.ReadFile(fullPath)
+	return ReadMachineIDFile(filepath.Join(root, machineIDPath))
+}
+
+// ReadMachineIDFile reads a machine ID from the given file, formatted like
+// /etc/machine-id.
+func ReadMachineIDFile(path string) (string, error) {
+	id, err := ioutil.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -133,44 +193,139 @@ func readLocalMachineID(root string) (string, error) {
 	return mID, nil
 }
 
-func getLocalIP() (got string) {
-	iface := getDefaultGatewayIface()
-	if iface == nil {
-		return
+// ValidateMachineID returns an error if the given string cannot be used as
+// the ID of a machine, which is part of the keys fleet stores its data under.
+func ValidateMachineID(id string) error {
+	if id == "" {
+		return errors.New("machine ID must not be empty")
 	}
+	if strings.ContainsAny(id, "/ \t\n") {
+		return fmt.Errorf("machine ID %q must not contain slashes or whitespace", id)
+	}
+	return nil
+}
 
-	addrs, err := iface.Addrs()
-	if err != nil || len(addrs) == 0 {
-		return
+// readLocalBootID returns the random identifier the kernel generated for
+// the current boot of the local host.
+func readLocalBootID(root string) (string, error) {
+	id, err := ioutil.ReadFile(filepath.Join(root, bootIDPath))
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(string(id)), nil
+}
 
-	for _, addr := range addrs {
-		// Attempt to parse the address in CIDR notation
-		// and assert that it is IPv4 and global unicast
-		ip, _, err := net.ParseCIDR(addr.String())
-		if err != nil {
+// readLocalResources determines the total CPU, memory and disk capacity of
+// the local host. Components which cannot be determined are left at zero.
+func readLocalResources(root string) *resource.ResourceTuple {
+	res := &resource.ResourceTuple{
+		Cores: runtime.NumCPU() * 100,
+	}
+
+	mem, err := readTotalMemory(filepath.Join(root, meminfoPath))
+	if err != nil {
+		log.Debugf("Unable to determine total memory: %v", err)
+	} else {
+		res.Memory = mem
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(root, &st); err != nil {
+		log.Debugf("Unable to determine total disk space: %v", err)
+	} else {
+		res.Disk = int(st.Blocks * uint64(st.Bsize) / (1024 * 1024))
+	}
+
+	return res
+}
+
+// readTotalMemory returns the MemTotal value (in MB) of the given meminfo file
+func readTotalMemory(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
 			continue
 		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, err
+		}
+		return kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("MemTotal not found in %s", path)
+}
 
-		if !usableAddress(ip) {
+// getLocalAddresses returns the usable addresses of the interfaces of the
+// IPv4 and IPv6 default routes as public addresses, IPv4 addresses first.
+func getLocalAddresses() []Address {
+	var ips []net.IP
+	for _, iface := range getDefaultGatewayIfaces() {
+		addrs, err := iface.Addrs()
+		if err != nil {
 			continue
 		}
 
-		got = ip.String()
-		break
+		for _, addr := range addrs {
+			// Attempt to parse the address in CIDR notation
+			// and assert that it is global unicast
+			ip, _, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				continue
+			}
+
+			if !usableAddress(ip) {
+				continue
+			}
+
+			ips = append(ips, ip)
+		}
 	}
 
-	return
+	return publicAddresses(ips)
+}
+
+// publicAddresses returns the given IPs as public addresses, without
+// duplicates and IPv4 addresses first.
+func publicAddresses(ips []net.IP) []Address {
+	var v4, v6 []Address
+	seen := make(map[string]bool)
+	for _, ip := range ips {
+		if seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+
+		addr := Address{Role: AddressPublic, IP: ip.String()}
+		if ip.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	return append(v4, v6...)
 }
 
 func usableAddress(ip net.IP) bool {
-	return ip.To4() != nil && ip.IsGlobalUnicast()
+	return ip.IsGlobalUnicast()
 }
 
-func getDefaultGatewayIface() *net.Interface {
+// getDefaultGatewayIfaces returns the interfaces of the default routes of
+// all address families.
+func getDefaultGatewayIfaces() []*net.Interface {
 	log.Debug("Attempting to retrieve IP route info from netlink")
 
-	routes, err := netlink.RouteList(nil, 0)
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
 	if err != nil {
 		log.Debugf("Unable to detect default interface: %v", err)
 		return nil
@@ -181,19 +336,25 @@ func getDefaultGatewayIface() *net.Interface {
 		return nil
 	}
 
+	var ifaces []*net.Interface
+	seen := make(map[int]bool)
 	for _, route := range routes {
 		// a nil Dst means that this is the default route.
-		if route.Dst == nil {
-			i, err := net.InterfaceByIndex(route.LinkIndex)
-			if err != nil {
-				log.Debugf("Found default route but could not determine interface")
-				continue
-			}
-			log.Debugf("Found default route with interface %v", i)
-			return i
+		if route.Dst != nil || seen[route.LinkIndex] {
+			continue
+		}
+		i, err := net.InterfaceByIndex(route.LinkIndex)
+		if err != nil {
+			log.Debugf("Found default route but could not determine interface")
+			continue
 		}
+		log.Debugf("Found default route with interface %v", i)
+		seen[route.LinkIndex] = true
+		ifaces = append(ifaces, i)
 	}
 
-	log.Debugf("Unable to find default route")
-	return nil
+	if len(ifaces) == 0 {
+		log.Debugf("Unable to find default route")
+	}
+	return ifaces
 }
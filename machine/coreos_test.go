@@ -65,6 +65,79 @@ func TestReadLocalMachineIDFound(t *testing.T) {
 	}
 }
 
+func TestIsLocalMachineID(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpMachineIDPath := filepath.Join(dir, "/etc/machine-id")
+	err = os.MkdirAll(filepath.Dir(tmpMachineIDPath), os.FileMode(0755))
+	if err != nil {
+		t.Fatalf("Failed setting up fake mach ID path: %v", err)
+	}
+	err = ioutil.WriteFile(tmpMachineIDPath, []byte("pingpong"), os.FileMode(0644))
+	if err != nil {
+		t.Fatalf("Failed writing fake mach ID file: %v", err)
+	}
+
+	if !isLocalMachineID(dir, "pingpong") {
+		t.Fatal("Expected machine-id to be local before registration")
+	}
+
+	if err := writeRegisteredMachineID(dir, "web-1"); err != nil {
+		t.Fatalf("Failed recording registered machine ID: %v", err)
+	}
+	if !isLocalMachineID(dir, "web-1") {
+		t.Fatal("Expected registered machine ID to be local")
+	}
+	if isLocalMachineID(dir, "pingpong") {
+		t.Fatal("Expected machine-id not to be local once registered under another ID")
+	}
+}
+
+func TestValidateMachineID(t *testing.T) {
+	for _, id := range []string{"pingpong", "4d389537d9d14bdabe8be54a9c29f68d", "web-1.example.com"} {
+		if err := ValidateMachineID(id); err != nil {
+			t.Errorf("Unexpected error validating %q: %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "ping/pong", "ping pong"} {
+		if err := ValidateMachineID(id); err == nil {
+			t.Errorf("Expected error validating %q", id)
+		}
+	}
+}
+
+func TestReadLocalBootID(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := readLocalBootID(dir); err == nil {
+		t.Fatal("Expected error for missing boot ID, but got nil")
+	}
+
+	tmpBootIDPath := filepath.Join(dir, bootIDPath)
+	if err := os.MkdirAll(filepath.Dir(tmpBootIDPath), os.FileMode(0755)); err != nil {
+		t.Fatalf("Failed setting up fake boot ID path: %v", err)
+	}
+	if err := ioutil.WriteFile(tmpBootIDPath, []byte("c7a9ab4a-1a64-4a4b-a6a1-bc2ec5e9e3b1\n"), os.FileMode(0644)); err != nil {
+		t.Fatalf("Failed writing fake boot ID file: %v", err)
+	}
+
+	bootID, err := readLocalBootID(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error reading boot ID: %v", err)
+	}
+	if bootID != "c7a9ab4a-1a64-4a4b-a6a1-bc2ec5e9e3b1" {
+		t.Fatalf("Received incorrect boot ID %q", bootID)
+	}
+}
+
 func TestUsableAddress(t *testing.T) {
 	tests := []struct {
 		ip net.IP
@@ -73,8 +146,9 @@ func TestUsableAddress(t *testing.T) {
 		// unicast IPv4 usable
 		{net.ParseIP("192.168.1.12"), true},
 
-		// unicast IPv6 unusable
-		{net.ParseIP("2001:DB8::3"), false},
+		// unicast IPv6 usable
+		{net.ParseIP("2001:DB8::3"), true},
+		{net.ParseIP("fd00::3"), true},
 
 		// loopback IPv4/6 unusable
 		{net.ParseIP("127.0.0.12"), false},
@@ -100,3 +174,29 @@ func TestUsableAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestReadTotalMemory(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	meminfo := filepath.Join(dir, "meminfo")
+	contents := "MemTotal:        2048000 kB\nMemFree:          512000 kB\n"
+	if err := ioutil.WriteFile(meminfo, []byte(contents), os.FileMode(0644)); err != nil {
+		t.Fatalf("Failed writing fake meminfo file: %v", err)
+	}
+
+	mem, err := readTotalMemory(meminfo)
+	if err != nil {
+		t.Fatalf("Unexpected error reading total memory: %v", err)
+	}
+	if mem != 2000 {
+		t.Fatalf("Received incorrect total memory %d, expected 2000", mem)
+	}
+
+	if _, err := readTotalMemory(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("Expected error for missing meminfo, but got nil")
+	}
+}
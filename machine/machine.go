@@ -15,14 +15,112 @@
 package machine
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/pkg"
 )
 
+// metadataOperators lists the operators which may separate the key of a
+// metadata requirement from its value. Longer operators must come first.
+var metadataOperators = []string{"!~=", "!=", "~=", ">=", "<=", "=", ">", "<"}
+
+// The match expressions of the existence and absence of a key. As values
+// are never empty and cannot contain "!" or "=", neither can be mistaken
+// for the value of a key=value requirement.
+const (
+	metadataMatchSet   = "="
+	metadataMatchUnset = "!"
+)
+
 type Machine interface {
 	State() MachineState
 }
 
+// ParseMetadataRequirement parses a single metadata requirement of a unit
+// into the key it applies to and the match expression stored for that key.
+// The following forms are supported:
+//
+//	key=value      the value of key is value
+//	key!=value     key is unset, or its value is not value
+//	key~=pattern   the value of key matches the glob pattern
+//	key!~=pattern  key is unset, or its value does not match the pattern
+//	key>=N         the value of key is a number greater than or equal to N;
+//	               likewise for <=, > and <
+//	key            key is set
+//	!key           key is not set
+//
+// An error is returned if the requirement is malformed.
+func ParseMetadataRequirement(req string) (key, match string, err error) {
+	if strings.HasPrefix(req, "!") {
+		key = req[1:]
+		if strings.ContainsAny(key, "!=<>") {
+			return "", "", fmt.Errorf("invalid metadata requirement %q: negated key cannot have a value", req)
+		}
+		if key == "" {
+			return "", "", fmt.Errorf("invalid metadata requirement %q: empty key", req)
+		}
+		return key, metadataMatchUnset, nil
+	}
+
+	i := strings.IndexAny(req, "!=<>")
+	if i == -1 {
+		if req == "" {
+			return "", "", errors.New("invalid metadata requirement: empty key")
+		}
+		return req, metadataMatchSet, nil
+	}
+	if strings.HasPrefix(req[i:], "=") && strings.HasSuffix(req[:i], "~") {
+		i--
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("invalid metadata requirement %q: empty key", req)
+	}
+
+	key = req[:i]
+	op := ""
+	for _, o := range metadataOperators {
+		if strings.HasPrefix(req[i:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return "", "", fmt.Errorf("invalid metadata requirement %q: unknown operator", req)
+	}
+
+	value := req[i+len(op):]
+	switch {
+	case value == "":
+		return "", "", fmt.Errorf("invalid metadata requirement %q: empty value", req)
+	case strings.ContainsAny(value, "!=<>"):
+		return "", "", fmt.Errorf("invalid metadata requirement %q: value cannot contain any of \"!=<>\"", req)
+	}
+
+	switch op {
+	case "=", "!=":
+	case "~=", "!~=":
+		if _, err := globRegexp(value); err != nil {
+			return "", "", fmt.Errorf("invalid metadata requirement %q: %v", req, err)
+		}
+	default:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", "", fmt.Errorf("invalid metadata requirement %q: %q is not a number", req, value)
+		}
+	}
+
+	if op == "=" {
+		return key, value, nil
+	}
+	return key, op + value, nil
+}
+
 // HasMetadata determine if the Metadata of a given MachineState
 // matches the indicated values.
 func HasMetadata(state *MachineState, metadata map[string]pkg.Set) bool {
@@ -30,12 +128,11 @@ func HasMetadata(state *MachineState, metadata map[string]pkg.Set) bool {
 		local, ok := state.Metadata[key]
 		if !ok {
 			log.Debugf("No local values found for Metadata(%s)", key)
-			return false
+		} else {
+			log.Debugf("Asserting local Metadata(%s) meets requirements", key)
 		}
 
-		log.Debugf("Asserting local Metadata(%s) meets requirements", key)
-
-		if values.Contains(local) {
+		if matchMetadata(local, ok, values) {
 			log.Debugf("Local Metadata(%s) meets requirement", key)
 		} else {
 			log.Debugf("Local Metadata(%s) does not match requirement", key)
@@ -45,3 +142,157 @@ func HasMetadata(state *MachineState, metadata map[string]pkg.Set) bool {
 
 	return true
 }
+
+// matchMetadata determines whether a local metadata value, which is unset
+// if present is false, matches the expressions created by
+// ParseMetadataRequirement for its key. Values, patterns and the existence
+// of the key are alternatives, of which at least one must match; negations,
+// absence and comparisons must all hold.
+func matchMetadata(local string, present bool, matches pkg.Set) bool {
+	hasAlternatives := false
+	matchesAlternative := false
+
+	for _, m := range matches.Values() {
+		switch {
+		case m == metadataMatchUnset:
+			if present {
+				return false
+			}
+		case m == metadataMatchSet:
+			hasAlternatives = true
+			if present {
+				matchesAlternative = true
+			}
+		case strings.HasPrefix(m, "!~="):
+			if present && globMatch(m[3:], local) {
+				return false
+			}
+		case strings.HasPrefix(m, "!="):
+			if present && m[2:] == local {
+				return false
+			}
+		case strings.HasPrefix(m, ">"), strings.HasPrefix(m, "<"):
+			if !present || !compareNumeric(m, local) {
+				return false
+			}
+		case strings.HasPrefix(m, "~="):
+			hasAlternatives = true
+			if present && globMatch(m[2:], local) {
+				matchesAlternative = true
+			}
+		default:
+			hasAlternatives = true
+			if present && m == local {
+				matchesAlternative = true
+			}
+		}
+	}
+
+	if hasAlternatives {
+		return matchesAlternative
+	}
+	return true
+}
+
+func globMatch(pattern, value string) bool {
+	re, err := globRegexp(pattern)
+	return err == nil && re.MatchString(value)
+}
+
+// globRegexp translates a glob pattern, in the syntax of path.Match, into a
+// regular expression. Unlike path.Match, "*", "?" and character classes
+// also match "/", which is nothing special in metadata values.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b bytes.Buffer
+	b.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		case '\\':
+			i++
+			if i == len(runes) {
+				return nil, path.ErrBadPattern
+			}
+			fmt.Fprintf(&b, `\x{%x}`, runes[i])
+		case '[':
+			b.WriteString("[")
+			i++
+			if i < len(runes) && runes[i] == '^' {
+				b.WriteString("^")
+				i++
+			}
+			for n := 0; i == len(runes) || runes[i] != ']' || n == 0; n++ {
+				lo, next, err := globClassChar(runes, i)
+				if err != nil {
+					return nil, err
+				}
+				i = next
+				fmt.Fprintf(&b, `\x{%x}`, lo)
+				if i < len(runes) && runes[i] == '-' {
+					hi, next, err := globClassChar(runes, i+1)
+					if err != nil {
+						return nil, err
+					}
+					i = next
+					fmt.Fprintf(&b, `-\x{%x}`, hi)
+				}
+			}
+			b.WriteString("]")
+		default:
+			fmt.Fprintf(&b, `\x{%x}`, runes[i])
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globClassChar reads the character at position i of a character class,
+// which may be escaped, returning it along with the position following it.
+func globClassChar(runes []rune, i int) (rune, int, error) {
+	if i >= len(runes) {
+		return 0, 0, path.ErrBadPattern
+	}
+	switch runes[i] {
+	case '\\':
+		if i+1 == len(runes) {
+			return 0, 0, path.ErrBadPattern
+		}
+		return runes[i+1], i + 2, nil
+	case '-', ']':
+		return 0, 0, path.ErrBadPattern
+	}
+	return runes[i], i + 1, nil
+}
+
+// compareNumeric evaluates a comparison such as ">=32" against value. A
+// value which is not a number never satisfies a comparison.
+func compareNumeric(cmp, value string) bool {
+	op := cmp[:1]
+	if strings.HasPrefix(cmp[1:], "=") {
+		op = cmp[:2]
+	}
+	want, err := strconv.ParseFloat(cmp[len(op):], 64)
+	if err != nil {
+		return false
+	}
+	got, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case ">=":
+		return got >= want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case "<":
+		return got < want
+	}
+	return false
+}
@@ -71,6 +71,212 @@ func TestHasMetadata(t *testing.T) {
 			},
 			false,
 		},
+		// globs
+		{
+			map[string]string{
+				"zone": "us-east-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("~=us-east-*"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"zone": "us-west-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("~=us-east-*"),
+			},
+			false,
+		},
+		// negations match unset keys
+		{
+			map[string]string{
+				"zone": "us-west-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("!~=us-east-*", "!~=eu-*"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"zone": "eu-west-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("!~=us-east-*", "!~=eu-*"),
+			},
+			false,
+		},
+		{
+			map[string]string{},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("!~=us-east-*"),
+			},
+			true,
+		},
+		// existence and non-existence
+		{
+			map[string]string{
+				"gpu": "",
+			},
+			map[string]pkg.Set{
+				"gpu": pkg.NewUnsafeSet("="),
+			},
+			true,
+		},
+		{
+			map[string]string{},
+			map[string]pkg.Set{
+				"gpu": pkg.NewUnsafeSet("="),
+			},
+			false,
+		},
+		{
+			map[string]string{},
+			map[string]pkg.Set{
+				"gpu": pkg.NewUnsafeSet("!"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"gpu": "nvidia",
+			},
+			map[string]pkg.Set{
+				"gpu": pkg.NewUnsafeSet("!"),
+			},
+			false,
+		},
+		// values are literal, and a value with a slash is still set
+		{
+			map[string]string{
+				"zone": "us-east-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("us-east-*"),
+			},
+			false,
+		},
+		{
+			map[string]string{
+				"zone": "us-east-*",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("us-east-*"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"zone": "us-east-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("!=us-east-1a"),
+			},
+			false,
+		},
+		{
+			map[string]string{
+				"region": "us/east",
+			},
+			map[string]pkg.Set{
+				"region": pkg.NewUnsafeSet("="),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"region": "us/east",
+			},
+			map[string]pkg.Set{
+				"region": pkg.NewUnsafeSet("!"),
+			},
+			false,
+		},
+		// patterns match across slashes
+		{
+			map[string]string{
+				"region": "us/east/1",
+			},
+			map[string]pkg.Set{
+				"region": pkg.NewUnsafeSet("~=us/*"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"region": "us/east",
+			},
+			map[string]pkg.Set{
+				"region": pkg.NewUnsafeSet("~=us?east"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"region": "us/east",
+			},
+			map[string]pkg.Set{
+				"region": pkg.NewUnsafeSet("!~=*/*"),
+			},
+			false,
+		},
+		// numeric comparisons must all hold
+		{
+			map[string]string{
+				"memory_gb": "64",
+			},
+			map[string]pkg.Set{
+				"memory_gb": pkg.NewUnsafeSet(">=32", "<128"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"memory_gb": "16",
+			},
+			map[string]pkg.Set{
+				"memory_gb": pkg.NewUnsafeSet(">=32", "<128"),
+			},
+			false,
+		},
+		{
+			map[string]string{
+				"memory_gb": "lots",
+			},
+			map[string]pkg.Set{
+				"memory_gb": pkg.NewUnsafeSet(">=32"),
+			},
+			false,
+		},
+		{
+			map[string]string{},
+			map[string]pkg.Set{
+				"memory_gb": pkg.NewUnsafeSet(">=32"),
+			},
+			false,
+		},
+		// alternatives and constraints combined
+		{
+			map[string]string{
+				"zone": "us-east-1b",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("~=us-*", "!=us-east-1a"),
+			},
+			true,
+		},
+		{
+			map[string]string{
+				"zone": "us-east-1a",
+			},
+			map[string]pkg.Set{
+				"zone": pkg.NewUnsafeSet("~=us-*", "!=us-east-1a"),
+			},
+			false,
+		},
 	}
 
 	for i, tt := range testCases {
@@ -81,3 +287,85 @@ func TestHasMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestGlobMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"a*", "a/b/c", true},
+		{"a?c", "a/c", true},
+		{"a[/b]c", "a/c", true},
+		{"a[^b]c", "a/c", true},
+		{"a[^/]c", "a/c", false},
+		{"[a-c]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"a.c", "abc", false},
+		{"(a|b)", "a", false},
+		{"é*", "éa", true},
+	}
+
+	for i, tt := range testCases {
+		if got := globMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("case %d: globMatch(%q, %q) returned %t, expected %t", i, tt.pattern, tt.value, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"[", "[]", "[a", "a\\", "[a-]", "[-a]"} {
+		if _, err := globRegexp(pattern); err == nil {
+			t.Errorf("globRegexp(%q) expected error", pattern)
+		}
+	}
+}
+
+func TestParseMetadataRequirement(t *testing.T) {
+	testCases := []struct {
+		req   string
+		key   string
+		match string
+		valid bool
+	}{
+		{"region=us-east-1", "region", "us-east-1", true},
+		{"zone=us-east-*", "zone", "us-east-*", true},
+		{"zone=[", "zone", "[", true},
+		{"zone~=us-east-*", "zone", "~=us-east-*", true},
+		{"zone!=us-east-1a", "zone", "!=us-east-1a", true},
+		{"zone!~=us-east-*", "zone", "!~=us-east-*", true},
+		{"memory_gb>=32", "memory_gb", ">=32", true},
+		{"memory_gb<=32", "memory_gb", "<=32", true},
+		{"cores>4", "cores", ">4", true},
+		{"cores<4.5", "cores", "<4.5", true},
+		{"gpu", "gpu", "=", true},
+		{"!gpu", "gpu", "!", true},
+
+		{"", "", "", false},
+		{"!", "", "", false},
+		{"=foo", "", "", false},
+		{"foo=", "", "", false},
+		{"foo!=", "", "", false},
+		{"foo=bar=baz", "", "", false},
+		{"foo=<bar", "", "", false},
+		{"foo!bar", "", "", false},
+		{"!foo=bar", "", "", false},
+		{"foo>=lots", "", "", false},
+		{"foo~=[", "", "", false},
+		{"foo!~=[a-]", "", "", false},
+		{"~=foo", "", "", false},
+	}
+
+	for i, tt := range testCases {
+		key, match, err := ParseMetadataRequirement(tt.req)
+		if (err == nil) != tt.valid {
+			t.Errorf("case %d: %q: bad error value (got err=%v, want valid=%t)", i, tt.req, err, tt.valid)
+			continue
+		}
+		if key != tt.key || match != tt.match {
+			t.Errorf("case %d: %q: got key=%q match=%q, want key=%q match=%q", i, tt.req, key, match, tt.key, tt.match)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/pkg"
+)
+
+const (
+	kernelReleasePath = "/proc/sys/kernel/osrelease"
+	osReleasePath     = "/etc/os-release"
+
+	// DefaultProbeTimeout is the time a metadata probe may run for before
+	// it is killed
+	DefaultProbeTimeout = 10 * time.Second
+)
+
+// MetadataProbe gathers metadata of the local host on every refresh of its
+// state, so that it does not need to be maintained by hand. Sources are
+// built-in facts about the host and, in a drop-in directory, *.conf files of
+// key=value lines and executables printing key=value lines.
+type MetadataProbe struct {
+	// Facts enables the built-in facts: arch, cpu_count, memory_mb,
+	// kernel_version, os_id and os_version
+	Facts bool
+	// Dir is the drop-in directory, if any
+	Dir string
+	// Timeout bounds the run time of each executable in Dir
+	Timeout time.Duration
+
+	root string
+}
+
+// Metadata returns the metadata gathered from all sources. Later sources
+// take precedence: built-in facts, then *.conf files, then executables, each
+// in lexical order of their file names. Sources which fail are skipped.
+func (p *MetadataProbe) Metadata() map[string]string {
+	meta := make(map[string]string)
+	if p == nil {
+		return meta
+	}
+
+	root := p.root
+	if root == "" {
+		root = "/"
+	}
+	if p.Facts {
+		for k, v := range readFacts(root) {
+			meta[k] = v
+		}
+	}
+	if p.Dir == "" {
+		return meta
+	}
+
+	// ReadDir sorts the files by name
+	files, err := ioutil.ReadDir(p.Dir)
+	if err != nil {
+		log.Warningf("Unable to read metadata directory %s: %v", p.Dir, err)
+		return meta
+	}
+	var confs, probes []string
+	for _, fi := range files {
+		path := filepath.Join(p.Dir, fi.Name())
+		// follow symlinks, which drop-in directories often consist of
+		st, err := os.Stat(path)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(fi.Name(), ".conf") {
+			confs = append(confs, path)
+		} else if st.Mode()&0111 != 0 {
+			probes = append(probes, path)
+		}
+	}
+
+	for _, path := range confs {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Warningf("Unable to read metadata file %s: %v", path, err)
+			continue
+		}
+		err = parseMetadataLines(f, meta)
+		f.Close()
+		if err != nil {
+			log.Warningf("Invalid metadata file %s: %v", path, err)
+		}
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	for _, path := range probes {
+		out, err := runProbe(path, timeout)
+		if err != nil {
+			log.Warningf("Metadata probe %s failed: %v", path, err)
+			continue
+		}
+		if err := parseMetadataLines(bytes.NewReader(out), meta); err != nil {
+			log.Warningf("Invalid output of metadata probe %s: %v", path, err)
+		}
+	}
+
+	return meta
+}
+
+// parseMetadataLines adds the key=value lines read from r to meta. Empty
+// lines and lines starting with # are ignored. Valid lines are added even if
+// others are invalid, in which case the first error is returned.
+func parseMetadataLines(r io.Reader, meta map[string]string) error {
+	var first error
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if err := validateMetadataKey(key); len(parts) != 2 || err != nil {
+			if first == nil {
+				first = fmt.Errorf("line %q is not a valid key=value pair", line)
+			}
+			continue
+		}
+		meta[key] = strings.TrimSpace(parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return first
+}
+
+// validateMetadataKey returns an error if the given key could not be
+// matched by a MachineMetadata requirement.
+func validateMetadataKey(key string) error {
+	if key == "" {
+		return errors.New("empty metadata key")
+	}
+	if strings.ContainsAny(key, "!=<>,/ \t") {
+		return fmt.Errorf("metadata key %q must not contain any of \"!=<>,/\" or whitespace", key)
+	}
+	return nil
+}
+
+// runProbe runs the given executable and returns its output, killing it and
+// its descendants if it does not exit within the timeout.
+func runProbe(path string, timeout time.Duration) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdout = &out
+	if err := pkg.RunWithTimeout(cmd, timeout); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// readFacts returns the built-in facts about the host below root. Facts
+// which cannot be determined are left out.
+func readFacts(root string) map[string]string {
+	facts := map[string]string{
+		"arch":      runtime.GOARCH,
+		"cpu_count": strconv.Itoa(runtime.NumCPU()),
+	}
+
+	if mem, err := readTotalMemory(filepath.Join(root, meminfoPath)); err == nil {
+		facts["memory_mb"] = strconv.Itoa(mem)
+	}
+	if release, err := ioutil.ReadFile(filepath.Join(root, kernelReleasePath)); err == nil {
+		if v := strings.TrimSpace(string(release)); v != "" {
+			facts["kernel_version"] = v
+		}
+	}
+	if osRelease, err := readOSRelease(filepath.Join(root, osReleasePath)); err == nil {
+		if v := osRelease["ID"]; v != "" {
+			facts["os_id"] = v
+		}
+		if v := osRelease["VERSION_ID"]; v != "" {
+			facts["os_version"] = v
+		}
+	}
+
+	return facts
+}
+
+// readOSRelease parses the variables of an os-release file.
+func readOSRelease(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+		vars[parts[0]] = strings.Trim(parts[1], "\"'")
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeProbeFile(t *testing.T, path, contents string, mode os.FileMode) {
+	if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0755)); err != nil {
+		t.Fatalf("Failed creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), mode); err != nil {
+		t.Fatalf("Failed writing %s: %v", path, err)
+	}
+}
+
+func TestReadFacts(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	writeProbeFile(t, filepath.Join(root, meminfoPath), "MemTotal:        2048000 kB\n", 0644)
+	writeProbeFile(t, filepath.Join(root, kernelReleasePath), "4.9.24-coreos\n", 0644)
+	writeProbeFile(t, filepath.Join(root, osReleasePath), "NAME=\"Container Linux by CoreOS\"\nID=coreos\nVERSION_ID=1409.7.0\n", 0644)
+
+	want := map[string]string{
+		"arch":           runtime.GOARCH,
+		"cpu_count":      strconv.Itoa(runtime.NumCPU()),
+		"memory_mb":      "2000",
+		"kernel_version": "4.9.24-coreos",
+		"os_id":          "coreos",
+		"os_version":     "1409.7.0",
+	}
+	if got := readFacts(root); !reflect.DeepEqual(want, got) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// facts which cannot be determined are left out
+	empty, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(empty)
+
+	want = map[string]string{
+		"arch":      runtime.GOARCH,
+		"cpu_count": strconv.Itoa(runtime.NumCPU()),
+	}
+	if got := readFacts(empty); !reflect.DeepEqual(want, got) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMetadataProbe(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeProbeFile(t, filepath.Join(dir, "10-rack.conf"), "# rack of the host\nrack = r1\nrow=a\n", 0644)
+	writeProbeFile(t, filepath.Join(dir, "20-rack.conf"), "rack=r2\nnot a pair\n", 0644)
+	writeProbeFile(t, filepath.Join(dir, "gpu"), "#!/bin/sh\necho gpu=nvidia\necho row=b\n", 0755)
+	writeProbeFile(t, filepath.Join(dir, "broken"), "#!/bin/sh\necho broken=yes\nexit 1\n", 0755)
+	writeProbeFile(t, filepath.Join(dir, "README"), "ignored=yes\n", 0644)
+	if err := os.Symlink(filepath.Join(dir, "20-rack.conf"), filepath.Join(dir, "30-link.conf")); err != nil {
+		t.Fatalf("Failed creating symlink: %v", err)
+	}
+
+	p := &MetadataProbe{Dir: dir}
+	want := map[string]string{
+		"rack": "r2",
+		"row":  "b",
+		"gpu":  "nvidia",
+	}
+	if got := p.Metadata(); !reflect.DeepEqual(want, got) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var nilProbe *MetadataProbe
+	if got := nilProbe.Metadata(); len(got) != 0 {
+		t.Errorf("expected no metadata from nil probe, got %v", got)
+	}
+}
+
+func TestMetadataProbeTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fleet-")
+	if err != nil {
+		t.Fatalf("Failed creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeProbeFile(t, filepath.Join(dir, "slow"), "#!/bin/sh\nexec sleep 5\n", 0755)
+
+	p := &MetadataProbe{Dir: dir, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if got := p.Metadata(); len(got) != 0 {
+		t.Errorf("expected no metadata, got %v", got)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("probe was not killed after its timeout, took %v", elapsed)
+	}
+}
+
+func TestParseMetadataLines(t *testing.T) {
+	meta := map[string]string{"rack": "r0"}
+	err := parseMetadataLines(strings.NewReader("rack=r1\nbad key=x\nssd=true\n"), meta)
+	if err == nil {
+		t.Errorf("expected error for invalid key")
+	}
+	want := map[string]string{"rack": "r1", "ssd": "true"}
+	if !reflect.DeepEqual(want, meta) {
+		t.Errorf("got %v, want %v", meta, want)
+	}
+}
@@ -14,6 +14,10 @@
 
 package machine
 
+import (
+	"github.com/coreos/fleet/resource"
+)
+
 const (
 	shortIDLen = 8
 )
@@ -26,6 +30,18 @@ type MachineState struct {
 	Metadata     map[string]string
 	Capabilities Capabilities
 	Version      string
+	// Name is a human-friendly name of the host, which MachineID= unit
+	// options may refer to instead of the ID
+	Name string `json:",omitempty"`
+	// TotalResources is the capacity the host advertises for scheduling
+	TotalResources *resource.ResourceTuple `json:",omitempty"`
+	// Cordoned machines do not accept newly scheduled units
+	Cordoned bool `json:",omitempty"`
+	// BootID identifies the boot of the host the state was published
+	// from, to tell two hosts sharing an ID apart
+	BootID string `json:",omitempty"`
+	// Addresses lists the IPv4 and IPv6 addresses of the host by role
+	Addresses []Address `json:",omitempty"`
 }
 
 func (ms MachineState) ShortID() string {
@@ -35,8 +51,10 @@ func (ms MachineState) ShortID() string {
 	return ms.ID[0:shortIDLen]
 }
 
+// MatchID returns whether the given string refers to the machine by its full
+// or short ID, or by its name.
 func (ms MachineState) MatchID(ID string) bool {
-	return ms.ID == ID || ms.ShortID() == ID
+	return ms.ID == ID || ms.ShortID() == ID || (ms.Name != "" && ms.Name == ID)
 }
 
 // stackState is used to merge two MachineStates. Values configured on the top
@@ -46,17 +64,28 @@ func stackState(top, bottom MachineState) MachineState {
 
 	if top.PublicIP != "" {
 		state.PublicIP = top.PublicIP
+	} else if ips := top.AddressesFor(AddressPublic); len(ips) > 0 {
+		state.PublicIP = ips[0]
 	}
 
+	state.Addresses = stackAddresses(top.Addresses, bottom.Addresses)
+
 	if top.ID != "" {
 		state.ID = top.ID
 	}
 
-	//FIXME: This will *always* overwrite the bottom's metadata,
-	// but the only use-case we have today does not ever have
-	// metadata on the bottom.
+	if top.Name != "" {
+		state.Name = top.Name
+	}
+
 	if len(top.Metadata) > 0 {
-		state.Metadata = top.Metadata
+		state.Metadata = make(map[string]string, len(top.Metadata)+len(bottom.Metadata))
+		for k, v := range bottom.Metadata {
+			state.Metadata[k] = v
+		}
+		for k, v := range top.Metadata {
+			state.Metadata[k] = v
+		}
 	}
 
 	if len(top.Capabilities) > 0 {
@@ -67,5 +96,13 @@ func stackState(top, bottom MachineState) MachineState {
 		state.Version = top.Version
 	}
 
+	if top.TotalResources != nil {
+		state.TotalResources = top.TotalResources
+	}
+
+	if top.BootID != "" {
+		state.BootID = top.BootID
+	}
+
 	return state
 }
@@ -14,7 +14,10 @@
 
 package machine
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestStackState(t *testing.T) {
 	top := MachineState{
@@ -39,7 +42,7 @@ func TestStackState(t *testing.T) {
 		t.Errorf("Unexpected PublicIp value %s", stacked.PublicIP)
 	}
 
-	if len(stacked.Metadata) != 1 || stacked.Metadata["ping"] != "pong" {
+	if len(stacked.Metadata) != 2 || stacked.Metadata["ping"] != "pong" || stacked.Metadata["foo"] != "bar" {
 		t.Errorf("Unexpected Metadata %v", stacked.Metadata)
 	}
 
@@ -48,6 +51,17 @@ func TestStackState(t *testing.T) {
 	}
 }
 
+func TestStackStateMetadataPrecedence(t *testing.T) {
+	top := MachineState{Metadata: map[string]string{"arch": "arm64"}}
+	bottom := MachineState{Metadata: map[string]string{"arch": "amd64", "cpu_count": "4"}}
+	stacked := stackState(top, bottom)
+
+	want := map[string]string{"arch": "arm64", "cpu_count": "4"}
+	if !reflect.DeepEqual(want, stacked.Metadata) {
+		t.Errorf("Unexpected Metadata %v", stacked.Metadata)
+	}
+}
+
 func TestStackStateEmptyTop(t *testing.T) {
 	top := MachineState{}
 	bottom := MachineState{
@@ -91,6 +105,11 @@ var shortIDTests = []struct {
 			map[string]string{"foo": "bar"},
 			Capabilities{},
 			"",
+			"",
+			nil,
+			false,
+			"",
+			nil,
 		},
 		s: "595989bb",
 		l: "595989bb-cbb7-49ce-8726-722d6e157b4e",
@@ -136,3 +155,19 @@ func TestStateMatchID(t *testing.T) {
 		}
 	}
 }
+
+func TestStateMatchName(t *testing.T) {
+	ms := MachineState{ID: "595989bb-cbb7-49ce-8726-722d6e157b4e", Name: "web-1"}
+	for _, id := range []string{"595989bb-cbb7-49ce-8726-722d6e157b4e", "595989bb", "web-1"} {
+		if !ms.MatchID(id) {
+			t.Errorf("expected %q to match", id)
+		}
+	}
+	if ms.MatchID("web-2") {
+		t.Errorf("expected web-2 not to match")
+	}
+
+	if (MachineState{ID: "595989bb"}).MatchID("") {
+		t.Errorf("expected empty name not to match")
+	}
+}
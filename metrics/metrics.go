@@ -22,8 +22,10 @@ import (
 )
 
 type (
-	engineFailure string
-	registryOp    string
+	engineFailure     string
+	scheduleFailure   string
+	failureReschedule string
+	registryOp        string
 )
 
 const (
@@ -35,6 +37,14 @@ const (
 	Get             registryOp    = "get"
 	Set             registryOp    = "set"
 	GetAll          registryOp    = "get_all"
+
+	NoAgents              scheduleFailure = "no_agents"
+	NoAgentsAbleToRun     scheduleFailure = "unable_to_run"
+	InsufficientResources scheduleFailure = "insufficient_resources"
+	InvalidResources      scheduleFailure = "invalid_resources"
+
+	FailureRescheduled     failureReschedule = "rescheduled"
+	FailureBudgetExhausted failureReschedule = "exhausted"
 )
 
 var (
@@ -80,6 +90,20 @@ var (
 		Help:      "Counter of scheduling failures.",
 	}, []string{"type"})
 
+	engineScheduleFailureCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "engine",
+		Name:      "schedule_failure_count_total",
+		Help:      "Counter of scheduling decisions that could not be made, by reason.",
+	}, []string{"reason"})
+
+	engineFailureRescheduleCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "engine",
+		Name:      "failure_reschedule_count_total",
+		Help:      "Counter of failed units moved away from their machine, and of failed units left without a machine to run them.",
+	}, []string{"result"})
+
 	registryOpCount = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: Namespace,
 		Subsystem: "registry",
@@ -108,6 +132,8 @@ func init() {
 	prometheus.MustRegister(engineTaskFailureCount)
 	prometheus.MustRegister(engineReconcileCount)
 	prometheus.MustRegister(engineReconcileFailureCount)
+	prometheus.MustRegister(engineScheduleFailureCount)
+	prometheus.MustRegister(engineFailureRescheduleCount)
 }
 
 func ReportEngineLeader() {
@@ -129,6 +155,12 @@ func ReportEngineReconcileSuccess(start time.Time) {
 func ReportEngineReconcileFailure(reason engineFailure) {
 	engineReconcileFailureCount.WithLabelValues(string(reason)).Inc()
 }
+func ReportEngineScheduleFailure(reason scheduleFailure) {
+	engineScheduleFailureCount.WithLabelValues(string(reason)).Inc()
+}
+func ReportEngineFailureReschedule(result failureReschedule) {
+	engineFailureRescheduleCount.WithLabelValues(string(result)).Inc()
+}
 func ReportRegistryOpSuccess(op registryOp, start time.Time) {
 	registryOpCount.WithLabelValues(string(op)).Inc()
 	registryOpDuration.WithLabelValues(string(op)).Observe(float64(time.Since(start)) / float64(time.Second))
@@ -0,0 +1,53 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "echo ok")
+	cmd.Stdout = &out
+	if err := RunWithTimeout(cmd, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "ok\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if err := RunWithTimeout(exec.Command("/bin/sh", "-c", "exit 1"), time.Second); err == nil {
+		t.Errorf("expected error for failing command")
+	}
+}
+
+func TestRunWithTimeoutKillsDescendants(t *testing.T) {
+	// the shell exits at once, but leaves a child holding its stdout
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "sleep 30 & echo started")
+	cmd.Stdout = &out
+
+	start := time.Now()
+	if err := RunWithTimeout(cmd, 100*time.Millisecond); err == nil {
+		t.Errorf("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("descendant was not killed after the timeout, took %v", elapsed)
+	}
+}
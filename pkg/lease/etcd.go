@@ -176,25 +176,31 @@ func (r *etcdLeaseManager) AcquireLease(name string, machID string, ver int, per
 
 func (r *etcdLeaseManager) leaseFromResponse(res *etcd.Response) *etcdLease {
 	l := &etcdLease{
-		mgr: r,
-		key: res.Node.Key,
-		idx: res.Node.ModifiedIndex,
-		ttl: res.Node.TTLDuration(),
+		mgr:  r,
+		key:  res.Node.Key,
+		idx:  res.Node.ModifiedIndex,
+		ttl:  res.Node.TTLDuration(),
+		meta: parseLeaseMetadata(res.Node.Value),
 	}
 
-	err := json.Unmarshal([]byte(res.Node.Value), &l.meta)
+	return l
+}
+
+func parseLeaseMetadata(val string) etcdLeaseMetadata {
+	var meta etcdLeaseMetadata
+	err := json.Unmarshal([]byte(val), &meta)
 
 	// fall back to using the entire value as the MachineID for
 	// backwards-compatibility with engines that are not aware
 	// of this versioning mechanism
 	if err != nil {
-		l.meta = etcdLeaseMetadata{
-			MachineID: res.Node.Value,
+		meta = etcdLeaseMetadata{
+			MachineID: val,
 			Version:   0,
 		}
 	}
 
-	return l
+	return meta
 }
 
 func isEtcdError(err error, code int) bool {
@@ -0,0 +1,207 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lease
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+)
+
+// etcdV3Lease implements the Lease interface on top of a native etcd v3
+// lease, which the lease key is attached to.
+type etcdV3Lease struct {
+	mgr  *etcdV3LeaseManager
+	key  string
+	meta etcdLeaseMetadata
+	rev  int64
+	id   clientv3.LeaseID
+	ttl  time.Duration
+}
+
+func (l *etcdV3Lease) Release() error {
+	ctx, cancel := l.mgr.ctx()
+	defer cancel()
+	res, err := l.mgr.kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(l.key), "=", l.rev)).
+		Then(clientv3.OpDelete(l.key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !res.Succeeded {
+		return errors.New("lease has changed since it was acquired")
+	}
+	l.mgr.revoke(l.id)
+	return nil
+}
+
+func (l *etcdV3Lease) Renew(period time.Duration) error {
+	val, err := serializeLeaseMetadata(l.meta.MachineID, l.meta.Version)
+	if err != nil {
+		return err
+	}
+
+	renewed, err := l.mgr.put(l.key, val, period, clientv3.Compare(clientv3.ModRevision(l.key), "=", l.rev))
+	if err != nil {
+		return err
+	}
+	if renewed == nil {
+		return errors.New("lease has changed since it was acquired")
+	}
+
+	l.mgr.revoke(l.id)
+	*l = *renewed
+	return nil
+}
+
+func (l *etcdV3Lease) MachineID() string {
+	return l.meta.MachineID
+}
+
+func (l *etcdV3Lease) Version() int {
+	return l.meta.Version
+}
+
+func (l *etcdV3Lease) Index() uint64 {
+	return uint64(l.rev)
+}
+
+func (l *etcdV3Lease) TimeRemaining() time.Duration {
+	return l.ttl
+}
+
+type etcdV3LeaseManager struct {
+	kv        clientv3.KV
+	lease     clientv3.Lease
+	keyPrefix string
+	timeout   time.Duration
+}
+
+func NewEtcdV3LeaseManager(kv clientv3.KV, lease clientv3.Lease, keyPrefix string, timeout time.Duration) *etcdV3LeaseManager {
+	return &etcdV3LeaseManager{kv: kv, lease: lease, keyPrefix: keyPrefix, timeout: timeout}
+}
+
+func (r *etcdV3LeaseManager) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), r.timeout)
+}
+
+func (r *etcdV3LeaseManager) leasePath(name string) string {
+	return path.Join(r.keyPrefix, leasePrefix, name)
+}
+
+// put grants a new native lease of the given period and attaches the lease
+// key to it, provided cmp holds. A nil Lease is returned if it does not.
+func (r *etcdV3LeaseManager) put(key, val string, period time.Duration, cmp clientv3.Cmp) (*etcdV3Lease, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+
+	secs := int64(period / time.Second)
+	if period%time.Second != 0 || secs < 1 {
+		secs++
+	}
+	grant, err := r.lease.Grant(ctx, secs)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.kv.Txn(ctx).
+		If(cmp).
+		Then(clientv3.OpPut(key, val, clientv3.WithLease(grant.ID))).
+		Commit()
+	if err != nil || !res.Succeeded {
+		r.revoke(grant.ID)
+		return nil, err
+	}
+
+	return &etcdV3Lease{
+		mgr:  r,
+		key:  key,
+		meta: parseLeaseMetadata(val),
+		rev:  res.Header.Revision,
+		id:   grant.ID,
+		ttl:  time.Duration(secs) * time.Second,
+	}, nil
+}
+
+// revoke gives up a native lease that no longer has the lease key attached.
+// Failures are harmless, as the lease expires anyway.
+func (r *etcdV3LeaseManager) revoke(id clientv3.LeaseID) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+	r.lease.Revoke(ctx, id)
+}
+
+func (r *etcdV3LeaseManager) GetLease(name string) (Lease, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+
+	key := r.leasePath(name)
+	res, err := r.kv.Get(ctx, key)
+	if err != nil || len(res.Kvs) == 0 {
+		return nil, err
+	}
+	kv := res.Kvs[0]
+
+	l := &etcdV3Lease{
+		mgr:  r,
+		key:  key,
+		meta: parseLeaseMetadata(string(kv.Value)),
+		rev:  kv.ModRevision,
+		id:   clientv3.LeaseID(kv.Lease),
+	}
+	if l.id != clientv3.NoLease {
+		ttl, err := r.lease.TimeToLive(ctx, l.id)
+		if err != nil {
+			return nil, err
+		}
+		if ttl.TTL > 0 {
+			l.ttl = time.Duration(ttl.TTL) * time.Second
+		}
+	}
+
+	return l, nil
+}
+
+func (r *etcdV3LeaseManager) StealLease(name, machID string, ver int, period time.Duration, idx uint64) (Lease, error) {
+	val, err := serializeLeaseMetadata(machID, ver)
+	if err != nil {
+		return nil, err
+	}
+
+	key := r.leasePath(name)
+	l, err := r.put(key, val, period, clientv3.Compare(clientv3.ModRevision(key), "=", int64(idx)))
+	if l == nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (r *etcdV3LeaseManager) AcquireLease(name string, machID string, ver int, period time.Duration) (Lease, error) {
+	val, err := serializeLeaseMetadata(machID, ver)
+	if err != nil {
+		return nil, err
+	}
+
+	key := r.leasePath(name)
+	l, err := r.put(key, val, period, clientv3.Compare(clientv3.CreateRevision(key), "=", 0))
+	if l == nil {
+		return nil, err
+	}
+	return l, nil
+}
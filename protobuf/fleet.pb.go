@@ -267,6 +267,7 @@ type UnitState struct {
 	ActiveState string `protobuf:"bytes,4,opt,name=active_state,json=activeState,proto3" json:"active_state,omitempty"`
 	SubState    string `protobuf:"bytes,5,opt,name=sub_state,json=subState,proto3" json:"sub_state,omitempty"`
 	MachineID   string `protobuf:"bytes,6,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`
+	Health      string `protobuf:"bytes,7,opt,name=health,proto3" json:"health,omitempty"`
 }
 
 func (m *UnitState) Reset()                    { *m = UnitState{} }
@@ -1722,6 +1723,12 @@ func (m *UnitState) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintFleet(dAtA, i, uint64(len(m.MachineID)))
 		i += copy(dAtA[i:], m.MachineID)
 	}
+	if len(m.Health) > 0 {
+		dAtA[i] = 0x3a
+		i++
+		i = encodeVarintFleet(dAtA, i, uint64(len(m.Health)))
+		i += copy(dAtA[i:], m.Health)
+	}
 	return i, nil
 }
 
@@ -2268,6 +2275,10 @@ func (m *UnitState) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovFleet(uint64(l))
 	}
+	l = len(m.Health)
+	if l > 0 {
+		n += 1 + l + sovFleet(uint64(l))
+	}
 	return n
 }
 
@@ -3926,6 +3937,35 @@ func (m *UnitState) Unmarshal(dAtA []byte) error {
 			}
 			m.MachineID = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFleet
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthFleet
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Health = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipFleet(dAtA[iNdEx:])
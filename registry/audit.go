@@ -0,0 +1,144 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/log"
+)
+
+const (
+	auditPrefix = "audit"
+
+	// MaxAuditRecords is the size of the ring buffer of audit records.
+	// Once it is full, each new record overwrites the oldest one.
+	MaxAuditRecords = 1000
+
+	// auditAppendAttempts is the number of times appending an audit
+	// record is attempted while other machines append concurrently.
+	auditAppendAttempts = 5
+)
+
+var errAuditAppendRace = errors.New("audit record could not be appended due to concurrent appends")
+
+// auditModel is used for serializing and deserializing audit Records
+// stored in the Registry. Seq orders the Records of the ring buffer.
+type auditModel struct {
+	Seq    uint64
+	Record audit.Record
+}
+
+// AppendAuditRecord implements the audit.Store interface
+func (r *EtcdRegistry) AppendAuditRecord(rec audit.Record) error {
+	for i := 0; i < auditAppendAttempts; i++ {
+		seq, err := r.takeAuditSeq()
+		if err == errAuditAppendRace {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		val, err := marshal(auditModel{seq, rec})
+		if err != nil {
+			return err
+		}
+		_, err = r.kAPI.Set(context.Background(), r.auditRecordPath(seq), val, nil)
+		return err
+	}
+	return errAuditAppendRace
+}
+
+// takeAuditSeq increments the sequence number of the audit ring buffer,
+// returning the sequence number of the record to append.
+func (r *EtcdRegistry) takeAuditSeq() (uint64, error) {
+	key := r.prefixed(auditPrefix, "next")
+	opts := &etcd.SetOptions{PrevExist: etcd.PrevNoExist}
+	var seq uint64
+
+	res, err := r.kAPI.Get(context.Background(), key, nil)
+	if err == nil {
+		seq, err = strconv.ParseUint(res.Node.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid audit sequence number: %v", err)
+		}
+		opts = &etcd.SetOptions{PrevIndex: res.Node.ModifiedIndex}
+	} else if !isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+		return 0, err
+	}
+
+	_, err = r.kAPI.Set(context.Background(), key, strconv.FormatUint(seq+1, 10), opts)
+	if isEtcdError(err, etcd.ErrorCodeTestFailed) || isEtcdError(err, etcd.ErrorCodeNodeExist) {
+		err = errAuditAppendRace
+	}
+	return seq, err
+}
+
+// AuditRecords implements the audit.Store interface
+func (r *EtcdRegistry) AuditRecords() ([]audit.Record, error) {
+	res, err := r.kAPI.Get(context.Background(), r.prefixed(auditPrefix, "records"), nil)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	models := make([]auditModel, 0, len(res.Node.Nodes))
+	for _, node := range res.Node.Nodes {
+		var am auditModel
+		if err := unmarshal(node.Value, &am); err != nil {
+			log.Errorf("Error unmarshaling audit record %s: %v", path.Base(node.Key), err)
+			continue
+		}
+		models = append(models, am)
+	}
+	return auditRecords(models), nil
+}
+
+func (r *EtcdRegistry) auditRecordPath(seq uint64) string {
+	return r.prefixed(auditPrefix, "records", auditSlot(seq))
+}
+
+// auditSlot is the key of the slot of the ring buffer holding the record
+// with the given sequence number.
+func auditSlot(seq uint64) string {
+	return fmt.Sprintf("%04d", seq%MaxAuditRecords)
+}
+
+// auditRecords returns the records of the given models ordered by their
+// sequence number.
+func auditRecords(models []auditModel) []audit.Record {
+	sort.Sort(auditModelsBySeq(models))
+	records := make([]audit.Record, len(models))
+	for i, am := range models {
+		records[i] = am.Record
+	}
+	return records
+}
+
+type auditModelsBySeq []auditModel
+
+func (s auditModelsBySeq) Len() int           { return len(s) }
+func (s auditModelsBySeq) Less(i, j int) bool { return s[i].Seq < s[j].Seq }
+func (s auditModelsBySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
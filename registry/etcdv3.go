@@ -0,0 +1,232 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+)
+
+// EtcdV3Registry fulfils the Registry and ClusterRegistry interfaces and uses
+// the etcd v3 API as a backend. It stores fleet data under the same keys as
+// EtcdRegistry, attaching expiring keys to leases instead of TTLs.
+type EtcdV3Registry struct {
+	kv        clientv3.KV
+	lease     clientv3.Lease
+	keyPrefix string
+	timeout   time.Duration
+
+	mu *sync.Mutex
+	// leases tracks the lease each expiring key written by this
+	// registry is attached to, so it can be kept alive on rewrite.
+	leases map[string]keyLease
+}
+
+type keyLease struct {
+	id  clientv3.LeaseID
+	ttl int64
+}
+
+func NewEtcdV3Registry(kv clientv3.KV, lease clientv3.Lease, keyPrefix string, timeout time.Duration) *EtcdV3Registry {
+	return &EtcdV3Registry{
+		kv:        kv,
+		lease:     lease,
+		keyPrefix: keyPrefix,
+		timeout:   timeout,
+		mu:        new(sync.Mutex),
+		leases:    make(map[string]keyLease),
+	}
+}
+
+func (r *EtcdV3Registry) prefixed(p ...string) string {
+	return path.Join(r.keyPrefix, path.Join(p...))
+}
+
+// dirPrefixed returns the key prefix shared by all keys below the given
+// path, as etcd v3 has no notion of directories.
+func (r *EtcdV3Registry) dirPrefixed(p ...string) string {
+	return r.prefixed(p...) + "/"
+}
+
+func (r *EtcdV3Registry) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), r.timeout)
+}
+
+func (r *EtcdV3Registry) get(key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+	return r.kv.Get(ctx, key, opts...)
+}
+
+func (r *EtcdV3Registry) put(key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+	return r.kv.Put(ctx, key, val, opts...)
+}
+
+func (r *EtcdV3Registry) delete(key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+	return r.kv.Delete(ctx, key, opts...)
+}
+
+func (r *EtcdV3Registry) txn(cmp []clientv3.Cmp, then []clientv3.Op, els []clientv3.Op) (*clientv3.TxnResponse, error) {
+	ctx, cancel := r.ctx()
+	defer cancel()
+	return r.kv.Txn(ctx).If(cmp...).Then(then...).Else(els...).Commit()
+}
+
+// create stores the value at the given key only if the key does not exist
+// yet. It reports whether the value was stored.
+func (r *EtcdV3Registry) create(key, val string, opts ...clientv3.OpOption) (bool, error) {
+	res, err := r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(key), "=", 0)},
+		[]clientv3.Op{clientv3.OpPut(key, val, opts...)},
+		nil,
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// leaseFor returns a lease to attach the given key to so that it expires
+// after ttl, reusing and refreshing the lease the key was last written with.
+func (r *EtcdV3Registry) leaseFor(key string, ttl time.Duration) (clientv3.LeaseID, error) {
+	secs := ttlSeconds(ttl)
+
+	r.mu.Lock()
+	kl, ok := r.leases[key]
+	r.mu.Unlock()
+
+	ctx, cancel := r.ctx()
+	defer cancel()
+	if ok && kl.ttl == secs {
+		if _, err := r.lease.KeepAliveOnce(ctx, kl.id); err == nil {
+			return kl.id, nil
+		}
+	}
+
+	res, err := r.lease.Grant(ctx, secs)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+
+	r.mu.Lock()
+	r.leases[key] = keyLease{id: res.ID, ttl: secs}
+	r.mu.Unlock()
+	return res.ID, nil
+}
+
+// forgetLease drops the lease of the given key after it has been deleted.
+func (r *EtcdV3Registry) forgetLease(key string) {
+	r.mu.Lock()
+	delete(r.leases, key)
+	r.mu.Unlock()
+}
+
+// forgetLeases drops the leases of the keys starting with the given prefix
+// after they have been deleted.
+func (r *EtcdV3Registry) forgetLeases(prefix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.leases {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.leases, key)
+		}
+	}
+}
+
+// putWithTTL stores the value at the given key so that it expires unless
+// written again within ttl.
+func (r *EtcdV3Registry) putWithTTL(key, val string, ttl time.Duration) (*clientv3.PutResponse, error) {
+	id, err := r.leaseFor(key, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return r.put(key, val, clientv3.WithLease(id))
+}
+
+// ttlSeconds rounds the given TTL up to the whole seconds etcd leases use.
+func ttlSeconds(ttl time.Duration) int64 {
+	secs := int64(ttl / time.Second)
+	if ttl%time.Second != 0 {
+		secs++
+	}
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// getDirs returns the values of all keys below the given path, grouped by
+// the name of their first path element below it, along with the sorted
+// names. The keys within each group are relative to that element.
+func (r *EtcdV3Registry) getDirs(p ...string) (map[string]map[string]string, []string, error) {
+	prefix := r.dirPrefixed(p...)
+	res, err := r.get(prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs := make(map[string]map[string]string)
+	var names []string
+	for _, kv := range res.Kvs {
+		rel := strings.TrimPrefix(string(kv.Key), prefix)
+		parts := strings.SplitN(rel, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		dir, ok := dirs[parts[0]]
+		if !ok {
+			dir = make(map[string]string)
+			dirs[parts[0]] = dir
+			names = append(names, parts[0])
+		}
+		dir[parts[1]] = string(kv.Value)
+	}
+	sort.Strings(names)
+	return dirs, names, nil
+}
+
+// getDir returns the values of all keys below the given path, with keys
+// relative to it. A nil map is returned if there are none.
+func (r *EtcdV3Registry) getDir(p ...string) (map[string]string, error) {
+	prefix := r.dirPrefixed(p...)
+	res, err := r.get(prefix, clientv3.WithPrefix())
+	if err != nil || len(res.Kvs) == 0 {
+		return nil, err
+	}
+
+	dir := make(map[string]string, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		dir[strings.TrimPrefix(string(kv.Key), prefix)] = string(kv.Value)
+	}
+	return dir, nil
+}
+
+func (r *EtcdV3Registry) IsRegistryReady() bool {
+	return true
+}
+
+func (r *EtcdV3Registry) UseEtcdRegistry() bool {
+	return true
+}
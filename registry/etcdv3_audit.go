@@ -0,0 +1,87 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/log"
+)
+
+// AppendAuditRecord implements the audit.Store interface. The sequence
+// number of the ring buffer is incremented in the same transaction as the
+// record is stored.
+func (r *EtcdV3Registry) AppendAuditRecord(rec audit.Record) error {
+	key := r.prefixed(auditPrefix, "next")
+	for i := 0; i < auditAppendAttempts; i++ {
+		res, err := r.get(key)
+		if err != nil {
+			return err
+		}
+
+		var seq uint64
+		cmp := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		if len(res.Kvs) > 0 {
+			seq, err = strconv.ParseUint(string(res.Kvs[0].Value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid audit sequence number: %v", err)
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", res.Kvs[0].ModRevision)
+		}
+
+		val, err := marshal(auditModel{seq, rec})
+		if err != nil {
+			return err
+		}
+		tres, err := r.txn(
+			[]clientv3.Cmp{cmp},
+			[]clientv3.Op{
+				clientv3.OpPut(key, strconv.FormatUint(seq+1, 10)),
+				clientv3.OpPut(r.prefixed(auditPrefix, "records", auditSlot(seq)), val),
+			},
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+		if tres.Succeeded {
+			return nil
+		}
+	}
+	return errAuditAppendRace
+}
+
+// AuditRecords implements the audit.Store interface
+func (r *EtcdV3Registry) AuditRecords() ([]audit.Record, error) {
+	res, err := r.get(r.dirPrefixed(auditPrefix, "records"), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]auditModel, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		var am auditModel
+		if err := unmarshal(string(kv.Value), &am); err != nil {
+			log.Errorf("Error unmarshaling audit record %s: %v", kv.Key, err)
+			continue
+		}
+		models = append(models, am)
+	}
+	return auditRecords(models), nil
+}
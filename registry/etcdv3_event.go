@@ -0,0 +1,199 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/pkg"
+)
+
+type etcdV3EventStream struct {
+	watcher    clientv3.Watcher
+	rootPrefix string
+
+	// key is the prefix of the keys watched, parse picks the events of
+	// interest among their changes and resync is emitted when changes
+	// were missed.
+	key    string
+	opts   []clientv3.OpOption
+	parse  func(e *clientv3.Event, prefix string) (pkg.Event, bool)
+	resync pkg.Event
+
+	mu *sync.Mutex
+	// revs holds, per consumer, the revision of the last event seen, so
+	// that events occurring between two calls to Next are not missed.
+	revs map[chan struct{}]int64
+}
+
+func NewEtcdV3EventStream(watcher clientv3.Watcher, rootPrefix string) pkg.EventStream {
+	return &etcdV3EventStream{
+		watcher:    watcher,
+		rootPrefix: rootPrefix,
+		key:        path.Join(rootPrefix, jobPrefix) + "/",
+		parse: func(e *clientv3.Event, prefix string) (pkg.Event, bool) {
+			return parseV3Key(string(e.Kv.Key), prefix)
+		},
+		resync: JobTargetChangeEvent,
+		mu:     new(sync.Mutex),
+		revs:   make(map[chan struct{}]int64),
+	}
+}
+
+// NewEtcdV3ClusterEventStream returns an EventStream emitting a
+// ClusterChangeEvent whenever a unit, unit state or machine changes.
+func NewEtcdV3ClusterEventStream(watcher clientv3.Watcher, rootPrefix string) pkg.EventStream {
+	return &etcdV3EventStream{
+		watcher:    watcher,
+		rootPrefix: rootPrefix,
+		key:        path.Join(rootPrefix) + "/",
+		opts:       []clientv3.OpOption{clientv3.WithPrevKV()},
+		parse:      parseV3Cluster,
+		resync:     ClusterChangeEvent,
+		mu:         new(sync.Mutex),
+		revs:       make(map[chan struct{}]int64),
+	}
+}
+
+// Next returns a channel which will emit an Event as soon as one of interest occurs
+func (es *etcdV3EventStream) Next(stop chan struct{}) chan pkg.Event {
+	es.mu.Lock()
+	rev, known := es.revs[stop]
+	if !known {
+		es.revs[stop] = 0
+		go func() {
+			<-stop
+			es.mu.Lock()
+			delete(es.revs, stop)
+			es.mu.Unlock()
+		}()
+	}
+	es.mu.Unlock()
+
+	evchan := make(chan pkg.Event)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			ev, next, ok := es.watch(rev, stop)
+			if next > rev {
+				rev = next
+				es.mu.Lock()
+				if _, known := es.revs[stop]; known {
+					es.revs[stop] = rev
+				}
+				es.mu.Unlock()
+			}
+			if ok {
+				select {
+				case evchan <- ev:
+				case <-stop:
+				}
+				return
+			}
+
+			// Let's not slam the etcd server in the event that we know
+			// an unexpected error occurred.
+			time.Sleep(time.Second)
+		}
+	}()
+
+	return evchan
+}
+
+// watch waits for an event of interest on the watched keys after the given
+// revision, or from now on if it is 0. It returns the event, if any, and
+// the revision up to which events were seen.
+func (es *etcdV3EventStream) watch(rev int64, stop chan struct{}) (ev pkg.Event, seen int64, ok bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	key := es.key
+	opts := append([]clientv3.OpOption{clientv3.WithPrefix()}, es.opts...)
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	log.Debugf("Creating etcd watcher: %s", key)
+
+	for res := range es.watcher.Watch(ctx, key, opts...) {
+		if res.CompactRevision > 0 {
+			// Events were compacted away, so whatever changed in
+			// the meantime must be reconciled.
+			log.Errorf("etcd watcher %v missed events compacted up to revision %d", key, res.CompactRevision)
+			return es.resync, res.CompactRevision - 1, true
+		}
+		if err := res.Err(); err != nil {
+			log.Errorf("etcd watcher %v returned error: %v", key, err)
+			return
+		}
+
+		seen = res.Header.Revision
+		for _, e := range res.Events {
+			if ev, ok = es.parse(e, es.rootPrefix); ok {
+				return
+			}
+		}
+	}
+	return
+}
+
+func parseV3Key(key, prefix string) (ev pkg.Event, ok bool) {
+	if !strings.HasPrefix(key, path.Join(prefix, jobPrefix)+"/") {
+		return
+	}
+
+	switch path.Base(key) {
+	case "target-state":
+		ev = JobTargetStateChangeEvent
+		ok = true
+	case "target":
+		ev = JobTargetChangeEvent
+		ok = true
+	}
+
+	return
+}
+
+// parseV3Cluster returns a ClusterChangeEvent if the given event changes a
+// unit, unit state or machine. Puts leaving the value of a key as it was,
+// like those attaching it to a new lease, change nothing.
+func parseV3Cluster(e *clientv3.Event, prefix string) (ev pkg.Event, ok bool) {
+	if !isClusterKey(string(e.Kv.Key), prefix) {
+		return
+	}
+	if e.Type == clientv3.EventTypePut && e.PrevKv != nil && bytes.Equal(e.PrevKv.Value, e.Kv.Value) {
+		return
+	}
+	return ClusterChangeEvent, true
+}
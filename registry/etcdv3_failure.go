@@ -0,0 +1,83 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+)
+
+// RecordUnitFailure counts a failure of the named Unit on the given
+// machine. The failures are stored alongside the Job, so they are
+// forgotten when the Unit is destroyed.
+func (r *EtcdV3Registry) RecordUnitFailure(name, machID string) error {
+	key := r.prefixed(jobPrefix, name, "failures")
+	for i := 0; i < failureRecordAttempts; i++ {
+		res, err := r.get(key)
+		if err != nil {
+			return err
+		}
+
+		var fm failuresModel
+		cmp := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		if len(res.Kvs) > 0 {
+			if err := unmarshal(string(res.Kvs[0].Value), &fm); err != nil {
+				return err
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", res.Kvs[0].ModRevision)
+		}
+
+		val, err := fm.addFailure(machID)
+		if err != nil {
+			return err
+		}
+		tres, err := r.txn([]clientv3.Cmp{cmp}, []clientv3.Op{clientv3.OpPut(key, val)}, nil)
+		if err != nil {
+			return err
+		}
+		if tres.Succeeded {
+			return nil
+		}
+	}
+	return fmt.Errorf("failures of Unit(%s) were recorded concurrently", name)
+}
+
+// UnitFailures returns the recorded failures of all Units that ever failed,
+// indexed by name
+func (r *EtcdV3Registry) UnitFailures() (map[string]job.UnitFailures, error) {
+	dirs, names, err := r.getDirs(jobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make(map[string]job.UnitFailures)
+	for _, name := range names {
+		val, ok := dirs[name]["failures"]
+		if !ok {
+			continue
+		}
+		var fm failuresModel
+		if err := unmarshal(val, &fm); err != nil {
+			log.Errorf("Error unmarshaling failures of Job(%s): %v", name, err)
+			continue
+		}
+		failures[name] = fm.unitFailures()
+	}
+	return failures, nil
+}
@@ -0,0 +1,450 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/metrics"
+	"github.com/coreos/fleet/unit"
+)
+
+// Schedule returns all ScheduledUnits known by fleet, ordered by name
+func (r *EtcdV3Registry) Schedule() ([]job.ScheduledUnit, error) {
+	dirs, names, err := r.getDirs(jobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := r.statesByMUSKey()
+	if err != nil {
+		return nil, err
+	}
+
+	units := make([]job.ScheduledUnit, 0, len(names))
+	for _, name := range names {
+		dir := dirs[name]
+		su := job.ScheduledUnit{
+			Name:            name,
+			TargetMachineID: dir["target"],
+		}
+		us := states[MUSKey{MachID: su.TargetMachineID, Name: name}]
+		js := determineJobState(dir["job-state"], su.TargetMachineID, us)
+		su.State = &js
+		units = append(units, su)
+	}
+	return units, nil
+}
+
+// Units lists all Units stored in the Registry, ordered by name. This includes both global and non-global units.
+func (r *EtcdV3Registry) Units() ([]job.Unit, error) {
+	dirs, names, err := r.getDirs(jobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch all units at once to avoid sending N requests to etcd.
+	hashToUnit, err := r.getAllUnitsHashMap()
+	if err != nil {
+		log.Errorf("failed fetching all Units from etcd: %v", err)
+		return nil, err
+	}
+	unitHashLookupFunc := func(hash unit.Hash) *unit.UnitFile {
+		stringHash := hash.String()
+		unit, ok := hashToUnit[stringHash]
+		if !ok {
+			log.Errorf("did not find Unit %v in list of all units", stringHash)
+			return nil
+		}
+		return unit
+	}
+
+	units := make([]job.Unit, 0)
+	for _, name := range names {
+		u, err := dirValuesToUnit(name, dirs[name], unitHashLookupFunc)
+		if err != nil {
+			log.Errorf("Failed to parse Unit from etcd: %v", err)
+			continue
+		}
+		if u == nil {
+			continue
+		}
+
+		units = append(units, *u)
+	}
+
+	return units, nil
+}
+
+// Unit retrieves the Unit by the given name from the Registry. Returns nil if
+// no such Unit exists, and any error encountered.
+func (r *EtcdV3Registry) Unit(name string) (*job.Unit, error) {
+	dir, err := r.getDir(jobPrefix, name)
+	if err != nil || dir == nil {
+		return nil, err
+	}
+
+	return dirValuesToUnit(name, dir, r.getUnitByHash)
+}
+
+// dirValuesToUnit takes the values of the keys making up a Job and returns
+// a *job.Unit, or any error encountered
+func dirValuesToUnit(name string, dir map[string]string, unitHashLookupFunc func(unit.Hash) *unit.UnitFile) (*job.Unit, error) {
+	obj, ok := dir["object"]
+	if !ok {
+		return nil, nil
+	}
+
+	var jm jobModel
+	if err := unmarshal(obj, &jm); err != nil {
+		return nil, err
+	}
+	uf := unitHashLookupFunc(jm.UnitHash)
+	if uf == nil {
+		log.Warningf("No Unit found in Registry for Job(%s)", jm.Name)
+		return nil, fmt.Errorf("unable to parse Unit in Registry for Job(%s)", name)
+	}
+
+	u := &job.Unit{
+		Name: jm.Name,
+		Unit: *uf,
+	}
+	if tgtstate := dir["target-state"]; tgtstate != "" {
+		ts, err := job.ParseJobState(tgtstate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Unit(%s) target-state: %v", u.Name, err)
+		}
+		u.TargetState = ts
+	}
+
+	return u, nil
+}
+
+// ScheduledUnit retrieves the ScheduledUnit by the given name from the Registry.
+// Returns nil if no such ScheduledUnit exists, and any error encountered.
+func (r *EtcdV3Registry) ScheduledUnit(name string) (*job.ScheduledUnit, error) {
+	dir, err := r.getDir(jobPrefix, name)
+	if err != nil || dir == nil {
+		return nil, err
+	}
+
+	su := job.ScheduledUnit{
+		Name:            name,
+		TargetMachineID: dir["target"],
+	}
+
+	var us *unit.UnitState
+	if len(su.TargetMachineID) > 0 {
+		us, err = r.getUnitState(name, su.TargetMachineID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	js := determineJobState(dir["job-state"], su.TargetMachineID, us)
+	su.State = &js
+
+	return &su, nil
+}
+
+// DestroyUnit removes a Job object from the repository. It does not yet remove underlying
+// UnitFiles from the repository.
+func (r *EtcdV3Registry) DestroyUnit(name string) error {
+	prefix := r.dirPrefixed(jobPrefix, name)
+	res, err := r.delete(prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	r.forgetLeases(prefix)
+	if res.Deleted == 0 {
+		return errors.New("job does not exist")
+	}
+	return nil
+}
+
+// CreateUnit attempts to store a Unit and its associated unit file in the registry
+func (r *EtcdV3Registry) CreateUnit(u *job.Unit) error {
+	if err := r.storeOrGetUnitFile(u.Unit); err != nil {
+		return err
+	}
+
+	jm := jobModel{
+		Name:     u.Name,
+		UnitHash: u.Unit.Hash(),
+	}
+	val, err := marshal(jm)
+	if err != nil {
+		return err
+	}
+
+	// Since we support replacing units, overwrite any previous job
+	// object, which allows us to update it with a new unit.
+	if _, err := r.put(r.prefixed(jobPrefix, u.Name, "object"), val); err != nil {
+		return err
+	}
+
+	return r.SetUnitTargetState(u.Name, u.TargetState)
+}
+
+// UpdateUnit swaps the unit file of an existing Unit for the one given,
+// leaving its schedule and target state untouched. The job object is
+// compare-and-swapped, so concurrent updates of the same Unit fail rather
+// than silently overwrite each other.
+func (r *EtcdV3Registry) UpdateUnit(u *job.Unit) error {
+	key := r.prefixed(jobPrefix, u.Name, "object")
+	res, err := r.get(key)
+	if err != nil {
+		return err
+	}
+	if len(res.Kvs) == 0 {
+		return errors.New("job does not exist")
+	}
+
+	if err := r.storeOrGetUnitFile(u.Unit); err != nil {
+		return err
+	}
+
+	jm := jobModel{
+		Name:     u.Name,
+		UnitHash: u.Unit.Hash(),
+	}
+	val, err := marshal(jm)
+	if err != nil {
+		return err
+	}
+
+	tres, err := r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.ModRevision(key), "=", res.Kvs[0].ModRevision)},
+		[]clientv3.Op{clientv3.OpPut(key, val)},
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	if !tres.Succeeded {
+		return fmt.Errorf("Unit(%s) was modified concurrently", u.Name)
+	}
+	return nil
+}
+
+func (r *EtcdV3Registry) SetUnitTargetState(name string, state job.JobState) error {
+	_, err := r.put(r.prefixed(jobPrefix, name, "target-state"), string(state))
+	return err
+}
+
+func (r *EtcdV3Registry) ScheduleUnit(name string, machID string) error {
+	ok, err := r.create(r.prefixed(jobPrefix, name, "target"), machID)
+	if err == nil && !ok {
+		err = fmt.Errorf("Unit(%s) is already scheduled", name)
+	}
+	return err
+}
+
+func (r *EtcdV3Registry) UnscheduleUnit(name, machID string) error {
+	key := r.prefixed(jobPrefix, name, "target")
+	res, err := r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.Value(key), "=", machID)},
+		[]clientv3.Op{clientv3.OpDelete(key)},
+		[]clientv3.Op{clientv3.OpGet(key)},
+	)
+	if err != nil {
+		return err
+	}
+	if !res.Succeeded && len(res.Responses[0].GetResponseRange().Kvs) > 0 {
+		return fmt.Errorf("Unit(%s) is not scheduled to Machine(%s)", name, machID)
+	}
+	return nil
+}
+
+func (r *EtcdV3Registry) UnitHeartbeat(name, machID string, ttl time.Duration) error {
+	_, err := r.putWithTTL(r.prefixed(jobPrefix, name, "job-state"), machID, ttl)
+	return err
+}
+
+func (r *EtcdV3Registry) ClearUnitHeartbeat(name string) {
+	key := r.prefixed(jobPrefix, name, "job-state")
+	r.delete(key)
+	r.forgetLease(key)
+}
+
+func (r *EtcdV3Registry) storeOrGetUnitFile(u unit.UnitFile) error {
+	um := unitModel{
+		Raw: u.String(),
+	}
+
+	val, err := marshal(um)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	// an existing unit file is identical, as it is stored by hash
+	_, err = r.create(r.prefixed(unitPrefix, u.Hash().String()), val)
+	if err != nil {
+		metrics.ReportRegistryOpFailure(metrics.Set)
+		return err
+	}
+	metrics.ReportRegistryOpSuccess(metrics.Set, start)
+	return nil
+}
+
+// getUnitByHash retrieves from the Registry the Unit associated with the given Hash
+func (r *EtcdV3Registry) getUnitByHash(hash unit.Hash) *unit.UnitFile {
+	start := time.Now()
+	res, err := r.get(r.prefixed(unitPrefix, hash.String()))
+	if err != nil {
+		metrics.ReportRegistryOpFailure(metrics.Get)
+		return nil
+	}
+	metrics.ReportRegistryOpSuccess(metrics.Get, start)
+	if len(res.Kvs) == 0 {
+		return nil
+	}
+	return unitFromModelValue(hash, string(res.Kvs[0].Value))
+}
+
+// getAllUnitsHashMap retrieves from the Registry all Units and returns a map of hash to UnitFile
+func (r *EtcdV3Registry) getAllUnitsHashMap() (map[string]*unit.UnitFile, error) {
+	prefix := r.dirPrefixed(unitPrefix)
+	start := time.Now()
+	res, err := r.get(prefix, clientv3.WithPrefix())
+	if err != nil {
+		metrics.ReportRegistryOpFailure(metrics.GetAll)
+		return nil, err
+	}
+	metrics.ReportRegistryOpSuccess(metrics.GetAll, start)
+
+	hashToUnit := map[string]*unit.UnitFile{}
+	for _, kv := range res.Kvs {
+		stringHash := string(kv.Key[len(prefix):])
+		hash, err := unit.HashFromHexString(stringHash)
+		if err != nil {
+			log.Errorf("failed to get Hash for key '%s' with stringHash '%v': %v", kv.Key, stringHash, err)
+			continue
+		}
+		unit := unitFromModelValue(hash, string(kv.Value))
+		if unit == nil {
+			continue
+		}
+		hashToUnit[stringHash] = unit
+	}
+
+	return hashToUnit, nil
+}
+
+// SaveUnitRevision records the given unit file as the newest revision of
+// the named Unit, unless it already is. The revision number and creation
+// time are assigned by the Registry.
+func (r *EtcdV3Registry) SaveUnitRevision(name string, rev job.UnitRevision) error {
+	models, err := r.revisionModels(name)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(models) > 0 {
+		last := models[len(models)-1]
+		if last.UnitHash == rev.Unit.Hash() {
+			return nil
+		}
+		next = last.Revision + 1
+	}
+
+	if err := r.storeOrGetUnitFile(rev.Unit); err != nil {
+		return err
+	}
+
+	rm := revisionModel{
+		Revision: next,
+		UnitHash: rev.Unit.Hash(),
+		Created:  time.Now().UTC(),
+		User:     rev.User,
+	}
+	val, err := marshal(rm)
+	if err != nil {
+		return err
+	}
+
+	ok, err := r.create(r.revisionPath(name, next), val)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("revision %d of Unit(%s) was saved concurrently", next, name)
+	}
+
+	for i := 0; i < len(models)+1-MaxUnitRevisions; i++ {
+		if _, err := r.delete(r.revisionPath(name, models[i].Revision)); err != nil {
+			log.Warningf("Failed pruning revision %d of Unit(%s): %v", models[i].Revision, name, err)
+		}
+	}
+
+	return nil
+}
+
+// UnitRevisions returns the known revisions of the named Unit, oldest
+// first. Revisions whose unit file cannot be found are skipped.
+func (r *EtcdV3Registry) UnitRevisions(name string) ([]job.UnitRevision, error) {
+	models, err := r.revisionModels(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]job.UnitRevision, 0, len(models))
+	for _, rm := range models {
+		uf := r.getUnitByHash(rm.UnitHash)
+		if uf == nil {
+			log.Warningf("No Unit found in Registry for revision %d of Unit(%s)", rm.Revision, name)
+			continue
+		}
+		revs = append(revs, job.UnitRevision{
+			Revision: rm.Revision,
+			Unit:     *uf,
+			Created:  rm.Created,
+			User:     rm.User,
+		})
+	}
+
+	return revs, nil
+}
+
+func (r *EtcdV3Registry) revisionModels(name string) ([]revisionModel, error) {
+	res, err := r.get(r.dirPrefixed(revisionPrefix, name), clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]revisionModel, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		var rm revisionModel
+		if err := unmarshal(string(kv.Value), &rm); err != nil {
+			log.Errorf("Error unmarshaling revision %s: %v", kv.Key, err)
+			continue
+		}
+		models = append(models, rm)
+	}
+
+	return models, nil
+}
+
+func (r *EtcdV3Registry) revisionPath(name string, rev int) string {
+	return r.prefixed(revisionPrefix, name, fmt.Sprintf("%010d", rev))
+}
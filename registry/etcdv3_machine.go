@@ -0,0 +1,247 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/coreos/fleet/machine"
+)
+
+func (r *EtcdV3Registry) Machines() (machines []machine.MachineState, err error) {
+	dirs, names, err := r.getDirs(machinePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		var mach machine.MachineState
+		mach, err = machineStateFromValues(dirs[name])
+		if err != nil {
+			return
+		}
+
+		if mach.ID != "" {
+			machines = append(machines, mach)
+		}
+	}
+
+	return
+}
+
+func (r *EtcdV3Registry) CreateMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error) {
+	val, err := marshal(ms)
+	if err != nil {
+		return uint64(0), err
+	}
+
+	key := r.prefixed(machinePrefix, ms.ID, "object")
+	id, err := r.leaseFor(key, ttl)
+	if err != nil {
+		return uint64(0), err
+	}
+	res, err := r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(key), "=", 0)},
+		[]clientv3.Op{clientv3.OpPut(key, val, clientv3.WithLease(id))},
+		nil,
+	)
+	if err != nil {
+		return uint64(0), err
+	}
+	if !res.Succeeded {
+		return uint64(0), fmt.Errorf("Machine(%s) state already exists", ms.ID)
+	}
+
+	return uint64(res.Header.Revision), nil
+}
+
+func (r *EtcdV3Registry) SetMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error) {
+	val, err := marshal(ms)
+	if err != nil {
+		return uint64(0), err
+	}
+
+	res, err := r.putWithTTL(r.prefixed(machinePrefix, ms.ID, "object"), val, ttl)
+	if err != nil {
+		return uint64(0), err
+	}
+
+	return uint64(res.Header.Revision), nil
+}
+
+func (r *EtcdV3Registry) MachineState(machID string) (machine.MachineState, error) {
+	dir, err := r.getDir(machinePrefix, machID)
+	if err != nil {
+		return machine.MachineState{}, err
+	}
+	if dir == nil {
+		return machine.MachineState{}, fmt.Errorf("Machine(%s) does not exist", machID)
+	}
+
+	return machineStateFromValues(dir)
+}
+
+func (r *EtcdV3Registry) SetMachineMetadata(machID string, key string, value string) error {
+	_, err := r.put(r.prefixed(machinePrefix, machID, "metadata", key), value)
+	return err
+}
+
+func (r *EtcdV3Registry) DeleteMachineMetadata(machID string, key string) error {
+	// Deleting a key sets its value to "" to allow for intelligent merging
+	// between the machine-defined metadata and the dynamic metadata.
+	// See mergeMetadata for more detail.
+	return r.SetMachineMetadata(machID, key, "")
+}
+
+// CordonMachine prevents new units from being scheduled to the machine.
+func (r *EtcdV3Registry) CordonMachine(machID string) error {
+	_, err := r.put(r.prefixed(machinePrefix, machID, "cordoned"), "true")
+	return err
+}
+
+// UncordonMachine allows new units to be scheduled to the machine again.
+func (r *EtcdV3Registry) UncordonMachine(machID string) error {
+	_, err := r.delete(r.prefixed(machinePrefix, machID, "cordoned"))
+	return err
+}
+
+func (r *EtcdV3Registry) RemoveMachineState(machID string) error {
+	key := r.prefixed(machinePrefix, machID, "object")
+	_, err := r.delete(key)
+	r.forgetLease(key)
+	return err
+}
+
+// machineStateFromValues reads machine state from the values of the keys
+// below a machine, relative to it
+func machineStateFromValues(dir map[string]string) (mach machine.MachineState, err error) {
+	var metadata map[string]string
+	cordoned := false
+
+	for key, val := range dir {
+		switch {
+		case key == "object":
+			if err = unmarshal(val, &mach); err != nil {
+				return
+			}
+		case strings.HasPrefix(key, "metadata/"):
+			// Load metadata into a separate map to avoid stepping on it when deserializing the object key
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[strings.TrimPrefix(key, "metadata/")] = val
+		case key == "cordoned":
+			cordoned = true
+		}
+	}
+
+	mach.Metadata = mergeMetadata(mach.Metadata, metadata)
+	mach.Cordoned = cordoned
+	return
+}
+
+// LatestDaemonVersion attempts to retrieve the latest version of fleetd
+// that has been registered in the Registry. It returns the version if
+// it can be determined (or nil otherwise), and any error encountered.
+func (r *EtcdV3Registry) LatestDaemonVersion() (*semver.Version, error) {
+	machs, err := r.Machines()
+	if err != nil {
+		return nil, err
+	}
+	var lv *semver.Version
+	for _, m := range machs {
+		v, err := semver.NewVersion(m.Version)
+		if err != nil {
+			continue
+		} else if lv == nil || lv.LessThan(*v) {
+			lv = v
+		}
+	}
+	return lv, nil
+}
+
+// EngineVersion implements the ClusterRegistry interface
+func (r *EtcdV3Registry) EngineVersion() (int, error) {
+	res, err := r.get(r.prefixed("/engine/version"))
+	// no version is no big deal, either the cluster is new or is
+	// just upgrading from old unversioned code
+	if err != nil || len(res.Kvs) == 0 {
+		return 0, err
+	}
+
+	return strconv.Atoi(string(res.Kvs[0].Value))
+}
+
+// UpdateEngineVersion implements the ClusterRegistry interface
+func (r *EtcdV3Registry) UpdateEngineVersion(from, to int) error {
+	key := r.prefixed("/engine/version")
+	strTo := strconv.Itoa(to)
+
+	res, err := r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.Value(key), "=", strconv.Itoa(from))},
+		[]clientv3.Op{clientv3.OpPut(key, strTo)},
+		[]clientv3.Op{clientv3.OpGet(key)},
+	)
+	if err != nil {
+		return err
+	}
+	if res.Succeeded {
+		return nil
+	}
+	if len(res.Responses[0].GetResponseRange().Kvs) > 0 {
+		return fmt.Errorf("engine version is no longer %d", from)
+	}
+
+	ok, err := r.create(key, strTo)
+	if err == nil && !ok {
+		err = errors.New("engine version was set concurrently")
+	}
+	return err
+}
+
+// RequestRebalance implements the ClusterRegistry interface
+func (r *EtcdV3Registry) RequestRebalance() error {
+	_, err := r.put(r.prefixed("/engine/rebalance"), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// TakeRebalanceRequest implements the ClusterRegistry interface. As it is
+// called in every reconciliation round, the request is only deleted if it
+// exists, and only if it was not renewed in the meantime; a renewed request
+// is taken in a later round.
+func (r *EtcdV3Registry) TakeRebalanceRequest() (bool, error) {
+	key := r.prefixed("/engine/rebalance")
+	res, err := r.get(key)
+	if err != nil || len(res.Kvs) == 0 {
+		return false, err
+	}
+
+	_, err = r.txn(
+		[]clientv3.Cmp{clientv3.Compare(clientv3.ModRevision(key), "=", res.Kvs[0].ModRevision)},
+		[]clientv3.Op{clientv3.OpDelete(key)},
+		nil,
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+)
+
+// MigrateEtcdV2ToV3 copies the fleet data found under keyPrefix in the etcd
+// v2 keyspace to the same keys in the etcd v3 keyspace. Keys with a TTL, such
+// as machine states and leases, are recreated by running fleetd instances and
+// are not copied. Keys that already exist in the v3 keyspace are left alone,
+// so the migration can safely be repeated. It returns the number of keys
+// copied and the number of keys skipped because they already existed.
+func MigrateEtcdV2ToV3(kAPI etcd.KeysAPI, kv clientv3.KV, keyPrefix string, timeout time.Duration) (copied, existing int, err error) {
+	opts := &etcd.GetOptions{
+		Recursive: true,
+		Sort:      true,
+	}
+	res, err := kAPI.Get(context.Background(), keyPrefix, opts)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	var walk func(node *etcd.Node) error
+	walk = func(node *etcd.Node) error {
+		if node.Dir {
+			for _, child := range node.Nodes {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if node.Expiration != nil {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		res, err := kv.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(node.Key), "=", 0)).
+			Then(clientv3.OpPut(node.Key, node.Value)).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if res.Succeeded {
+			copied++
+		} else {
+			existing++
+		}
+		return nil
+	}
+
+	err = walk(res.Node)
+	return
+}
@@ -0,0 +1,657 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/coreos/fleet/audit"
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/registry/local"
+	"github.com/coreos/fleet/unit"
+)
+
+// testEtcdV3 is an in-memory stand-in for the etcd v3 KV and lease services.
+type testEtcdV3 struct {
+	mu     sync.Mutex
+	rev    int64
+	kvs    map[string]*mvccpb.KeyValue
+	leases map[clientv3.LeaseID]int64
+	grants int
+}
+
+func newTestEtcdV3() *testEtcdV3 {
+	return &testEtcdV3{
+		rev:    1,
+		kvs:    make(map[string]*mvccpb.KeyValue),
+		leases: make(map[clientv3.LeaseID]int64),
+	}
+}
+
+func (e *testEtcdV3) registry() *EtcdV3Registry {
+	return NewEtcdV3Registry(clientv3.NewKVFromKVClient(e), e, "/fleet/", time.Second)
+}
+
+func (e *testEtcdV3) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: e.rev}
+}
+
+func (e *testEtcdV3) keys(key, end []byte) []string {
+	var keys []string
+	for k := range e.kvs {
+		if len(end) == 0 && k == string(key) ||
+			len(end) > 0 && k >= string(key) && k < string(end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *testEtcdV3) rangeKeys(in *pb.RangeRequest) *pb.RangeResponse {
+	res := &pb.RangeResponse{Header: e.header()}
+	for _, k := range e.keys(in.Key, in.RangeEnd) {
+		res.Kvs = append(res.Kvs, e.kvs[k])
+	}
+	res.Count = int64(len(res.Kvs))
+	return res
+}
+
+func (e *testEtcdV3) put(in *pb.PutRequest) *pb.PutResponse {
+	kv := &mvccpb.KeyValue{
+		Key:            in.Key,
+		Value:          in.Value,
+		CreateRevision: e.rev,
+		ModRevision:    e.rev,
+		Version:        1,
+		Lease:          in.Lease,
+	}
+	if prev, ok := e.kvs[string(in.Key)]; ok {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+	e.kvs[string(in.Key)] = kv
+	return &pb.PutResponse{Header: e.header()}
+}
+
+func (e *testEtcdV3) deleteRange(in *pb.DeleteRangeRequest) *pb.DeleteRangeResponse {
+	keys := e.keys(in.Key, in.RangeEnd)
+	for _, k := range keys {
+		delete(e.kvs, k)
+	}
+	return &pb.DeleteRangeResponse{Header: e.header(), Deleted: int64(len(keys))}
+}
+
+func (e *testEtcdV3) compare(c *pb.Compare) bool {
+	kv, ok := e.kvs[string(c.Key)]
+	if !ok {
+		kv = &mvccpb.KeyValue{}
+	}
+
+	var res int
+	switch t := c.TargetUnion.(type) {
+	case *pb.Compare_Version:
+		res = compareInt64(kv.Version, t.Version)
+	case *pb.Compare_CreateRevision:
+		res = compareInt64(kv.CreateRevision, t.CreateRevision)
+	case *pb.Compare_ModRevision:
+		res = compareInt64(kv.ModRevision, t.ModRevision)
+	case *pb.Compare_Value:
+		if !ok {
+			return false
+		}
+		res = bytes.Compare(kv.Value, t.Value)
+	}
+
+	switch c.Result {
+	case pb.Compare_GREATER:
+		return res > 0
+	case pb.Compare_LESS:
+		return res < 0
+	default:
+		return res == 0
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (e *testEtcdV3) Range(_ context.Context, in *pb.RangeRequest, _ ...grpc.CallOption) (*pb.RangeResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rangeKeys(in), nil
+}
+
+func (e *testEtcdV3) Put(_ context.Context, in *pb.PutRequest, _ ...grpc.CallOption) (*pb.PutResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rev++
+	return e.put(in), nil
+}
+
+func (e *testEtcdV3) DeleteRange(_ context.Context, in *pb.DeleteRangeRequest, _ ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rev++
+	return e.deleteRange(in), nil
+}
+
+func (e *testEtcdV3) Txn(_ context.Context, in *pb.TxnRequest, _ ...grpc.CallOption) (*pb.TxnResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := &pb.TxnResponse{Succeeded: true}
+	for _, c := range in.Compare {
+		if !e.compare(c) {
+			res.Succeeded = false
+			break
+		}
+	}
+	ops := in.Success
+	if !res.Succeeded {
+		ops = in.Failure
+	}
+
+	e.rev++
+	for _, op := range ops {
+		switch r := op.Request.(type) {
+		case *pb.RequestOp_RequestRange:
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseRange{ResponseRange: e.rangeKeys(r.RequestRange)},
+			})
+		case *pb.RequestOp_RequestPut:
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponsePut{ResponsePut: e.put(r.RequestPut)},
+			})
+		case *pb.RequestOp_RequestDeleteRange:
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: e.deleteRange(r.RequestDeleteRange)},
+			})
+		}
+	}
+	res.Header = e.header()
+	return res, nil
+}
+
+func (e *testEtcdV3) Compact(_ context.Context, _ *pb.CompactionRequest, _ ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (e *testEtcdV3) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.grants++
+	id := clientv3.LeaseID(e.grants)
+	e.leases[id] = ttl
+	return &clientv3.LeaseGrantResponse{ResponseHeader: e.header(), ID: id, TTL: ttl}, nil
+}
+
+// Revoke behaves like the expiry of a lease, deleting the keys attached to it.
+func (e *testEtcdV3) Revoke(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.leases, id)
+	for k, kv := range e.kvs {
+		if clientv3.LeaseID(kv.Lease) == id {
+			delete(e.kvs, k)
+		}
+	}
+	return &clientv3.LeaseRevokeResponse{Header: e.header()}, nil
+}
+
+func (e *testEtcdV3) TimeToLive(_ context.Context, id clientv3.LeaseID, _ ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ttl, ok := e.leases[id]
+	if !ok {
+		ttl = -1
+	}
+	return &clientv3.LeaseTimeToLiveResponse{ResponseHeader: e.header(), ID: id, TTL: ttl, GrantedTTL: ttl}, nil
+}
+
+func (e *testEtcdV3) KeepAlive(_ context.Context, _ clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (e *testEtcdV3) KeepAliveOnce(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ttl, ok := e.leases[id]
+	if !ok {
+		return nil, errors.New("requested lease not found")
+	}
+	return &clientv3.LeaseKeepAliveResponse{ResponseHeader: e.header(), ID: id, TTL: ttl}, nil
+}
+
+func (e *testEtcdV3) Close() error {
+	return nil
+}
+
+func TestEtcdV3RegistryUnits(t *testing.T) {
+	r := newTestEtcdV3().registry()
+
+	uf, err := unit.NewUnitFile("[Service]\nExecStart=/bin/true\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u := &job.Unit{Name: "foo.service", Unit: *uf, TargetState: job.JobStateLoaded}
+
+	if err := r.CreateUnit(u); err != nil {
+		t.Fatalf("CreateUnit failed: %v", err)
+	}
+	// units can be replaced
+	if err := r.CreateUnit(u); err != nil {
+		t.Fatalf("CreateUnit of an existing unit failed: %v", err)
+	}
+
+	got, err := r.Unit("foo.service")
+	if err != nil || got == nil {
+		t.Fatalf("Unit returned %v, %v", got, err)
+	}
+	if !reflect.DeepEqual(*u, *got) {
+		t.Errorf("Unit returned %#v, want %#v", *got, *u)
+	}
+	if got, err := r.Unit("bar.service"); got != nil || err != nil {
+		t.Errorf("Unit of a missing unit returned %v, %v", got, err)
+	}
+
+	if err := r.SetUnitTargetState("foo.service", job.JobStateLaunched); err != nil {
+		t.Fatalf("SetUnitTargetState failed: %v", err)
+	}
+	units, err := r.Units()
+	if err != nil {
+		t.Fatalf("Units failed: %v", err)
+	}
+	if len(units) != 1 || units[0].TargetState != job.JobStateLaunched {
+		t.Errorf("Units returned %#v", units)
+	}
+
+	if err := r.ScheduleUnit("foo.service", "XXX"); err != nil {
+		t.Fatalf("ScheduleUnit failed: %v", err)
+	}
+	if err := r.ScheduleUnit("foo.service", "YYY"); err == nil {
+		t.Errorf("ScheduleUnit of a scheduled unit succeeded")
+	}
+	su, err := r.ScheduledUnit("foo.service")
+	if err != nil || su == nil || su.TargetMachineID != "XXX" {
+		t.Errorf("ScheduledUnit returned %#v, %v", su, err)
+	}
+
+	if err := r.UnscheduleUnit("foo.service", "YYY"); err == nil {
+		t.Errorf("UnscheduleUnit from another machine succeeded")
+	}
+	if su, _ := r.ScheduledUnit("foo.service"); su == nil || su.TargetMachineID != "XXX" {
+		t.Errorf("UnscheduleUnit from another machine changed the schedule: %#v", su)
+	}
+	if err := r.UnscheduleUnit("foo.service", "XXX"); err != nil {
+		t.Fatalf("UnscheduleUnit failed: %v", err)
+	}
+	if su, _ := r.ScheduledUnit("foo.service"); su == nil || su.TargetMachineID != "" {
+		t.Errorf("UnscheduleUnit left the unit scheduled: %#v", su)
+	}
+
+	if err := r.DestroyUnit("foo.service"); err != nil {
+		t.Fatalf("DestroyUnit failed: %v", err)
+	}
+	if err := r.DestroyUnit("foo.service"); err == nil {
+		t.Errorf("DestroyUnit of a missing unit succeeded")
+	}
+	if units, _ := r.Units(); len(units) != 0 {
+		t.Errorf("Units returned %#v after DestroyUnit", units)
+	}
+}
+
+func TestEtcdV3RegistryMachines(t *testing.T) {
+	e := newTestEtcdV3()
+	r := e.registry()
+
+	ms := machine.MachineState{ID: "XXX", PublicIP: "10.0.0.1", Metadata: map[string]string{}}
+	if _, err := r.CreateMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("CreateMachineState failed: %v", err)
+	}
+	if _, err := r.CreateMachineState(ms, 30*time.Second); err == nil {
+		t.Errorf("CreateMachineState of an existing machine succeeded")
+	}
+
+	ms.PublicIP = "10.0.0.2"
+	if _, err := r.SetMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("SetMachineState failed: %v", err)
+	}
+	if e.grants != 1 {
+		t.Errorf("SetMachineState granted %d leases, want the existing one to be reused", e.grants)
+	}
+
+	machines, err := r.Machines()
+	if err != nil {
+		t.Fatalf("Machines failed: %v", err)
+	}
+	if len(machines) != 1 || machines[0].ID != "XXX" || machines[0].PublicIP != "10.0.0.2" {
+		t.Errorf("Machines returned %#v", machines)
+	}
+
+	// an expired lease takes the machine state with it
+	e.Revoke(context.Background(), 1)
+	if machines, _ := r.Machines(); len(machines) != 0 {
+		t.Errorf("Machines returned %#v after the lease expired", machines)
+	}
+	if _, err := r.SetMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("SetMachineState failed: %v", err)
+	}
+	if machines, _ := r.Machines(); len(machines) != 1 {
+		t.Errorf("Machines returned %#v, want the machine state to be restored", machines)
+	}
+}
+
+func TestEtcdV3RegistryTakeRebalanceRequest(t *testing.T) {
+	e := newTestEtcdV3()
+	r := e.registry()
+
+	// taking no request writes nothing
+	if requested, err := r.TakeRebalanceRequest(); err != nil || requested {
+		t.Fatalf("TakeRebalanceRequest returned %t, %v without a request", requested, err)
+	}
+	if e.rev != 1 {
+		t.Errorf("TakeRebalanceRequest wrote to etcd without a request")
+	}
+
+	if err := r.RequestRebalance(); err != nil {
+		t.Fatalf("RequestRebalance failed: %v", err)
+	}
+	if requested, err := r.TakeRebalanceRequest(); err != nil || !requested {
+		t.Fatalf("TakeRebalanceRequest returned %t, %v after a request", requested, err)
+	}
+	if requested, err := r.TakeRebalanceRequest(); err != nil || requested {
+		t.Errorf("TakeRebalanceRequest returned %t, %v once the request was taken", requested, err)
+	}
+}
+
+func newTestEtcdV3Registry(store *local.Store) *EtcdV3Registry {
+	return NewEtcdV3Registry(clientv3.NewKVFromKVClient(store), store, "/fleet/", time.Second)
+}
+
+// TestEtcdV3RegistryMachinesLocalStore runs the registry against the store of
+// the local backend rather than the etcd stand-in.
+func TestEtcdV3RegistryMachinesLocalStore(t *testing.T) {
+	store := local.New()
+	r := newTestEtcdV3Registry(store)
+
+	ms := machine.MachineState{ID: "XXX", PublicIP: "10.0.0.1", Metadata: map[string]string{}}
+	if _, err := r.CreateMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("CreateMachineState failed: %v", err)
+	}
+	if _, err := r.CreateMachineState(ms, 30*time.Second); err == nil {
+		t.Errorf("CreateMachineState of an existing machine succeeded")
+	}
+
+	ms.PublicIP = "10.0.0.2"
+	if _, err := r.SetMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("SetMachineState failed: %v", err)
+	}
+	res, err := store.Range(context.Background(), &pb.RangeRequest{Key: []byte("/fleet/machines/XXX/object")})
+	if err != nil || len(res.Kvs) != 1 || res.Kvs[0].Lease != 1 {
+		t.Errorf("SetMachineState did not reuse the existing lease: %v, %v", res, err)
+	}
+
+	machines, err := r.Machines()
+	if err != nil {
+		t.Fatalf("Machines failed: %v", err)
+	}
+	if len(machines) != 1 || machines[0].ID != "XXX" || machines[0].PublicIP != "10.0.0.2" {
+		t.Errorf("Machines returned %#v", machines)
+	}
+
+	// an expired lease takes the machine state with it
+	store.Revoke(context.Background(), 1)
+	if machines, _ := r.Machines(); len(machines) != 0 {
+		t.Errorf("Machines returned %#v after the lease expired", machines)
+	}
+	if _, err := r.SetMachineState(ms, 30*time.Second); err != nil {
+		t.Fatalf("SetMachineState failed: %v", err)
+	}
+	if machines, _ := r.Machines(); len(machines) != 1 {
+		t.Errorf("Machines returned %#v, want the machine state to be restored", machines)
+	}
+}
+
+func TestEtcdV3RegistryAuditRecords(t *testing.T) {
+	r := newTestEtcdV3().registry()
+
+	if records, err := r.AuditRecords(); err != nil || len(records) != 0 {
+		t.Fatalf("AuditRecords returned %v, %v before any record was appended", records, err)
+	}
+
+	// fill the ring buffer, and overwrite its oldest records
+	total := MaxAuditRecords + 3
+	for i := 0; i < total; i++ {
+		rec := audit.Record{Action: audit.ActionCreate, UnitName: fmt.Sprintf("%d.service", i)}
+		if err := r.AppendAuditRecord(rec); err != nil {
+			t.Fatalf("AppendAuditRecord %d failed: %v", i, err)
+		}
+	}
+
+	records, err := r.AuditRecords()
+	if err != nil {
+		t.Fatalf("AuditRecords failed: %v", err)
+	}
+	if len(records) != MaxAuditRecords {
+		t.Fatalf("AuditRecords returned %d records, want %d", len(records), MaxAuditRecords)
+	}
+	for i, rec := range records {
+		if want := fmt.Sprintf("%d.service", i+3); rec.UnitName != want {
+			t.Fatalf("record %d is of Unit(%s), want Unit(%s)", i, rec.UnitName, want)
+		}
+	}
+}
+
+func TestEtcdV3RegistryUnitFailures(t *testing.T) {
+	r := newTestEtcdV3().registry()
+
+	uf, err := unit.NewUnitFile("[Service]\nExecStart=/bin/false\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.CreateUnit(&job.Unit{Name: "foo.service", Unit: *uf, TargetState: job.JobStateLaunched}); err != nil {
+		t.Fatalf("CreateUnit failed: %v", err)
+	}
+
+	for _, machID := range []string{"XXX", "XXX", "YYY"} {
+		if err := r.RecordUnitFailure("foo.service", machID); err != nil {
+			t.Fatalf("RecordUnitFailure failed: %v", err)
+		}
+	}
+	failures, err := r.UnitFailures()
+	if err != nil {
+		t.Fatalf("UnitFailures failed: %v", err)
+	}
+	got := failures["foo.service"]
+	if want := map[string]int{"XXX": 2, "YYY": 1}; !reflect.DeepEqual(got.Machines, want) || got.Last.IsZero() {
+		t.Errorf("UnitFailures returned %#v, want machines %v", got, want)
+	}
+
+	// the failures are not mistaken for a unit property
+	if units, err := r.Units(); err != nil || len(units) != 1 {
+		t.Errorf("Units returned %v, %v", units, err)
+	}
+
+	// destroying the unit forgets its failures
+	if err := r.DestroyUnit("foo.service"); err != nil {
+		t.Fatalf("DestroyUnit failed: %v", err)
+	}
+	if failures, err := r.UnitFailures(); err != nil || len(failures) != 0 {
+		t.Errorf("UnitFailures returned %v, %v after the unit was destroyed", failures, err)
+	}
+}
+
+func TestMigrateEtcdV2ToV3(t *testing.T) {
+	exp := time.Now().Add(time.Minute)
+	res := &etcd.Response{
+		Node: &etcd.Node{
+			Key: "/fleet",
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{
+					Key: "/fleet/job",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/fleet/job/foo.service/target-state", Value: "launched"},
+						{Key: "/fleet/job/foo.service/target", Value: "XXX"},
+					},
+				},
+				{Key: "/fleet/machines/XXX/object", Value: "{}", Expiration: &exp},
+			},
+		},
+	}
+	e := newTestEtcdV3()
+	e.Put(context.Background(), &pb.PutRequest{Key: []byte("/fleet/job/foo.service/target"), Value: []byte("YYY")})
+
+	copied, existing, err := MigrateEtcdV2ToV3(&testEtcdKeysAPI{res: []*etcd.Response{res}}, clientv3.NewKVFromKVClient(e), "/fleet", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if copied != 1 || existing != 1 {
+		t.Errorf("got %d copied and %d existing keys, want 1 and 1", copied, existing)
+	}
+
+	want := map[string]string{
+		"/fleet/job/foo.service/target-state": "launched",
+		"/fleet/job/foo.service/target":       "YYY",
+	}
+	got := make(map[string]string)
+	for k, kv := range e.kvs {
+		got[k] = string(kv.Value)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+}
+
+func TestMigrateEtcdV2ToV3LocalStore(t *testing.T) {
+	exp := time.Now().Add(time.Minute)
+	res := &etcd.Response{
+		Node: &etcd.Node{
+			Key: "/fleet",
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{
+					Key: "/fleet/job",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{Key: "/fleet/job/foo.service/target-state", Value: "launched"},
+						{Key: "/fleet/job/foo.service/target", Value: "XXX"},
+					},
+				},
+				{Key: "/fleet/machines/XXX/object", Value: "{}", Expiration: &exp},
+			},
+		},
+	}
+	kv := clientv3.NewKVFromKVClient(local.New())
+	kv.Put(context.Background(), "/fleet/job/foo.service/target", "YYY")
+
+	copied, existing, err := MigrateEtcdV2ToV3(&testEtcdKeysAPI{res: []*etcd.Response{res}}, kv, "/fleet", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if copied != 1 || existing != 1 {
+		t.Errorf("got %d copied and %d existing keys, want 1 and 1", copied, existing)
+	}
+
+	want := map[string]string{
+		"/fleet/job/foo.service/target-state": "launched",
+		"/fleet/job/foo.service/target":       "YYY",
+	}
+	all, err := kv.Get(context.Background(), "/fleet/", clientv3.WithPrefix())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := make(map[string]string)
+	for _, kv := range all.Kvs {
+		got[string(kv.Key)] = string(kv.Value)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+}
+
+func TestFilterEtcdV3Events(t *testing.T) {
+	tests := []struct {
+		in string
+		ev pkg.Event
+		ok bool
+	}{
+		{in: "", ok: false},
+		{in: "/fleet/job", ok: false},
+		{in: "/fleet/job/foo/object", ok: false},
+		{in: "/fleet/machines/asdf/object", ok: false},
+		{in: "/fleet/job/foobarbaz/target-state", ev: JobTargetStateChangeEvent, ok: true},
+		{in: "/fleet/job/asdf/target", ev: JobTargetChangeEvent, ok: true},
+	}
+
+	for i, tt := range tests {
+		ev, ok := parseV3Key(tt.in, "/fleet")
+		if ok != tt.ok {
+			t.Errorf("case %d: expected ok=%t, got %t", i, tt.ok, ok)
+			continue
+		}
+		if !reflect.DeepEqual(tt.ev, ev) {
+			t.Errorf("case %d: received incorrect event\nexpected %#v\ngot %#v", i, tt.ev, ev)
+		}
+	}
+}
+
+func TestFilterEtcdV3ClusterEvents(t *testing.T) {
+	kv := func(key, value string) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value)}
+	}
+	tests := []struct {
+		e  clientv3.Event
+		ok bool
+	}{
+		{clientv3.Event{Type: clientv3.EventTypePut, Kv: kv("/fleet/job/foo/target", "XXX")}, true},
+		{clientv3.Event{Type: clientv3.EventTypePut, Kv: kv("/fleet/job/foo/job-state", "launched")}, false},
+		{clientv3.Event{Type: clientv3.EventTypePut, Kv: kv("/fleet/states/foo/XXX", "{}"), PrevKv: kv("/fleet/states/foo/XXX", "{}")}, false},
+		{clientv3.Event{Type: clientv3.EventTypePut, Kv: kv("/fleet/states/foo/XXX", "{}"), PrevKv: kv("/fleet/states/foo/XXX", "")}, true},
+		{clientv3.Event{Type: clientv3.EventTypeDelete, Kv: kv("/fleet/machines/XXX/object", ""), PrevKv: kv("/fleet/machines/XXX/object", "")}, true},
+		{clientv3.Event{Type: clientv3.EventTypePut, Kv: kv("/fleet/lease/engine-leader", "XXX")}, false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := parseV3Cluster(&tt.e, "/fleet"); ok != tt.ok {
+			t.Errorf("case %d: expected ok=%t, got %t", i, tt.ok, ok)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/unit"
+)
+
+// UnitState returns a single UnitState stored in the registry for a given unit
+// name.
+func (r *EtcdV3Registry) UnitState(name string) (*unit.UnitState, error) {
+	dir, err := r.getDir(statesPrefix, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for machID, val := range dir {
+		if us := unitStateFromValue(name, machID, val); us != nil {
+			return us, nil
+		}
+	}
+	return nil, nil
+}
+
+// UnitStates returns a list of all UnitStates stored in the registry, sorted
+// by unit name and then machine ID.
+func (r *EtcdV3Registry) UnitStates() (states []*unit.UnitState, err error) {
+	var mus map[MUSKey]*unit.UnitState
+	mus, err = r.statesByMUSKey()
+	if err != nil {
+		return
+	}
+
+	var sorted MUSKeys
+	for key := range mus {
+		sorted = append(sorted, key)
+	}
+	sort.Sort(sorted)
+
+	for _, key := range sorted {
+		states = append(states, mus[key])
+	}
+
+	return
+}
+
+// statesByMUSKey returns a map of all UnitStates stored in the registry indexed by MUSKey
+func (r *EtcdV3Registry) statesByMUSKey() (map[MUSKey]*unit.UnitState, error) {
+	dirs, _, err := r.getDirs(statesPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	mus := make(map[MUSKey]*unit.UnitState)
+	for name, dir := range dirs {
+		for machID, val := range dir {
+			if us := unitStateFromValue(name, machID, val); us != nil {
+				mus[MUSKey{name, machID}] = us
+			}
+		}
+	}
+	return mus, nil
+}
+
+// getUnitState retrieves the current UnitState, if any exists, for the
+// given unit that originates from the indicated machine
+func (r *EtcdV3Registry) getUnitState(uName, machID string) (*unit.UnitState, error) {
+	res, err := r.get(r.prefixed(statesPrefix, uName, machID))
+	if err != nil || len(res.Kvs) == 0 {
+		return nil, err
+	}
+
+	var usm unitStateModel
+	if err := unmarshal(string(res.Kvs[0].Value), &usm); err != nil {
+		return nil, err
+	}
+
+	return modelToUnitState(&usm, uName), nil
+}
+
+func unitStateFromValue(name, machID, val string) *unit.UnitState {
+	// Only direct children of a unit are states
+	if strings.Contains(machID, "/") {
+		return nil
+	}
+	var usm unitStateModel
+	if err := unmarshal(val, &usm); err != nil {
+		log.Errorf("Error unmarshalling UnitState(%s) from Machine(%s): %v", name, machID, err)
+		return nil
+	}
+	return modelToUnitState(&usm, name)
+}
+
+// SaveUnitState persists the given UnitState to the Registry
+func (r *EtcdV3Registry) SaveUnitState(jobName string, unitState *unit.UnitState, ttl time.Duration) {
+	usm := unitStateToModel(unitState)
+	if usm == nil {
+		log.Errorf("Unable to save nil UnitState model")
+		return
+	}
+
+	val, err := marshal(usm)
+	if err != nil {
+		log.Errorf("Error marshalling UnitState: %v", err)
+		return
+	}
+
+	r.putWithTTL(r.prefixed(statePrefix, jobName), val, ttl)
+	r.putWithTTL(r.prefixed(statesPrefix, jobName, unitState.MachineID), val, ttl)
+}
+
+// Delete the state from the Registry for the given Job's Unit
+func (r *EtcdV3Registry) RemoveUnitState(jobName string) error {
+	legacyKey := r.prefixed(statePrefix, jobName)
+	if _, err := r.delete(legacyKey); err != nil {
+		return err
+	}
+	r.forgetLease(legacyKey)
+
+	prefix := r.dirPrefixed(statesPrefix, jobName)
+	if _, err := r.delete(prefix, clientv3.WithPrefix()); err != nil {
+		return err
+	}
+	r.forgetLeases(prefix)
+	return nil
+}
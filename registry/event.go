@@ -17,6 +17,7 @@ package registry
 import (
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
@@ -31,6 +32,8 @@ const (
 	JobTargetChangeEvent = pkg.Event("JobTargetChangeEvent")
 	// Occurs when any Job's target state is touched
 	JobTargetStateChangeEvent = pkg.Event("JobTargetStateChangeEvent")
+	// Occurs when any Unit, Unit state or Machine changes
+	ClusterChangeEvent = pkg.Event("ClusterChangeEvent")
 )
 
 type etcdEventStream struct {
@@ -114,3 +117,143 @@ func watch(kAPI etcd.KeysAPI, key string, stop chan struct{}) (res *etcd.Respons
 
 	return
 }
+
+// isClusterKey tells whether the given key holds part of the units, unit
+// states or machines of the cluster, as opposed to, say, the job states
+// agents keep refreshing.
+func isClusterKey(key, prefix string) bool {
+	rel := strings.TrimPrefix(key, path.Join(prefix)+"/")
+	if rel == key {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	switch parts[0] {
+	case jobPrefix:
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "object", "target", "target-state":
+				return true
+			}
+		}
+		// deleting a job removes its whole directory
+		return len(parts) == 2
+	case strings.Trim(statesPrefix, "/"), machinePrefix:
+		return len(parts) > 1
+	}
+	return false
+}
+
+type etcdClusterEventStream struct {
+	kAPI       etcd.KeysAPI
+	rootPrefix string
+
+	mu *sync.Mutex
+	// watchers holds, per consumer, a watcher following on from the last
+	// change seen, so that changes occurring between two calls to Next
+	// are not missed.
+	watchers map[chan struct{}]etcd.Watcher
+}
+
+// NewEtcdClusterEventStream returns an EventStream emitting a
+// ClusterChangeEvent whenever a unit, unit state or machine changes.
+func NewEtcdClusterEventStream(kAPI etcd.KeysAPI, rootPrefix string) pkg.EventStream {
+	return &etcdClusterEventStream{
+		kAPI:       kAPI,
+		rootPrefix: rootPrefix,
+		mu:         new(sync.Mutex),
+		watchers:   make(map[chan struct{}]etcd.Watcher),
+	}
+}
+
+// Next returns a channel which will emit an Event as soon as one of interest occurs
+func (es *etcdClusterEventStream) Next(stop chan struct{}) chan pkg.Event {
+	es.mu.Lock()
+	w, known := es.watchers[stop]
+	if !known {
+		w = es.watcher()
+		es.watchers[stop] = w
+		go func() {
+			<-stop
+			es.mu.Lock()
+			delete(es.watchers, stop)
+			es.mu.Unlock()
+		}()
+	}
+	es.mu.Unlock()
+
+	evchan := make(chan pkg.Event)
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for {
+			res, err := w.Next(ctx)
+			ok := false
+			switch {
+			case err == nil:
+				_, ok = parseCluster(res, es.rootPrefix)
+			case ctx.Err() != nil:
+				log.Debugf("Gracefully closing etcd watch loop: key=%s", es.rootPrefix)
+				return
+			case isEtcdError(err, etcd.ErrorCodeEventIndexCleared):
+				// Whatever changed in the meantime is unknown,
+				// so watch again from now on and have it all
+				// read again.
+				log.Errorf("etcd watcher %v fell behind: %v", es.rootPrefix, err)
+				w = es.watcher()
+				es.mu.Lock()
+				if _, known := es.watchers[stop]; known {
+					es.watchers[stop] = w
+				}
+				es.mu.Unlock()
+				ok = true
+			default:
+				log.Errorf("etcd watcher %v returned error: %v", es.rootPrefix, err)
+				// Let's not slam the etcd server in the event that we know
+				// an unexpected error occurred.
+				time.Sleep(time.Second)
+			}
+
+			if ok {
+				select {
+				case evchan <- ClusterChangeEvent:
+				case <-stop:
+				}
+				return
+			}
+		}
+	}()
+
+	return evchan
+}
+
+func (es *etcdClusterEventStream) watcher() etcd.Watcher {
+	log.Debugf("Creating etcd watcher: %s", es.rootPrefix)
+	return es.kAPI.Watcher(es.rootPrefix, &etcd.WatcherOptions{AfterIndex: 0, Recursive: true})
+}
+
+// parseCluster returns a ClusterChangeEvent if the given response changes
+// a unit, unit state or machine. Writes leaving the value of a key as it
+// was, like those refreshing its TTL, change nothing.
+func parseCluster(res *etcd.Response, prefix string) (ev pkg.Event, ok bool) {
+	if res == nil || res.Node == nil || !isClusterKey(res.Node.Key, prefix) {
+		return
+	}
+
+	switch res.Action {
+	case "set", "update", "compareAndSwap":
+		if res.PrevNode != nil && !res.PrevNode.Dir && res.PrevNode.Value == res.Node.Value {
+			return
+		}
+	}
+
+	return ClusterChangeEvent, true
+}
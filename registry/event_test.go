@@ -92,3 +92,47 @@ func TestFilterEtcdEvents(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterEtcdClusterEvents(t *testing.T) {
+	tests := []struct {
+		action string
+		key    string
+		prev   string
+		value  string
+		ok     bool
+	}{
+		{"set", "/fleet/job/foo.service/object", "", "{}", true},
+		{"set", "/fleet/job/foo.service/target", "XXX", "YYY", true},
+		{"create", "/fleet/job/foo.service/target-state", "", "launched", true},
+		{"delete", "/fleet/job/foo.service", "", "", true},
+		{"set", "/fleet/job/foo.service/job-state", "", "launched", false},
+		{"set", "/fleet/states/foo.service/XXX", "", "{}", true},
+		{"expire", "/fleet/states/foo.service/XXX", "{}", "", true},
+		{"create", "/fleet/machines/XXX/object", "", "{}", true},
+		{"compareAndSwap", "/fleet/machines/XXX/metadata/region", "us", "eu", true},
+		{"delete", "/fleet/machines/XXX/object", "{}", "", true},
+		{"expire", "/fleet/machines/XXX/object", "{}", "", true},
+		{"set", "/fleet/lease/engine-leader", "", "XXX", false},
+		{"set", "/fleet/machines", "", "", false},
+		{"set", "/other/machines/XXX/object", "", "{}", false},
+		// heartbeats refresh the TTL of a key without changing it
+		{"update", "/fleet/machines/XXX/object", "{}", "{}", false},
+		{"set", "/fleet/states/foo.service/XXX", "{}", "{}", false},
+	}
+
+	for i, tt := range tests {
+		res := &etcd.Response{
+			Action: tt.action,
+			Node:   &etcd.Node{Key: tt.key, Value: tt.value},
+		}
+		if tt.prev != "" {
+			res.PrevNode = &etcd.Node{Key: tt.key, Value: tt.prev}
+		}
+		ev, ok := parseCluster(res, "/fleet")
+		if ok != tt.ok {
+			t.Errorf("case %d: expected ok=%t, got %t", i, tt.ok, ok)
+		} else if ok && ev != ClusterChangeEvent {
+			t.Errorf("case %d: expected %v, got %v", i, ClusterChangeEvent, ev)
+		}
+	}
+}
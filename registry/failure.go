@@ -0,0 +1,128 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+)
+
+// failureRecordAttempts is the number of times recording a unit failure is
+// retried when the failures of the same Unit are updated concurrently
+const failureRecordAttempts = 5
+
+// failuresModel is used for serializing and deserializing UnitFailures
+// stored in the Registry
+type failuresModel struct {
+	Machines map[string]int
+	Last     time.Time
+}
+
+// addFailure counts one more failure on the given machine and returns the
+// serialized model
+func (fm *failuresModel) addFailure(machID string) (string, error) {
+	if fm.Machines == nil {
+		fm.Machines = make(map[string]int)
+	}
+	fm.Machines[machID]++
+	fm.Last = time.Now().UTC()
+	return marshal(fm)
+}
+
+func (fm *failuresModel) unitFailures() job.UnitFailures {
+	return job.UnitFailures{
+		Machines: fm.Machines,
+		Last:     fm.Last,
+	}
+}
+
+// RecordUnitFailure counts a failure of the named Unit on the given
+// machine. The failures are stored alongside the Job, so they are
+// forgotten when the Unit is destroyed.
+func (r *EtcdRegistry) RecordUnitFailure(name, machID string) error {
+	key := r.jobFailuresPath(name)
+	for i := 0; i < failureRecordAttempts; i++ {
+		var fm failuresModel
+		opts := &etcd.SetOptions{
+			PrevExist: etcd.PrevNoExist,
+		}
+
+		res, err := r.kAPI.Get(context.Background(), key, nil)
+		if err == nil {
+			if err := unmarshal(res.Node.Value, &fm); err != nil {
+				return err
+			}
+			opts = &etcd.SetOptions{
+				PrevIndex: res.Node.ModifiedIndex,
+			}
+		} else if !isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			return err
+		}
+
+		val, err := fm.addFailure(machID)
+		if err != nil {
+			return err
+		}
+		_, err = r.kAPI.Set(context.Background(), key, val, opts)
+		if err == nil {
+			return nil
+		}
+		if !isEtcdError(err, etcd.ErrorCodeNodeExist) && !isEtcdError(err, etcd.ErrorCodeTestFailed) {
+			return err
+		}
+	}
+	return fmt.Errorf("failures of Unit(%s) were recorded concurrently", name)
+}
+
+// UnitFailures returns the recorded failures of all Units that ever failed,
+// indexed by name
+func (r *EtcdRegistry) UnitFailures() (map[string]job.UnitFailures, error) {
+	opts := &etcd.GetOptions{
+		Recursive: true,
+	}
+	res, err := r.kAPI.Get(context.Background(), r.prefixed(jobPrefix), opts)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	failures := make(map[string]job.UnitFailures)
+	for _, dir := range res.Node.Nodes {
+		val := getValueInDir(dir, "failures")
+		if val == "" {
+			continue
+		}
+		var fm failuresModel
+		if err := unmarshal(val, &fm); err != nil {
+			log.Errorf("Error unmarshaling failures of Job(%s): %v", path.Base(dir.Key), err)
+			continue
+		}
+		failures[path.Base(dir.Key)] = fm.unitFailures()
+	}
+	return failures, nil
+}
+
+func (r *EtcdRegistry) jobFailuresPath(jobName string) string {
+	return r.prefixed(jobPrefix, jobName, "failures")
+}
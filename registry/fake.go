@@ -21,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/pkg/lease"
@@ -33,6 +34,8 @@ func NewFakeRegistry() *FakeRegistry {
 		machines:      []machine.MachineState{},
 		jobStates:     map[string]map[string]*unit.UnitState{},
 		jobs:          map[string]job.Job{},
+		revisions:     map[string][]job.UnitRevision{},
+		failures:      map[string]job.UnitFailures{},
 		daemonVersion: nil,
 	}
 }
@@ -47,6 +50,9 @@ type FakeRegistry struct {
 	machines      []machine.MachineState
 	jobStates     map[string]map[string]*unit.UnitState
 	jobs          map[string]job.Job
+	revisions     map[string][]job.UnitRevision
+	failures      map[string]job.UnitFailures
+	audit         []audit.Record
 	daemonVersion *semver.Version
 }
 
@@ -197,11 +203,107 @@ func (f *FakeRegistry) CreateUnit(u *job.Unit) error {
 	return f.unsafeSetUnitTargetState(u.Name, u.TargetState)
 }
 
+func (f *FakeRegistry) UpdateUnit(u *job.Unit) error {
+	f.Lock()
+	defer f.Unlock()
+
+	j, ok := f.jobs[u.Name]
+	if !ok {
+		return errors.New("job does not exist")
+	}
+
+	j.Unit = u.Unit
+	f.jobs[u.Name] = j
+	return nil
+}
+
+func (f *FakeRegistry) SaveUnitRevision(name string, rev job.UnitRevision) error {
+	f.Lock()
+	defer f.Unlock()
+
+	revs := f.revisions[name]
+	next := 1
+	if len(revs) > 0 {
+		last := revs[len(revs)-1]
+		if last.Unit.Hash() == rev.Unit.Hash() {
+			return nil
+		}
+		next = last.Revision + 1
+	}
+
+	rev.Revision = next
+	rev.Created = time.Now().UTC()
+	revs = append(revs, rev)
+	if len(revs) > MaxUnitRevisions {
+		revs = revs[len(revs)-MaxUnitRevisions:]
+	}
+	f.revisions[name] = revs
+	return nil
+}
+
+func (f *FakeRegistry) UnitRevisions(name string) ([]job.UnitRevision, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	revs := make([]job.UnitRevision, len(f.revisions[name]))
+	copy(revs, f.revisions[name])
+	return revs, nil
+}
+
+func (f *FakeRegistry) RecordUnitFailure(name, machID string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	uf := f.failures[name]
+	machines := make(map[string]int, len(uf.Machines)+1)
+	for m, n := range uf.Machines {
+		machines[m] = n
+	}
+	machines[machID]++
+	f.failures[name] = job.UnitFailures{
+		Machines: machines,
+		Last:     time.Now().UTC(),
+	}
+	return nil
+}
+
+func (f *FakeRegistry) UnitFailures() (map[string]job.UnitFailures, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	failures := make(map[string]job.UnitFailures, len(f.failures))
+	for name, uf := range f.failures {
+		failures[name] = uf
+	}
+	return failures, nil
+}
+
+func (f *FakeRegistry) AppendAuditRecord(r audit.Record) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.audit = append(f.audit, r)
+	if len(f.audit) > MaxAuditRecords {
+		f.audit = f.audit[len(f.audit)-MaxAuditRecords:]
+	}
+	return nil
+}
+
+func (f *FakeRegistry) AuditRecords() ([]audit.Record, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	records := make([]audit.Record, len(f.audit))
+	copy(records, f.audit)
+	return records, nil
+}
+
 func (f *FakeRegistry) DestroyUnit(name string) error {
 	f.Lock()
 	defer f.Unlock()
 
 	delete(f.jobs, name)
+	delete(f.failures, name)
 	return nil
 }
 
@@ -241,6 +343,21 @@ func (f *FakeRegistry) ScheduleUnit(name string, machID string) error {
 	return nil
 }
 
+func (f *FakeRegistry) UnscheduleUnit(name, machID string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	j, ok := f.jobs[name]
+	if !ok || j.TargetMachineID != machID {
+		return nil
+	}
+
+	j.TargetMachineID = ""
+	f.jobs[name] = j
+
+	return nil
+}
+
 func (f *FakeRegistry) SaveUnitState(jobName string, unitState *unit.UnitState, ttl time.Duration) {
 	f.Lock()
 	defer f.Unlock()
@@ -294,7 +411,7 @@ func (f *FakeRegistry) UnitState(unitName string) (*unit.UnitState, error) {
 		}
 		for _, mID := range sMIDs {
 			js := f.jobStates[name][mID]
-			if name == js.UnitName {
+			if name == unitName {
 				us = js
 				break
 			}
@@ -332,6 +449,26 @@ func (f *FakeRegistry) DeleteMachineMetadata(machID string, key string) error {
 	return nil
 }
 
+func (f *FakeRegistry) CordonMachine(machID string) error {
+	return f.setMachineCordoned(machID, true)
+}
+
+func (f *FakeRegistry) UncordonMachine(machID string) error {
+	return f.setMachineCordoned(machID, false)
+}
+
+func (f *FakeRegistry) setMachineCordoned(machID string, cordoned bool) error {
+	f.Lock()
+	defer f.Unlock()
+
+	for i := range f.machines {
+		if f.machines[i].ID == machID {
+			f.machines[i].Cordoned = cordoned
+		}
+	}
+	return nil
+}
+
 func (f *FakeRegistry) MachineState(machID string) (machine.MachineState, error) {
 	f.RLock()
 	defer f.RUnlock()
@@ -353,8 +490,9 @@ func NewFakeClusterRegistry(dVersion *semver.Version, eVersion int) *FakeCluster
 }
 
 type FakeClusterRegistry struct {
-	dVersion *semver.Version
-	eVersion int
+	dVersion  *semver.Version
+	eVersion  int
+	rebalance bool
 }
 
 func (fc *FakeClusterRegistry) LatestDaemonVersion() (*semver.Version, error) {
@@ -374,6 +512,17 @@ func (fc *FakeClusterRegistry) UpdateEngineVersion(from, to int) error {
 	return nil
 }
 
+func (fc *FakeClusterRegistry) RequestRebalance() error {
+	fc.rebalance = true
+	return nil
+}
+
+func (fc *FakeClusterRegistry) TakeRebalanceRequest() (bool, error) {
+	requested := fc.rebalance
+	fc.rebalance = false
+	return requested, nil
+}
+
 func (fl *FakeLeaseRegistry) SetLease(name, machID string, ver int, ttl time.Duration) *fakeLease {
 	l := &fakeLease{
 		name:   name,
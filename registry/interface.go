@@ -28,6 +28,9 @@ type Registry interface {
 	ClearUnitHeartbeat(name string)
 	CreateMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error)
 	CreateUnit(*job.Unit) error
+	UpdateUnit(*job.Unit) error
+	SaveUnitRevision(name string, rev job.UnitRevision) error
+	RecordUnitFailure(name, machID string) error
 	DestroyUnit(string) error
 	UnitHeartbeat(name, machID string, ttl time.Duration) error
 	Machines() ([]machine.MachineState, error)
@@ -41,6 +44,8 @@ type Registry interface {
 	UnscheduleUnit(name, machID string) error
 	SetMachineMetadata(machID string, key string, value string) error
 	DeleteMachineMetadata(machID string, key string) error
+	CordonMachine(machID string) error
+	UncordonMachine(machID string) error
 
 	IsRegistryReady() bool
 	UseEtcdRegistry() bool
@@ -54,6 +59,8 @@ type UnitRegistry interface {
 	Units() ([]job.Unit, error)
 	UnitState(name string) (*unit.UnitState, error)
 	UnitStates() ([]*unit.UnitState, error)
+	UnitRevisions(name string) ([]job.UnitRevision, error)
+	UnitFailures() (map[string]job.UnitFailures, error)
 }
 
 type ClusterRegistry interface {
@@ -70,4 +77,12 @@ type ClusterRegistry interface {
 	// indicated by the returned error object. A nil value will be returned
 	// on success.
 	UpdateEngineVersion(from, to int) error
+
+	// RequestRebalance asks the lead engine to even out the load of the
+	// cluster during its next reconciliation.
+	RequestRebalance() error
+
+	// TakeRebalanceRequest reports whether a rebalance has been requested
+	// since it was last called, clearing the request.
+	TakeRebalanceRequest() (bool, error)
 }
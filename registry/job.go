@@ -341,6 +341,43 @@ func (r *EtcdRegistry) CreateUnit(u *job.Unit) error {
 	return r.SetUnitTargetState(u.Name, u.TargetState)
 }
 
+// UpdateUnit swaps the unit file of an existing Unit for the one given,
+// leaving its schedule and target state untouched. The job object is
+// compare-and-swapped, so concurrent updates of the same Unit fail rather
+// than silently overwrite each other.
+func (r *EtcdRegistry) UpdateUnit(u *job.Unit) error {
+	key := r.prefixed(jobPrefix, u.Name, "object")
+	res, err := r.kAPI.Get(context.Background(), key, nil)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = errors.New("job does not exist")
+		}
+		return err
+	}
+
+	if err := r.storeOrGetUnitFile(u.Unit); err != nil {
+		return err
+	}
+
+	jm := jobModel{
+		Name:     u.Name,
+		UnitHash: u.Unit.Hash(),
+	}
+	val, err := marshal(jm)
+	if err != nil {
+		return err
+	}
+
+	opts := &etcd.SetOptions{
+		PrevIndex: res.Node.ModifiedIndex,
+	}
+	_, err = r.kAPI.Set(context.Background(), key, val, opts)
+	if isEtcdError(err, etcd.ErrorCodeTestFailed) {
+		err = fmt.Errorf("Unit(%s) was modified concurrently", u.Name)
+	}
+	return err
+}
+
 func (r *EtcdRegistry) SetUnitTargetState(name string, state job.JobState) error {
 	key := r.jobTargetStatePath(name)
 	_, err := r.kAPI.Set(context.Background(), key, string(state), nil)
@@ -0,0 +1,119 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+)
+
+// revoke deletes the given lease along with the keys attached to it, which
+// it returns. It must be called with the lock held.
+func (s *Store) revoke(id clientv3.LeaseID) []string {
+	delete(s.leases, id)
+
+	var keys []string
+	for _, k := range s.sortedKeys() {
+		if clientv3.LeaseID(s.kvs[k].Lease) == id {
+			delete(s.kvs, k)
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *Store) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+
+	id := s.nextID
+	s.nextID++
+	s.leases[id] = &lease{ttl: ttl, expires: s.clock.Now().Add(time.Duration(ttl) * time.Second)}
+	if err := s.persist(); err != nil {
+		return nil, err
+	}
+	return &clientv3.LeaseGrantResponse{ResponseHeader: s.header(), ID: id, TTL: ttl}, nil
+}
+
+func (s *Store) Revoke(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+	if _, ok := s.leases[id]; !ok {
+		return nil, ErrLeaseNotFound
+	}
+
+	s.rev++
+	if err := s.commit(s.revoke(id)); err != nil {
+		return nil, err
+	}
+	return &clientv3.LeaseRevokeResponse{Header: s.header()}, nil
+}
+
+func (s *Store) TimeToLive(_ context.Context, id clientv3.LeaseID, _ ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+
+	res := &clientv3.LeaseTimeToLiveResponse{ResponseHeader: s.header(), ID: id, TTL: -1}
+	l, ok := s.leases[id]
+	if !ok {
+		return res, nil
+	}
+	res.TTL = int64(l.expires.Sub(s.clock.Now()) / time.Second)
+	res.GrantedTTL = l.ttl
+	for _, k := range s.sortedKeys() {
+		if clientv3.LeaseID(s.kvs[k].Lease) == id {
+			res.Keys = append(res.Keys, []byte(k))
+		}
+	}
+	return res, nil
+}
+
+// KeepAlive is not supported, as the store has no way to stop renewing the
+// lease once the store itself is no longer used. Use KeepAliveOnce instead.
+func (s *Store) KeepAlive(_ context.Context, _ clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	return nil, errors.New("KeepAlive is not supported by the local store")
+}
+
+func (s *Store) KeepAliveOnce(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+
+	l, ok := s.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+	l.expires = s.clock.Now().Add(time.Duration(l.ttl) * time.Second)
+	return &clientv3.LeaseKeepAliveResponse{ResponseHeader: s.header(), ID: id, TTL: l.ttl}, nil
+}
+
+// Close is a no-op, as all leases are kept in the store itself.
+func (s *Store) Close() error {
+	return nil
+}
@@ -0,0 +1,517 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package local provides an embedded, single-node key-value store speaking
+// the etcd v3 KV and lease APIs, so the etcd v3 registry, lease manager and
+// event stream of fleet can run without an etcd cluster.
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/jonboulle/clockwork"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	// snapshotFile is the name of the file the store is persisted to
+	// within its data directory.
+	snapshotFile = "registry.json"
+
+	// historySize is the number of changed keys remembered for
+	// consumers of Changes.
+	historySize = 1000
+)
+
+var ErrLeaseNotFound = errors.New("requested lease not found")
+
+// Store is an in-memory key-value store with etcd v3 semantics: keys carry
+// create and mod revisions, writes are grouped in transactions and keys may
+// be attached to leases expiring them. Every write is persisted to a JSON
+// snapshot in the data directory of the store, if it has one.
+type Store struct {
+	path  string
+	clock clockwork.Clock
+
+	mu     *sync.Mutex
+	rev    int64
+	kvs    map[string]*mvccpb.KeyValue
+	leases map[clientv3.LeaseID]*lease
+	nextID clientv3.LeaseID
+
+	// history holds the keys changed by the most recent revisions, and
+	// changed is closed as soon as the next revision is written.
+	history []change
+	changed chan struct{}
+}
+
+type lease struct {
+	ttl     int64
+	expires time.Time
+}
+
+type change struct {
+	rev int64
+	key string
+}
+
+// New returns an empty Store which is not persisted.
+func New() *Store {
+	return newStore("", clockwork.NewRealClock())
+}
+
+func newStore(path string, clock clockwork.Clock) *Store {
+	return &Store{
+		path:    path,
+		clock:   clock,
+		mu:      new(sync.Mutex),
+		rev:     1,
+		kvs:     make(map[string]*mvccpb.KeyValue),
+		leases:  make(map[clientv3.LeaseID]*lease),
+		nextID:  1,
+		changed: make(chan struct{}),
+	}
+}
+
+// Open returns a Store persisted in the given data directory, loading the
+// data previously stored there.
+func Open(dataDir string) (*Store, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := newStore(filepath.Join(dataDir, snapshotFile), clockwork.NewRealClock())
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type snapshot struct {
+	Revision int64
+	Keys     []snapshotKey
+	Leases   []snapshotLease
+}
+
+type snapshotKey struct {
+	Key            string
+	Value          string
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+	Lease          int64 `json:",omitempty"`
+}
+
+type snapshotLease struct {
+	ID      int64
+	TTL     int64
+	Expires time.Time
+}
+
+func (s *Store) load() error {
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+
+	s.rev = snap.Revision
+	for _, k := range snap.Keys {
+		s.kvs[k.Key] = &mvccpb.KeyValue{
+			Key:            []byte(k.Key),
+			Value:          []byte(k.Value),
+			CreateRevision: k.CreateRevision,
+			ModRevision:    k.ModRevision,
+			Version:        k.Version,
+			Lease:          k.Lease,
+		}
+	}
+	for _, l := range snap.Leases {
+		id := clientv3.LeaseID(l.ID)
+		s.leases[id] = &lease{ttl: l.TTL, expires: l.Expires}
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+	return nil
+}
+
+// persist writes the data of the store to its snapshot file, replacing the
+// previous snapshot atomically. Lease deadlines are only persisted along
+// with other writes, so keys attached to leases kept alive since may expire
+// early after a restart.
+func (s *Store) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	snap := snapshot{Revision: s.rev}
+	for _, key := range s.sortedKeys() {
+		kv := s.kvs[key]
+		snap.Keys = append(snap.Keys, snapshotKey{
+			Key:            key,
+			Value:          string(kv.Value),
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+			Lease:          kv.Lease,
+		})
+	}
+	for id, l := range s.leases {
+		snap.Leases = append(snap.Leases, snapshotLease{ID: int64(id), TTL: l.ttl, Expires: l.expires})
+	}
+	sort.Sort(leasesByID(snap.Leases))
+
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+type leasesByID []snapshotLease
+
+func (ls leasesByID) Len() int           { return len(ls) }
+func (ls leasesByID) Less(i, j int) bool { return ls[i].ID < ls[j].ID }
+func (ls leasesByID) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
+
+func (s *Store) sortedKeys() []string {
+	keys := make([]string, 0, len(s.kvs))
+	for k := range s.kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Store) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: s.rev}
+}
+
+// expire revokes the leases past their deadline, deleting the keys attached
+// to them, before the store is accessed. It must be called with the lock held.
+func (s *Store) expire() error {
+	now := s.clock.Now()
+	var expired []clientv3.LeaseID
+	for id, l := range s.leases {
+		if !now.Before(l.expires) {
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	s.rev++
+	var keys []string
+	for _, id := range expired {
+		keys = append(keys, s.revoke(id)...)
+	}
+	return s.commit(keys)
+}
+
+// commit records the keys changed at the current revision and persists the
+// store. It must be called with the lock held.
+func (s *Store) commit(keys []string) error {
+	for _, key := range keys {
+		s.history = append(s.history, change{rev: s.rev, key: key})
+	}
+	if n := len(s.history) - historySize; n > 0 {
+		s.history = append([]change(nil), s.history[n:]...)
+	}
+	if len(keys) > 0 {
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+	return s.persist()
+}
+
+// Changes returns the keys whose value changed after the given revision,
+// the current revision and a channel closed as soon as the next change
+// happens. If changes after the given revision are no longer remembered,
+// complete is false and only the most recent changes are returned.
+func (s *Store) Changes(rev int64) (keys []string, cur int64, complete bool, changed <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	complete = len(s.history) == 0 || s.history[0].rev <= rev+1
+	for _, c := range s.history {
+		if c.rev > rev {
+			keys = append(keys, c.key)
+		}
+	}
+	return keys, s.rev, complete, s.changed
+}
+
+// keysIn returns the sorted keys in the range from key up to, but not
+// including, end. An empty end selects key alone, and "\x00" all keys from
+// key on.
+func (s *Store) keysIn(key, end []byte) []string {
+	var keys []string
+	for _, k := range s.sortedKeys() {
+		switch {
+		case len(end) == 0:
+			if k == string(key) {
+				keys = append(keys, k)
+			}
+		case len(end) == 1 && end[0] == 0:
+			if k >= string(key) {
+				keys = append(keys, k)
+			}
+		case k >= string(key) && k < string(end):
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *Store) rangeKeys(in *pb.RangeRequest) *pb.RangeResponse {
+	res := &pb.RangeResponse{Header: s.header()}
+	for _, k := range s.keysIn(in.Key, in.RangeEnd) {
+		res.Kvs = append(res.Kvs, s.kvs[k])
+	}
+	res.Count = int64(len(res.Kvs))
+	if in.SortOrder == pb.RangeRequest_DESCEND {
+		for i, j := 0, len(res.Kvs)-1; i < j; i, j = i+1, j-1 {
+			res.Kvs[i], res.Kvs[j] = res.Kvs[j], res.Kvs[i]
+		}
+	}
+	if in.Limit > 0 && int64(len(res.Kvs)) > in.Limit {
+		res.Kvs = res.Kvs[:in.Limit]
+		res.More = true
+	}
+	return res
+}
+
+func (s *Store) checkLease(in *pb.PutRequest) error {
+	id := clientv3.LeaseID(in.Lease)
+	if id == clientv3.NoLease {
+		return nil
+	}
+	if _, ok := s.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+// put stores the given key, telling whether its value changed: putting a
+// key again with the value it had, say to attach it to a new lease, does
+// not.
+func (s *Store) put(in *pb.PutRequest) (*pb.PutResponse, bool) {
+	changed := true
+	kv := &mvccpb.KeyValue{
+		Key:            in.Key,
+		Value:          in.Value,
+		CreateRevision: s.rev,
+		ModRevision:    s.rev,
+		Version:        1,
+		Lease:          in.Lease,
+	}
+	if prev, ok := s.kvs[string(in.Key)]; ok {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+		changed = !bytes.Equal(prev.Value, in.Value)
+	}
+	s.kvs[string(in.Key)] = kv
+	return &pb.PutResponse{Header: s.header()}, changed
+}
+
+func (s *Store) deleteRange(in *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, []string) {
+	keys := s.keysIn(in.Key, in.RangeEnd)
+	for _, k := range keys {
+		delete(s.kvs, k)
+	}
+	return &pb.DeleteRangeResponse{Header: s.header(), Deleted: int64(len(keys))}, keys
+}
+
+func (s *Store) compare(c *pb.Compare) bool {
+	kv, ok := s.kvs[string(c.Key)]
+	if !ok {
+		kv = &mvccpb.KeyValue{}
+	}
+
+	var res int
+	switch t := c.TargetUnion.(type) {
+	case *pb.Compare_Version:
+		res = compareInt64(kv.Version, t.Version)
+	case *pb.Compare_CreateRevision:
+		res = compareInt64(kv.CreateRevision, t.CreateRevision)
+	case *pb.Compare_ModRevision:
+		res = compareInt64(kv.ModRevision, t.ModRevision)
+	case *pb.Compare_Value:
+		if !ok {
+			return false
+		}
+		res = bytes.Compare(kv.Value, t.Value)
+	}
+
+	switch c.Result {
+	case pb.Compare_GREATER:
+		return res > 0
+	case pb.Compare_LESS:
+		return res < 0
+	default:
+		return res == 0
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (s *Store) Range(_ context.Context, in *pb.RangeRequest, _ ...grpc.CallOption) (*pb.RangeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+	return s.rangeKeys(in), nil
+}
+
+func (s *Store) Put(_ context.Context, in *pb.PutRequest, _ ...grpc.CallOption) (*pb.PutResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+	if err := s.checkLease(in); err != nil {
+		return nil, err
+	}
+
+	s.rev++
+	res, changed := s.put(in)
+	var keys []string
+	if changed {
+		keys = append(keys, string(in.Key))
+	}
+	return res, s.commit(keys)
+}
+
+func (s *Store) DeleteRange(_ context.Context, in *pb.DeleteRangeRequest, _ ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+	if len(s.keysIn(in.Key, in.RangeEnd)) == 0 {
+		return &pb.DeleteRangeResponse{Header: s.header()}, nil
+	}
+
+	s.rev++
+	res, keys := s.deleteRange(in)
+	return res, s.commit(keys)
+}
+
+func (s *Store) Txn(_ context.Context, in *pb.TxnRequest, _ ...grpc.CallOption) (*pb.TxnResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return nil, err
+	}
+
+	res := &pb.TxnResponse{Succeeded: true}
+	for _, c := range in.Compare {
+		if !s.compare(c) {
+			res.Succeeded = false
+			break
+		}
+	}
+	ops := in.Success
+	if !res.Succeeded {
+		ops = in.Failure
+	}
+
+	write := false
+	for _, op := range ops {
+		switch r := op.Request.(type) {
+		case *pb.RequestOp_RequestPut:
+			if err := s.checkLease(r.RequestPut); err != nil {
+				return nil, err
+			}
+			write = true
+		case *pb.RequestOp_RequestDeleteRange:
+			write = true
+		}
+	}
+	if write {
+		s.rev++
+	}
+
+	var keys []string
+	for _, op := range ops {
+		switch r := op.Request.(type) {
+		case *pb.RequestOp_RequestRange:
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseRange{ResponseRange: s.rangeKeys(r.RequestRange)},
+			})
+		case *pb.RequestOp_RequestPut:
+			pres, changed := s.put(r.RequestPut)
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponsePut{ResponsePut: pres},
+			})
+			if changed {
+				keys = append(keys, string(r.RequestPut.Key))
+			}
+		case *pb.RequestOp_RequestDeleteRange:
+			dres, deleted := s.deleteRange(r.RequestDeleteRange)
+			res.Responses = append(res.Responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: dres},
+			})
+			keys = append(keys, deleted...)
+		}
+	}
+	res.Header = s.header()
+
+	if !write {
+		return res, nil
+	}
+	return res, s.commit(keys)
+}
+
+// Compact is a no-op, as the store keeps no history of values.
+func (s *Store) Compact(_ context.Context, _ *pb.CompactionRequest, _ ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &pb.CompactionResponse{Header: s.header()}, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/jonboulle/clockwork"
+	"golang.org/x/net/context"
+)
+
+func TestStorePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fleet-local-store")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kv := clientv3.NewKVFromKVClient(s)
+	ctx := context.Background()
+
+	kv.Put(ctx, "/fleet/job/foo.service/object", "foo")
+	kv.Put(ctx, "/fleet/job/bar.service/object", "bar")
+	kv.Delete(ctx, "/fleet/job/bar.service/", clientv3.WithPrefix())
+	res, err := kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision("/fleet/job/foo.service/target"), "=", 0)).
+		Then(clientv3.OpPut("/fleet/job/foo.service/target", "XXX")).
+		Commit()
+	if err != nil || !res.Succeeded {
+		t.Fatalf("Txn returned %v, %v", res, err)
+	}
+	grant, err := s.Grant(ctx, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kv.Put(ctx, "/fleet/machines/XXX/object", "{}", clientv3.WithLease(grant.ID))
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kv = clientv3.NewKVFromKVClient(s)
+
+	got, err := kv.Get(ctx, "/fleet/", clientv3.WithPrefix())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vals := make(map[string]string)
+	for _, kv := range got.Kvs {
+		vals[string(kv.Key)] = string(kv.Value)
+	}
+	want := map[string]string{
+		"/fleet/job/foo.service/object": "foo",
+		"/fleet/job/foo.service/target": "XXX",
+		"/fleet/machines/XXX/object":    "{}",
+	}
+	if !reflect.DeepEqual(want, vals) {
+		t.Errorf("got keys %v after reopening, want %v", vals, want)
+	}
+	if got.Header.Revision != 6 {
+		t.Errorf("got revision %d after reopening, want 6", got.Header.Revision)
+	}
+
+	// leases survive a restart, and new ones do not reuse their IDs
+	if ttl, _ := s.TimeToLive(ctx, grant.ID); ttl.TTL < 0 || len(ttl.Keys) != 1 {
+		t.Errorf("lease was not restored: %#v", ttl)
+	}
+	if next, _ := s.Grant(ctx, 30); next.ID == grant.ID {
+		t.Errorf("lease ID %d was reused", next.ID)
+	}
+}
+
+func TestStoreLeaseExpiry(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	s := newStore("", clock)
+	kv := clientv3.NewKVFromKVClient(s)
+	ctx := context.Background()
+
+	grant, err := s.Grant(ctx, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kv.Put(ctx, "/fleet/machines/XXX/object", "{}", clientv3.WithLease(grant.ID)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kv.Put(ctx, "/fleet/machines/YYY/object", "{}", clientv3.WithLease(42)); err != ErrLeaseNotFound {
+		t.Errorf("Put with an unknown lease returned %v, want %v", err, ErrLeaseNotFound)
+	}
+	_, rev, _, changed := s.Changes(0)
+
+	clock.Advance(8 * time.Second)
+	if _, err := s.KeepAliveOnce(ctx, grant.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(8 * time.Second)
+	if res, _ := kv.Get(ctx, "/fleet/machines/XXX/object"); len(res.Kvs) != 1 {
+		t.Errorf("key expired although its lease was kept alive")
+	}
+
+	clock.Advance(3 * time.Second)
+	if res, _ := kv.Get(ctx, "/fleet/machines/XXX/object"); len(res.Kvs) != 0 {
+		t.Errorf("key did not expire along with its lease")
+	}
+	select {
+	case <-changed:
+	default:
+		t.Errorf("expiry of the key was not signalled")
+	}
+	keys, _, complete, _ := s.Changes(rev)
+	if !complete || !reflect.DeepEqual(keys, []string{"/fleet/machines/XXX/object"}) {
+		t.Errorf("Changes returned %v, %t after the key expired", keys, complete)
+	}
+	if _, err := s.KeepAliveOnce(ctx, grant.ID); err != ErrLeaseNotFound {
+		t.Errorf("KeepAliveOnce of an expired lease returned %v, want %v", err, ErrLeaseNotFound)
+	}
+}
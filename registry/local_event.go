@@ -0,0 +1,124 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sync"
+
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/registry/local"
+)
+
+type localEventStream struct {
+	store      *local.Store
+	rootPrefix string
+
+	// parse picks the changes of interest among the changed keys and
+	// resync is emitted when changes were missed.
+	parse  func(key, prefix string) (pkg.Event, bool)
+	resync pkg.Event
+
+	mu *sync.Mutex
+	// revs holds, per consumer, the revision of the last change seen, so
+	// that changes occurring between two calls to Next are not missed.
+	revs map[chan struct{}]int64
+}
+
+// NewLocalEventStream returns an EventStream emitting the changes made to
+// the jobs kept in the given local store.
+func NewLocalEventStream(store *local.Store, rootPrefix string) pkg.EventStream {
+	return &localEventStream{
+		store:      store,
+		rootPrefix: rootPrefix,
+		parse:      parseV3Key,
+		resync:     JobTargetChangeEvent,
+		mu:         new(sync.Mutex),
+		revs:       make(map[chan struct{}]int64),
+	}
+}
+
+// NewLocalClusterEventStream returns an EventStream emitting a
+// ClusterChangeEvent whenever a unit, unit state or machine kept in the
+// given local store changes.
+func NewLocalClusterEventStream(store *local.Store, rootPrefix string) pkg.EventStream {
+	return &localEventStream{
+		store:      store,
+		rootPrefix: rootPrefix,
+		parse:      parseLocalCluster,
+		resync:     ClusterChangeEvent,
+		mu:         new(sync.Mutex),
+		revs:       make(map[chan struct{}]int64),
+	}
+}
+
+// Next returns a channel which will emit an Event as soon as one of interest occurs
+func (es *localEventStream) Next(stop chan struct{}) chan pkg.Event {
+	es.mu.Lock()
+	rev, known := es.revs[stop]
+	if !known {
+		_, rev, _, _ = es.store.Changes(0)
+		es.revs[stop] = rev
+		go func() {
+			<-stop
+			es.mu.Lock()
+			delete(es.revs, stop)
+			es.mu.Unlock()
+		}()
+	}
+	es.mu.Unlock()
+
+	evchan := make(chan pkg.Event)
+	go func() {
+		for {
+			keys, cur, complete, changed := es.store.Changes(rev)
+			rev = cur
+			es.mu.Lock()
+			if _, known := es.revs[stop]; known {
+				es.revs[stop] = rev
+			}
+			es.mu.Unlock()
+
+			ev, ok := es.resync, !complete
+			for _, key := range keys {
+				if ok {
+					break
+				}
+				ev, ok = es.parse(key, es.rootPrefix)
+			}
+			if ok {
+				select {
+				case evchan <- ev:
+				case <-stop:
+				}
+				return
+			}
+
+			select {
+			case <-changed:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return evchan
+}
+
+func parseLocalCluster(key, prefix string) (ev pkg.Event, ok bool) {
+	if isClusterKey(key, prefix) {
+		ev, ok = ClusterChangeEvent, true
+	}
+	return
+}
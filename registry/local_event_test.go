@@ -0,0 +1,106 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/registry/local"
+)
+
+func TestLocalEventStream(t *testing.T) {
+	store := local.New()
+	kv := clientv3.NewKVFromKVClient(store)
+	es := NewLocalEventStream(store, "/fleet")
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// changes made between two calls to Next are not missed
+	evchan := es.Next(stop)
+	kv.Put(context.Background(), "/fleet/machines/XXX/object", "{}")
+	kv.Put(context.Background(), "/fleet/job/foo.service/target", "XXX")
+	select {
+	case ev := <-evchan:
+		if ev != JobTargetChangeEvent {
+			t.Errorf("got event %v, want %v", ev, JobTargetChangeEvent)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+
+	kv.Put(context.Background(), "/fleet/job/foo.service/target-state", "launched")
+	select {
+	case ev := <-es.Next(stop):
+		if ev != JobTargetStateChangeEvent {
+			t.Errorf("got event %v, want %v", ev, JobTargetStateChangeEvent)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+
+	evchan = es.Next(stop)
+	kv.Put(context.Background(), "/fleet/machines/XXX/object", "{}")
+	select {
+	case ev := <-evchan:
+		t.Errorf("got unexpected event %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLocalClusterEventStream(t *testing.T) {
+	store := local.New()
+	kv := clientv3.NewKVFromKVClient(store)
+	es := NewLocalClusterEventStream(store, "/fleet")
+	stop := make(chan struct{})
+	defer close(stop)
+
+	kv.Put(context.Background(), "/fleet/states/foo.service/XXX", `{"activeState":"active"}`)
+	kv.Put(context.Background(), "/fleet/job/foo.service/job-state", "launched")
+
+	// neither job states nor writes of an unchanged value are changes
+	evchan := es.Next(stop)
+	kv.Put(context.Background(), "/fleet/job/foo.service/job-state", "inactive")
+	kv.Put(context.Background(), "/fleet/states/foo.service/XXX", `{"activeState":"active"}`)
+	select {
+	case ev := <-evchan:
+		t.Fatalf("got unexpected event %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	kv.Put(context.Background(), "/fleet/states/foo.service/XXX", `{"activeState":"failed"}`)
+	select {
+	case ev := <-evchan:
+		if ev != ClusterChangeEvent {
+			t.Errorf("got event %v, want %v", ev, ClusterChangeEvent)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+
+	kv.Delete(context.Background(), "/fleet/machines/XXX/object")
+	kv.Put(context.Background(), "/fleet/machines/XXX/object", "{}")
+	select {
+	case ev := <-es.Next(stop):
+		if ev != ClusterChangeEvent {
+			t.Errorf("got event %v, want %v", ev, ClusterChangeEvent)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+}
@@ -135,6 +135,25 @@ func (r *EtcdRegistry) DeleteMachineMetadata(machID string, key string) error {
 	return r.SetMachineMetadata(machID, key, "")
 }
 
+// CordonMachine prevents new units from being scheduled to the machine.
+// Like metadata set through the registry, the flag persists across the
+// machine leaving and rejoining the cluster.
+func (r *EtcdRegistry) CordonMachine(machID string) error {
+	key := path.Join(r.keyPrefix, machinePrefix, machID, "cordoned")
+	_, err := r.kAPI.Set(context.Background(), key, "true", nil)
+	return err
+}
+
+// UncordonMachine allows new units to be scheduled to the machine again.
+func (r *EtcdRegistry) UncordonMachine(machID string) error {
+	key := path.Join(r.keyPrefix, machinePrefix, machID, "cordoned")
+	_, err := r.kAPI.Delete(context.Background(), key, nil)
+	if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+		err = nil
+	}
+	return err
+}
+
 func (r *EtcdRegistry) RemoveMachineState(machID string) error {
 	key := r.prefixed(machinePrefix, machID, "object")
 	_, err := r.kAPI.Delete(context.Background(), key, nil)
@@ -172,6 +191,7 @@ func mergeMetadata(machineMetadata, dynamicMetadata map[string]string) map[strin
 // readMachineState reads machine state from an etcd node
 func readMachineState(node *etcd.Node) (mach machine.MachineState, err error) {
 	var metadata map[string]string
+	cordoned := false
 
 	for _, obj := range node.Nodes {
 		if strings.HasSuffix(obj.Key, "/object") {
@@ -185,9 +205,12 @@ func readMachineState(node *etcd.Node) (mach machine.MachineState, err error) {
 			for _, mdnode := range obj.Nodes {
 				metadata[path.Base(mdnode.Key)] = mdnode.Value
 			}
+		} else if strings.HasSuffix(obj.Key, "/cordoned") {
+			cordoned = true
 		}
 	}
 
 	mach.Metadata = mergeMetadata(mach.Metadata, metadata)
+	mach.Cordoned = cordoned
 	return
 }
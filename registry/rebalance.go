@@ -0,0 +1,60 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// RequestRebalance implements the ClusterRegistry interface
+func (r *EtcdRegistry) RequestRebalance() error {
+	_, err := r.kAPI.Set(context.Background(), r.rebalancePath(), time.Now().UTC().Format(time.RFC3339), nil)
+	return err
+}
+
+// TakeRebalanceRequest implements the ClusterRegistry interface. As it is
+// called in every reconciliation round, the request is only deleted if it
+// exists, and only if it was not renewed in the meantime; a renewed request
+// is taken in a later round.
+func (r *EtcdRegistry) TakeRebalanceRequest() (bool, error) {
+	res, err := r.kAPI.Get(context.Background(), r.rebalancePath(), nil)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = nil
+		}
+		return false, err
+	}
+
+	opts := &etcd.DeleteOptions{
+		PrevIndex: res.Node.ModifiedIndex,
+	}
+	_, err = r.kAPI.Delete(context.Background(), r.rebalancePath(), opts)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			return false, nil
+		}
+		if !isEtcdError(err, etcd.ErrorCodeTestFailed) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (r *EtcdRegistry) rebalancePath() string {
+	return r.prefixed("/engine/rebalance")
+}
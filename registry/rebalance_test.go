@@ -0,0 +1,52 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+)
+
+func TestTakeRebalanceRequest(t *testing.T) {
+	requested := &etcd.Response{Node: &etcd.Node{Key: "/fleet/engine/rebalance", ModifiedIndex: 7}}
+	tests := []struct {
+		res       []*etcd.Response
+		err       []error
+		requested bool
+		deletes   int
+	}{
+		// nothing is deleted without a request
+		{nil, []error{etcd.Error{Code: etcd.ErrorCodeKeyNotFound}}, false, 0},
+		{[]*etcd.Response{requested, {}}, nil, true, 1},
+		// a request renewed in the meantime is still a request
+		{[]*etcd.Response{requested}, []error{nil, etcd.Error{Code: etcd.ErrorCodeTestFailed}}, true, 1},
+	}
+
+	for i, tt := range tests {
+		e := &testEtcdKeysAPI{res: tt.res, err: tt.err}
+		r := &EtcdRegistry{kAPI: e, keyPrefix: "/fleet/"}
+		got, err := r.TakeRebalanceRequest()
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if got != tt.requested {
+			t.Errorf("case %d: expected requested=%t, got %t", i, tt.requested, got)
+		}
+		if len(e.deletes) != tt.deletes {
+			t.Errorf("case %d: expected %d deletes, got %v", i, tt.deletes, e.deletes)
+		}
+	}
+}
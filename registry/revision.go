@@ -0,0 +1,156 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/job"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/unit"
+)
+
+const (
+	revisionPrefix = "revisions"
+
+	// MaxUnitRevisions is the number of revisions kept per unit name.
+	// Older revisions are dropped as new ones are saved.
+	MaxUnitRevisions = 10
+)
+
+// revisionModel is used for serializing and deserializing UnitRevisions
+// stored in the Registry
+type revisionModel struct {
+	Revision int
+	UnitHash unit.Hash
+	Created  time.Time
+	User     string
+}
+
+// SaveUnitRevision records the given unit file as the newest revision of
+// the named Unit, unless it already is. The revision number and creation
+// time are assigned by the Registry.
+func (r *EtcdRegistry) SaveUnitRevision(name string, rev job.UnitRevision) error {
+	models, err := r.revisionModels(name)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(models) > 0 {
+		last := models[len(models)-1]
+		if last.UnitHash == rev.Unit.Hash() {
+			return nil
+		}
+		next = last.Revision + 1
+	}
+
+	if err := r.storeOrGetUnitFile(rev.Unit); err != nil {
+		return err
+	}
+
+	rm := revisionModel{
+		Revision: next,
+		UnitHash: rev.Unit.Hash(),
+		Created:  time.Now().UTC(),
+		User:     rev.User,
+	}
+	val, err := marshal(rm)
+	if err != nil {
+		return err
+	}
+
+	opts := &etcd.SetOptions{
+		PrevExist: etcd.PrevNoExist,
+	}
+	_, err = r.kAPI.Set(context.Background(), r.revisionPath(name, next), val, opts)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeNodeExist) {
+			err = fmt.Errorf("revision %d of Unit(%s) was saved concurrently", next, name)
+		}
+		return err
+	}
+
+	for i := 0; i < len(models)+1-MaxUnitRevisions; i++ {
+		_, err := r.kAPI.Delete(context.Background(), r.revisionPath(name, models[i].Revision), nil)
+		if err != nil && !isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			log.Warningf("Failed pruning revision %d of Unit(%s): %v", models[i].Revision, name, err)
+		}
+	}
+
+	return nil
+}
+
+// UnitRevisions returns the known revisions of the named Unit, oldest
+// first. Revisions whose unit file cannot be found are skipped.
+func (r *EtcdRegistry) UnitRevisions(name string) ([]job.UnitRevision, error) {
+	models, err := r.revisionModels(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]job.UnitRevision, 0, len(models))
+	for _, rm := range models {
+		uf := r.getUnitByHash(rm.UnitHash)
+		if uf == nil {
+			log.Warningf("No Unit found in Registry for revision %d of Unit(%s)", rm.Revision, name)
+			continue
+		}
+		revs = append(revs, job.UnitRevision{
+			Revision: rm.Revision,
+			Unit:     *uf,
+			Created:  rm.Created,
+			User:     rm.User,
+		})
+	}
+
+	return revs, nil
+}
+
+func (r *EtcdRegistry) revisionModels(name string) ([]revisionModel, error) {
+	opts := &etcd.GetOptions{
+		Sort: true,
+	}
+	res, err := r.kAPI.Get(context.Background(), r.prefixed(revisionPrefix, name), opts)
+	if err != nil {
+		if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	models := make([]revisionModel, 0, len(res.Node.Nodes))
+	for _, node := range res.Node.Nodes {
+		var rm revisionModel
+		if err := unmarshal(node.Value, &rm); err != nil {
+			log.Errorf("Error unmarshaling revision %s: %v", path.Base(node.Key), err)
+			continue
+		}
+		models = append(models, rm)
+	}
+
+	return models, nil
+}
+
+// revisionPath zero-pads the revision number so that etcd's lexical
+// ordering of the keys matches the numerical one.
+func (r *EtcdRegistry) revisionPath(name string, rev int) string {
+	return r.prefixed(revisionPrefix, name, fmt.Sprintf("%010d", rev))
+}
@@ -0,0 +1,299 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/fleet/debug"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/pkg"
+	pb "github.com/coreos/fleet/protobuf"
+)
+
+const (
+	// Occurs when the engine pushes a change of units relevant to an agent
+	AgentUnitsChangeEvent = pkg.Event("AgentUnitsChangeEvent")
+
+	agentEventsRetryInterval    = time.Second
+	agentEventsMaxRetryInterval = 30 * time.Second
+)
+
+// agentEventBroker fans out unit changes to the agents subscribed through
+// the AgentEvents stream. Changes are coalesced per subscriber, so a slow
+// agent receives a single update listing every unit touched since its
+// previous one.
+type agentEventBroker struct {
+	mu   sync.Mutex
+	subs map[*agentSubscriber]struct{}
+}
+
+type agentSubscriber struct {
+	machID string
+
+	mu    sync.Mutex
+	units map[string]struct{}
+	// wake holds at most one pending notification
+	wake chan struct{}
+}
+
+func newAgentEventBroker() *agentEventBroker {
+	return &agentEventBroker{
+		subs: make(map[*agentSubscriber]struct{}),
+	}
+}
+
+func (b *agentEventBroker) subscribe(machID string) *agentSubscriber {
+	sub := &agentSubscriber{
+		machID: machID,
+		units:  make(map[string]struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *agentEventBroker) unsubscribe(sub *agentSubscriber) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
+
+// publish notifies the agents on the given machine that the named unit
+// changed. An empty machID notifies every subscribed agent.
+func (b *agentEventBroker) publish(unitName, machID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if machID == "" || sub.machID == machID {
+			sub.add(unitName)
+		}
+	}
+}
+
+func (sub *agentSubscriber) add(unitName string) {
+	sub.mu.Lock()
+	sub.units[unitName] = struct{}{}
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the names of the units changed since the last call, sorted.
+func (sub *agentSubscriber) take() []string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	names := make([]string, 0, len(sub.units))
+	for name := range sub.units {
+		names = append(names, name)
+	}
+	sub.units = make(map[string]struct{})
+	sort.Strings(names)
+	return names
+}
+
+type agentEventStream struct {
+	mux      *RegistryMux
+	mach     machine.Machine
+	fallback pkg.EventStream
+
+	mu     sync.Mutex
+	stop   chan struct{}
+	events chan pkg.Event
+}
+
+// NewAgentEventStream returns an EventStream emitting the changes the
+// gRPC engine pushes for the local machine. While the cluster leader is
+// not a gRPC engine, events are read from the fallback stream instead,
+// which may be nil.
+func NewAgentEventStream(mux *RegistryMux, mach machine.Machine, fallback pkg.EventStream) pkg.EventStream {
+	return &agentEventStream{
+		mux:      mux,
+		mach:     mach,
+		fallback: fallback,
+	}
+}
+
+// Next returns a channel which will emit an Event as soon as one of interest
+// occurs. A single subscription is kept open for as long as stop is not
+// closed, so changes pushed between two calls to Next are not lost.
+func (es *agentEventStream) Next(stop chan struct{}) chan pkg.Event {
+	es.mu.Lock()
+	if es.stop != stop {
+		es.stop = stop
+		es.events = make(chan pkg.Event, 1)
+		go es.receive(stop, es.events)
+	}
+	events := es.events
+	es.mu.Unlock()
+
+	evchan := make(chan pkg.Event)
+	go func() {
+		select {
+		case <-stop:
+		case ev := <-events:
+			select {
+			case <-stop:
+			case evchan <- ev:
+			}
+		}
+	}()
+	return evchan
+}
+
+func (es *agentEventStream) receive(stop chan struct{}, events chan pkg.Event) {
+	emit := func(ev pkg.Event) {
+		select {
+		case events <- ev:
+		default:
+		}
+	}
+
+	retry := agentEventsRetryInterval
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if es.mux.UseEtcdRegistry() {
+			if es.fallback == nil {
+				sleepOrStop(agentEventsRetryInterval, stop)
+				continue
+			}
+			// Once the engine switches to gRPC, the next etcd event
+			// hands over to the pushed stream.
+			select {
+			case <-stop:
+				return
+			case ev := <-es.fallback.Next(stop):
+				emit(ev)
+			}
+			continue
+		}
+
+		err := es.watch(stop, func() {
+			retry = agentEventsRetryInterval
+			emit(AgentUnitsChangeEvent)
+		})
+		if err != nil {
+			log.Errorf("Agent events stream from engine failed, retrying in %v: %v", retry, err)
+		}
+		sleepOrStop(retry, stop)
+		retry *= 2
+		if retry > agentEventsMaxRetryInterval {
+			retry = agentEventsMaxRetryInterval
+		}
+	}
+}
+
+// watch consumes the AgentEvents stream until it fails or stop is closed.
+// A notification is emitted right after subscribing, as changes may have
+// been missed while no stream was open.
+func (es *agentEventStream) watch(stop chan struct{}, notify func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	stream, err := es.mux.agentEvents(ctx, es.mach.State().ID)
+	if err != nil {
+		return err
+	}
+	notify()
+	for {
+		state, err := stream.Recv()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			return err
+		}
+		log.Debugf("Engine pushed changes of units %v", state.UnitIds)
+		notify()
+	}
+}
+
+func sleepOrStop(d time.Duration, stop chan struct{}) {
+	select {
+	case <-stop:
+	case <-time.After(d):
+	}
+}
+
+// AgentEvents streams the names of the units whose schedule or target state
+// changed on the subscribing machine until the agent goes away or the
+// server stops.
+func (s *rpcserver) AgentEvents(props *pb.MachineProperties, stream pb.Registry_AgentEventsServer) error {
+	if debugRPCServer {
+		defer debug.Exit_(debug.Enter_(props.Id))
+	}
+
+	sub := s.events.subscribe(props.Id)
+	defer s.events.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.stop:
+			return nil
+		case <-sub.wake:
+			if err := stream.Send(&pb.UpdatedState{UnitIds: sub.take()}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// notifyAgents publishes a change of the named unit to the agent it is
+// scheduled to. Changes to global units are published to every agent.
+func (s *rpcserver) notifyAgents(unitName string) {
+	machID, ok := s.unitAgent(unitName)
+	if ok {
+		s.events.publish(unitName, machID)
+	}
+}
+
+// unitAgent returns the machine whose agent is interested in the named unit,
+// or an empty machID if all agents are. It returns false if no agent is.
+func (s *rpcserver) unitAgent(unitName string) (string, bool) {
+	if su := s.localRegistry.ScheduledUnit(unitName); su.MachineID != "" {
+		return su.MachineID, true
+	}
+	u, exists := s.localRegistry.Unit(unitName)
+	if exists && rpcUnitToJobUnit(&u).IsGlobal() {
+		return "", true
+	}
+	return "", false
+}
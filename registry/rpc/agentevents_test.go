@@ -0,0 +1,148 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/coreos/fleet/protobuf"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/unit"
+)
+
+func TestAgentEventBrokerPublish(t *testing.T) {
+	b := newAgentEventBroker()
+	sub1 := b.subscribe("machine1")
+	sub2 := b.subscribe("machine2")
+
+	b.publish("b.service", "machine1")
+	b.publish("a.service", "machine1")
+	b.publish("b.service", "machine1")
+	b.publish("global.service", "")
+
+	if len(sub1.wake) != 1 {
+		t.Fatalf("expected a single pending notification for machine1, got %d", len(sub1.wake))
+	}
+	if got, want := sub1.take(), []string{"a.service", "b.service", "global.service"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected units for machine1: got %v, want %v", got, want)
+	}
+	if got := sub1.take(); len(got) != 0 {
+		t.Errorf("expected no units after take, got %v", got)
+	}
+	if got, want := sub2.take(), []string{"global.service"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected units for machine2: got %v, want %v", got, want)
+	}
+
+	b.unsubscribe(sub2)
+	b.publish("global.service", "")
+	if got := sub2.take(); len(got) != 0 {
+		t.Errorf("unsubscribed agent received units %v", got)
+	}
+}
+
+type fakeAgentEventsServer struct {
+	grpc.ServerStream
+
+	ctx  context.Context
+	sent chan []string
+}
+
+func (f *fakeAgentEventsServer) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeAgentEventsServer) Send(s *pb.UpdatedState) error {
+	f.sent <- s.UnitIds
+	return nil
+}
+
+func TestRPCServerAgentEvents(t *testing.T) {
+	s := &rpcserver{
+		etcdRegistry:  registry.NewFakeRegistry(),
+		mu:            new(sync.Mutex),
+		localRegistry: newInmemoryRegistry(),
+		events:        newAgentEventBroker(),
+		stop:          make(chan struct{}),
+	}
+
+	uf, err := unit.NewUnitFile("[Service]\nExecStart=/bin/true\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing unit: %v", err)
+	}
+	for _, name := range []string{"foo.service", "bar.service"} {
+		if _, err := s.CreateUnit(context.Background(), &pb.Unit{Name: name, Unit: uf.ToPB()}); err != nil {
+			t.Fatalf("unexpected error creating %s: %v", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeAgentEventsServer{ctx: ctx, sent: make(chan []string, 10)}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.AgentEvents(&pb.MachineProperties{Id: "machine1"}, stream)
+	}()
+
+	// Wait for the agent to be subscribed before publishing changes
+	for i := 0; ; i++ {
+		s.events.mu.Lock()
+		n := len(s.events.subs)
+		s.events.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("agent did not subscribe to events")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.ScheduleUnit(context.Background(), &pb.ScheduleUnitRequest{Name: "bar.service", MachineID: "machine2"})
+	s.ScheduleUnit(context.Background(), &pb.ScheduleUnitRequest{Name: "foo.service", MachineID: "machine1"})
+
+	select {
+	case got := <-stream.sent:
+		if want := []string{"foo.service"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected units pushed: got %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event pushed after scheduling a unit")
+	}
+
+	s.SetUnitTargetState(context.Background(), &pb.ScheduledUnit{Name: "foo.service", CurrentState: pb.TargetState_LAUNCHED})
+	select {
+	case got := <-stream.sent:
+		if want := []string{"foo.service"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected units pushed: got %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event pushed after changing the target state")
+	}
+
+	cancel()
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("AgentEvents did not return after the stream was closed")
+	}
+	if len(s.events.subs) != 0 {
+		t.Errorf("agent still subscribed after the stream was closed")
+	}
+}
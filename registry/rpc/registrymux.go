@@ -16,30 +16,34 @@ package rpc
 
 import (
 	"errors"
-	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
+	"golang.org/x/net/context"
 
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/engine"
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/pkg/lease"
+	pb "github.com/coreos/fleet/protobuf"
 	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/unit"
 )
 
 type RegistryMux struct {
-	etcdRegistry    *registry.EtcdRegistry
+	etcdRegistry    engine.CompleteRegistry
 	localMachine    machine.Machine
 	rpcserver       *rpcserver
 	currentRegistry registry.Registry
 	rpcRegistry     *RPCRegistry
 	currentEngine   machine.MachineState
 	leaseManager    lease.Manager
+	transport       TransportConfig
 
 	handlingEngineChange *sync.RWMutex
 }
@@ -50,12 +54,13 @@ const (
 	engineLeaderKeyPath = "engine-leader"
 )
 
-func NewRegistryMux(etcdRegistry *registry.EtcdRegistry, localMachine machine.Machine, leaseManager lease.Manager) *RegistryMux {
+func NewRegistryMux(etcdRegistry engine.CompleteRegistry, localMachine machine.Machine, leaseManager lease.Manager, transport TransportConfig) *RegistryMux {
 	return &RegistryMux{
 		etcdRegistry:         etcdRegistry,
 		localMachine:         localMachine,
 		handlingEngineChange: new(sync.RWMutex),
 		leaseManager:         leaseManager,
+		transport:            transport,
 	}
 }
 
@@ -77,7 +82,7 @@ func (r *RegistryMux) ConnectToRegistry(e *engine.Engine) {
 						r.rpcRegistry.Close()
 					}
 					log.Infof("New engine supports gRPC, connecting\n")
-					r.rpcRegistry = NewRPCRegistry(r.rpcDialerNoEngine)
+					r.rpcRegistry = NewRPCRegistry(r.rpcDialerNoEngine, r.transport)
 					// connect to rpc registry
 					r.rpcRegistry.Connect()
 					r.currentRegistry = r.rpcRegistry
@@ -94,6 +99,37 @@ func (r *RegistryMux) ConnectToRegistry(e *engine.Engine) {
 	}
 }
 
+// engineAddress returns the address agents connect to the current engine at,
+// its private address if it has one.
+func (r *RegistryMux) engineAddress() string {
+	return r.currentEngine.AddressFor(machine.AddressPrivate)
+}
+
+// engineAddresses returns the addresses the engine of the given state
+// listens on, and agents try in turn: its private address, if it published
+// one, then its PublicIP, which is all engines and agents of earlier
+// versions know of.
+func engineAddresses(ms machine.MachineState) []string {
+	addrs := []string{ms.AddressFor(machine.AddressPrivate)}
+	if ms.PublicIP != "" && ms.PublicIP != addrs[0] {
+		addrs = append(addrs, ms.PublicIP)
+	}
+	return addrs
+}
+
+// dialEngine connects to the first address of the current engine that
+// accepts connections.
+func (r *RegistryMux) dialEngine() (conn net.Conn, err error) {
+	for _, ip := range engineAddresses(r.currentEngine) {
+		conn, err = net.Dial("tcp", net.JoinHostPort(ip, strconv.Itoa(r.transport.port())))
+		if err == nil {
+			log.Infof("Connected to engine on %s\n", ip)
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
 func (r *RegistryMux) rpcDialerNoEngine(_ string, timeout time.Duration) (net.Conn, error) {
 	ticker := time.Tick(dialRegistryReconnectTimeout)
 	// Timeout re-defined to call etcd every 5secs to get the leader
@@ -103,7 +139,7 @@ func (r *RegistryMux) rpcDialerNoEngine(_ string, timeout time.Duration) (net.Co
 	for {
 		select {
 		case <-check:
-			log.Errorf("Unable to connect to engine %s\n", r.currentEngine.PublicIP)
+			log.Errorf("Unable to connect to engine %s\n", r.engineAddress())
 			// Get the new engine leader of the cluster out of etcd
 			lease, err := r.leaseManager.GetLease(engineLeaderKeyPath)
 			// Key found
@@ -124,7 +160,7 @@ func (r *RegistryMux) rpcDialerNoEngine(_ string, timeout time.Duration) (net.Co
 							return nil, errors.New("New leader engine has not gRPC enabled!")
 						}
 						r.currentEngine = s
-						log.Infof("Found a new engine to connect to: %s\n", r.currentEngine.PublicIP)
+						log.Infof("Found a new engine to connect to: %s\n", r.engineAddress())
 						// Restore initial check configuration
 						timeout = 5 * time.Second
 						check = time.After(timeout)
@@ -136,10 +172,8 @@ func (r *RegistryMux) rpcDialerNoEngine(_ string, timeout time.Duration) (net.Co
 				check = time.After(timeout)
 			}
 		case <-ticker:
-			addr := fmt.Sprintf("%s:%d", r.currentEngine.PublicIP, rpcServerPort)
-			conn, err := net.Dial("tcp", addr)
+			conn, err := r.dialEngine()
 			if err == nil {
-				log.Infof("Connected to engine on %s\n", r.currentEngine.PublicIP)
 				return conn, nil
 			}
 			log.Errorf("Retry to connect to new engine: %+v", err)
@@ -154,13 +188,11 @@ func (r *RegistryMux) rpcDialer(_ string, timeout time.Duration) (net.Conn, erro
 	for {
 		select {
 		case <-alert:
-			log.Errorf("Unable to connect to engine %s\n", r.currentEngine.PublicIP)
+			log.Errorf("Unable to connect to engine %s\n", r.engineAddress())
 			return nil, errors.New("Unable to connect to new engine, the client connection is closing")
 		case <-ticker:
-			addr := fmt.Sprintf("%s:%d", r.currentEngine.PublicIP, rpcServerPort)
-			conn, err := net.Dial("tcp", addr)
+			conn, err := r.dialEngine()
 			if err == nil {
-				log.Infof("Connected to engine on %s\n", r.currentEngine.PublicIP)
 				return conn, nil
 			}
 			log.Errorf("Retry to connect to new engine: %+v", err)
@@ -189,7 +221,7 @@ func (r *RegistryMux) EngineChanged(newEngine machine.MachineState) {
 				// start rpc server
 				log.Infof("Starting rpc server...\n")
 				var err error
-				r.rpcserver, err = NewRPCServer(r.etcdRegistry, newEngine.PublicIP)
+				r.rpcserver, err = NewRPCServer(r.etcdRegistry, engineAddresses(newEngine), r.transport)
 				if err != nil {
 					log.Fatalf("Unable to create rpc server %+v", err)
 				}
@@ -209,7 +241,7 @@ func (r *RegistryMux) EngineChanged(newEngine machine.MachineState) {
 				r.currentRegistry = r.rpcRegistry
 			} else {
 				log.Infof("New engine supports gRPC, connecting\n")
-				r.rpcRegistry = NewRPCRegistry(r.rpcDialer)
+				r.rpcRegistry = NewRPCRegistry(r.rpcDialer, r.transport)
 				// connect to rpc registry
 				r.rpcRegistry.Connect()
 				r.currentRegistry = r.rpcRegistry
@@ -238,6 +270,15 @@ func (r *RegistryMux) getRegistry() registry.Registry {
 	return r.currentRegistry
 }
 
+// agentEvents opens the AgentEvents stream of the current gRPC engine.
+func (r *RegistryMux) agentEvents(ctx context.Context, machID string) (pb.Registry_AgentEventsClient, error) {
+	rpcRegistry, ok := r.getRegistry().(*RPCRegistry)
+	if !ok {
+		return nil, errors.New("engine does not support gRPC")
+	}
+	return rpcRegistry.AgentEvents(ctx, machID)
+}
+
 func (r *RegistryMux) IsRegistryReady() bool {
 	return r.getRegistry().IsRegistryReady()
 }
@@ -254,6 +295,10 @@ func (r *RegistryMux) CreateUnit(unit *job.Unit) error {
 	return r.getRegistry().CreateUnit(unit)
 }
 
+func (r *RegistryMux) UpdateUnit(unit *job.Unit) error {
+	return r.getRegistry().UpdateUnit(unit)
+}
+
 func (r *RegistryMux) CreateMachineState(ms machine.MachineState, ttl time.Duration) (uint64, error) {
 	return r.etcdRegistry.CreateMachineState(ms, ttl)
 }
@@ -338,6 +383,14 @@ func (r *RegistryMux) UpdateEngineVersion(from int, to int) error {
 	return r.etcdRegistry.UpdateEngineVersion(from, to)
 }
 
+func (r *RegistryMux) RequestRebalance() error {
+	return r.etcdRegistry.RequestRebalance()
+}
+
+func (r *RegistryMux) TakeRebalanceRequest() (bool, error) {
+	return r.etcdRegistry.TakeRebalanceRequest()
+}
+
 func (r *RegistryMux) SetMachineMetadata(machID string, key string, value string) error {
 	return r.etcdRegistry.SetMachineMetadata(machID, key, value)
 }
@@ -345,3 +398,45 @@ func (r *RegistryMux) SetMachineMetadata(machID string, key string, value string
 func (r *RegistryMux) DeleteMachineMetadata(machID string, key string) error {
 	return r.etcdRegistry.DeleteMachineMetadata(machID, key)
 }
+
+func (r *RegistryMux) SaveUnitRevision(name string, rev job.UnitRevision) error {
+	return r.etcdRegistry.SaveUnitRevision(name, rev)
+}
+
+func (r *RegistryMux) UnitRevisions(name string) ([]job.UnitRevision, error) {
+	return r.etcdRegistry.UnitRevisions(name)
+}
+
+func (r *RegistryMux) RecordUnitFailure(name, machID string) error {
+	return r.etcdRegistry.RecordUnitFailure(name, machID)
+}
+
+func (r *RegistryMux) UnitFailures() (map[string]job.UnitFailures, error) {
+	return r.etcdRegistry.UnitFailures()
+}
+
+// AppendAuditRecord implements the audit.Store interface
+func (r *RegistryMux) AppendAuditRecord(rec audit.Record) error {
+	store, ok := r.etcdRegistry.(audit.Store)
+	if !ok {
+		return errors.New("the registry cannot store audit records")
+	}
+	return store.AppendAuditRecord(rec)
+}
+
+// AuditRecords implements the audit.Store interface
+func (r *RegistryMux) AuditRecords() ([]audit.Record, error) {
+	store, ok := r.etcdRegistry.(audit.Store)
+	if !ok {
+		return nil, errors.New("the registry cannot store audit records")
+	}
+	return store.AuditRecords()
+}
+
+func (r *RegistryMux) CordonMachine(machID string) error {
+	return r.etcdRegistry.CordonMachine(machID)
+}
+
+func (r *RegistryMux) UncordonMachine(machID string) error {
+	return r.etcdRegistry.UncordonMachine(machID)
+}
@@ -16,9 +16,13 @@ package rpc
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
+	"reflect"
+	"strconv"
 	"syscall"
 	"testing"
+	"time"
 
 	etcd "github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
@@ -107,12 +111,12 @@ func TestRegistryMuxUnitManagement(t *testing.T) {
 		t.Fatalf("unexpected error creating systemd unit manager: %v", err)
 	}
 
-	mach := machine.NewCoreOSMachine(*state, mgr)
+	mach := machine.NewCoreOSMachine(*state, mgr, nil)
 	e := &testEtcdKeysAPI{}
 	etcdReg := registry.NewEtcdRegistry(e, "/fleet/")
 
 	lManager := lease.NewEtcdLeaseManager(e, "/fleet/")
-	reg := NewRegistryMux(etcdReg, mach, lManager)
+	reg := NewRegistryMux(etcdReg, mach, lManager, TransportConfig{})
 
 	contents := `
 [Unit]
@@ -148,3 +152,53 @@ Description = Foo
 		t.Fatalf("unexpected error removing machine state: %v", err)
 	}
 }
+
+func TestEngineAddresses(t *testing.T) {
+	tests := []struct {
+		state machine.MachineState
+		addrs []string
+	}{
+		// engines of earlier versions only publish their PublicIP
+		{machine.MachineState{PublicIP: "1.2.3.4"}, []string{"1.2.3.4"}},
+		{
+			machine.MachineState{PublicIP: "1.2.3.4", Addresses: []machine.Address{{Role: machine.AddressPrivate, IP: "10.0.0.4"}}},
+			[]string{"10.0.0.4", "1.2.3.4"},
+		},
+		{
+			machine.MachineState{PublicIP: "1.2.3.4", Addresses: []machine.Address{{Role: machine.AddressPrivate, IP: "1.2.3.4"}}},
+			[]string{"1.2.3.4"},
+		},
+	}
+
+	for i, tt := range tests {
+		if addrs := engineAddresses(tt.state); !reflect.DeepEqual(addrs, tt.addrs) {
+			t.Errorf("case %d: expected %v, got %v", i, tt.addrs, addrs)
+		}
+	}
+}
+
+func TestRPCServerListensOnAllAddresses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	addrs := []string{"127.0.0.1", "127.0.0.2"}
+	s, err := NewRPCServer(registry.NewFakeRegistry(), addrs, TransportConfig{Port: port})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go s.Start()
+	defer s.Stop()
+
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), time.Second)
+		if err != nil {
+			t.Errorf("failed connecting to %s: %v", addr, err)
+			continue
+		}
+		conn.Close()
+	}
+}
@@ -36,16 +36,18 @@ var DebugRPCRegistry bool = false
 
 type RPCRegistry struct {
 	dialer         func(addr string, timeout time.Duration) (net.Conn, error)
+	dialOption     grpc.DialOption
 	mu             *sync.Mutex
 	registryClient pb.RegistryClient
 	registryConn   *grpc.ClientConn
 	balancer       *simpleBalancer
 }
 
-func NewRPCRegistry(dialer func(string, time.Duration) (net.Conn, error)) *RPCRegistry {
+func NewRPCRegistry(dialer func(string, time.Duration) (net.Conn, error), transport TransportConfig) *RPCRegistry {
 	return &RPCRegistry{
-		mu:     new(sync.Mutex),
-		dialer: dialer,
+		mu:         new(sync.Mutex),
+		dialer:     dialer,
+		dialOption: transport.dialOption(),
 	}
 }
 
@@ -64,7 +66,7 @@ func (r *RPCRegistry) Connect() {
 	ep_engines := []string{":fleet-engine:"}
 	r.balancer = newSimpleBalancer(ep_engines)
 	connection, err := grpc.Dial(ep_engines[0],
-		grpc.WithTimeout(12*time.Second), grpc.WithInsecure(),
+		grpc.WithTimeout(12*time.Second), r.dialOption,
 		grpc.WithDialer(r.dialer), grpc.WithBlock(), grpc.WithBalancer(r.balancer))
 	if err != nil {
 		log.Fatalf("Unable to dial to registry: %s", err)
@@ -115,6 +117,16 @@ func (r *RPCRegistry) Status() (pb.HealthCheckResponse_ServingStatus, error) {
 	return resp.Status, err
 }
 
+// AgentEvents opens the stream over which the engine pushes changes of the
+// units relevant to the given machine. The stream is closed with ctx.
+func (r *RPCRegistry) AgentEvents(ctx context.Context, machID string) (pb.Registry_AgentEventsClient, error) {
+	if DebugRPCRegistry {
+		defer debug.Exit_(debug.Enter_(machID))
+	}
+
+	return r.getClient().AgentEvents(ctx, &pb.MachineProperties{Id: machID})
+}
+
 func (r *RPCRegistry) ClearUnitHeartbeat(unitName string) {
 	if DebugRPCRegistry {
 		defer debug.Exit_(debug.Enter_(unitName))
@@ -133,6 +145,28 @@ func (r *RPCRegistry) CreateUnit(j *job.Unit) error {
 	return err
 }
 
+// UpdateUnit has no RPC of its own: it re-creates the Unit through
+// CreateUnit, carrying over the current target state. Unlike the etcd
+// registry this is not atomic.
+func (r *RPCRegistry) UpdateUnit(j *job.Unit) error {
+	if DebugRPCRegistry {
+		defer debug.Exit_(debug.Enter_(j.Name))
+	}
+
+	cur, err := r.Unit(j.Name)
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		return errors.New("job does not exist")
+	}
+
+	un := j.ToPB()
+	un.DesiredState = cur.TargetState.ToPB()
+	_, err = r.getClient().CreateUnit(r.ctx(), &un)
+	return err
+}
+
 func (r *RPCRegistry) DestroyUnit(unitName string) error {
 	if DebugRPCRegistry {
 		defer debug.Exit_(debug.Enter_(unitName))
@@ -224,6 +258,30 @@ func (r *RPCRegistry) DeleteMachineMetadata(machID string, key string) error {
 	panic("Delete machine metadata function not implemented")
 }
 
+func (r *RPCRegistry) CordonMachine(machID string) error {
+	panic("Cordon machine function not implemented")
+}
+
+func (r *RPCRegistry) UncordonMachine(machID string) error {
+	panic("Uncordon machine function not implemented")
+}
+
+func (r *RPCRegistry) SaveUnitRevision(name string, rev job.UnitRevision) error {
+	panic("Save unit revision function not implemented")
+}
+
+func (r *RPCRegistry) UnitRevisions(name string) ([]job.UnitRevision, error) {
+	panic("Unit revisions function not implemented")
+}
+
+func (r *RPCRegistry) RecordUnitFailure(name, machID string) error {
+	panic("Record unit failure function not implemented")
+}
+
+func (r *RPCRegistry) UnitFailures() (map[string]job.UnitFailures, error) {
+	panic("Unit failures function not implemented")
+}
+
 func (r *RPCRegistry) Machines() ([]machine.MachineState, error) {
 	panic("Machines function not implemented")
 }
@@ -339,6 +397,7 @@ func (r *RPCRegistry) UnitState(unitName string) (*unit.UnitState, error) {
 		LoadState:   state.LoadState,
 		ActiveState: state.ActiveState,
 		SubState:    state.SubState,
+		Health:      state.Health,
 	}, nil
 }
 
@@ -362,6 +421,7 @@ func (r *RPCRegistry) UnitStates() ([]*unit.UnitState, error) {
 			LoadState:   state.LoadState,
 			ActiveState: state.ActiveState,
 			SubState:    state.SubState,
+			Health:      state.Health,
 		}
 	}
 	return nUnitStates, nil
@@ -375,6 +435,14 @@ func (r *RPCRegistry) UpdateEngineVersion(from, to int) error {
 	return errors.New("Update engine version function not implemented")
 }
 
+func (r *RPCRegistry) RequestRebalance() error {
+	return errors.New("Request rebalance function not implemented")
+}
+
+func (r *RPCRegistry) TakeRebalanceRequest() (bool, error) {
+	return false, errors.New("Take rebalance request function not implemented")
+}
+
 func (r *RPCRegistry) LatestDaemonVersion() (*semver.Version, error) {
 	return nil, errors.New("Latest daemon version function not implemented")
 }
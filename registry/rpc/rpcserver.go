@@ -15,9 +15,8 @@
 package rpc
 
 import (
-	"errors"
-	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -35,7 +34,6 @@ import (
 var debugRPCServer bool = false
 
 const (
-	rpcServerPort    = 50059
 	bindAddrMaxRetry = 5
 	bindRetryTimeout = 500 * time.Millisecond
 
@@ -45,11 +43,13 @@ const (
 type rpcserver struct {
 	etcdRegistry registry.Registry
 	mu           *sync.Mutex
-	listener     net.Listener
+	listeners    []net.Listener
 	grpcserver   *grpc.Server
 
 	stop          chan struct{}
+	stopOnce      sync.Once
 	localRegistry *inmemoryRegistry
+	events        *agentEventBroker
 
 	// serverStatus stores the serving status of this service.
 	serverStatus pb.HealthCheckResponse_ServingStatus
@@ -57,31 +57,26 @@ type rpcserver struct {
 	hasNonGRPCAgents bool
 }
 
-func NewRPCServer(reg registry.Registry, addr string) (*rpcserver, error) {
+// NewRPCServer creates the engine's gRPC server, listening on each of the
+// given addresses.
+func NewRPCServer(reg registry.Registry, addrs []string, transport TransportConfig) (*rpcserver, error) {
 	s := &rpcserver{
 		etcdRegistry:  reg,
 		mu:            new(sync.Mutex),
 		localRegistry: newInmemoryRegistry(),
+		events:        newAgentEventBroker(),
 		stop:          make(chan struct{}),
 	}
-	var err error
-	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", addr, rpcServerPort))
-	if err != nil {
-		return nil, err
-	}
-	for it := 0; it < bindAddrMaxRetry; it++ {
-		s.listener, err = net.ListenTCP("tcp", tcpAddr)
-		if err == nil {
-			break
+	for _, addr := range addrs {
+		l, err := listenTCP(net.JoinHostPort(addr, strconv.Itoa(transport.port())))
+		if err != nil {
+			s.closeListeners()
+			return nil, err
 		}
-		log.Infof("Retrying %d to bind %s address... %v", it, tcpAddr, err)
-		time.Sleep(bindRetryTimeout)
-	}
-	if err != nil {
-		return nil, err
+		s.listeners = append(s.listeners, l)
 	}
 
-	s.grpcserver = grpc.NewServer()
+	s.grpcserver = grpc.NewServer(transport.serverOptions()...)
 	s.localRegistry.LoadFrom(s.etcdRegistry)
 	pb.RegisterRegistryServer(s.grpcserver, s)
 
@@ -89,6 +84,7 @@ func NewRPCServer(reg registry.Registry, addr string) (*rpcserver, error) {
 
 	machineStates, err := s.etcdRegistry.Machines()
 	if err != nil {
+		s.closeListeners()
 		return nil, err
 	}
 	s.hasNonGRPCAgents = false
@@ -102,6 +98,28 @@ func NewRPCServer(reg registry.Registry, addr string) (*rpcserver, error) {
 	return s, nil
 }
 
+func listenTCP(addr string) (l net.Listener, err error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	for it := 0; it < bindAddrMaxRetry; it++ {
+		l, err = net.ListenTCP("tcp", tcpAddr)
+		if err == nil {
+			return l, nil
+		}
+		log.Infof("Retrying %d to bind %s address... %v", it, tcpAddr, err)
+		time.Sleep(bindRetryTimeout)
+	}
+	return nil, err
+}
+
+func (s *rpcserver) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+}
+
 func (s *rpcserver) Status(ctx context.Context, in *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -120,16 +138,23 @@ func (s *rpcserver) SetServingStatus(status pb.HealthCheckResponse_ServingStatus
 	s.mu.Unlock()
 }
 
+// Start serves gRPC requests on all listeners, until the first of them
+// fails.
 func (s *rpcserver) Start() error {
 	s.SetServingStatus(pb.HealthCheckResponse_SERVING)
-	return s.grpcserver.Serve(s.listener)
+	errc := make(chan error, len(s.listeners))
+	for _, l := range s.listeners {
+		go func(l net.Listener) {
+			errc <- s.grpcserver.Serve(l)
+		}(l)
+	}
+	return <-errc
 }
 
 func (s *rpcserver) Stop() {
-	if s.listener != nil {
-		s.listener.Close()
-	}
+	s.closeListeners()
 	s.SetServingStatus(pb.HealthCheckResponse_NOT_SERVING)
+	s.stopOnce.Do(func() { close(s.stop) })
 	s.grpcserver.Stop()
 }
 
@@ -251,6 +276,7 @@ func (s *rpcserver) CreateUnit(ctx context.Context, u *pb.Unit) (*pb.GenericRepl
 	err := s.etcdRegistry.CreateUnit(rpcUnitToJobUnit(u))
 	if err == nil {
 		s.localRegistry.CreateUnit(u)
+		s.notifyAgents(u.Name)
 	}
 	return &pb.GenericReply{}, err
 }
@@ -260,9 +286,13 @@ func (s *rpcserver) DestroyUnit(ctx context.Context, name *pb.UnitName) (*pb.Gen
 		defer debug.Exit_(debug.Enter_(name.Name))
 	}
 
+	machID, notify := s.unitAgent(name.Name)
 	err := s.etcdRegistry.DestroyUnit(name.Name)
 	if err == nil {
 		s.localRegistry.DestroyUnit(name.Name)
+		if notify {
+			s.events.publish(name.Name, machID)
+		}
 	}
 	return &pb.GenericReply{}, err
 }
@@ -313,6 +343,7 @@ func (s *rpcserver) ScheduleUnit(ctx context.Context, unit *pb.ScheduleUnitReque
 	err := s.etcdRegistry.ScheduleUnit(unit.Name, unit.MachineID)
 	if err == nil {
 		s.localRegistry.ScheduleUnit(unit.Name, unit.MachineID)
+		s.events.publish(unit.Name, unit.MachineID)
 	}
 	return &pb.GenericReply{}, err
 }
@@ -325,6 +356,7 @@ func (s *rpcserver) SetUnitTargetState(ctx context.Context, unit *pb.ScheduledUn
 	err := s.etcdRegistry.SetUnitTargetState(unit.Name, rpcUnitStateToJobState(unit.CurrentState))
 	if err == nil {
 		if s.localRegistry.SetUnitTargetState(unit.Name, unit.CurrentState) {
+			s.notifyAgents(unit.Name)
 		}
 	}
 	return &pb.GenericReply{}, err
@@ -338,13 +370,7 @@ func (s *rpcserver) UnscheduleUnit(ctx context.Context, unit *pb.UnscheduleUnitR
 	err := s.etcdRegistry.UnscheduleUnit(unit.Name, unit.MachineID)
 	if err == nil {
 		s.localRegistry.UnscheduleUnit(unit.Name, unit.MachineID)
+		s.events.publish(unit.Name, unit.MachineID)
 	}
 	return &pb.GenericReply{}, err
 }
-
-func (s *rpcserver) AgentEvents(props *pb.MachineProperties, stream pb.Registry_AgentEventsServer) error {
-	if debugRPCServer {
-		defer debug.Exit_(debug.Enter_(props.Id))
-	}
-	return errors.New("Agent events function not implemented")
-}
@@ -42,6 +42,7 @@ func rpcUnitStateToExtUnitState(state *pb.UnitState) *unit.UnitState {
 		ActiveState: state.ActiveState,
 		SubState:    state.SubState,
 		MachineID:   state.MachineID,
+		Health:      state.Health,
 	}
 }
 
@@ -0,0 +1,95 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"crypto/tls"
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// DefaultPort is the port the engine serves gRPC requests on
+	DefaultPort = 50059
+)
+
+// TransportConfig describes the channel between the engine and the agents.
+type TransportConfig struct {
+	// Port the engine listens on and agents dial to
+	Port int
+	// TLS enables mutual TLS authentication when set. Its certificate is
+	// presented by the engine as well as by the agents, and its RootCAs
+	// verify the certificate of the other side.
+	TLS *tls.Config
+}
+
+func (c TransportConfig) port() int {
+	if c.Port == 0 {
+		return DefaultPort
+	}
+	return c.Port
+}
+
+func (c TransportConfig) serverOptions() []grpc.ServerOption {
+	if c.TLS == nil {
+		return nil
+	}
+	cfg := &tls.Config{
+		Certificates: c.TLS.Certificates,
+		ClientCAs:    c.TLS.RootCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   c.TLS.MinVersion,
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(cfg))}
+}
+
+func (c TransportConfig) dialOption() grpc.DialOption {
+	if c.TLS == nil {
+		return grpc.WithInsecure()
+	}
+	return grpc.WithTransportCredentials(newEngineCredentials(c.TLS))
+}
+
+// engineCredentials verifies the certificate of the engine against the
+// address an agent actually dialed. The gRPC target is a placeholder, as
+// the engine moves between machines, so it cannot be used as server name.
+type engineCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+}
+
+func newEngineCredentials(cfg *tls.Config) credentials.TransportCredentials {
+	return &engineCredentials{
+		TransportCredentials: credentials.NewTLS(cfg),
+		config:               cfg,
+	}
+}
+
+func (c *engineCredentials) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	host, _, err := net.SplitHostPort(rawConn.RemoteAddr().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	creds := credentials.NewTLS(c.config)
+	creds.OverrideServerName(host)
+	return creds.ClientHandshake(ctx, addr, rawConn)
+}
+
+func (c *engineCredentials) Clone() credentials.TransportCredentials {
+	return newEngineCredentials(c.config)
+}
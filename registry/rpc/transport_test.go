@@ -0,0 +1,179 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/coreos/fleet/protobuf"
+	"github.com/coreos/fleet/registry"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fleet test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed parsing CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// tlsConfig returns the configuration of a fleet machine holding a
+// certificate for the given IP address, signed by the CA.
+func (ca *testCA) tlsConfig(t *testing.T, ip string) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: ip},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP(ip)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      ca.pool,
+	}
+}
+
+func TestTransportConfigMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	tests := []struct {
+		engine *tls.Config
+		agent  *tls.Config
+		ok     bool
+	}{
+		// engine and agent trust each other
+		{
+			engine: ca.tlsConfig(t, "127.0.0.1"),
+			agent:  ca.tlsConfig(t, "10.0.0.2"),
+			ok:     true,
+		},
+		// engine certificate issued for another address
+		{
+			engine: ca.tlsConfig(t, "10.0.0.1"),
+			agent:  ca.tlsConfig(t, "10.0.0.2"),
+			ok:     false,
+		},
+		// engine certificate signed by an unknown CA
+		{
+			engine: otherCA.tlsConfig(t, "127.0.0.1"),
+			agent:  ca.tlsConfig(t, "10.0.0.2"),
+			ok:     false,
+		},
+		// agent certificate signed by an unknown CA
+		{
+			engine: ca.tlsConfig(t, "127.0.0.1"),
+			agent:  otherCA.tlsConfig(t, "10.0.0.2"),
+			ok:     false,
+		},
+		// agent without TLS
+		{
+			engine: ca.tlsConfig(t, "127.0.0.1"),
+			agent:  nil,
+			ok:     false,
+		},
+	}
+
+	for i, tt := range tests {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("case %d: failed to listen: %v", i, err)
+		}
+		s := &rpcserver{
+			etcdRegistry:  registry.NewFakeRegistry(),
+			mu:            new(sync.Mutex),
+			localRegistry: newInmemoryRegistry(),
+			events:        newAgentEventBroker(),
+			stop:          make(chan struct{}),
+			serverStatus:  pb.HealthCheckResponse_SERVING,
+		}
+		s.grpcserver = grpc.NewServer(TransportConfig{TLS: tt.engine}.serverOptions()...)
+		pb.RegisterRegistryServer(s.grpcserver, s)
+		go s.grpcserver.Serve(lis)
+
+		conn, err := grpc.Dial(lis.Addr().String(), TransportConfig{TLS: tt.agent}.dialOption())
+		if err != nil {
+			t.Fatalf("case %d: failed to dial: %v", i, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err = pb.NewRegistryClient(conn).Status(ctx, &pb.HealthCheckRequest{Service: registryServiceName})
+		cancel()
+		conn.Close()
+		s.grpcserver.Stop()
+
+		if tt.ok && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("case %d: expected error, got nil", i)
+		}
+	}
+}
+
+func TestTransportConfigPort(t *testing.T) {
+	if p := (TransportConfig{}).port(); p != DefaultPort {
+		t.Errorf("expected default port %d, got %d", DefaultPort, p)
+	}
+	if p := (TransportConfig{Port: 4242}).port(); p != 4242 {
+		t.Errorf("expected port 4242, got %d", p)
+	}
+}
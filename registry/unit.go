@@ -117,8 +117,13 @@ func (r *EtcdRegistry) getAllUnitsHashMap() (map[string]*unit.UnitFile, error) {
 }
 
 func (r *EtcdRegistry) unitFromEtcdNode(hash unit.Hash, etcdNode *etcd.Node) *unit.UnitFile {
+	return unitFromModelValue(hash, etcdNode.Value)
+}
+
+// unitFromModelValue parses the UnitFile out of a serialized unitModel
+func unitFromModelValue(hash unit.Hash, val string) *unit.UnitFile {
 	var um unitModel
-	if err := unmarshal(etcdNode.Value, &um); err != nil {
+	if err := unmarshal(val, &um); err != nil {
 		log.Errorf("error unmarshaling Unit(%s): %v", hash, err)
 		return nil
 	}
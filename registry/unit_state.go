@@ -244,6 +244,7 @@ type unitStateModel struct {
 	SubState     string                `json:"subState"`
 	MachineState *machine.MachineState `json:"machineState"`
 	UnitHash     string                `json:"unitHash"`
+	Health       string                `json:"health,omitempty"`
 }
 
 func modelToUnitState(usm *unitStateModel, name string) *unit.UnitState {
@@ -257,6 +258,7 @@ func modelToUnitState(usm *unitStateModel, name string) *unit.UnitState {
 		SubState:    usm.SubState,
 		UnitHash:    usm.UnitHash,
 		UnitName:    name,
+		Health:      usm.Health,
 	}
 
 	if usm.MachineState != nil {
@@ -281,6 +283,7 @@ func unitStateToModel(us *unit.UnitState) *unitStateModel {
 		ActiveState: us.ActiveState,
 		SubState:    us.SubState,
 		UnitHash:    us.UnitHash,
+		Health:      us.Health,
 	}
 
 	if us.MachineID != "" {
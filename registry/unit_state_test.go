@@ -258,7 +258,7 @@ func TestModelToUnitState(t *testing.T) {
 			want: nil,
 		},
 		{
-			in: &unitStateModel{"foo", "bar", "baz", nil, ""},
+			in: &unitStateModel{"foo", "bar", "baz", nil, "", ""},
 			want: &unit.UnitState{
 				LoadState:   "foo",
 				ActiveState: "bar",
@@ -269,7 +269,7 @@ func TestModelToUnitState(t *testing.T) {
 			},
 		},
 		{
-			in: &unitStateModel{"z", "x", "y", &machine.MachineState{ID: "abcd"}, ""},
+			in: &unitStateModel{"z", "x", "y", &machine.MachineState{ID: "abcd"}, "", ""},
 			want: &unit.UnitState{
 				LoadState:   "z",
 				ActiveState: "x",
@@ -279,6 +279,17 @@ func TestModelToUnitState(t *testing.T) {
 				UnitName:    "name",
 			},
 		},
+		{
+			in: &unitStateModel{"loaded", "active", "running", &machine.MachineState{ID: "abcd"}, "", "healthy"},
+			want: &unit.UnitState{
+				LoadState:   "loaded",
+				ActiveState: "active",
+				SubState:    "running",
+				MachineID:   "abcd",
+				UnitName:    "name",
+				Health:      "healthy",
+			},
+		},
 	} {
 		got := modelToUnitState(tt.in, "name")
 		if !reflect.DeepEqual(got, tt.want) {
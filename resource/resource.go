@@ -14,6 +14,13 @@
 
 package resource
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // ResourceTuple groups together CPU, memory and disk space. This could be
 // total, available or consumed. It could also be used by job resource requirements.
 type ResourceTuple struct {
@@ -63,3 +70,75 @@ func Sub(r1, r2 ResourceTuple) (res ResourceTuple) {
 	res.Disk = r1.Disk - r2.Disk
 	return
 }
+
+// Fits returns true if every component of the required ResourceTuple can be
+// satisfied by the available ResourceTuple.
+func Fits(available, required ResourceTuple) bool {
+	return required.Cores <= available.Cores &&
+		required.Memory <= available.Memory &&
+		required.Disk <= available.Disk
+}
+
+func (rt ResourceTuple) String() string {
+	return fmt.Sprintf("cores=%d memory=%dM disk=%dM", rt.Cores, rt.Memory, rt.Disk)
+}
+
+// ParseResourceTuple parses a whitespace-separated list of key=value pairs,
+// e.g. "cores=50 memory=512M disk=1G", into a ResourceTuple. Valid keys are
+// cores, memory and disk. Memory and disk are expressed in MB unless suffixed
+// with M, G or T.
+func ParseResourceTuple(s string) (rt ResourceTuple, err error) {
+	for _, pair := range strings.Fields(s) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return ResourceTuple{}, fmt.Errorf("invalid resource %q, expected key=value", pair)
+		}
+
+		switch parts[0] {
+		case "cores":
+			rt.Cores, err = strconv.Atoi(parts[1])
+			if err == nil && rt.Cores < 0 {
+				err = errNegative
+			}
+		case "memory":
+			rt.Memory, err = parseSize(parts[1])
+		case "disk":
+			rt.Disk, err = parseSize(parts[1])
+		default:
+			return ResourceTuple{}, fmt.Errorf("unknown resource %q", parts[0])
+		}
+
+		if err != nil {
+			return ResourceTuple{}, fmt.Errorf("invalid value %q for resource %q: %v", parts[1], parts[0], err)
+		}
+	}
+
+	return
+}
+
+var errNegative = errors.New("value must not be negative")
+
+// parseSize converts a size with an optional M, G or T suffix to MB
+func parseSize(s string) (int, error) {
+	mult := 1
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "M":
+		s = s[:len(s)-1]
+	case "G":
+		mult = 1024
+		s = s[:len(s)-1]
+	case "T":
+		mult = 1024 * 1024
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errNegative
+	}
+
+	return n * mult, nil
+}
@@ -70,3 +70,105 @@ func TestSub(t *testing.T) {
 		}
 	}
 }
+
+func TestFits(t *testing.T) {
+	for i, tt := range []struct {
+		available ResourceTuple
+		required  ResourceTuple
+		want      bool
+	}{
+		{
+			ResourceTuple{100, 1024, 0},
+			ResourceTuple{0, 0, 0},
+			true,
+		},
+		{
+			ResourceTuple{100, 1024, 0},
+			ResourceTuple{100, 1024, 0},
+			true,
+		},
+		{
+			ResourceTuple{100, 1024, 0},
+			ResourceTuple{50, 2048, 0},
+			false,
+		},
+		{
+			ResourceTuple{100, 1024, 0},
+			ResourceTuple{0, 0, 1},
+			false,
+		},
+	} {
+		got := Fits(tt.available, tt.required)
+		if got != tt.want {
+			t.Errorf("case %d: got %t, want %t", i, got, tt.want)
+		}
+	}
+}
+
+func TestParseResourceTuple(t *testing.T) {
+	for i, tt := range []struct {
+		in   string
+		want ResourceTuple
+		err  bool
+	}{
+		{
+			"",
+			ResourceTuple{0, 0, 0},
+			false,
+		},
+		{
+			"cores=50 memory=512M",
+			ResourceTuple{50, 512, 0},
+			false,
+		},
+		{
+			"cores=200  memory=2G disk=1T",
+			ResourceTuple{200, 2048, 1024 * 1024},
+			false,
+		},
+		{
+			"memory=128",
+			ResourceTuple{0, 128, 0},
+			false,
+		},
+		{
+			"disk=10g",
+			ResourceTuple{0, 0, 10240},
+			false,
+		},
+		{
+			"cores=-1",
+			ResourceTuple{},
+			true,
+		},
+		{
+			"memory=lots",
+			ResourceTuple{},
+			true,
+		},
+		{
+			"gpus=1",
+			ResourceTuple{},
+			true,
+		},
+		{
+			"cores",
+			ResourceTuple{},
+			true,
+		},
+		{
+			"memory=",
+			ResourceTuple{},
+			true,
+		},
+	} {
+		got, err := ParseResourceTuple(tt.in)
+		if tt.err != (err != nil) {
+			t.Errorf("case %d: unexpected error state: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("case %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
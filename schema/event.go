@@ -0,0 +1,61 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+// Types of the events served by the events resource.
+const (
+	EventUnitCreated            = "UnitCreated"
+	EventUnitDestroyed          = "UnitDestroyed"
+	EventUnitTargetStateChanged = "UnitTargetStateChanged"
+	EventUnitScheduled          = "UnitScheduled"
+	EventUnitUnscheduled        = "UnitUnscheduled"
+	EventUnitStateChanged       = "UnitStateChanged"
+	EventUnitStateRemoved       = "UnitStateRemoved"
+	EventMachineJoined          = "MachineJoined"
+	EventMachineLeft            = "MachineLeft"
+)
+
+// Event describes a single change in the cluster, as streamed by the events
+// resource. Like UnitRevision it is not generated from the discovery
+// document. Index orders the events of a stream, and watching from the
+// index of the last event received resumes the stream after it.
+type Event struct {
+	Index uint64 `json:"index"`
+	Type  string `json:"type"`
+
+	// UnitName is set by the events concerning a unit or unit state.
+	UnitName string `json:"unitName,omitempty"`
+	// MachineID is the machine a unit was scheduled to or unscheduled
+	// from, the machine of a unit state or the machine joining or
+	// leaving the cluster.
+	MachineID string `json:"machineID,omitempty"`
+	// DesiredState is the target state of a unit created or changed.
+	DesiredState string `json:"desiredState,omitempty"`
+	// UnitState is the new state of a unit on a machine.
+	UnitState *UnitState `json:"unitState,omitempty"`
+	// Machine describes a machine joining the cluster.
+	Machine *Machine `json:"machine,omitempty"`
+}
+
+// SameState returns whether the two unit states describe the same state of
+// a unit, i.e. whether replacing one with the other is no change worth an
+// event.
+func (us *UnitState) SameState(other *UnitState) bool {
+	return us.Hash == other.Hash &&
+		us.SystemdLoadState == other.SystemdLoadState &&
+		us.SystemdActiveState == other.SystemdActiveState &&
+		us.SystemdSubState == other.SystemdSubState &&
+		us.Health == other.Health
+}
@@ -86,7 +86,12 @@ func MapSchemaUnitsToUnits(entities []*Unit) []job.Unit {
 func MapMachineStateToSchema(ms *machine.MachineState) *Machine {
 	sm := Machine{
 		Id:        ms.ID,
-		PrimaryIP: ms.PublicIP,
+		Name:      ms.Name,
+		PrimaryIP: ms.AddressFor(machine.AddressPublic),
+	}
+
+	for _, a := range ms.Addresses {
+		sm.Addresses = append(sm.Addresses, &MachineAddress{Role: string(a.Role), Ip: a.IP})
 	}
 
 	sm.Metadata = make(map[string]string, len(ms.Metadata))
@@ -104,6 +109,7 @@ func MapSchemaToMachineStates(entities []*Machine) []machine.MachineState {
 
 		ms := machine.MachineState{
 			ID:       me.Id,
+			Name:     me.Name,
 			PublicIP: me.PrimaryIP,
 		}
 
@@ -112,6 +118,10 @@ func MapSchemaToMachineStates(entities []*Machine) []machine.MachineState {
 			ms.Metadata[k] = v
 		}
 
+		for _, a := range me.Addresses {
+			ms.Addresses = append(ms.Addresses, machine.Address{Role: machine.AddressRole(a.Role), IP: a.Ip})
+		}
+
 		machines[i] = ms
 	}
 
@@ -135,6 +145,7 @@ func MapUnitStateToSchemaUnitState(entity *unit.UnitState) *UnitState {
 		SystemdLoadState:   entity.LoadState,
 		SystemdActiveState: entity.ActiveState,
 		SystemdSubState:    entity.SubState,
+		Health:             entity.Health,
 	}
 
 	return &us
@@ -150,6 +161,7 @@ func MapSchemaUnitStatesToUnitStates(entities []*UnitState) []*unit.UnitState {
 			LoadState:   e.SystemdLoadState,
 			ActiveState: e.SystemdActiveState,
 			SubState:    e.SystemdSubState,
+			Health:      e.Health,
 		}
 	}
 
@@ -0,0 +1,47 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"time"
+
+	"github.com/coreos/fleet/job"
+)
+
+// UnitRevision is served by the revisions sub-resource of a unit. Unlike
+// the other entities of this package it is not generated from the
+// discovery document.
+type UnitRevision struct {
+	Revision int           `json:"revision"`
+	Hash     string        `json:"hash"`
+	Created  time.Time     `json:"created"`
+	User     string        `json:"user,omitempty"`
+	Options  []*UnitOption `json:"options"`
+}
+
+// UnitRevisionPage lists the revisions of a unit, oldest first.
+type UnitRevisionPage struct {
+	Revisions []*UnitRevision `json:"revisions"`
+}
+
+func MapUnitRevisionToSchema(rev *job.UnitRevision) *UnitRevision {
+	return &UnitRevision{
+		Revision: rev.Revision,
+		Hash:     rev.Unit.Hash().String(),
+		Created:  rev.Created,
+		User:     rev.User,
+		Options:  MapUnitFileToSchemaUnitOptions(&rev.Unit),
+	}
+}
@@ -118,10 +118,14 @@ type UnitsService struct {
 }
 
 type Machine struct {
+	Addresses []*MachineAddress `json:"addresses,omitempty"`
+
 	Id string `json:"id,omitempty"`
 
 	Metadata map[string]string `json:"metadata,omitempty"`
 
+	Name string `json:"name,omitempty"`
+
 	PrimaryIP string `json:"primaryIP,omitempty"`
 
 	// ForceSendFields is a list of field names (e.g. "Id") to
@@ -147,6 +151,34 @@ func (s *Machine) MarshalJSON() ([]byte, error) {
 	return gensupport.MarshalJSON(raw, s.ForceSendFields, s.NullFields)
 }
 
+type MachineAddress struct {
+	Ip string `json:"ip,omitempty"`
+
+	Role string `json:"role,omitempty"`
+
+	// ForceSendFields is a list of field names (e.g. "Ip") to
+	// unconditionally include in API requests. By default, fields with
+	// empty values are omitted from API requests. However, any non-pointer,
+	// non-interface field appearing in ForceSendFields will be sent to the
+	// server regardless of whether the field is empty or not. This may be
+	// used to include empty fields in Patch requests.
+	ForceSendFields []string `json:"-"`
+
+	// NullFields is a list of field names (e.g. "Ip") to include in API
+	// requests with the JSON null value. By default, fields with empty
+	// values are omitted from API requests. However, any field with an
+	// empty value appearing in NullFields will be sent to the server as
+	// null. It is an error if a field in this list has a non-empty value.
+	// This may be used to include null fields in Patch requests.
+	NullFields []string `json:"-"`
+}
+
+func (s *MachineAddress) MarshalJSON() ([]byte, error) {
+	type noMethod MachineAddress
+	raw := noMethod(*s)
+	return gensupport.MarshalJSON(raw, s.ForceSendFields, s.NullFields)
+}
+
 type MachinePage struct {
 	Machines []*Machine `json:"machines,omitempty"`
 
@@ -290,6 +322,8 @@ func (s *UnitPage) MarshalJSON() ([]byte, error) {
 type UnitState struct {
 	Hash string `json:"hash,omitempty"`
 
+	Health string `json:"health,omitempty"`
+
 	MachineID string `json:"machineID,omitempty"`
 
 	Name string `json:"name,omitempty"`
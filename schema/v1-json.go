@@ -49,9 +49,18 @@ const DiscoveryJSON = `{
         "id": {
           "type": "string"
         },
+        "name": {
+          "type": "string"
+        },
         "primaryIP": {
           "type": "string"
         },
+        "addresses": {
+          "type": "array",
+          "items": {
+            "$ref": "MachineAddress"
+          }
+        },
         "metadata": {
           "type": "object",
           "properties": {},
@@ -61,6 +70,18 @@ const DiscoveryJSON = `{
         }
       }
     },
+    "MachineAddress": {
+      "id": "MachineAddress",
+      "type": "object",
+      "properties": {
+        "role": {
+          "type": "string"
+        },
+        "ip": {
+          "type": "string"
+        }
+      }
+    },
     "MachinePage": {
       "id": "MachinePage",
       "type": "object",
@@ -162,6 +183,9 @@ const DiscoveryJSON = `{
         },
         "systemdSubState": {
           "type": "string"
+        },
+        "health": {
+          "type": "string"
         }
       }
     },
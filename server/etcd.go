@@ -0,0 +1,178 @@
+// Copyright 2016 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/fleet/config"
+	"github.com/coreos/fleet/engine"
+	"github.com/coreos/fleet/log"
+	"github.com/coreos/fleet/pkg"
+	"github.com/coreos/fleet/pkg/lease"
+	"github.com/coreos/fleet/registry"
+	"github.com/coreos/fleet/registry/local"
+)
+
+func etcdRequestTimeout(cfg config.Config) time.Duration {
+	return time.Duration(cfg.EtcdRequestTimeout*1000) * time.Millisecond
+}
+
+func newEtcdKeysAPI(cfg config.Config) (etcd.KeysAPI, error) {
+	tlsConfig, err := pkg.ReadTLSConfigFiles(cfg.EtcdCAFile, cfg.EtcdCertFile, cfg.EtcdKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	eCfg := etcd.Config{
+		Transport:               &http.Transport{TLSClientConfig: tlsConfig},
+		Endpoints:               cfg.EtcdServers,
+		HeaderTimeoutPerRequest: etcdRequestTimeout(cfg),
+		Username:                cfg.EtcdUsername,
+		Password:                cfg.EtcdPassword,
+	}
+
+	eClient, err := etcd.New(eCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return etcd.NewKeysAPI(eClient), nil
+}
+
+func newEtcdV3Client(cfg config.Config) (*clientv3.Client, error) {
+	eCfg := clientv3.Config{
+		Endpoints:   cfg.EtcdServers,
+		DialTimeout: etcdRequestTimeout(cfg),
+		Username:    cfg.EtcdUsername,
+		Password:    cfg.EtcdPassword,
+	}
+
+	// The v3 client speaks TLS to every endpoint as soon as it is given a
+	// TLS configuration, so only provide one if etcd is secured.
+	if cfg.EtcdCAFile != "" || cfg.EtcdCertFile != "" || cfg.EtcdKeyFile != "" {
+		tlsConfig, err := pkg.ReadTLSConfigFiles(cfg.EtcdCAFile, cfg.EtcdCertFile, cfg.EtcdKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		eCfg.TLS = tlsConfig
+	}
+
+	return clientv3.New(eCfg)
+}
+
+// newRegistryBackend sets up the registry, lease manager and, unless watches
+// are disabled, the job and cluster event streams backed by the configured
+// registry backend.
+func newRegistryBackend(cfg config.Config) (reg engine.CompleteRegistry, lManager lease.Manager, rStream, cStream pkg.EventStream, err error) {
+	switch cfg.RegistryBackend {
+	case "etcd":
+		return newEtcdBackend(cfg)
+	case "local":
+		return newLocalBackend(cfg)
+	default:
+		err = fmt.Errorf("unsupported registry_backend %q, must be etcd or local", cfg.RegistryBackend)
+		return
+	}
+}
+
+// newLocalBackend keeps fleet data in an embedded store persisted in the data
+// directory, for single-machine clusters without etcd.
+func newLocalBackend(cfg config.Config) (reg engine.CompleteRegistry, lManager lease.Manager, rStream, cStream pkg.EventStream, err error) {
+	// an empty etcd_servers option still holds a single empty endpoint
+	for _, ep := range cfg.EtcdServers {
+		if ep != "" {
+			err = errors.New("etcd_servers must be empty when registry_backend is local")
+			return
+		}
+	}
+
+	store, err := local.Open(cfg.DataDir)
+	if err != nil {
+		return
+	}
+
+	kv := clientv3.NewKVFromKVClient(store)
+	timeout := etcdRequestTimeout(cfg)
+	reg = registry.NewEtcdV3Registry(kv, store, cfg.EtcdKeyPrefix, timeout)
+	lManager = lease.NewEtcdV3LeaseManager(kv, store, cfg.EtcdKeyPrefix, timeout)
+	if !cfg.DisableWatches {
+		rStream = registry.NewLocalEventStream(store, cfg.EtcdKeyPrefix)
+		cStream = registry.NewLocalClusterEventStream(store, cfg.EtcdKeyPrefix)
+	}
+	return
+}
+
+func newEtcdBackend(cfg config.Config) (reg engine.CompleteRegistry, lManager lease.Manager, rStream, cStream pkg.EventStream, err error) {
+	switch cfg.EtcdAPIVersion {
+	case 2:
+		var kAPI etcd.KeysAPI
+		kAPI, err = newEtcdKeysAPI(cfg)
+		if err != nil {
+			return
+		}
+		reg = registry.NewEtcdRegistry(kAPI, cfg.EtcdKeyPrefix)
+		lManager = lease.NewEtcdLeaseManager(kAPI, cfg.EtcdKeyPrefix)
+		if !cfg.DisableWatches {
+			rStream = registry.NewEtcdEventStream(kAPI, cfg.EtcdKeyPrefix)
+			cStream = registry.NewEtcdClusterEventStream(kAPI, cfg.EtcdKeyPrefix)
+		}
+	case 3:
+		var eClient *clientv3.Client
+		eClient, err = newEtcdV3Client(cfg)
+		if err != nil {
+			return
+		}
+		timeout := etcdRequestTimeout(cfg)
+		reg = registry.NewEtcdV3Registry(eClient, eClient, cfg.EtcdKeyPrefix, timeout)
+		lManager = lease.NewEtcdV3LeaseManager(eClient, eClient, cfg.EtcdKeyPrefix, timeout)
+		if !cfg.DisableWatches {
+			rStream = registry.NewEtcdV3EventStream(eClient, cfg.EtcdKeyPrefix)
+			cStream = registry.NewEtcdV3ClusterEventStream(eClient, cfg.EtcdKeyPrefix)
+		}
+	default:
+		err = fmt.Errorf("unsupported etcd_api_version %d, must be 2 or 3", cfg.EtcdAPIVersion)
+	}
+	return
+}
+
+// MigrateEtcdV2ToV3 copies the fleet data stored through the etcd v2 API to
+// the etcd v3 keyspace, so the cluster can be switched to etcd_api_version=3.
+func MigrateEtcdV2ToV3(cfg config.Config) error {
+	kAPI, err := newEtcdKeysAPI(cfg)
+	if err != nil {
+		return err
+	}
+
+	eClient, err := newEtcdV3Client(cfg)
+	if err != nil {
+		return err
+	}
+	defer eClient.Close()
+
+	copied, existing, err := registry.MigrateEtcdV2ToV3(kAPI, eClient, cfg.EtcdKeyPrefix, etcdRequestTimeout(cfg))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Migrated %d keys from etcd v2 to etcd v3, %d keys already existed", copied, existing)
+	return nil
+}
@@ -15,17 +15,19 @@
 package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
-	"net/http"
+	"strings"
 	"sync"
 	"time"
 
-	etcd "github.com/coreos/etcd/client"
 	"github.com/coreos/go-systemd/activation"
 
 	"github.com/coreos/fleet/agent"
+	"github.com/coreos/fleet/audit"
 	"github.com/coreos/fleet/api"
 	"github.com/coreos/fleet/config"
 	"github.com/coreos/fleet/engine"
@@ -33,8 +35,6 @@ import (
 	"github.com/coreos/fleet/log"
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/pkg"
-	"github.com/coreos/fleet/pkg/lease"
-	"github.com/coreos/fleet/registry"
 	"github.com/coreos/fleet/registry/rpc"
 	"github.com/coreos/fleet/systemd"
 	"github.com/coreos/fleet/unit"
@@ -54,6 +54,7 @@ type Server struct {
 	aReconciler    *agent.AgentReconciler
 	usPub          *agent.UnitStatePublisher
 	usGen          *unit.UnitStateGenerator
+	usHealth       *agent.HealthChecker
 	engine         *engine.Engine
 	mach           *machine.CoreOSMachine
 	hrt            heart.Heart
@@ -86,63 +87,70 @@ func New(cfg config.Config, listeners []net.Listener) (*Server, error) {
 		return nil, err
 	}
 
-	tlsConfig, err := pkg.ReadTLSConfigFiles(cfg.EtcdCAFile, cfg.EtcdCertFile, cfg.EtcdKeyFile)
+	etcdReg, lManager, rStream, cStream, err := newRegistryBackend(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	eCfg := etcd.Config{
-		Transport:               &http.Transport{TLSClientConfig: tlsConfig},
-		Endpoints:               cfg.EtcdServers,
-		HeaderTimeoutPerRequest: (time.Duration(cfg.EtcdRequestTimeout*1000) * time.Millisecond),
-		Username:                cfg.EtcdUsername,
-		Password:                cfg.EtcdPassword,
-	}
-
-	eClient, err := etcd.New(eCfg)
-	if err != nil {
-		return nil, err
-	}
-
-	kAPI := etcd.NewKeysAPI(eClient)
-
 	var (
 		reg        engine.CompleteRegistry
 		genericReg interface{}
 	)
-	lManager := lease.NewEtcdLeaseManager(kAPI, cfg.EtcdKeyPrefix)
 
 	if !cfg.EnableGRPC {
-		genericReg = registry.NewEtcdRegistry(kAPI, cfg.EtcdKeyPrefix)
+		genericReg = etcdReg
 		if obj, ok := genericReg.(engine.CompleteRegistry); ok {
 			reg = obj
 		}
 	} else {
-		etcdReg := registry.NewEtcdRegistry(kAPI, cfg.EtcdKeyPrefix)
-		genericReg = rpc.NewRegistryMux(etcdReg, mach, lManager)
+		transport, err := newRPCTransportConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		genericReg = rpc.NewRegistryMux(etcdReg, mach, lManager, transport)
 		if obj, ok := genericReg.(engine.CompleteRegistry); ok {
 			reg = obj
 		}
 	}
 
-	pub := agent.NewUnitStatePublisher(reg, mach, agentTTL)
+	health := agent.NewHealthChecker()
+	pub := agent.NewUnitStatePublisher(reg, mach, agentTTL, health)
 	gen := unit.NewUnitStateGenerator(mgr)
 
-	a := agent.New(mgr, gen, reg, mach, agentTTL)
+	a := agent.New(mgr, gen, reg, mach, agentTTL, health)
 
-	var rStream pkg.EventStream
-	if !cfg.DisableWatches {
-		rStream = registry.NewEtcdEventStream(kAPI, cfg.EtcdKeyPrefix)
+	// With watches enabled, agents of a gRPC-enabled cluster receive unit
+	// changes pushed by the engine and fall back to etcd watches while the
+	// leader does not speak gRPC.
+	arStream, arInterval := rStream, agent.ReconcileInterval
+	if regMux, ok := genericReg.(*rpc.RegistryMux); ok && rStream != nil {
+		arStream = rpc.NewAgentEventStream(regMux, mach, rStream)
+		arInterval = agent.PushedReconcileInterval
 	}
+	ar := agent.NewReconciler(reg, arStream, arInterval)
 
-	ar := agent.NewReconciler(reg, rStream)
+	sched, err := engine.NewScheduler(cfg.EngineScheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	rebalance := engine.RebalanceConfig{
+		Enabled:  cfg.EngineRebalance,
+		MaxMoves: cfg.EngineRebalanceMaxMoves,
+	}
+
+	auditStore, _ := reg.(audit.Store)
+	auditSink, err := audit.NewSink(cfg.AuditSink, cfg.AuditFile, auditStore)
+	if err != nil {
+		return nil, err
+	}
 
 	var e *engine.Engine
 	if !cfg.EnableGRPC {
-		e = engine.New(reg, lManager, rStream, mach, nil)
+		e = engine.New(reg, lManager, rStream, mach, sched, rebalance, auditSink, nil)
 	} else {
 		regMux := genericReg.(*rpc.RegistryMux)
-		e = engine.New(reg, lManager, rStream, mach, regMux.EngineChanged)
+		e = engine.New(reg, lManager, rStream, mach, sched, rebalance, auditSink, regMux.EngineChanged)
 		if cfg.DisableEngine {
 			go regMux.ConnectToRegistry(e)
 		}
@@ -158,7 +166,24 @@ func New(cfg config.Config, listeners []net.Listener) (*Server, error) {
 	hrt := heart.New(reg, mach)
 	mon := NewMonitor(agentTTL)
 
-	apiServer := api.NewServer(listeners, api.NewServeMux(reg, cfg.TokenLimit))
+	apiTLS, err := newAPITLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	apiAuth, err := newAPIAuth(cfg, apiTLS)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAPICredentialListeners(cfg, apiTLS, listeners); err != nil {
+		return nil, err
+	}
+
+	if cfg.APIEventInterval <= 0 {
+		return nil, errors.New("api_event_interval must be positive")
+	}
+	eventIval := time.Duration(cfg.APIEventInterval*1000) * time.Millisecond
+	apiServer := api.NewServer(listeners, api.NewServeMux(reg, reg, cfg.TokenLimit, cStream, eventIval, apiAuth, auditSink))
+	apiServer.TLS = apiTLS
 	apiServer.Serve()
 
 	eIval := time.Duration(cfg.EngineReconcileInterval*1000) * time.Millisecond
@@ -168,6 +193,7 @@ func New(cfg config.Config, listeners []net.Listener) (*Server, error) {
 		aReconciler: ar,
 		usGen:       gen,
 		usPub:       pub,
+		usHealth:    health,
 		engine:      e,
 		mach:        mach,
 		hrt:         hrt,
@@ -185,14 +211,31 @@ func New(cfg config.Config, listeners []net.Listener) (*Server, error) {
 }
 
 func newMachineFromConfig(cfg config.Config, mgr unit.UnitManager) (*machine.CoreOSMachine, error) {
+	id, err := machineIDFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := cfg.Addresses()
+	if err != nil {
+		return nil, fmt.Errorf("invalid addresses: %v", err)
+	}
+
 	state := machine.MachineState{
+		ID:           id,
+		Name:         strings.TrimSpace(cfg.MachineName),
 		PublicIP:     cfg.PublicIP,
 		Metadata:     cfg.Metadata(),
 		Capabilities: cfg.Capabilities(),
 		Version:      version.Version,
+		Addresses:    addrs,
+	}
+
+	var probe *machine.MetadataProbe
+	if cfg.MetadataFacts || cfg.MetadataDir != "" {
+		probe = &machine.MetadataProbe{Facts: cfg.MetadataFacts, Dir: cfg.MetadataDir}
 	}
 
-	mach := machine.NewCoreOSMachine(state, mgr)
+	mach := machine.NewCoreOSMachine(state, mgr, probe)
 	mach.Refresh()
 
 	if mach.State().ID == "" {
@@ -202,6 +245,134 @@ func newMachineFromConfig(cfg config.Config, mgr unit.UnitManager) (*machine.Cor
 	return mach, nil
 }
 
+// machineIDFromConfig returns the machine ID set by the machine_id or
+// machine_id_file options, if any. Otherwise the machine uses the ID in
+// /etc/machine-id.
+func machineIDFromConfig(cfg config.Config) (string, error) {
+	if cfg.MachineID == "" && cfg.MachineIDFile == "" {
+		return "", nil
+	}
+	if cfg.MachineID != "" && cfg.MachineIDFile != "" {
+		return "", errors.New("machine_id and machine_id_file cannot be used together")
+	}
+
+	id := strings.TrimSpace(cfg.MachineID)
+	if cfg.MachineIDFile != "" {
+		var err error
+		if id, err = machine.ReadMachineIDFile(cfg.MachineIDFile); err != nil {
+			return "", fmt.Errorf("unable to read machine_id_file: %v", err)
+		}
+	}
+	if err := machine.ValidateMachineID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// newRPCTransportConfig builds the configuration of the gRPC channel between
+// the engine and the agents. Mutual TLS is enabled once a certificate, its
+// key and the CA used to verify peers are all provided.
+func newRPCTransportConfig(cfg config.Config) (rpc.TransportConfig, error) {
+	transport := rpc.TransportConfig{Port: cfg.GRPCPort}
+	if transport.Port < 0 || transport.Port > 65535 {
+		return transport, fmt.Errorf("invalid grpc_port %d", transport.Port)
+	}
+
+	if cfg.GRPCCAFile == "" && cfg.GRPCCertFile == "" && cfg.GRPCKeyFile == "" {
+		return transport, nil
+	}
+	if cfg.GRPCCAFile == "" || cfg.GRPCCertFile == "" || cfg.GRPCKeyFile == "" {
+		return transport, errors.New("grpc_cafile, grpc_certfile and grpc_keyfile must be provided together")
+	}
+
+	tlsConfig, err := pkg.ReadTLSConfigFiles(cfg.GRPCCAFile, cfg.GRPCCertFile, cfg.GRPCKeyFile)
+	if err != nil {
+		return transport, err
+	}
+	transport.TLS = tlsConfig
+	return transport, nil
+}
+
+// newAPITLSConfig returns the configuration to serve the API over TLS with,
+// if any. Client certificates are verified if a CA file is given.
+func newAPITLSConfig(cfg config.Config) (*tls.Config, error) {
+	if cfg.APICAFile == "" && cfg.APICertFile == "" && cfg.APIKeyFile == "" {
+		return nil, nil
+	}
+	if cfg.APICertFile == "" || cfg.APIKeyFile == "" {
+		return nil, errors.New("api_certfile and api_keyfile must be provided together")
+	}
+
+	tlsConfig, err := pkg.ReadTLSConfigFiles(cfg.APICAFile, cfg.APICertFile, cfg.APIKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	srvConfig := &tls.Config{
+		Certificates: tlsConfig.Certificates,
+		MinVersion:   tlsConfig.MinVersion,
+	}
+	if cfg.APICAFile != "" {
+		srvConfig.ClientCAs = tlsConfig.RootCAs
+		srvConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return srvConfig, nil
+}
+
+// newAPIAuth returns the authentication required by the API, if any. A
+// verified client certificate authenticates its holder, so does a bearer
+// token or password from the configured files.
+func newAPIAuth(cfg config.Config, tlsConfig *tls.Config) (*api.Auth, error) {
+	auth := &api.Auth{}
+	if tlsConfig != nil && tlsConfig.ClientCAs != nil {
+		auth.Authenticators = append(auth.Authenticators, api.CertAuthenticator{})
+	}
+	if cfg.APITokenFile != "" {
+		ta, err := api.NewTokenAuthenticator(cfg.APITokenFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, ta)
+	}
+	if cfg.APIHtpasswdFile != "" {
+		ha, err := api.NewHtpasswdAuthenticator(cfg.APIHtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, ha)
+	}
+
+	if cfg.APIPolicyFile != "" {
+		if len(auth.Authenticators) == 0 {
+			return nil, errors.New("api_policy_file requires api_cafile, api_token_file or api_htpasswd_file to authenticate users")
+		}
+		policy, err := api.LoadPolicy(cfg.APIPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Policy = policy
+	}
+
+	if len(auth.Authenticators) == 0 {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// checkAPICredentialListeners refuses to serve the API on TCP listeners
+// without TLS while clients send it bearer tokens or passwords, as these
+// would go over the network in the clear. Unix sockets are fine.
+func checkAPICredentialListeners(cfg config.Config, tlsConfig *tls.Config, listeners []net.Listener) error {
+	if tlsConfig != nil || (cfg.APITokenFile == "" && cfg.APIHtpasswdFile == "") {
+		return nil
+	}
+	for _, l := range listeners {
+		if l.Addr().Network() != "unix" {
+			return fmt.Errorf("api_token_file and api_htpasswd_file require api_certfile and api_keyfile to serve the API over TLS on %s listener %s", l.Addr().Network(), l.Addr())
+		}
+	}
+	return nil
+}
+
 func (s *Server) Run() {
 	log.Infof("Establishing etcd connectivity")
 
@@ -224,6 +395,10 @@ func (s *Server) Run() {
 		time.Sleep(sleep)
 	}
 
+	if err := machine.RecordRegisteredMachineID(s.mach.State().ID); err != nil {
+		log.Warningf("Failed recording registered machine ID, fleetctl on this host may not recognize it as local: %v", err)
+	}
+
 	go s.Supervise()
 
 	log.Infof("Starting server components")
@@ -238,6 +413,7 @@ func (s *Server) Run() {
 		func() { s.aReconciler.Run(s.agent, s.stopc) },
 		func() { s.usGen.Run(beatc, s.stopc) },
 		func() { s.usPub.Run(beatc, s.stopc) },
+		func() { s.usHealth.Run(s.stopc) },
 	}
 	if s.disableEngine {
 		log.Info("Not starting engine; disable-engine is set")
@@ -198,10 +198,16 @@ func sshClientConfig(user string, checker *HostKeyChecker, addr string) (*gossh.
 }
 
 func maybeAddDefaultPort(addr string) string {
-	if strings.Contains(addr, ":") {
+	return AddPortIfMissing(addr, sshDefaultPort)
+}
+
+// AddPortIfMissing joins the given host name, IPv4 or IPv6 address with the
+// given port, unless it already has a port.
+func AddPortIfMissing(addr string, port int) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
 		return addr
 	}
-	return net.JoinHostPort(addr, strconv.Itoa(sshDefaultPort))
+	return net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(port))
 }
 
 func NewSSHClient(user, addr string, checker *HostKeyChecker, agentForwarding bool, timeout time.Duration) (*SSHForwardingClient, error) {
@@ -0,0 +1,37 @@
+// Copyright 2014 The fleet Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import "testing"
+
+func TestAddPortIfMissing(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1:2222"},
+		{"192.0.2.1:22", "192.0.2.1:22"},
+		{"example.com", "example.com:2222"},
+		{"2001:db8::1", "[2001:db8::1]:2222"},
+		{"[2001:db8::1]", "[2001:db8::1]:2222"},
+		{"[2001:db8::1]:22", "[2001:db8::1]:22"},
+	}
+
+	for i, tt := range tests {
+		if got := AddPortIfMissing(tt.addr, 2222); got != tt.want {
+			t.Errorf("case %d: got %q, want %q", i, got, tt.want)
+		}
+	}
+}
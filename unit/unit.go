@@ -193,6 +193,18 @@ func HashFromHexString(key string) (Hash, error) {
 	return h, nil
 }
 
+const (
+	// HealthUnknown is the health of a unit whose health check has not
+	// reached a threshold yet, or which is not active
+	HealthUnknown = "unknown"
+	// HealthHealthy is the health of an active unit whose health check
+	// succeeded as many consecutive times as its healthy threshold
+	HealthHealthy = "healthy"
+	// HealthUnhealthy is the health of an active unit whose health check
+	// failed as many consecutive times as its unhealthy threshold
+	HealthUnhealthy = "unhealthy"
+)
+
 // UnitState encodes the current state of a unit loaded into a fleet agent
 type UnitState struct {
 	LoadState   string
@@ -201,6 +213,9 @@ type UnitState struct {
 	MachineID   string
 	UnitHash    string
 	UnitName    string
+	// Health is the outcome of the health check declared by the unit, or
+	// empty if it declares none
+	Health string
 }
 
 func NewUnitState(loadState, activeState, subState, mID string) *UnitState {
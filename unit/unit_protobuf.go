@@ -39,5 +39,6 @@ func (s UnitState) ToPB() *pb.UnitState {
 		ActiveState: s.ActiveState,
 		SubState:    s.SubState,
 		MachineID:   s.MachineID,
+		Health:      s.Health,
 	}
 }
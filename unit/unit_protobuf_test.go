@@ -59,6 +59,7 @@ func TestUnitStateProtoBuf(t *testing.T) {
 		MachineID:   "machine1",
 		UnitHash:    "heh",
 		UnitName:    "foo",
+		Health:      "healthy",
 	}
 
 	got := want.ToPB()
@@ -72,8 +73,22 @@ func TestUnitStateProtoBuf(t *testing.T) {
 		ActiveState: "bar",
 		SubState:    "baz",
 		MachineID:   "machine1",
+		Health:      "healthy",
 	}
 	if !reflect.DeepEqual(got, expect) {
 		t.Fatalf("got %#v, expected %#v", got, expect)
 	}
+
+	// the health survives the wire encoding
+	data, err := got.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error marshalling: %v", err)
+	}
+	var decoded pb.UnitState
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("unexpected error unmarshalling: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, expect) {
+		t.Fatalf("got %#v after decoding, expected %#v", &decoded, expect)
+	}
 }